@@ -8,10 +8,18 @@ import (
 	"os/signal"
 	"sync"
 	"syscall"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
 
 	async "github.com/justEngineer/go-metrics-service/internal/async"
+	"github.com/justEngineer/go-metrics-service/internal/collector"
+	pb "github.com/justEngineer/go-metrics-service/internal/grpc/proto"
 	client "github.com/justEngineer/go-metrics-service/internal/http/client"
 	logger "github.com/justEngineer/go-metrics-service/internal/logger"
+	"github.com/justEngineer/go-metrics-service/internal/push"
+	"github.com/justEngineer/go-metrics-service/internal/queue"
 	"github.com/justEngineer/go-metrics-service/internal/security"
 	storage "github.com/justEngineer/go-metrics-service/internal/storage"
 )
@@ -25,6 +33,39 @@ func main() {
 	}
 
 	ClientHandler := client.New(MetricStorage, &config, appLogger)
+	collectors, err := collector.NewRegistry().Build(config.Collectors, collector.Options{
+		Interval:   time.Duration(config.PollInterval) * time.Second,
+		ProcRoot:   config.ProcRoot,
+		CgroupRoot: config.CgroupRoot,
+	})
+	if err != nil {
+		log.Fatalf("Collectors weren't initialized due to %s", err)
+	}
+	ClientHandler.SetCollectors(collectors)
+	if config.GRPCEndpoint != "" {
+		// gRPC передает данные без шифрования конвертом, поэтому не используется, если задан ключ шифрования
+		if config.PublicCryptoKey != nil {
+			log.Fatalf("gRPC client cannot encrypt payloads, disable -grpc or -crypto-key")
+		}
+		opts := []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+		if config.SHA256Key != "" {
+			opts = append(opts, grpc.WithUnaryInterceptor(security.UnaryClientInterceptor(config.SHA256Key)))
+		}
+		conn, err := grpc.NewClient(config.GRPCEndpoint, opts...)
+		if err != nil {
+			log.Fatalf("gRPC client wasn't initialized due to %s", err)
+		}
+		defer conn.Close()
+		ClientHandler.SetGRPCClient(pb.NewMetricsClient(conn))
+	}
+	if config.QueueDir != "" {
+		outbox, err := queue.Open(config.QueueDir, config.QueueMaxBytes, queueSegmentSize(config.QueueMaxBytes))
+		if err != nil {
+			log.Fatalf("Queue wasn't opened due to %s", err)
+		}
+		defer outbox.Close()
+		ClientHandler.SetQueue(outbox)
+	}
 
 	signalChannel := make(chan os.Signal, 1)
 	signal.Notify(signalChannel,
@@ -44,6 +85,8 @@ func main() {
 		ClientHandler.GetMetrics(ctx)
 	}()
 
+	startPush(ctx, &wg, MetricStorage, &config, appLogger)
+
 	wg.Add(1)
 	requestLimiter := async.NewSemaphore(int(config.RateLimit))
 	go func() {
@@ -63,3 +106,40 @@ func main() {
 	wg.Wait()
 	log.Println("Agent stopped.")
 }
+
+// startPush запускает локальную точку приема метрик приложений, если задан хотя бы один адрес.
+func startPush(ctx context.Context, wg *sync.WaitGroup, metricStorage *storage.MemStorage, config *client.ClientConfig, appLogger *logger.Logger) {
+	if config.PushAddress == "" && config.PushSocket == "" && config.PushStatsDAddress == "" {
+		return
+	}
+	endpoint := push.New(metricStorage, time.Duration(config.PollInterval)*time.Second, appLogger)
+	if config.PushAddress != "" {
+		if err := endpoint.ListenHTTP(ctx, "tcp", config.PushAddress); err != nil {
+			log.Fatalf("Push endpoint wasn't started due to %s", err)
+		}
+	}
+	if config.PushSocket != "" {
+		if err := endpoint.ListenHTTP(ctx, "unix", config.PushSocket); err != nil {
+			log.Fatalf("Push socket wasn't started due to %s", err)
+		}
+	}
+	if config.PushStatsDAddress != "" {
+		if err := endpoint.ListenStatsD(ctx, config.PushStatsDAddress); err != nil {
+			log.Fatalf("Push StatsD listener wasn't started due to %s", err)
+		}
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		endpoint.Run(ctx)
+	}()
+}
+
+// queueSegmentSize возвращает размер сегмента очереди: шестнадцатая часть очереди, но не больше 4 МБ.
+func queueSegmentSize(maxBytes int64) int64 {
+	const maxSegmentSize = 4 << 20
+	if size := maxBytes / 16; size < maxSegmentSize {
+		return size
+	}
+	return maxSegmentSize
+}
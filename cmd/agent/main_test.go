@@ -10,6 +10,7 @@ import (
 	"os/signal"
 	"time"
 
+	"github.com/justEngineer/go-metrics-service/internal/collector"
 	client "github.com/justEngineer/go-metrics-service/internal/http/client"
 	logger "github.com/justEngineer/go-metrics-service/internal/logger"
 	storage "github.com/justEngineer/go-metrics-service/internal/storage"
@@ -25,6 +26,13 @@ func TestGetMetrics(t *testing.T) {
 		log.Fatalf("Logger wasn't initialized due to %s", err)
 	}
 	ClientHandler := client.New(MetricStorage, &config, appLogger)
+	collectors, err := collector.NewRegistry().Build(config.Collectors, collector.Options{
+		Interval:   time.Duration(config.PollInterval) * time.Second,
+		ProcRoot:   config.ProcRoot,
+		CgroupRoot: config.CgroupRoot,
+	})
+	assert.NoError(t, err)
+	ClientHandler.SetCollectors(collectors)
 	ctx, cancel := context.WithCancel(context.Background())
 	signalChannel := make(chan os.Signal, 1)
 	signal.Notify(signalChannel, syscall.SIGTERM, syscall.SIGINT)
@@ -0,0 +1,153 @@
+// Команда metricsctl позволяет просматривать и проверять копии хранилища метрик, сохраненные сервером.
+//
+//	metricsctl list [-f path] [-retention n]   список хранимых копий с заголовками
+//	metricsctl inspect [-json] file            заголовок и содержимое копии
+//	metricsctl verify file...                  проверка контрольных сумм, код возврата 1 при повреждении
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/justEngineer/go-metrics-service/internal/snapshot"
+)
+
+const usage = `usage: metricsctl <command> [flags]
+
+commands:
+  list     list kept snapshots of the store file
+  inspect  print snapshot header and metric counts, -json prints the metrics
+  verify   verify snapshot checksums
+`
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run выполняет команду и возвращает код завершения.
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+	var err error
+	switch args[0] {
+	case "list":
+		err = list(args[1:], stdout, stderr)
+	case "inspect":
+		err = inspect(args[1:], stdout, stderr)
+	case "verify":
+		err = verify(args[1:], stdout, stderr)
+	default:
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+	if errors.Is(err, flag.ErrHelp) {
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, "metricsctl:", err)
+		return 1
+	}
+	return 0
+}
+
+func list(args []string, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet("list", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	path := flags.String("f", "/tmp/metrics-db.json", "path to the store file")
+	retention := flags.Int("retention", snapshot.DefaultRetention, "number of kept snapshots")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "PATH\tVERSION\tCOMPRESSION\tCREATED\tWAL SEGMENT\tSIZE\tSTATUS")
+	for _, candidate := range snapshot.Paths(*path, *retention) {
+		snap, err := snapshot.ReadFile(candidate)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			header, _ := snapshot.ReadHeader(candidate)
+			fmt.Fprintf(w, "%s\t%s\t%s\n", candidate, formatHeader(header), err)
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%s\tok\n", candidate, formatHeader(snap.Header))
+	}
+	return w.Flush()
+}
+
+func inspect(args []string, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet("inspect", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	asJSON := flags.Bool("json", false, "print metrics as JSON")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("inspect expects exactly one snapshot file")
+	}
+	snap, err := snapshot.ReadFile(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		encoder := json.NewEncoder(stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(snap.Dump)
+	}
+	w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "path:\t%s\n", snap.Path)
+	fmt.Fprintf(w, "version:\t%d\n", snap.Header.Version)
+	fmt.Fprintf(w, "compression:\t%s\n", snap.Header.Compression)
+	fmt.Fprintf(w, "created:\t%s\n", formatTime(snap.Header.CreatedAt))
+	fmt.Fprintf(w, "wal segment:\t%d\n", snap.Header.WALSegment)
+	fmt.Fprintf(w, "size:\t%d\n", snap.Header.Size)
+	fmt.Fprintf(w, "checksum:\t%08x\n", snap.Header.Checksum)
+	fmt.Fprintf(w, "gauges:\t%d\n", len(snap.Dump.Gauges))
+	fmt.Fprintf(w, "counters:\t%d\n", len(snap.Dump.Counters))
+	fmt.Fprintf(w, "histograms:\t%d\n", len(snap.Dump.Histograms))
+	fmt.Fprintf(w, "summaries:\t%d\n", len(snap.Dump.Summaries))
+	return w.Flush()
+}
+
+func verify(args []string, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet("verify", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		return errors.New("verify expects snapshot files")
+	}
+	var failed int
+	for _, path := range flags.Args() {
+		if _, err := snapshot.ReadFile(path); err != nil {
+			fmt.Fprintf(stdout, "FAIL %s\n", err)
+			failed++
+			continue
+		}
+		fmt.Fprintf(stdout, "OK   %s\n", path)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d snapshots are corrupted", failed, flags.NArg())
+	}
+	return nil
+}
+
+func formatHeader(header snapshot.Header) string {
+	return fmt.Sprintf("%d\t%s\t%s\t%d\t%d", header.Version, header.Compression, formatTime(header.CreatedAt), header.WALSegment, header.Size)
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() || t.Unix() == 0 {
+		return "-"
+	}
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/justEngineer/go-metrics-service/internal/snapshot"
+	"github.com/justEngineer/go-metrics-service/internal/storage"
+)
+
+func TestCommands(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.json")
+	dump := storage.MetricsDump{
+		Counters:   []storage.CounterMetric{{Name: "requests", Value: 3}},
+		Gauges:     []storage.GaugeMetric{{Name: "temperature", Value: 36.6}},
+		WALSegment: 4,
+	}
+	for i := 0; i < 2; i++ {
+		_, err := snapshot.Save(path, dump, snapshot.CompressionGzip, 3)
+		require.NoError(t, err)
+	}
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, data[:len(data)-1], 0644))
+
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, 0, run([]string{"list", "-f", path}, &stdout, &stderr), stderr.String())
+	assert.Contains(t, stdout.String(), "snapshot: corrupted")
+	assert.Contains(t, stdout.String(), path+".1")
+	assert.Contains(t, stdout.String(), "gzip")
+
+	stdout.Reset()
+	assert.Equal(t, 0, run([]string{"inspect", path + ".1"}, &stdout, &stderr), stderr.String())
+	assert.Contains(t, stdout.String(), "wal segment:  4")
+	assert.Contains(t, stdout.String(), "counters:     1")
+
+	stdout.Reset()
+	assert.Equal(t, 0, run([]string{"inspect", "-json", path + ".1"}, &stdout, &stderr), stderr.String())
+	assert.Contains(t, stdout.String(), `"name": "temperature"`)
+
+	stdout.Reset()
+	stderr.Reset()
+	assert.Equal(t, 1, run([]string{"verify", path, path + ".1"}, &stdout, &stderr))
+	assert.Contains(t, stdout.String(), "OK   "+path+".1")
+	assert.Contains(t, stderr.String(), "1 of 2 snapshots are corrupted")
+
+	assert.Equal(t, 2, run(nil, &stdout, &stderr))
+	assert.Equal(t, 2, run([]string{"unknown"}, &stdout, &stderr))
+}
@@ -5,46 +5,160 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 
-	database "github.com/justEngineer/go-metrics-service/internal/database"
-	filedump "github.com/justEngineer/go-metrics-service/internal/filestorage"
+	"google.golang.org/grpc"
+
+	"github.com/justEngineer/go-metrics-service/internal/alerting"
+	grpcserver "github.com/justEngineer/go-metrics-service/internal/grpc/server"
 	config "github.com/justEngineer/go-metrics-service/internal/http/server/config"
 	server "github.com/justEngineer/go-metrics-service/internal/http/server/handlers"
 	routing "github.com/justEngineer/go-metrics-service/internal/http/server/routing"
 	logger "github.com/justEngineer/go-metrics-service/internal/logger"
+	"github.com/justEngineer/go-metrics-service/internal/security"
+	"github.com/justEngineer/go-metrics-service/internal/statsd"
 	storage "github.com/justEngineer/go-metrics-service/internal/storage"
+	"github.com/justEngineer/go-metrics-service/internal/storage/registry"
 )
 
 func main() {
 	cfg := config.Parse()
-	MetricStorage := storage.New()
 	ctx, stop := context.WithCancel(context.Background())
 	defer stop()
-	dbConnecton, err := database.NewConnection(ctx, &cfg)
-	if err != nil {
-		log.Printf("Database connection failed %s", err)
-	} else {
-		defer dbConnecton.Connections.Close()
-	}
 	appLogger, err := logger.New(cfg.LogLevel)
-	filedump.New(MetricStorage, &cfg, ctx, appLogger)
 	if err != nil {
 		log.Fatalf("Logger wasn't initialized due to %s", err)
 	}
-
-	ServerHandler := server.New(MetricStorage, &cfg, appLogger, dbConnecton)
-
-	server := routing.ServerStart(appLogger, ServerHandler, &cfg)
+	metricStorage, err := registry.Open(ctx, &cfg, appLogger)
+	if err != nil {
+		log.Fatalf("Storage wasn't opened due to %s", err)
+	}
+	log.Printf("Using %s storage", registry.Scheme(&cfg))
 
 	signalChannel := make(chan os.Signal, 1)
 	signal.Notify(signalChannel, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+	// горутины, работающие с хранилищем; оно закрывается только после их завершения
+	var background sync.WaitGroup
+
+	ServerHandler := server.New(metricStorage, &cfg, appLogger)
+	if cfg.AlertRulesPath != "" {
+		engine, err := newAlertEngine(&cfg, ServerHandler.Storage(), appLogger)
+		if err != nil {
+			log.Fatalf("Alerting wasn't initialized due to %s", err)
+		}
+		ServerHandler.SetAlerts(engine)
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			engine.Run(ctx)
+		}()
+		defer func() {
+			if err := engine.Close(); err != nil {
+				log.Printf("Closing alert notifiers failed: %v", err)
+			}
+		}()
+	}
+	if len(cfg.TTLPolicy) > 0 {
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			storage.RunJanitor(ctx, ServerHandler.Storage(), cfg.TTLPolicy, cfg.JanitorInterval, appLogger)
+		}()
+	}
+	if cfg.StatsDAddress != "" || cfg.StatsDSocket != "" {
+		listener, err := startStatsD(ctx, &cfg, ServerHandler.Storage(), appLogger)
+		if err != nil {
+			log.Fatalf("StatsD listener wasn't started due to %s", err)
+		}
+		listener.SetHub(ServerHandler.Hub())
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			listener.Run(ctx)
+		}()
+	}
+
+	var grpcServer *grpc.Server
+	if cfg.GRPCEndpoint != "" {
+		// gRPC передает данные без шифрования конвертом, поэтому не запускается, если сервер его требует
+		if cfg.PrivateKeyPath != "" {
+			log.Fatalf("gRPC server cannot decrypt payloads, disable -grpc or -crypto-key")
+		}
+		var opts []grpc.ServerOption
+		if cfg.SHA256Key != "" {
+			opts = append(opts,
+				grpc.UnaryInterceptor(security.UnaryServerInterceptor(cfg.SHA256Key, cfg.AllowUnsigned)),
+				grpc.StreamInterceptor(security.StreamServerInterceptor(cfg.AllowUnsigned)),
+			)
+		}
+		grpcService := grpcserver.New(ServerHandler.Storage(), appLogger)
+		grpcService.SetHub(ServerHandler.Hub())
+		grpcServer, err = grpcserver.Start(cfg.GRPCEndpoint, grpcService, opts...)
+		if err != nil {
+			log.Fatalf("gRPC server wasn't started due to %s", err)
+		}
+		log.Printf("Running gRPC server on endpoint: %s\n", cfg.GRPCEndpoint)
+	}
+
+	server := routing.ServerStart(appLogger, ServerHandler, &cfg)
 	<-signalChannel
 
 	log.Println("Shutting down the server...")
 	if err := server.Shutdown(ctx); err != nil {
-		log.Fatalf("Server forced to shutdown: %v", err)
+		log.Printf("Server forced to shutdown: %v", err)
+	}
+	if grpcServer != nil {
+		grpcServer.GracefulStop()
+	}
+	stop()
+	background.Wait()
+	if err := metricStorage.Close(); err != nil {
+		log.Printf("Closing storage failed: %v", err)
 	}
 
 	log.Println("Server stopped.")
 }
+
+// newAlertEngine загружает правила оповещений и создает их вычислитель.
+func newAlertEngine(cfg *config.ServerConfig, source alerting.Source, appLogger *logger.Logger) (*alerting.Engine, error) {
+	rules, err := alerting.LoadRules(cfg.AlertRulesPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := alerting.CheckHistory(rules, registry.HistoryEnabled(cfg)); err != nil {
+		return nil, err
+	}
+	var notifiers []alerting.Notifier
+	if cfg.AlertWebhookURL != "" {
+		notifiers = append(notifiers, alerting.NewWebhookNotifier(cfg.AlertWebhookURL))
+	}
+	if cfg.AlertLogPath != "" {
+		notifier, err := alerting.NewFileNotifier(cfg.AlertLogPath)
+		if err != nil {
+			return nil, err
+		}
+		notifiers = append(notifiers, notifier)
+	}
+	log.Printf("Loaded %d alerting rules from %s", len(rules), cfg.AlertRulesPath)
+	return alerting.New(rules, source, cfg.AlertInterval, appLogger, notifiers...), nil
+}
+
+// startStatsD запускает прием метрик StatsD на UDP адресе и Unix сокете из конфигурации.
+// Запись накопленных значений в хранилище выполняет Run возвращенного приемника.
+func startStatsD(ctx context.Context, cfg *config.ServerConfig, storage statsd.Storage, appLogger *logger.Logger) (*statsd.Listener, error) {
+	listener := statsd.New(storage, cfg.StatsDFlush, appLogger)
+	if cfg.StatsDAddress != "" {
+		if err := listener.ListenUDP(ctx, cfg.StatsDAddress); err != nil {
+			return nil, err
+		}
+		log.Printf("Receiving StatsD metrics on udp %s", cfg.StatsDAddress)
+	}
+	if cfg.StatsDSocket != "" {
+		if err := listener.ListenUnix(ctx, cfg.StatsDSocket); err != nil {
+			return nil, err
+		}
+		log.Printf("Receiving StatsD metrics on unixgram %s", cfg.StatsDSocket)
+	}
+	return listener, nil
+}
@@ -1,20 +1,27 @@
 package main
 
 import (
+	"bufio"
 	"context"
+	"encoding/json"
 	"io"
 	"log"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
 	"slices"
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	config "github.com/justEngineer/go-metrics-service/internal/http/server/config"
 	server "github.com/justEngineer/go-metrics-service/internal/http/server/handlers"
+	routing "github.com/justEngineer/go-metrics-service/internal/http/server/routing"
 	logger "github.com/justEngineer/go-metrics-service/internal/logger"
+	"github.com/justEngineer/go-metrics-service/internal/statsd"
 	storage "github.com/justEngineer/go-metrics-service/internal/storage"
+	"github.com/justEngineer/go-metrics-service/internal/storage/registry"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/stretchr/testify/assert"
@@ -54,7 +61,7 @@ func TestUpdateMetric(t *testing.T) {
 			if err != nil {
 				log.Fatalf("Logger wasn't initialized due to %s", err)
 			}
-			ServerHandler := server.New(MetricStorage, &cfg, appLogger, nil)
+			ServerHandler := server.New(MetricStorage, &cfg, appLogger)
 			// вызовем хендлер как обычную функцию, без запуска самого сервера
 			ServerHandler.UpdateMetric(w, r)
 			assert.Equal(t, tc.expectedCode, w.Code, "Код ответа не совпадает с ожидаемым")
@@ -100,7 +107,7 @@ func TestGetMetric(t *testing.T) {
 			if err != nil {
 				log.Fatalf("Logger wasn't initialized due to %s", err)
 			}
-			ServerHandler := server.New(MetricStorage, &cfg, appLogger, nil)
+			ServerHandler := server.New(MetricStorage, &cfg, appLogger)
 			// вызовем хендлер как обычную функцию, без запуска самого сервера
 			ServerHandler.GetMetric(w, r)
 			assert.Equal(t, tc.expectedCode, w.Code, "Код ответа не совпадает с ожидаемым")
@@ -127,9 +134,583 @@ func TestMainPage(t *testing.T) {
 	if err != nil {
 		log.Fatalf("Logger wasn't initialized due to %s", err)
 	}
-	ServerHandler := server.New(MetricStorage, &cfg, appLogger, nil)
+	ServerHandler := server.New(MetricStorage, &cfg, appLogger)
 	r := httptest.NewRequest(http.MethodGet, "http://localhost:8080/", nil)
 	w := httptest.NewRecorder()
 	ServerHandler.MainPage(w, r)
 	assert.Equal(t, http.StatusOK, w.Code, "Код ответа не совпадает с ожидаемым")
+
+	ctx := context.Background()
+	require.NoError(t, MetricStorage.Set(ctx, storage.NewGauge("temp", 36.6)))
+	require.NoError(t, MetricStorage.Set(ctx, storage.NewGauge(storage.SeriesKey("Alloc", map[string]string{"host": "a"}), 1024)))
+	require.NoError(t, MetricStorage.Set(ctx, storage.NewCounter("PollCount", 5)))
+	router := chi.NewRouter()
+	routing.SetRequestRouting(router, ServerHandler)
+
+	r = httptest.NewRequest(http.MethodGet, "http://localhost:8080/", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+	body := w.Body.String()
+	assert.Less(t, strings.Index(body, `data-name="Alloc"`), strings.Index(body, `data-name="temp"`), "метрики отсортированы по имени")
+	assert.Contains(t, body, `data-labels="host=a"`)
+	assert.Contains(t, body, "<td class=\"value\">5</td>")
+	assert.NotContains(t, body, "cdn")
+
+	r = httptest.NewRequest(http.MethodGet, "http://localhost:8080/?filter=TEMP&refresh=0", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `data-name="temp"`)
+	assert.NotContains(t, w.Body.String(), `data-name="Alloc"`)
+
+	for _, asset := range []string{"/static/dashboard.js", "/static/dashboard.css"} {
+		r = httptest.NewRequest(http.MethodGet, "http://localhost:8080"+asset, nil)
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		assert.Equal(t, http.StatusOK, w.Code, asset)
+		assert.NotEmpty(t, w.Body.String(), asset)
+	}
+}
+
+func TestGetMetricHistory(t *testing.T) {
+	testCases := []struct {
+		name            string
+		url             string
+		expectedCode    int
+		expectedSamples []float64
+	}{
+		{name: "gauge", url: "http://localhost:8080/history/gauge/temp", expectedCode: http.StatusOK, expectedSamples: []float64{36.6, 37.2}},
+		{name: "counter", url: "http://localhost:8080/history/counter/requests", expectedCode: http.StatusOK, expectedSamples: []float64{2, 5}},
+		{name: "unknown metric", url: "http://localhost:8080/history/gauge/unknown", expectedCode: http.StatusNotFound},
+		{name: "unknown type", url: "http://localhost:8080/history/meter/temp", expectedCode: http.StatusBadRequest},
+		{name: "wrong step", url: "http://localhost:8080/history/gauge/temp?step=abc", expectedCode: http.StatusBadRequest},
+	}
+
+	MetricStorage := storage.New()
+	require.NoError(t, MetricStorage.Set(context.Background(), storage.NewGauge("temp", 36.6)))
+	require.NoError(t, MetricStorage.Set(context.Background(), storage.NewGauge("temp", 37.2)))
+	require.NoError(t, MetricStorage.Set(context.Background(), storage.NewCounter("requests", 2)))
+	require.NoError(t, MetricStorage.Set(context.Background(), storage.NewCounter("requests", 3)))
+	cfg := config.ServerConfig{Endpoint: "", HistoryRetention: storage.DefaultHistoryRetention}
+	appLogger, err := logger.New(cfg.LogLevel)
+	require.NoError(t, err)
+	ServerHandler := server.New(MetricStorage, &cfg, appLogger)
+	router := chi.NewRouter()
+	router.Get("/history/{type}/{name}", ServerHandler.GetMetricHistory)
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tc.url, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+			assert.Equal(t, tc.expectedCode, w.Code, "Код ответа не совпадает с ожидаемым")
+			if tc.expectedCode != http.StatusOK {
+				return
+			}
+			var history server.MetricHistory
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &history))
+			var values []float64
+			for _, sample := range history.Samples {
+				values = append(values, sample.Value)
+			}
+			assert.Equal(t, tc.expectedSamples, values)
+		})
+	}
+}
+
+func TestPrometheusMetrics(t *testing.T) {
+	testCases := []struct {
+		name         string
+		accept       string
+		expectedType string
+		expectedBody string
+	}{
+		{
+			name:         "text format",
+			accept:       "text/plain",
+			expectedType: "text/plain; version=0.0.4; charset=utf-8",
+			expectedBody: "# TYPE heap_alloc gauge\nheap_alloc 1024\n# TYPE PollCount counter\nPollCount 5\n",
+		},
+		{
+			name:         "openmetrics format",
+			accept:       "application/openmetrics-text;version=1.0.0,text/plain;version=0.0.4;q=0.5",
+			expectedType: "application/openmetrics-text; version=1.0.0; charset=utf-8",
+			expectedBody: "# TYPE heap_alloc gauge\nheap_alloc 1024\n# TYPE PollCount counter\nPollCount_total 5\n# EOF\n",
+		},
+	}
+
+	MetricStorage := storage.New()
+	require.NoError(t, MetricStorage.Set(context.Background(), storage.NewGauge("heap.alloc", 1024)))
+	require.NoError(t, MetricStorage.Set(context.Background(), storage.NewCounter("PollCount", 5)))
+	cfg := config.ServerConfig{Endpoint: ""}
+	appLogger, err := logger.New(cfg.LogLevel)
+	require.NoError(t, err)
+	ServerHandler := server.New(MetricStorage, &cfg, appLogger)
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "http://localhost:8080/metrics", nil)
+			r.Header.Set("Accept", tc.accept)
+			w := httptest.NewRecorder()
+			ServerHandler.PrometheusMetrics(w, r)
+			assert.Equal(t, http.StatusOK, w.Code, "Код ответа не совпадает с ожидаемым")
+			assert.Equal(t, tc.expectedType, w.Header().Get("Content-Type"))
+			assert.Equal(t, tc.expectedBody, w.Body.String())
+		})
+	}
+}
+
+func TestMetricsWithLabels(t *testing.T) {
+	MetricStorage := storage.New()
+	cfg := config.ServerConfig{Endpoint: ""}
+	appLogger, err := logger.New(cfg.LogLevel)
+	require.NoError(t, err)
+	ServerHandler := server.New(MetricStorage, &cfg, appLogger)
+	router := chi.NewRouter()
+	router.Post("/updates/", ServerHandler.UpdateMetricsFromBatch)
+	router.Get("/value/{type}/{name}", ServerHandler.GetMetric)
+	router.Get("/metrics", ServerHandler.PrometheusMetrics)
+
+	batch := `[
+		{"id":"Alloc","type":"gauge","value":1,"labels":{"host":"a"}},
+		{"id":"Alloc","type":"gauge","value":2,"labels":{"host":"b"}},
+		{"id":"Alloc","type":"gauge","value":3}
+	]`
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/updates/", strings.NewReader(batch)))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	testCases := []struct {
+		name         string
+		url          string
+		expectedCode int
+		expectedBody string
+	}{
+		{name: "host a", url: "/value/gauge/Alloc?labels=host=a", expectedCode: http.StatusOK, expectedBody: "1"},
+		{name: "host b", url: "/value/gauge/Alloc?labels=host=b", expectedCode: http.StatusOK, expectedBody: "2"},
+		{name: "without labels", url: "/value/gauge/Alloc", expectedCode: http.StatusOK, expectedBody: "3"},
+		{name: "unknown host", url: "/value/gauge/Alloc?labels=host=c", expectedCode: http.StatusNotFound},
+		{name: "invalid label", url: "/value/gauge/Alloc?labels=1host=a", expectedCode: http.StatusBadRequest},
+		{
+			name:         "prometheus",
+			url:          "/metrics",
+			expectedCode: http.StatusOK,
+			expectedBody: "# TYPE Alloc gauge\nAlloc 3\nAlloc{host=\"a\"} 1\nAlloc{host=\"b\"} 2\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.url, nil))
+			assert.Equal(t, tc.expectedCode, w.Code, "Код ответа не совпадает с ожидаемым")
+			if tc.expectedCode == http.StatusOK {
+				assert.Equal(t, tc.expectedBody, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestDistributionMetrics(t *testing.T) {
+	MetricStorage := storage.New()
+	cfg := config.ServerConfig{Endpoint: ""}
+	appLogger, err := logger.New(cfg.LogLevel)
+	require.NoError(t, err)
+	ServerHandler := server.New(MetricStorage, &cfg, appLogger)
+	router := chi.NewRouter()
+	router.Post("/update/{type}/{name}/{value}", ServerHandler.UpdateMetric)
+	router.Post("/updates/", ServerHandler.UpdateMetricsFromBatch)
+	router.Get("/value/{type}/{name}", ServerHandler.GetMetric)
+	router.Post("/value/", ServerHandler.GetMetricAsJSON)
+
+	testCases := []struct {
+		name          string
+		method        string
+		url           string
+		body          string
+		expectedCode  int
+		expectedValue float64
+	}{
+		{
+			name:   "histogram batch",
+			method: http.MethodPost, url: "/updates/",
+			body:         `[{"id":"latency","type":"histogram","histogram":{"bounds":[0.1,0.5,1],"counts":[5,3,2,0]}}]`,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:   "histogram merge",
+			method: http.MethodPost, url: "/updates/",
+			body:         `[{"id":"latency","type":"histogram","histogram":{"bounds":[0.1,0.5,1],"counts":[5,3,2,0]}}]`,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:   "histogram buckets mismatch",
+			method: http.MethodPost, url: "/updates/",
+			body:         `[{"id":"partial","type":"gauge","value":1},{"id":"latency","type":"histogram","histogram":{"bounds":[0.1,1],"counts":[1,1,0]}}]`,
+			expectedCode: http.StatusBadRequest,
+		},
+		{name: "histogram observation", method: http.MethodPost, url: "/update/histogram/latency/0.7", expectedCode: http.StatusOK},
+		{name: "histogram without buckets", method: http.MethodPost, url: "/update/histogram/unknown/0.7", expectedCode: http.StatusBadRequest},
+		{name: "histogram NaN observation", method: http.MethodPost, url: "/update/histogram/latency/NaN", expectedCode: http.StatusBadRequest},
+		{name: "summary infinite observation", method: http.MethodPost, url: "/update/summary/rtt/+Inf", expectedCode: http.StatusBadRequest},
+		{name: "histogram p50", method: http.MethodGet, url: "/value/histogram/latency?quantile=p50", expectedCode: http.StatusOK, expectedValue: 0.1 + 0.4*0.5/6},
+		{
+			name:   "summary batch",
+			method: http.MethodPost, url: "/updates/",
+			body:         `[{"id":"rtt","type":"summary","summary":{"values":[10,20,30,40,50,60,70,80,90,100]}}]`,
+			expectedCode: http.StatusOK,
+		},
+		{name: "summary observation", method: http.MethodPost, url: "/update/summary/rtt/1000", expectedCode: http.StatusOK},
+		{name: "summary p99", method: http.MethodGet, url: "/value/summary/rtt?quantile=0.99", expectedCode: http.StatusOK, expectedValue: 100},
+		{name: "wrong quantile", method: http.MethodGet, url: "/value/summary/rtt?quantile=2", expectedCode: http.StatusBadRequest},
+		{
+			name:   "summary as JSON",
+			method: http.MethodPost, url: "/value/",
+			body:         `{"id":"rtt","type":"summary"}`,
+			expectedCode: http.StatusOK,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(tc.method, tc.url, strings.NewReader(tc.body)))
+			assert.Equal(t, tc.expectedCode, w.Code, "Код ответа не совпадает с ожидаемым")
+			if tc.expectedValue != 0 {
+				value, err := strconv.ParseFloat(w.Body.String(), 64)
+				require.NoError(t, err)
+				assert.InDelta(t, tc.expectedValue, value, tc.expectedValue*0.01)
+			}
+		})
+	}
+
+	// пакет с несовместимой гистограммой отклоняется целиком
+	_, err = storage.GetGauge(context.Background(), MetricStorage, "partial")
+	assert.ErrorIs(t, err, storage.ErrMetricNotFound)
+	histogram, err := storage.GetHistogram(context.Background(), MetricStorage, "latency")
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{10, 6, 5, 0}, histogram.Counts)
+	summary, err := storage.GetSummary(context.Background(), MetricStorage, "rtt")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(11), summary.Count)
+}
+
+func TestListMetrics(t *testing.T) {
+	ctx := context.Background()
+	MetricStorage := storage.New()
+	require.NoError(t, MetricStorage.Set(ctx, storage.NewGauge("HeapAlloc", 1024)))
+	require.NoError(t, MetricStorage.Set(ctx, storage.NewGauge(storage.SeriesKey("HeapInuse", map[string]string{"host": "a"}), 512)))
+	require.NoError(t, MetricStorage.Set(ctx, storage.NewGauge("temp", 36.6)))
+	require.NoError(t, MetricStorage.Set(ctx, storage.NewCounter("HeapObjects", 7)))
+	cfg := config.ServerConfig{Endpoint: ""}
+	appLogger, err := logger.New(cfg.LogLevel)
+	require.NoError(t, err)
+	ServerHandler := server.New(MetricStorage, &cfg, appLogger)
+
+	list := func(query string) (int, storage.ListResult) {
+		r := httptest.NewRequest(http.MethodGet, "http://localhost:8080/api/v1/metrics?"+query, nil)
+		w := httptest.NewRecorder()
+		ServerHandler.ListMetrics(w, r)
+		var result storage.ListResult
+		if w.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+		}
+		return w.Code, result
+	}
+	names := func(result storage.ListResult) []string {
+		var names []string
+		for _, metric := range result.Metrics {
+			names = append(names, metric.MType+":"+storage.SeriesKey(metric.ID, metric.Labels))
+		}
+		return names
+	}
+
+	code, result := list("prefix=Heap&limit=2")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []string{"gauge:HeapAlloc", `gauge:HeapInuse{host="a"}`}, names(result))
+	assert.False(t, result.Metrics[0].UpdatedAt.IsZero())
+	require.NotEmpty(t, result.NextCursor)
+	code, result = list("prefix=Heap&limit=2&cursor=" + result.NextCursor)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []string{"counter:HeapObjects"}, names(result))
+	assert.Equal(t, int64(7), *result.Metrics[0].Delta)
+	assert.Empty(t, result.NextCursor)
+
+	code, result = list("type=gauge&regex=^[a-z]")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []string{"gauge:temp"}, names(result))
+	assert.Equal(t, 36.6, *result.Metrics[0].Value)
+
+	code, result = list("sort=-updated&limit=1")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []string{"counter:HeapObjects"}, names(result))
+	code, _ = list("sort=name&cursor=" + result.NextCursor)
+	assert.Equal(t, http.StatusBadRequest, code, "курсор выдан для другой сортировки")
+
+	for _, query := range []string{"type=meter", "sort=value", "limit=-1", "regex=(", "cursor=!!"} {
+		code, _ = list(query)
+		assert.Equal(t, http.StatusBadRequest, code, query)
+	}
+}
+
+func TestDeleteMetrics(t *testing.T) {
+	ctx := context.Background()
+	MetricStorage := storage.New()
+	require.NoError(t, MetricStorage.Set(ctx, storage.NewGauge("temp", 36.6)))
+	require.NoError(t, MetricStorage.Set(ctx, storage.NewGauge(storage.SeriesKey("host_cpu", map[string]string{"host": "a"}), 10)))
+	require.NoError(t, MetricStorage.Set(ctx, storage.NewGauge(storage.SeriesKey("host_cpu", map[string]string{"host": "b"}), 20)))
+	require.NoError(t, MetricStorage.Set(ctx, storage.NewCounter("requests", 5)))
+	require.NoError(t, MetricStorage.Set(ctx, storage.NewCounter("host_restarts", 1)))
+	cfg := config.ServerConfig{Endpoint: ""}
+	appLogger, err := logger.New(cfg.LogLevel)
+	require.NoError(t, err)
+	ServerHandler := server.New(MetricStorage, &cfg, appLogger)
+	router := chi.NewRouter()
+	router.Delete("/value/{type}/{name}", ServerHandler.DeleteMetric)
+	router.Post("/reset/counter/{name}", ServerHandler.ResetCounter)
+	router.Delete("/api/v1/metrics", ServerHandler.DeleteMetrics)
+
+	testCases := []struct {
+		name         string
+		method       string
+		url          string
+		expectedCode int
+		expectedBody string
+	}{
+		{name: "delete gauge", method: http.MethodDelete, url: "/value/gauge/temp", expectedCode: http.StatusOK},
+		{name: "delete missing gauge", method: http.MethodDelete, url: "/value/gauge/temp", expectedCode: http.StatusNotFound},
+		{name: "delete unknown type", method: http.MethodDelete, url: "/value/meter/temp", expectedCode: http.StatusBadRequest},
+		{name: "delete with labels", method: http.MethodDelete, url: "/value/gauge/host_cpu?labels=host=a", expectedCode: http.StatusOK},
+		{name: "reset counter", method: http.MethodPost, url: "/reset/counter/requests", expectedCode: http.StatusOK},
+		{name: "reset missing counter", method: http.MethodPost, url: "/reset/counter/missing", expectedCode: http.StatusNotFound},
+		{name: "bulk delete without pattern", method: http.MethodDelete, url: "/api/v1/metrics?type=gauge", expectedCode: http.StatusBadRequest},
+		{name: "bulk delete by prefix", method: http.MethodDelete, url: "/api/v1/metrics?prefix=host_&type=gauge", expectedCode: http.StatusOK, expectedBody: `{"deleted":1}`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(tc.method, tc.url, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+			assert.Equal(t, tc.expectedCode, w.Code, "Код ответа не совпадает с ожидаемым")
+			if tc.expectedBody != "" {
+				assert.Equal(t, tc.expectedBody, w.Body.String())
+			}
+		})
+	}
+
+	dump, err := MetricStorage.GetAllMetrics(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, dump.Gauges)
+	counter, err := storage.GetCounter(ctx, MetricStorage, "requests")
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), counter)
+	_, err = storage.GetCounter(ctx, MetricStorage, "host_restarts")
+	assert.NoError(t, err, "массовое удаление ограничено типом gauge")
+	_, err = MetricStorage.GetMetricHistory(ctx, "gauge", "temp", time.Time{}, time.Now(), 0)
+	assert.Error(t, err, "история удаленной метрики тоже удаляется")
+}
+
+func TestDeleteMetricsUnsigned(t *testing.T) {
+	ctx := context.Background()
+	MetricStorage := storage.New()
+	require.NoError(t, MetricStorage.Set(ctx, storage.NewGauge("temp", 36.6)))
+	require.NoError(t, MetricStorage.Set(ctx, storage.NewCounter("requests", 5)))
+	cfg := config.ServerConfig{Endpoint: "", SHA256Key: "secret"}
+	appLogger, err := logger.New("error")
+	require.NoError(t, err)
+	router := chi.NewRouter()
+	routing.SetMiddlewares(router, appLogger, &cfg.SHA256Key, false, nil, false)
+	routing.SetRequestRouting(router, server.New(MetricStorage, &cfg, appLogger))
+
+	for _, tc := range []struct {
+		method string
+		url    string
+	}{
+		{method: http.MethodDelete, url: "/value/gauge/temp"},
+		{method: http.MethodPost, url: "/reset/counter/requests"},
+		{method: http.MethodDelete, url: "/api/v1/metrics?prefix=t"},
+	} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(tc.method, tc.url, nil))
+		assert.Equal(t, http.StatusBadRequest, w.Code, "%s %s", tc.method, tc.url)
+	}
+	_, err = storage.GetGauge(ctx, MetricStorage, "temp")
+	assert.NoError(t, err, "неподписанный запрос не удаляет метрику")
+	counter, err := storage.GetCounter(ctx, MetricStorage, "requests")
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), counter)
+}
+
+func TestExpireMetrics(t *testing.T) {
+	policy, err := storage.ParseTTLPolicy("gauge=1h, host_*=1m, *=24h")
+	require.NoError(t, err)
+	assert.Equal(t, time.Minute, policy.TTL("counter", "host_restarts"))
+	assert.Equal(t, time.Hour, policy.TTL("gauge", "temp"))
+	assert.Equal(t, 24*time.Hour, policy.TTL("counter", "requests"))
+	for _, value := range []string{"gauge", "gauge=abc", "temp=1h", "gauge=-1h"} {
+		_, err = storage.ParseTTLPolicy(value)
+		assert.Error(t, err, value)
+	}
+
+	ctx := context.Background()
+	MetricStorage := storage.New()
+	require.NoError(t, MetricStorage.Set(ctx, storage.NewGauge("temp", 36.6)))
+	require.NoError(t, MetricStorage.Set(ctx, storage.NewCounter("host_restarts", 1)))
+	require.NoError(t, MetricStorage.Set(ctx, storage.NewCounter("requests", 1)))
+	MetricStorage.Gauge["restored"] = 1
+
+	expired, err := MetricStorage.Expire(ctx, policy, time.Now().Add(30*time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 1, expired)
+	_, err = storage.GetCounter(ctx, MetricStorage, "host_restarts")
+	assert.Error(t, err)
+
+	// Время изменения восстановленного ряда отсчитывается от первой проверки.
+	expired, err = MetricStorage.Expire(ctx, policy, time.Now().Add(80*time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 1, expired)
+	_, err = storage.GetGauge(ctx, MetricStorage, "temp")
+	assert.Error(t, err)
+	_, err = storage.GetGauge(ctx, MetricStorage, "restored")
+	assert.NoError(t, err)
+}
+
+func TestStream(t *testing.T) {
+	cfg := config.ServerConfig{Endpoint: "", SHA256Key: "secret"}
+	appLogger, err := logger.New("error")
+	require.NoError(t, err)
+	ServerHandler := server.New(storage.New(), &cfg, appLogger)
+	router := chi.NewRouter()
+	routing.SetMiddlewares(router, appLogger, &cfg.SHA256Key, true, nil, false)
+	routing.SetRequestRouting(router, ServerHandler)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/stream?type=gauge&regex=^temp&heartbeat=50ms", nil)
+	require.NoError(t, err)
+	response, err := ts.Client().Do(request)
+	require.NoError(t, err)
+	defer response.Body.Close()
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, "text/event-stream", response.Header.Get("Content-Type"))
+	reader := bufio.NewReader(response.Body)
+	// ждем комментарий о подключении, чтобы подписка точно была создана до обновлений
+	line, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, ": connected\n", line)
+
+	for _, update := range []string{"/update/counter/temp/1", "/update/gauge/other/1", "/update/gauge/temp/36.6"} {
+		updateResponse, err := ts.Client().Post(ts.URL+update, "text/plain", nil)
+		require.NoError(t, err)
+		updateResponse.Body.Close()
+		require.Equal(t, http.StatusOK, updateResponse.StatusCode, update)
+	}
+
+	var events []string
+	heartbeat := false
+	for len(events) == 0 || !heartbeat {
+		line, err = reader.ReadString('\n')
+		require.NoError(t, err)
+		switch {
+		case strings.HasPrefix(line, "data: "):
+			events = append(events, strings.TrimSpace(strings.TrimPrefix(line, "data: ")))
+		case line == ": heartbeat\n":
+			heartbeat = true
+		}
+	}
+	require.Len(t, events, 1, "the counter and the other gauge are filtered out")
+	var event struct {
+		ID    string  `json:"id"`
+		MType string  `json:"type"`
+		Value float64 `json:"value"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(events[0]), &event))
+	assert.Equal(t, "temp", event.ID)
+	assert.Equal(t, "gauge", event.MType)
+	assert.Equal(t, 36.6, event.Value)
+
+	cancel()
+	assert.Eventually(t, func() bool { return ServerHandler.Hub().Subscribers() == 0 }, time.Second, 10*time.Millisecond)
+}
+
+func TestStreamStatsD(t *testing.T) {
+	cfg := config.ServerConfig{Endpoint: ""}
+	appLogger, err := logger.New("error")
+	require.NoError(t, err)
+	ServerHandler := server.New(storage.New(), &cfg, appLogger)
+	listener := statsd.New(ServerHandler.Storage(), time.Hour, appLogger)
+	listener.SetHub(ServerHandler.Hub())
+	router := chi.NewRouter()
+	routing.SetRequestRouting(router, ServerHandler)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/stream?prefix=temp", nil)
+	require.NoError(t, err)
+	response, err := ts.Client().Do(request)
+	require.NoError(t, err)
+	defer response.Body.Close()
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	reader := bufio.NewReader(response.Body)
+	line, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, ": connected\n", line)
+
+	listener.Handle([]byte("temp:36.6|g\nother:1|g"))
+	require.NoError(t, listener.Flush(ctx))
+	deleteRequest, err := http.NewRequest(http.MethodDelete, ts.URL+"/value/gauge/temp", nil)
+	require.NoError(t, err)
+	deleteResponse, err := ts.Client().Do(deleteRequest)
+	require.NoError(t, err)
+	deleteResponse.Body.Close()
+	require.Equal(t, http.StatusOK, deleteResponse.StatusCode)
+
+	// каждое событие передается строками event и data
+	var lines []string
+	for len(lines) < 4 {
+		line, err = reader.ReadString('\n')
+		require.NoError(t, err)
+		if strings.HasPrefix(line, "event: ") || strings.HasPrefix(line, "data: ") {
+			lines = append(lines, strings.TrimSpace(line))
+		}
+	}
+	assert.Equal(t, "event: update", lines[0], "значение, принятое по StatsD, публикуется в поток")
+	assert.Contains(t, lines[1], `"id":"temp"`)
+	assert.Contains(t, lines[1], `"value":36.6`)
+	assert.Equal(t, "event: delete", lines[2])
+	assert.Contains(t, lines[3], `"op":"delete"`)
+}
+
+func TestBoltStorage(t *testing.T) {
+	cfg := config.ServerConfig{DatabaseDSN: "bolt://" + filepath.Join(t.TempDir(), "metrics.db")}
+	appLogger, err := logger.New(cfg.LogLevel)
+	require.NoError(t, err)
+	boltStorage, err := registry.Open(context.Background(), &cfg, appLogger)
+	require.NoError(t, err)
+	defer boltStorage.Close()
+	ServerHandler := server.New(boltStorage, &cfg, appLogger)
+	router := chi.NewRouter()
+	routing.SetRequestRouting(router, ServerHandler)
+
+	for _, tt := range []struct {
+		method string
+		url    string
+		body   string
+	}{
+		{http.MethodGet, "/ping", ""},
+		{http.MethodPost, "/update/counter/PollCount/5", ""},
+		{http.MethodPost, "/update/counter/PollCount/2", ""},
+		{http.MethodGet, "/value/counter/PollCount", "7"},
+	} {
+		r := httptest.NewRequest(tt.method, "http://localhost:8080"+tt.url, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		require.Equal(t, http.StatusOK, w.Code, tt.url)
+		if tt.body != "" {
+			assert.Contains(t, w.Body.String(), tt.body, tt.url)
+		}
+	}
 }
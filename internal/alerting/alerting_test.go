@@ -0,0 +1,171 @@
+package alerting
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/justEngineer/go-metrics-service/internal/logger"
+	"github.com/justEngineer/go-metrics-service/internal/storage"
+)
+
+type recordingNotifier struct {
+	mu     sync.Mutex
+	alerts []Alert
+}
+
+func (n *recordingNotifier) Notify(_ context.Context, alert Alert) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.alerts = append(n.alerts, alert)
+	return nil
+}
+
+func TestLoadRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"rules": [
+		{"name": "high_alloc", "metric": {"type": "gauge", "name": "Alloc", "labels": {"host": "a"}}, "op": ">", "threshold": 100, "for": "30s"},
+		{"name": "agent_down", "metric": {"type": "counter", "name": "PollCount"}, "absent_for": "1m", "severity": "critical"}
+	]}`), 0644))
+	rules, err := LoadRules(path)
+	require.NoError(t, err)
+	require.Len(t, rules, 2)
+	assert.Equal(t, `Alloc{host="a"}`, rules[0].Metric.Key())
+	assert.Equal(t, Duration(30*time.Second), rules[0].For)
+	assert.Equal(t, "warning", rules[0].Severity)
+	assert.Equal(t, Duration(time.Minute), rules[1].AbsentFor)
+
+	invalid := []string{
+		`{"rules": [{"name": "a", "metric": {"type": "gauge", "name": "Alloc"}, "op": "=>", "threshold": 1}]}`,
+		`{"rules": [{"name": "a", "metric": {"type": "gauge", "name": "Alloc"}}]}`,
+		`{"rules": [{"name": "a", "metric": {"type": "summary", "name": "Latency", "quantile": 2}, "op": ">"}]}`,
+		`{"rules": [{"name": "a", "metric": {"type": "gauge", "name": "Alloc"}, "op": ">", "unknown": 1}]}`,
+		`{"rules": [{"name": "a", "metric": {"type": "gauge", "name": "A"}, "op": ">"}, {"name": "a", "metric": {"type": "gauge", "name": "B"}, "op": ">"}]}`,
+	}
+	for _, content := range invalid {
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+		_, err := LoadRules(path)
+		assert.Error(t, err, content)
+	}
+}
+
+func TestEngineThreshold(t *testing.T) {
+	appLogger, err := logger.New("error")
+	require.NoError(t, err)
+	ctx := context.Background()
+	source := storage.New()
+	notifier := &recordingNotifier{}
+	rules := []Rule{{Name: "high_alloc", Metric: Selector{Type: "gauge", Name: "Alloc"}, Op: ">", Threshold: 100, For: Duration(time.Minute), Severity: "critical"}}
+	engine := New(rules, source, time.Second, appLogger, notifier)
+
+	start := time.Now()
+	require.NoError(t, source.Set(ctx, storage.NewGauge("Alloc", 150)))
+	engine.Evaluate(ctx, start)
+	alerts := engine.Alerts()
+	require.Len(t, alerts, 1)
+	assert.Equal(t, StatePending, alerts[0].State)
+	assert.Empty(t, notifier.alerts)
+
+	engine.Evaluate(ctx, start.Add(time.Minute))
+	alerts = engine.Alerts()
+	require.Len(t, alerts, 1)
+	assert.Equal(t, StateFiring, alerts[0].State)
+	require.Len(t, notifier.alerts, 1)
+	assert.Equal(t, StateFiring, notifier.alerts[0].State)
+	assert.Equal(t, 150.0, *notifier.alerts[0].Value)
+
+	require.NoError(t, source.Set(ctx, storage.NewGauge("Alloc", 50)))
+	engine.Evaluate(ctx, start.Add(2*time.Minute))
+	alerts = engine.Alerts()
+	require.Len(t, alerts, 1)
+	assert.Equal(t, StateResolved, alerts[0].State)
+	require.Len(t, notifier.alerts, 2)
+	assert.Equal(t, StateResolved, notifier.alerts[1].State)
+
+	engine.Evaluate(ctx, start.Add(time.Hour))
+	assert.Empty(t, engine.Alerts())
+}
+
+func TestEngineAbsence(t *testing.T) {
+	appLogger, err := logger.New("error")
+	require.NoError(t, err)
+	ctx := context.Background()
+	source := storage.New()
+	notifier := &recordingNotifier{}
+	rules := []Rule{{Name: "agent_down", Metric: Selector{Type: "counter", Name: "PollCount"}, AbsentFor: Duration(time.Minute), Severity: "critical"}}
+	engine := New(rules, source, time.Second, appLogger, notifier)
+
+	engine.Evaluate(ctx, time.Now())
+	alerts := engine.Alerts()
+	require.Len(t, alerts, 1)
+	assert.Equal(t, StateFiring, alerts[0].State)
+
+	require.NoError(t, source.Set(ctx, storage.NewCounter("PollCount", 1)))
+	engine.Evaluate(ctx, time.Now())
+	alerts = engine.Alerts()
+	require.Len(t, alerts, 1)
+	assert.Equal(t, StateResolved, alerts[0].State)
+	require.Len(t, notifier.alerts, 2)
+}
+
+// blockingSource задерживает чтение значений, пока не закрыт канал release.
+type blockingSource struct {
+	*storage.MemStorage
+	started chan struct{}
+	release chan struct{}
+}
+
+func (s *blockingSource) Get(ctx context.Context, mType string, key string) (storage.Metric, error) {
+	close(s.started)
+	<-s.release
+	return s.MemStorage.Get(ctx, mType, key)
+}
+
+func TestEngineEvaluateWithoutLock(t *testing.T) {
+	appLogger, err := logger.New("error")
+	require.NoError(t, err)
+	source := &blockingSource{MemStorage: storage.New(), started: make(chan struct{}), release: make(chan struct{})}
+	rules := []Rule{{Name: "high_alloc", Metric: Selector{Type: "gauge", Name: "Alloc"}, Op: ">", Threshold: 100}}
+	engine := New(rules, source, time.Second, appLogger)
+
+	done := make(chan struct{})
+	go func() {
+		engine.Evaluate(context.Background(), time.Now())
+		close(done)
+	}()
+	<-source.started
+	// пока хранилище отвечает, оповещения читаются без ожидания
+	assert.Empty(t, engine.Alerts())
+	close(source.release)
+	<-done
+}
+
+func TestCheckHistory(t *testing.T) {
+	rules := []Rule{
+		{Name: "high_alloc", Metric: Selector{Type: "gauge", Name: "Alloc"}, Op: ">", Threshold: 100},
+		{Name: "agent_down", Metric: Selector{Type: "counter", Name: "PollCount"}, AbsentFor: Duration(time.Minute)},
+	}
+	assert.NoError(t, CheckHistory(rules, true))
+	assert.ErrorIs(t, CheckHistory(rules, false), ErrHistoryDisabled)
+	assert.NoError(t, CheckHistory(rules[:1], false))
+}
+
+func TestFileNotifierClose(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "alerts.log")
+	notifier, err := NewFileNotifier(path)
+	require.NoError(t, err)
+	engine := New(nil, storage.New(), time.Second, nil, notifier)
+	require.NoError(t, notifier.Notify(context.Background(), Alert{Rule: "high_alloc", State: StateFiring}))
+	require.NoError(t, engine.Close())
+	require.NoError(t, notifier.Close(), "repeated close is a no-op")
+	assert.Error(t, notifier.Notify(context.Background(), Alert{Rule: "high_alloc"}), "closed file is not written")
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"rule":"high_alloc"`)
+}
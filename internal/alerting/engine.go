@@ -0,0 +1,232 @@
+package alerting
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/justEngineer/go-metrics-service/internal/logger"
+	"github.com/justEngineer/go-metrics-service/internal/models"
+	"github.com/justEngineer/go-metrics-service/internal/storage"
+)
+
+// State описывает состояние оповещения.
+type State string
+
+const (
+	// StatePending условие правила выполняется, но еще не дольше For.
+	StatePending State = "pending"
+	// StateFiring условие правила выполняется дольше For, оповещение отправлено.
+	StateFiring State = "firing"
+	// StateResolved условие правила перестало выполняться после срабатывания.
+	StateResolved State = "resolved"
+)
+
+// resolvedRetention время, в течение которого разрешенное оповещение остается в списке.
+const resolvedRetention = 15 * time.Minute
+
+// Alert описывает оповещение, созданное правилом.
+type Alert struct {
+	Rule        string     `json:"rule"`
+	Severity    string     `json:"severity"`
+	Metric      string     `json:"metric"`
+	Type        string     `json:"type"`
+	State       State      `json:"state"`
+	Reason      string     `json:"reason"`
+	Value       *float64   `json:"value,omitempty"`
+	ActiveSince time.Time  `json:"active_since"`
+	FiredAt     *time.Time `json:"fired_at,omitempty"`
+	ResolvedAt  *time.Time `json:"resolved_at,omitempty"`
+}
+
+// Source описывает хранилище, из которого правила читают значения метрик.
+type Source interface {
+	storage.Getter
+	GetMetricHistory(ctx context.Context, mType string, key string, from, to time.Time, step time.Duration) ([]storage.Sample, error)
+}
+
+// Notifier отправляет оповещения при переходе в состояние firing или resolved.
+type Notifier interface {
+	Notify(ctx context.Context, alert Alert) error
+}
+
+// Engine периодически вычисляет правила и отслеживает состояние оповещений.
+type Engine struct {
+	rules     []Rule
+	source    Source
+	notifiers []Notifier
+	interval  time.Duration
+	appLogger *logger.Logger
+
+	mu     sync.RWMutex
+	alerts map[string]*Alert
+}
+
+// New создает вычислитель правил оповещений.
+func New(rules []Rule, source Source, interval time.Duration, appLogger *logger.Logger, notifiers ...Notifier) *Engine {
+	return &Engine{
+		rules:     rules,
+		source:    source,
+		notifiers: notifiers,
+		interval:  interval,
+		appLogger: appLogger,
+		alerts:    make(map[string]*Alert),
+	}
+}
+
+// Run вычисляет правила с интервалом interval до отмены контекста.
+func (e *Engine) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			e.Evaluate(ctx, now)
+		}
+	}
+}
+
+// result результат проверки условия правила.
+type result struct {
+	active bool
+	reason string
+	value  *float64
+}
+
+// Evaluate вычисляет все правила на момент времени now и отправляет оповещения об изменении состояния.
+// Хранилище опрашивается без блокировки, чтобы медленные запросы не задерживали чтение оповещений через Alerts.
+func (e *Engine) Evaluate(ctx context.Context, now time.Time) {
+	e.mu.RLock()
+	rules := e.rules
+	e.mu.RUnlock()
+	results := make([]result, len(rules))
+	for i, rule := range rules {
+		results[i].active, results[i].reason, results[i].value = e.check(ctx, rule, now)
+	}
+
+	var notifications []Alert
+	e.mu.Lock()
+	for i, rule := range rules {
+		active, reason, value := results[i].active, results[i].reason, results[i].value
+		alert, ok := e.alerts[rule.Name]
+		switch {
+		case active && (!ok || alert.State == StateResolved):
+			alert = &Alert{
+				Rule:        rule.Name,
+				Severity:    rule.Severity,
+				Metric:      rule.Metric.Key(),
+				Type:        rule.Metric.Type,
+				State:       StatePending,
+				ActiveSince: now,
+			}
+			e.alerts[rule.Name] = alert
+		case !active && ok && alert.State == StatePending:
+			delete(e.alerts, rule.Name)
+			continue
+		case !active && ok && alert.State == StateFiring:
+			alert.State = StateResolved
+			alert.ResolvedAt = &now
+			notifications = append(notifications, *alert)
+			continue
+		case !active:
+			if ok && now.Sub(*alert.ResolvedAt) > resolvedRetention {
+				delete(e.alerts, rule.Name)
+			}
+			continue
+		}
+		alert.Reason = reason
+		alert.Value = value
+		if alert.State == StatePending && now.Sub(alert.ActiveSince) >= time.Duration(rule.For) {
+			alert.State = StateFiring
+			alert.FiredAt = &now
+			notifications = append(notifications, *alert)
+		}
+	}
+	e.mu.Unlock()
+
+	for _, alert := range notifications {
+		for _, notifier := range e.notifiers {
+			if err := notifier.Notify(ctx, alert); err != nil {
+				e.appLogger.Log.Warn("alert notification failed", zap.String("rule", alert.Rule), zap.Error(err))
+			}
+		}
+	}
+}
+
+// Close закрывает отправителей оповещений, которые этого требуют, например файловые.
+func (e *Engine) Close() error {
+	var errs []error
+	for _, notifier := range e.notifiers {
+		if closer, ok := notifier.(io.Closer); ok {
+			errs = append(errs, closer.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Alerts возвращает текущие оповещения, отсортированные по имени правила.
+func (e *Engine) Alerts() []Alert {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	alerts := make([]Alert, 0, len(e.alerts))
+	for _, alert := range e.alerts {
+		alerts = append(alerts, *alert)
+	}
+	sort.Slice(alerts, func(i, j int) bool { return alerts[i].Rule < alerts[j].Rule })
+	return alerts
+}
+
+// check проверяет условие правила и возвращает причину срабатывания и текущее значение метрики.
+func (e *Engine) check(ctx context.Context, rule Rule, now time.Time) (bool, string, *float64) {
+	key := rule.Metric.Key()
+	if rule.AbsentFor > 0 {
+		samples, err := e.source.GetMetricHistory(ctx, rule.Metric.Type, key, now.Add(-time.Duration(rule.AbsentFor)), now, 0)
+		if err != nil || len(samples) == 0 {
+			return true, fmt.Sprintf("no data for %s", time.Duration(rule.AbsentFor)), nil
+		}
+	}
+	if rule.Op == "" {
+		return false, "", nil
+	}
+	value, err := e.value(ctx, rule.Metric)
+	if err != nil || math.IsNaN(value) {
+		return false, "", nil
+	}
+	if comparisons[rule.Op](value, rule.Threshold) {
+		return true, fmt.Sprintf("value %v %s %v", value, rule.Op, rule.Threshold), &value
+	}
+	return false, "", &value
+}
+
+// value возвращает текущее значение метрики, а для histogram и summary - значение квантиля.
+func (e *Engine) value(ctx context.Context, selector Selector) (float64, error) {
+	key := selector.Key()
+	switch selector.Type {
+	case models.Gauge:
+		return storage.GetGauge(ctx, e.source, key)
+	case models.Counter:
+		value, err := storage.GetCounter(ctx, e.source, key)
+		return float64(value), err
+	case models.Histogram:
+		histogram, err := storage.GetHistogram(ctx, e.source, key)
+		if err != nil {
+			return 0, err
+		}
+		return histogram.Quantile(selector.Quantile), nil
+	default:
+		summary, err := storage.GetSummary(ctx, e.source, key)
+		if err != nil {
+			return 0, err
+		}
+		return summary.Quantile(selector.Quantile), nil
+	}
+}
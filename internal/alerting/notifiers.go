@@ -0,0 +1,95 @@
+package alerting
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// WebhookNotifier отправляет оповещения POST-запросом с JSON-телом на заданный URL.
+type WebhookNotifier struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhookNotifier создает отправителя оповещений на webhook.
+func NewWebhookNotifier(url string) *WebhookNotifier {
+	return &WebhookNotifier{url: url, client: &http.Client{Timeout: 5 * time.Second}}
+}
+
+// Notify отправляет оповещение на webhook.
+func (n *WebhookNotifier) Notify(ctx context.Context, alert Alert) error {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// WriterNotifier записывает оповещения в поток по одному JSON-объекту в строке.
+type WriterNotifier struct {
+	mu     sync.Mutex
+	w      io.Writer
+	closer io.Closer
+}
+
+// NewWriterNotifier создает отправителя оповещений в поток w.
+func NewWriterNotifier(w io.Writer) *WriterNotifier {
+	return &WriterNotifier{w: w}
+}
+
+// NewFileNotifier создает отправителя оповещений в файл path; "-" означает стандартный вывод.
+func NewFileNotifier(path string) (*WriterNotifier, error) {
+	if path == "-" {
+		return NewWriterNotifier(os.Stdout), nil
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &WriterNotifier{w: file, closer: file}, nil
+}
+
+// Close закрывает файл, открытый NewFileNotifier; поток, переданный NewWriterNotifier, не закрывается.
+func (n *WriterNotifier) Close() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.closer == nil {
+		return nil
+	}
+	err := n.closer.Close()
+	n.closer = nil
+	return err
+}
+
+// Notify записывает оповещение в поток.
+func (n *WriterNotifier) Notify(_ context.Context, alert Alert) error {
+	data, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	_, err = n.w.Write(append(data, '\n'))
+	return err
+}
@@ -0,0 +1,160 @@
+// Package alerting предоставляет правила оповещений и фоновый вычислитель их состояния.
+package alerting
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/justEngineer/go-metrics-service/internal/models"
+	"github.com/justEngineer/go-metrics-service/internal/storage"
+)
+
+// Duration представляет time.Duration, который в JSON записывается строкой вида "1m30s".
+type Duration time.Duration
+
+// UnmarshalJSON разбирает длительность из строки в формате time.ParseDuration.
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("duration must be a string like \"30s\": %w", err)
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// MarshalJSON записывает длительность строкой.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// Selector определяет временной ряд, к которому применяется правило.
+type Selector struct {
+	Type     string            `json:"type"`               // gauge, counter, histogram или summary
+	Name     string            `json:"name"`               // имя метрики
+	Labels   map[string]string `json:"labels,omitempty"`   // метки временного ряда
+	Quantile float64           `json:"quantile,omitempty"` // квантиль для histogram и summary
+}
+
+// Key возвращает идентификатор временного ряда.
+func (s Selector) Key() string {
+	return storage.SeriesKey(s.Name, s.Labels)
+}
+
+// Rule описывает правило оповещения.
+// Правило срабатывает, если значение метрики удовлетворяет сравнению с порогом,
+// или, если задан AbsentFor, когда метрика не обновлялась дольше AbsentFor.
+// Оповещение отправляется, если условие выполняется не меньше For.
+type Rule struct {
+	Name      string   `json:"name"`
+	Metric    Selector `json:"metric"`
+	Op        string   `json:"op,omitempty"` // >, >=, <, <=, == или !=
+	Threshold float64  `json:"threshold,omitempty"`
+	For       Duration `json:"for,omitempty"`
+	Severity  string   `json:"severity,omitempty"`
+	AbsentFor Duration `json:"absent_for,omitempty"`
+}
+
+// RuleFile описывает файл с правилами оповещений.
+type RuleFile struct {
+	Rules []Rule `json:"rules"`
+}
+
+// LoadRules читает и проверяет правила оповещений из JSON-файла.
+func LoadRules(path string) ([]Rule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file RuleFile
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&file); err != nil {
+		return nil, fmt.Errorf("cannot parse alerting rules: %w", err)
+	}
+	names := make(map[string]bool)
+	for i := range file.Rules {
+		if err := file.Rules[i].Validate(); err != nil {
+			return nil, fmt.Errorf("rule #%d: %w", i+1, err)
+		}
+		if names[file.Rules[i].Name] {
+			return nil, fmt.Errorf("rule #%d: duplicate rule name %q", i+1, file.Rules[i].Name)
+		}
+		names[file.Rules[i].Name] = true
+	}
+	return file.Rules, nil
+}
+
+// ErrHistoryDisabled возвращается для правил с absent_for, если хранилище не ведет историю значений:
+// отсутствие данных определяется по истории, и без нее такие правила срабатывали бы всегда.
+var ErrHistoryDisabled = errors.New("absence rules require metric history, which is disabled")
+
+// CheckHistory проверяет, что правила с absent_for не заданы, если история значений не ведется.
+func CheckHistory(rules []Rule, historyEnabled bool) error {
+	if historyEnabled {
+		return nil
+	}
+	for _, rule := range rules {
+		if rule.AbsentFor > 0 {
+			return fmt.Errorf("rule %q: %w", rule.Name, ErrHistoryDisabled)
+		}
+	}
+	return nil
+}
+
+// Validate проверяет правило.
+func (r *Rule) Validate() error {
+	if r.Name == "" {
+		return errors.New("rule name is empty")
+	}
+	if r.Metric.Name == "" {
+		return errors.New("metric name is empty")
+	}
+	switch r.Metric.Type {
+	case models.Gauge, models.Counter:
+	case models.Histogram, models.Summary:
+		if r.Metric.Quantile < 0 || r.Metric.Quantile > 1 {
+			return fmt.Errorf("quantile must be in [0, 1], got %v", r.Metric.Quantile)
+		}
+		if r.AbsentFor > 0 {
+			return errors.New("absence rules are supported only for gauge and counter metrics")
+		}
+	default:
+		return fmt.Errorf("unknown metric type %q", r.Metric.Type)
+	}
+	if err := storage.ValidateLabels(r.Metric.Labels); err != nil {
+		return err
+	}
+	if r.Op == "" && r.AbsentFor <= 0 {
+		return errors.New("rule must define a comparison or absent_for")
+	}
+	if r.Op != "" {
+		if _, ok := comparisons[r.Op]; !ok {
+			return fmt.Errorf("unknown comparison %q", r.Op)
+		}
+	}
+	if r.For < 0 || r.AbsentFor < 0 {
+		return errors.New("durations must not be negative")
+	}
+	if r.Severity == "" {
+		r.Severity = "warning"
+	}
+	return nil
+}
+
+// comparisons содержит поддерживаемые операции сравнения значения метрики с порогом.
+var comparisons = map[string]func(value, threshold float64) bool{
+	">":  func(value, threshold float64) bool { return value > threshold },
+	">=": func(value, threshold float64) bool { return value >= threshold },
+	"<":  func(value, threshold float64) bool { return value < threshold },
+	"<=": func(value, threshold float64) bool { return value <= threshold },
+	"==": func(value, threshold float64) bool { return value == threshold },
+	"!=": func(value, threshold float64) bool { return value != threshold },
+}
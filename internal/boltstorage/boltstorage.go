@@ -0,0 +1,535 @@
+// Package boltstorage реализует хранилище метрик во встроенной базе ключ-значение bbolt.
+// Хранилище не требует отдельного сервера базы данных и выбирается строкой подключения
+// со схемой bolt, например bolt:///var/lib/metrics.db.
+//
+// Метрики каждого типа хранятся в отдельном бакете по идентификатору временного ряда; значение начинается
+// со времени последнего изменения. История значений хранится во вложенных бакетах бакета history,
+// по одному на ряд, с ключами в порядке добавления.
+package boltstorage
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/justEngineer/go-metrics-service/internal/distribution"
+	config "github.com/justEngineer/go-metrics-service/internal/http/server/config"
+	"github.com/justEngineer/go-metrics-service/internal/storage"
+)
+
+// Scheme схема строки подключения к хранилищу bbolt.
+const Scheme = "bolt"
+
+// historyCleanupInterval интервал удаления устаревших значений истории метрик.
+const historyCleanupInterval = time.Minute
+
+// metricTypes типы метрик; имена бакетов совпадают с названиями типов.
+var metricTypes = []string{"gauge", "counter", "histogram", "summary"}
+
+var historyBucket = []byte("history")
+
+// BoltStorage хранит метрики в файле базы bbolt.
+type BoltStorage struct {
+	db               *bolt.DB
+	historyRetention time.Duration
+	historyCapacity  int
+}
+
+// IsDSN проверяет, что строка подключения относится к хранилищу bbolt.
+func IsDSN(dsn string) bool {
+	return strings.HasPrefix(dsn, Scheme+"://")
+}
+
+// PathFromDSN возвращает путь к файлу базы из строки подключения: bolt:///var/lib/metrics.db
+// задает абсолютный путь, bolt://metrics.db — путь относительно рабочего каталога.
+func PathFromDSN(dsn string) (string, error) {
+	if !IsDSN(dsn) {
+		return "", fmt.Errorf("DSN %q is not a %s:// DSN", dsn, Scheme)
+	}
+	path := strings.TrimPrefix(dsn, Scheme+"://")
+	if path == "" {
+		return "", errors.New("bolt DSN has no database path")
+	}
+	return path, nil
+}
+
+// Open открывает или создает базу из cfg.DatabaseDSN и запускает удаление устаревшей истории до отмены ctx.
+func Open(ctx context.Context, cfg *config.ServerConfig) (*BoltStorage, error) {
+	path, err := PathFromDSN(cfg.DatabaseDSN)
+	if err != nil {
+		return nil, err
+	}
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("opening bolt database failed: %w", err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range append(metricTypes, string(historyBucket)) {
+			if _, err := tx.CreateBucketIfNotExists([]byte(name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("creating bolt buckets failed: %w", err)
+	}
+	s := &BoltStorage{db: db, historyRetention: cfg.HistoryRetention, historyCapacity: cfg.HistoryCapacity}
+	if s.historyRetention > 0 {
+		go s.cleanupHistory(ctx)
+	}
+	return s, nil
+}
+
+// Close закрывает базу.
+func (s *BoltStorage) Close() error {
+	return s.db.Close()
+}
+
+// Health проверяет, что база открыта.
+func (s *BoltStorage) Health(ctx context.Context) error {
+	return s.db.View(func(tx *bolt.Tx) error { return nil })
+}
+
+// Get возвращает метрику типа mType со временем ее последнего изменения.
+func (s *BoltStorage) Get(ctx context.Context, mType string, key string) (storage.Metric, error) {
+	var metric storage.Metric
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var data []byte
+		if bucket := tx.Bucket([]byte(mType)); bucket != nil {
+			data = bucket.Get([]byte(key))
+		}
+		if data == nil {
+			return fmt.Errorf("%w: %s %v", storage.ErrMetricNotFound, mType, key)
+		}
+		var err error
+		metric, err = decodeMetric(mType, key, data)
+		return err
+	})
+	return metric, err
+}
+
+// Set сохраняет метрику любого типа.
+func (s *BoltStorage) Set(ctx context.Context, metric storage.Metric) error {
+	return s.Batch(ctx, []storage.Metric{metric})
+}
+
+// Batch сохраняет метрики в одной транзакции.
+func (s *BoltStorage) Batch(ctx context.Context, metrics []storage.Metric) error {
+	if err := storage.ValidateBatch(metrics); err != nil {
+		return err
+	}
+	now := time.Now()
+	return s.db.Update(func(tx *bolt.Tx) error {
+		for _, metric := range metrics {
+			if err := setMetric(tx, metric, now, s.historyCapacity); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetAllMetrics извлекает все метрики из хранилища.
+func (s *BoltStorage) GetAllMetrics(ctx context.Context) (storage.MetricsDump, error) {
+	var dump storage.MetricsDump
+	err := s.forEach(func(metric storage.Metric, key string) error {
+		switch metric.MType {
+		case "gauge":
+			dump.Gauges = append(dump.Gauges, storage.GaugeMetric{Name: metric.ID, Labels: metric.Labels, Value: *metric.Value})
+		case "counter":
+			dump.Counters = append(dump.Counters, storage.CounterMetric{Name: metric.ID, Labels: metric.Labels, Value: *metric.Delta})
+		case "histogram":
+			dump.Histograms = append(dump.Histograms, storage.HistogramMetric{Name: metric.ID, Labels: metric.Labels, Value: metric.Histogram})
+		case "summary":
+			dump.Summaries = append(dump.Summaries, storage.SummaryMetric{Name: metric.ID, Labels: metric.Labels, Value: metric.Summary})
+		}
+		return nil
+	})
+	return dump, err
+}
+
+// List возвращает страницу метрик, отобранных фильтром, со временем их последнего изменения.
+func (s *BoltStorage) List(ctx context.Context, filter storage.ListFilter) (storage.ListResult, error) {
+	if err := filter.Normalize(); err != nil {
+		return storage.ListResult{}, err
+	}
+	var metrics []storage.Metric
+	err := s.forEach(func(metric storage.Metric, key string) error {
+		if filter.Match(metric.ID, metric.MType) {
+			metrics = append(metrics, metric)
+		}
+		return nil
+	})
+	if err != nil {
+		return storage.ListResult{}, err
+	}
+	return storage.Paginate(metrics, filter), nil
+}
+
+// Delete удаляет метрику типа mType вместе с ее историей.
+func (s *BoltStorage) Delete(ctx context.Context, mType string, key string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(mType))
+		if bucket == nil || bucket.Get([]byte(key)) == nil {
+			return fmt.Errorf("%w: %s %v", storage.ErrMetricNotFound, mType, key)
+		}
+		return deleteMetric(tx, mType, key)
+	})
+}
+
+// ResetCounter обнуляет метрику типа counter и добавляет нулевое значение в историю.
+func (s *BoltStorage) ResetCounter(ctx context.Context, key string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte("counter"))
+		if bucket.Get([]byte(key)) == nil {
+			return fmt.Errorf("%w: counter %v", storage.ErrMetricNotFound, key)
+		}
+		now := time.Now()
+		if err := bucket.Put([]byte(key), encodeCounter(now, 0)); err != nil {
+			return err
+		}
+		return appendHistory(tx, "counter", key, 0, now, s.historyCapacity)
+	})
+}
+
+// DeleteMetrics удаляет метрики, отобранные по типу и имени фильтром, и возвращает их количество.
+func (s *BoltStorage) DeleteMetrics(ctx context.Context, filter storage.ListFilter) (int, error) {
+	if err := filter.Normalize(); err != nil {
+		return 0, err
+	}
+	return s.deleteSelected(func(mType, name string, updatedAt time.Time) bool {
+		return filter.Match(name, mType)
+	})
+}
+
+// Expire удаляет ряды, не обновлявшиеся дольше времени жизни из policy.
+func (s *BoltStorage) Expire(ctx context.Context, policy storage.TTLPolicy, now time.Time) (int, error) {
+	if len(policy) == 0 {
+		return 0, nil
+	}
+	return s.deleteSelected(func(mType, name string, updatedAt time.Time) bool {
+		return policy.Expired(mType, name, updatedAt, now)
+	})
+}
+
+// GetMetricHistory возвращает значения метрики из интервала [from, to], прореженные с шагом step.
+func (s *BoltStorage) GetMetricHistory(ctx context.Context, mType string, key string, from, to time.Time, step time.Duration) ([]storage.Sample, error) {
+	var samples []storage.Sample
+	err := s.db.View(func(tx *bolt.Tx) error {
+		history := tx.Bucket(historyBucket).Bucket([]byte(historyKey(mType, key)))
+		if history == nil {
+			if bucket := tx.Bucket([]byte(mType)); bucket == nil || bucket.Get([]byte(key)) == nil {
+				return fmt.Errorf("%w: %s %v", storage.ErrMetricNotFound, mType, key)
+			}
+			return nil
+		}
+		return history.ForEach(func(_, data []byte) error {
+			sample := decodeSample(data)
+			if !sample.Timestamp.Before(from) && !sample.Timestamp.After(to) {
+				samples = append(samples, sample)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return storage.Downsample(samples, from, step), nil
+}
+
+// forEach передает fn все метрики хранилища внутри одной транзакции чтения.
+func (s *BoltStorage) forEach(fn func(metric storage.Metric, key string) error) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		for _, mType := range metricTypes {
+			mType := mType
+			err := tx.Bucket([]byte(mType)).ForEach(func(k, data []byte) error {
+				key := string(k)
+				metric, err := decodeMetric(mType, key, data)
+				if err != nil {
+					return err
+				}
+				return fn(metric, key)
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// deleteSelected удаляет в одной транзакции метрики, для которых match возвращает true.
+func (s *BoltStorage) deleteSelected(match func(mType, name string, updatedAt time.Time) bool) (int, error) {
+	var deleted int
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		deleted = 0
+		for _, mType := range metricTypes {
+			var keys []string
+			err := tx.Bucket([]byte(mType)).ForEach(func(k, data []byte) error {
+				name, _ := storage.ParseSeriesKey(string(k))
+				if match(mType, name, decodeTime(data)) {
+					keys = append(keys, string(k))
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			// бакет нельзя изменять во время обхода, поэтому ключи удаляются после него
+			for _, key := range keys {
+				if err := deleteMetric(tx, mType, key); err != nil {
+					return err
+				}
+			}
+			deleted += len(keys)
+		}
+		return nil
+	})
+	return deleted, err
+}
+
+// cleanupHistory периодически удаляет значения истории старше historyRetention.
+func (s *BoltStorage) cleanupHistory(ctx context.Context) {
+	ticker := time.NewTicker(historyCleanupInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			border := time.Now().Add(-s.historyRetention)
+			// при ошибке очистка повторится на следующем срабатывании таймера
+			_ = s.db.Update(func(tx *bolt.Tx) error {
+				var names [][]byte
+				err := tx.Bucket(historyBucket).ForEach(func(name, _ []byte) error {
+					names = append(names, append([]byte(nil), name...))
+					return nil
+				})
+				if err != nil {
+					return err
+				}
+				for _, name := range names {
+					if err := trimHistory(tx.Bucket(historyBucket).Bucket(name), border); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+		}
+	}
+}
+
+func setGauge(tx *bolt.Tx, key string, value float64, ts time.Time, capacity int) error {
+	if err := tx.Bucket([]byte("gauge")).Put([]byte(key), encodeGauge(ts, value)); err != nil {
+		return err
+	}
+	return appendHistory(tx, "gauge", key, value, ts, capacity)
+}
+
+func addCounter(tx *bolt.Tx, key string, value int64, ts time.Time, capacity int) error {
+	bucket := tx.Bucket([]byte("counter"))
+	if data := bucket.Get([]byte(key)); data != nil {
+		_, stored := decodeCounter(data)
+		value += stored
+	}
+	if err := bucket.Put([]byte(key), encodeCounter(ts, value)); err != nil {
+		return err
+	}
+	return appendHistory(tx, "counter", key, float64(value), ts, capacity)
+}
+
+// setMetric сохраняет проверенную метрику любого типа; история хранит не более capacity значений ряда.
+func setMetric(tx *bolt.Tx, metric storage.Metric, ts time.Time, capacity int) error {
+	key := metric.Key()
+	switch metric.MType {
+	case "gauge":
+		return setGauge(tx, key, *metric.Value, ts, capacity)
+	case "counter":
+		return addCounter(tx, key, *metric.Delta, ts, capacity)
+	case "histogram":
+		return mergeHistogram(tx, key, metric.Histogram)
+	case "summary":
+		return mergeSummary(tx, key, metric.Summary)
+	}
+	return fmt.Errorf("%w: unknown type %q", storage.ErrInvalidMetric, metric.MType)
+}
+
+func mergeHistogram(tx *bolt.Tx, key string, value *distribution.Histogram) error {
+	return mergeDistribution(tx, "histogram", key, value, func(stored *distribution.Histogram) error {
+		return stored.Merge(value)
+	})
+}
+
+func mergeSummary(tx *bolt.Tx, key string, value *distribution.Sketch) error {
+	return mergeDistribution(tx, "summary", key, value, func(stored *distribution.Sketch) error {
+		if err := stored.Validate(); err != nil {
+			return err
+		}
+		return stored.Merge(value)
+	})
+}
+
+// mergeDistribution сохраняет метрику или, если она уже есть, сливает ее с сохраненной.
+func mergeDistribution[T any](tx *bolt.Tx, mType string, key string, value *T, merge func(stored *T) error) error {
+	bucket := tx.Bucket([]byte(mType))
+	if data := bucket.Get([]byte(key)); data != nil {
+		var stored T
+		if _, err := decodeDistribution(data, &stored); err != nil {
+			return err
+		}
+		if err := merge(&stored); err != nil {
+			return fmt.Errorf("%s metric %v: %w", mType, key, err)
+		}
+		value = &stored
+	}
+	data, err := encodeDistribution(time.Now(), value)
+	if err != nil {
+		return err
+	}
+	return bucket.Put([]byte(key), data)
+}
+
+// decodeMetric декодирует сохраненное значение метрики типа mType.
+func decodeMetric(mType string, key string, data []byte) (storage.Metric, error) {
+	name, labels := storage.ParseSeriesKey(key)
+	metric := storage.Metric{ID: name, MType: mType, Labels: labels}
+	var err error
+	switch mType {
+	case "gauge":
+		var value float64
+		metric.UpdatedAt, value = decodeGauge(data)
+		metric.Value = &value
+	case "counter":
+		var value int64
+		metric.UpdatedAt, value = decodeCounter(data)
+		metric.Delta = &value
+	case "histogram":
+		metric.Histogram = &distribution.Histogram{}
+		metric.UpdatedAt, err = decodeDistribution(data, metric.Histogram)
+	case "summary":
+		metric.Summary = &distribution.Sketch{}
+		if metric.UpdatedAt, err = decodeDistribution(data, metric.Summary); err == nil {
+			err = metric.Summary.Validate()
+		}
+	}
+	if err != nil {
+		return metric, fmt.Errorf("%s metric %v: %w", mType, key, err)
+	}
+	return metric, nil
+}
+
+// deleteMetric удаляет метрику и ее историю.
+func deleteMetric(tx *bolt.Tx, mType string, key string) error {
+	if err := tx.Bucket([]byte(mType)).Delete([]byte(key)); err != nil {
+		return err
+	}
+	err := tx.Bucket(historyBucket).DeleteBucket([]byte(historyKey(mType, key)))
+	if err != nil && !errors.Is(err, bolt.ErrBucketNotFound) {
+		return err
+	}
+	return nil
+}
+
+// appendHistory добавляет значение в историю ряда и удаляет самые старые значения сверх capacity,
+// как MemStorage; при capacity <= 0 история не ведется. Ключи значений — номера по порядку добавления,
+// а удаляются всегда самые старые значения, поэтому в ряду хранятся значения с номерами от первого до seq.
+func appendHistory(tx *bolt.Tx, mType string, key string, value float64, ts time.Time, capacity int) error {
+	if capacity <= 0 {
+		return nil
+	}
+	history, err := tx.Bucket(historyBucket).CreateBucketIfNotExists([]byte(historyKey(mType, key)))
+	if err != nil {
+		return err
+	}
+	seq, err := history.NextSequence()
+	if err != nil {
+		return err
+	}
+	if err := history.Put(binary.BigEndian.AppendUint64(nil, seq), encodeSample(ts, value)); err != nil {
+		return err
+	}
+	cursor := history.Cursor()
+	for k, _ := cursor.First(); k != nil && seq-binary.BigEndian.Uint64(k) >= uint64(capacity); k, _ = cursor.First() {
+		if err := cursor.Delete(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// trimHistory удаляет значения истории старше border; значения добавляются по времени, поэтому обход
+// останавливается на первом более новом значении.
+func trimHistory(history *bolt.Bucket, border time.Time) error {
+	if history == nil {
+		return nil
+	}
+	cursor := history.Cursor()
+	for k, data := cursor.First(); k != nil; k, data = cursor.First() {
+		if !decodeSample(data).Timestamp.Before(border) {
+			return nil
+		}
+		if err := cursor.Delete(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func historyKey(mType, key string) string {
+	return mType + "/" + key
+}
+
+// Значение метрики начинается с 8 байт времени изменения в наносекундах Unix.
+
+func encodeGauge(ts time.Time, value float64) []byte {
+	return binary.BigEndian.AppendUint64(encodeTime(ts), math.Float64bits(value))
+}
+
+func decodeGauge(data []byte) (time.Time, float64) {
+	return decodeTime(data), math.Float64frombits(binary.BigEndian.Uint64(data[8:]))
+}
+
+func encodeCounter(ts time.Time, value int64) []byte {
+	return binary.BigEndian.AppendUint64(encodeTime(ts), uint64(value))
+}
+
+func decodeCounter(data []byte) (time.Time, int64) {
+	return decodeTime(data), int64(binary.BigEndian.Uint64(data[8:]))
+}
+
+func encodeDistribution(ts time.Time, value any) ([]byte, error) {
+	payload, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return append(encodeTime(ts), payload...), nil
+}
+
+func decodeDistribution(data []byte, value any) (time.Time, error) {
+	return decodeTime(data), json.Unmarshal(data[8:], value)
+}
+
+func encodeSample(ts time.Time, value float64) []byte {
+	return binary.BigEndian.AppendUint64(encodeTime(ts), math.Float64bits(value))
+}
+
+func decodeSample(data []byte) storage.Sample {
+	return storage.Sample{Timestamp: decodeTime(data), Value: math.Float64frombits(binary.BigEndian.Uint64(data[8:]))}
+}
+
+func encodeTime(ts time.Time) []byte {
+	return binary.BigEndian.AppendUint64(make([]byte, 0, 16), uint64(ts.UnixNano()))
+}
+
+func decodeTime(data []byte) time.Time {
+	return time.Unix(0, int64(binary.BigEndian.Uint64(data)))
+}
@@ -0,0 +1,98 @@
+package boltstorage
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	config "github.com/justEngineer/go-metrics-service/internal/http/server/config"
+	"github.com/justEngineer/go-metrics-service/internal/storage"
+	"github.com/justEngineer/go-metrics-service/internal/storage/storagetest"
+)
+
+func open(t *testing.T, path string) *BoltStorage {
+	return openWithCapacity(t, path, storage.DefaultHistoryCapacity)
+}
+
+func openWithCapacity(t *testing.T, path string, capacity int) *BoltStorage {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	s, err := Open(ctx, &config.ServerConfig{
+		DatabaseDSN:      "bolt://" + path,
+		HistoryRetention: storage.DefaultHistoryRetention,
+		HistoryCapacity:  capacity,
+	})
+	require.NoError(t, err)
+	return s
+}
+
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Backend {
+		s := open(t, filepath.Join(t.TempDir(), "metrics.db"))
+		t.Cleanup(func() { s.Close() })
+		return s
+	})
+}
+
+func TestReopen(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "metrics.db")
+	s := open(t, path)
+	require.NoError(t, s.Set(ctx, storage.NewCounter("requests", 5)))
+	require.NoError(t, s.Close())
+
+	s = open(t, path)
+	defer s.Close()
+	require.NoError(t, s.Health(ctx))
+	counter, err := storage.GetCounter(ctx, s, "requests")
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), counter)
+}
+
+func TestHistoryCapacity(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "metrics.db")
+	s := openWithCapacity(t, path, 3)
+	for i := 1; i <= 5; i++ {
+		require.NoError(t, s.Set(ctx, storage.NewGauge("temperature", float64(i))))
+	}
+	samples, err := s.GetMetricHistory(ctx, "gauge", "temperature", time.Time{}, time.Now(), 0)
+	require.NoError(t, err)
+	require.Len(t, samples, 3, "oldest samples are trimmed")
+	assert.Equal(t, []float64{3, 4, 5}, []float64{samples[0].Value, samples[1].Value, samples[2].Value})
+	require.NoError(t, s.Close())
+
+	// уменьшение емкости обрезает историю при следующей записи, нулевая емкость отключает историю
+	s = openWithCapacity(t, path, 1)
+	require.NoError(t, s.Set(ctx, storage.NewGauge("temperature", 6)))
+	samples, err = s.GetMetricHistory(ctx, "gauge", "temperature", time.Time{}, time.Now(), 0)
+	require.NoError(t, err)
+	require.Len(t, samples, 1)
+	assert.Equal(t, 6.0, samples[0].Value)
+	require.NoError(t, s.Close())
+
+	s = openWithCapacity(t, path, 0)
+	defer s.Close()
+	require.NoError(t, s.Set(ctx, storage.NewGauge("pressure", 1)))
+	samples, err = s.GetMetricHistory(ctx, "gauge", "pressure", time.Time{}, time.Now(), 0)
+	require.NoError(t, err)
+	assert.Empty(t, samples)
+}
+
+func TestPathFromDSN(t *testing.T) {
+	path, err := PathFromDSN("bolt:///var/lib/metrics.db")
+	require.NoError(t, err)
+	assert.Equal(t, "/var/lib/metrics.db", path)
+	path, err = PathFromDSN("bolt://metrics.db")
+	require.NoError(t, err)
+	assert.Equal(t, "metrics.db", path)
+	_, err = PathFromDSN("bolt://")
+	assert.Error(t, err)
+	_, err = PathFromDSN("postgres://localhost/metrics")
+	assert.Error(t, err)
+	assert.False(t, IsDSN("postgres://localhost/metrics"))
+}
@@ -0,0 +1,141 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/justEngineer/go-metrics-service/internal/models"
+)
+
+// Счетчики cpu.stat и io.stat и соответствующие им имена метрик.
+var (
+	cgroupCPUCounters = map[string]string{
+		"usage_usec":     "CgroupCPUUsageUsec",
+		"user_usec":      "CgroupCPUUserUsec",
+		"system_usec":    "CgroupCPUSystemUsec",
+		"nr_throttled":   "CgroupCPUThrottledPeriods",
+		"throttled_usec": "CgroupCPUThrottledUsec",
+	}
+	cgroupIOCounters = map[string]string{
+		"rbytes": "CgroupIOReadBytes",
+		"wbytes": "CgroupIOWriteBytes",
+		"rios":   "CgroupIOReads",
+		"wios":   "CgroupIOWrites",
+	}
+)
+
+// cgroupCollector собирает потребление памяти, процессора и ввода-вывода контрольными группами cgroup v2.
+// Метрики помечаются меткой cgroup, счетчики ввода-вывода еще и меткой device.
+// Файлы выключенных в группе контроллеров пропускаются.
+type cgroupCollector struct {
+	interval time.Duration
+	root     string
+	cgroups  []string
+	deltas   counterDeltas
+}
+
+// NewCgroup создает коллектор cgroup. Если контрольные группы не заданы, коллектор не создается.
+func NewCgroup(opts Options) (Collector, error) {
+	if len(opts.Settings.Cgroups) == 0 {
+		return nil, nil
+	}
+	return &cgroupCollector{
+		interval: opts.Interval,
+		root:     opts.CgroupRoot,
+		cgroups:  opts.Settings.Cgroups,
+		deltas:   make(counterDeltas),
+	}, nil
+}
+
+func (c *cgroupCollector) Name() string            { return "cgroup" }
+func (c *cgroupCollector) Interval() time.Duration { return c.interval }
+
+func (c *cgroupCollector) Collect(ctx context.Context) ([]models.Metrics, error) {
+	var metrics []models.Metrics
+	var errs []error
+	for _, cgroup := range c.cgroups {
+		cgroupMetrics, err := c.collectCgroup(cgroup)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("cgroup %s: %w", cgroup, err))
+		}
+		metrics = append(metrics, cgroupMetrics...)
+	}
+	return metrics, errors.Join(errs...)
+}
+
+func (c *cgroupCollector) collectCgroup(cgroup string) ([]models.Metrics, error) {
+	dir := filepath.Join(c.root, cgroup)
+	if _, err := os.Stat(dir); err != nil {
+		return nil, err
+	}
+	labels := map[string]string{"cgroup": cgroup}
+	var metrics []models.Metrics
+
+	if value, err := readCgroupValue(filepath.Join(dir, "memory.current")); err == nil {
+		metrics = append(metrics, Gauge("CgroupMemoryBytes", float64(value), labels))
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return metrics, err
+	}
+	// memory.max содержит "max", если ограничение не задано
+	if value, err := readCgroupValue(filepath.Join(dir, "memory.max")); err == nil {
+		metrics = append(metrics, Gauge("CgroupMemoryLimitBytes", float64(value), labels))
+	}
+
+	lines, err := readLines(filepath.Join(dir, "cpu.stat"))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return metrics, err
+	}
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) != 2 || cgroupCPUCounters[fields[0]] == "" {
+			continue
+		}
+		value, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return metrics, fmt.Errorf("malformed cpu.stat line %q: %w", line, err)
+		}
+		name := cgroupCPUCounters[fields[0]]
+		metrics = append(metrics, Counter(name, c.deltas.delta(cgroup+"|"+name, value), labels))
+	}
+
+	lines, err = readLines(filepath.Join(dir, "io.stat"))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return metrics, err
+	}
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		device := fields[0]
+		deviceLabels := map[string]string{"cgroup": cgroup, "device": device}
+		for _, field := range fields[1:] {
+			key, raw, ok := strings.Cut(field, "=")
+			name := cgroupIOCounters[key]
+			if !ok || name == "" {
+				continue
+			}
+			value, err := strconv.ParseUint(raw, 10, 64)
+			if err != nil {
+				return metrics, fmt.Errorf("malformed io.stat line %q: %w", line, err)
+			}
+			metrics = append(metrics, Counter(name, c.deltas.delta(cgroup+"|"+device+"|"+name, value), deviceLabels))
+		}
+	}
+	return metrics, nil
+}
+
+// readCgroupValue читает файл контрольной группы с одним числом.
+func readCgroupValue(path string) (uint64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+}
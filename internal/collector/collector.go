@@ -0,0 +1,225 @@
+// Package collector предоставляет интерфейс источников метрик агента, их реестр и запуск.
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/justEngineer/go-metrics-service/internal/logger"
+	"github.com/justEngineer/go-metrics-service/internal/models"
+)
+
+// Collector источник метрик агента, который опрашивается с интервалом Interval.
+type Collector interface {
+	Name() string
+	Interval() time.Duration
+	Collect(ctx context.Context) ([]models.Metrics, error)
+}
+
+// Options параметры создания коллектора.
+type Options struct {
+	Interval   time.Duration // интервал опроса
+	ProcRoot   string        // корень procfs, по умолчанию /proc
+	CgroupRoot string        // точка монтирования cgroup v2, по умолчанию /sys/fs/cgroup
+	Settings   Settings      // настройки коллектора из конфигурации агента
+}
+
+// Factory создает коллектор с заданными параметрами.
+// Фабрика возвращает nil, если коллектору нечего опрашивать, например не выбраны процессы.
+type Factory func(opts Options) (Collector, error)
+
+// Duration представляет time.Duration, который в JSON записывается строкой вида "10s".
+type Duration time.Duration
+
+// UnmarshalJSON разбирает длительность из строки в формате time.ParseDuration.
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("duration must be a string like \"10s\": %w", err)
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// Settings описывает настройки коллектора в конфигурации агента.
+type Settings struct {
+	Enabled  *bool    `json:"enabled,omitempty"`  // по умолчанию коллектор включен
+	Interval Duration `json:"interval,omitempty"` // по умолчанию используется интервал опроса агента
+
+	// Выбор процессов и контрольных групп для коллекторов process и cgroup.
+	Pidfiles []string `json:"pidfiles,omitempty"` // файлы с PID процессов
+	Names    []string `json:"names,omitempty"`    // регулярные выражения для имени или командной строки процесса
+	Cgroups  []string `json:"cgroups,omitempty"`  // пути контрольных групп относительно CgroupRoot
+}
+
+// Registry хранит фабрики коллекторов по именам.
+type Registry struct {
+	factories map[string]Factory
+}
+
+// NewRegistry создает реестр со встроенными коллекторами.
+func NewRegistry() *Registry {
+	r := &Registry{factories: make(map[string]Factory)}
+	r.Register("runtime", NewRuntime)
+	registerPlatform(r)
+	return r
+}
+
+// Register добавляет фабрику коллектора; коллектор с тем же именем заменяется.
+func (r *Registry) Register(name string, factory Factory) {
+	r.factories[name] = factory
+}
+
+// Names возвращает отсортированные имена зарегистрированных коллекторов.
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.factories))
+	for name := range r.factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Build создает включенные коллекторы. Коллекторы без настроек включены и опрашиваются с интервалом defaults.Interval.
+// Интервал опроса каждого коллектора должен быть положительным.
+func (r *Registry) Build(settings map[string]Settings, defaults Options) ([]Collector, error) {
+	for name := range settings {
+		if _, ok := r.factories[name]; !ok {
+			return nil, fmt.Errorf("unknown collector %q, available: %s", name, strings.Join(r.Names(), ", "))
+		}
+	}
+	var collectors []Collector
+	for _, name := range r.Names() {
+		s := settings[name]
+		if s.Enabled != nil && !*s.Enabled {
+			continue
+		}
+		opts := defaults
+		opts.Settings = s
+		if s.Interval < 0 {
+			return nil, fmt.Errorf("collector %q: interval must be positive, got %s", name, time.Duration(s.Interval))
+		}
+		if s.Interval > 0 {
+			opts.Interval = time.Duration(s.Interval)
+		}
+		if opts.ProcRoot == "" {
+			opts.ProcRoot = "/proc"
+		}
+		if opts.CgroupRoot == "" {
+			opts.CgroupRoot = "/sys/fs/cgroup"
+		}
+		c, err := r.factories[name](opts)
+		if err != nil {
+			return nil, fmt.Errorf("collector %q: %w", name, err)
+		}
+		if c == nil {
+			continue
+		}
+		if c.Interval() <= 0 {
+			return nil, fmt.Errorf("collector %q: interval must be positive, got %s", name, c.Interval())
+		}
+		collectors = append(collectors, c)
+	}
+	return collectors, nil
+}
+
+// ParseSettings разбирает настройки коллекторов из флагов: enabled - список включенных коллекторов
+// через запятую (остальные выключаются), intervals - интервалы в виде runtime=2s,filesystem=30s.
+func ParseSettings(registry *Registry, enabled, intervals string) (map[string]Settings, error) {
+	settings := make(map[string]Settings)
+	if strings.TrimSpace(enabled) != "" {
+		on := make(map[string]bool)
+		for _, name := range strings.Split(enabled, ",") {
+			on[strings.TrimSpace(name)] = true
+		}
+		for name := range on {
+			if _, ok := registry.factories[name]; !ok {
+				return nil, fmt.Errorf("unknown collector %q, available: %s", name, strings.Join(registry.Names(), ", "))
+			}
+		}
+		for _, name := range registry.Names() {
+			value := on[name]
+			settings[name] = Settings{Enabled: &value}
+		}
+	}
+	if strings.TrimSpace(intervals) == "" {
+		return settings, nil
+	}
+	for _, pair := range strings.Split(intervals, ",") {
+		name, value, ok := strings.Cut(pair, "=")
+		name = strings.TrimSpace(name)
+		if !ok {
+			return nil, fmt.Errorf("collector %q has no interval", name)
+		}
+		interval, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil || interval <= 0 {
+			return nil, fmt.Errorf("wrong interval of collector %q: %q", name, value)
+		}
+		s := settings[name]
+		s.Interval = Duration(interval)
+		settings[name] = s
+	}
+	return settings, nil
+}
+
+// Run опрашивает каждый коллектор в отдельной горутине с его интервалом и передает метрики в sink
+// до отмены контекста. Ошибка или паника одного коллектора не влияет на остальные.
+func Run(ctx context.Context, collectors []Collector, sink func([]models.Metrics), appLogger *logger.Logger) {
+	var wg sync.WaitGroup
+	for _, c := range collectors {
+		wg.Add(1)
+		go func(c Collector) {
+			defer wg.Done()
+			ticker := time.NewTicker(c.Interval())
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					metrics, err := safeCollect(ctx, c)
+					if err != nil {
+						appLogger.Log.Warn("collector failed", zap.String("collector", c.Name()), zap.Error(err))
+					}
+					if len(metrics) > 0 {
+						sink(metrics)
+					}
+				}
+			}
+		}(c)
+	}
+	wg.Wait()
+}
+
+// safeCollect вызывает Collect с ограничением по времени в один интервал и перехватывает панику.
+func safeCollect(ctx context.Context, c Collector) (metrics []models.Metrics, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			metrics, err = nil, fmt.Errorf("collector panicked: %v", r)
+		}
+	}()
+	ctx, cancel := context.WithTimeout(ctx, c.Interval())
+	defer cancel()
+	return c.Collect(ctx)
+}
+
+// Gauge создает метрику типа gauge.
+func Gauge(name string, value float64, labels map[string]string) models.Metrics {
+	return models.Metrics{ID: name, MType: models.Gauge, Value: &value, Labels: labels}
+}
+
+// Counter создает метрику типа counter с приращением delta.
+func Counter(name string, delta int64, labels map[string]string) models.Metrics {
+	return models.Metrics{ID: name, MType: models.Counter, Delta: &delta, Labels: labels}
+}
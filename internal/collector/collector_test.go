@@ -0,0 +1,77 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/justEngineer/go-metrics-service/internal/logger"
+	"github.com/justEngineer/go-metrics-service/internal/models"
+)
+
+type stubCollector struct {
+	name    string
+	collect func() ([]models.Metrics, error)
+}
+
+func (c *stubCollector) Name() string            { return c.name }
+func (c *stubCollector) Interval() time.Duration { return 10 * time.Millisecond }
+func (c *stubCollector) Collect(ctx context.Context) ([]models.Metrics, error) {
+	return c.collect()
+}
+
+func TestRunIsolatesFailures(t *testing.T) {
+	appLogger, err := logger.New("error")
+	require.NoError(t, err)
+	collectors := []Collector{
+		&stubCollector{name: "panic", collect: func() ([]models.Metrics, error) { panic("broken") }},
+		&stubCollector{name: "error", collect: func() ([]models.Metrics, error) { return nil, errors.New("unavailable") }},
+		&stubCollector{name: "ok", collect: func() ([]models.Metrics, error) {
+			return []models.Metrics{Counter("Polls", 1, nil)}, nil
+		}},
+	}
+	var mu sync.Mutex
+	var polls int64
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	Run(ctx, collectors, func(metrics []models.Metrics) {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, metric := range metrics {
+			polls += *metric.Delta
+		}
+	}, appLogger)
+	assert.Greater(t, polls, int64(2), "working collector must be polled despite failing ones")
+}
+
+func TestBuild(t *testing.T) {
+	registry := NewRegistry()
+	settings, err := ParseSettings(registry, "runtime", "runtime=5s")
+	require.NoError(t, err)
+	collectors, err := registry.Build(settings, Options{Interval: time.Second})
+	require.NoError(t, err)
+	require.Len(t, collectors, 1)
+	assert.Equal(t, "runtime", collectors[0].Name())
+	assert.Equal(t, 5*time.Second, collectors[0].Interval())
+
+	collectors, err = registry.Build(nil, Options{Interval: time.Second})
+	require.NoError(t, err)
+	for _, c := range collectors {
+		assert.NotEqual(t, "process", c.Name(), "process collector without selected processes is not created")
+	}
+
+	_, err = ParseSettings(registry, "runtime,unknown", "")
+	assert.Error(t, err)
+	_, err = registry.Build(map[string]Settings{"unknown": {}}, Options{Interval: time.Second})
+	assert.Error(t, err)
+
+	_, err = registry.Build(nil, Options{})
+	assert.Error(t, err, "zero poll interval")
+	_, err = registry.Build(map[string]Settings{"runtime": {Interval: Duration(-time.Second)}}, Options{Interval: time.Second})
+	assert.Error(t, err, "negative collector interval")
+}
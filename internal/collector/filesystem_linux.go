@@ -0,0 +1,110 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/justEngineer/go-metrics-service/internal/models"
+)
+
+// virtualFilesystems типы файловых систем без собственного хранилища, которые не учитываются.
+var virtualFilesystems = map[string]bool{
+	"autofs": true, "binfmt_misc": true, "bpf": true, "cgroup": true, "cgroup2": true,
+	"configfs": true, "debugfs": true, "devpts": true, "devtmpfs": true, "fusectl": true,
+	"hugetlbfs": true, "mqueue": true, "nsfs": true, "proc": true, "pstore": true,
+	"securityfs": true, "sysfs": true, "tracefs": true,
+}
+
+// filesystemCollector собирает заполненность смонтированных файловых систем из списка монтирования procfs.
+type filesystemCollector struct {
+	interval time.Duration
+	procRoot string
+}
+
+// rootfs возвращает каталог, относительно которого вызывается statfs для точек монтирования.
+// Если procRoot указывает на procfs другого пространства имен, например /host/proc в контейнере,
+// точки монтирования из его списка доступны через корень процесса 1 этого procfs.
+func (c *filesystemCollector) rootfs() string {
+	if filepath.Clean(c.procRoot) == "/proc" {
+		return "/"
+	}
+	root := filepath.Join(c.procRoot, "1", "root")
+	if _, err := os.Stat(root); err != nil {
+		return "/"
+	}
+	return root
+}
+
+// NewFilesystem создает коллектор filesystem.
+func NewFilesystem(opts Options) (Collector, error) {
+	return &filesystemCollector{interval: opts.Interval, procRoot: opts.ProcRoot}, nil
+}
+
+func (c *filesystemCollector) Name() string            { return "filesystem" }
+func (c *filesystemCollector) Interval() time.Duration { return c.interval }
+
+func (c *filesystemCollector) Collect(ctx context.Context) ([]models.Metrics, error) {
+	lines, err := readLines(filepath.Join(c.procRoot, "mounts"))
+	if err != nil {
+		return nil, err
+	}
+	var metrics []models.Metrics
+	var failed []string
+	seen := make(map[string]bool)
+	rootfs := c.rootfs()
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || virtualFilesystems[fields[2]] {
+			continue
+		}
+		device, mountpoint, fstype := unescapeMount(fields[0]), unescapeMount(fields[1]), fields[2]
+		if seen[mountpoint] {
+			continue
+		}
+		seen[mountpoint] = true
+		var stat syscall.Statfs_t
+		if err := syscall.Statfs(filepath.Join(rootfs, mountpoint), &stat); err != nil {
+			failed = append(failed, mountpoint)
+			continue
+		}
+		blockSize := uint64(stat.Bsize)
+		labels := map[string]string{"mountpoint": mountpoint, "device": device, "fstype": fstype}
+		metrics = append(metrics,
+			Gauge("FilesystemTotalBytes", float64(stat.Blocks*blockSize), labels),
+			Gauge("FilesystemFreeBytes", float64(stat.Bfree*blockSize), labels),
+			Gauge("FilesystemAvailableBytes", float64(stat.Bavail*blockSize), labels),
+			Gauge("FilesystemUsedBytes", float64((stat.Blocks-stat.Bfree)*blockSize), labels),
+			Gauge("FilesystemFiles", float64(stat.Files), labels),
+			Gauge("FilesystemFilesFree", float64(stat.Ffree), labels),
+		)
+	}
+	if len(failed) > 0 {
+		return metrics, fmt.Errorf("statfs failed for %s", strings.Join(failed, ", "))
+	}
+	return metrics, nil
+}
+
+// unescapeMount раскодирует восьмеричные последовательности вида \040, которыми ядро заменяет пробелы в путях.
+func unescapeMount(value string) string {
+	if !strings.Contains(value, `\`) {
+		return value
+	}
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\\' && i+3 < len(value) {
+			if code, err := strconv.ParseUint(value[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(code))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(value[i])
+	}
+	return b.String()
+}
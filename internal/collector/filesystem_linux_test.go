@@ -0,0 +1,45 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilesystemCollector(t *testing.T) {
+	procRoot := t.TempDir()
+	mountpoint := filepath.Join(t.TempDir(), "data dir")
+	require.NoError(t, os.Mkdir(mountpoint, 0755))
+	mounts := fmt.Sprintf("proc /proc proc rw 0 0\n/dev/sdb1 %s ext4 rw 0 0\n",
+		filepath.Join(filepath.Dir(mountpoint), `data\040dir`))
+	require.NoError(t, os.WriteFile(filepath.Join(procRoot, "mounts"), []byte(mounts), 0644))
+
+	c, err := NewFilesystem(Options{Interval: time.Second, ProcRoot: procRoot})
+	require.NoError(t, err)
+	got := collect(t, c)
+	require.Len(t, got, 6, "only the ext4 mount is reported")
+	labels := fmt.Sprintf(`{device="/dev/sdb1",fstype="ext4",mountpoint=%q}`, mountpoint)
+	assert.Greater(t, got["FilesystemTotalBytes"+labels], 0.0)
+	assert.LessOrEqual(t, got["FilesystemUsedBytes"+labels], got["FilesystemTotalBytes"+labels])
+}
+
+func TestFilesystemCollectorHostRoot(t *testing.T) {
+	// procfs хоста смонтирован в контейнер: точки монтирования разрешаются через корень процесса 1
+	procRoot := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(procRoot, "1", "root", "data"), 0755))
+	mounts := "/dev/sdb1 /data ext4 rw 0 0\n/dev/sdc1 /missing ext4 rw 0 0\n"
+	require.NoError(t, os.WriteFile(filepath.Join(procRoot, "mounts"), []byte(mounts), 0644))
+
+	c, err := NewFilesystem(Options{Interval: time.Second, ProcRoot: procRoot})
+	require.NoError(t, err)
+	metrics, err := c.Collect(context.Background())
+	assert.ErrorContains(t, err, "/missing")
+	require.Len(t, metrics, 6, "only the mount under the host root is reported")
+	assert.Equal(t, "/data", metrics[0].Labels["mountpoint"])
+}
@@ -0,0 +1,370 @@
+package collector
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/justEngineer/go-metrics-service/internal/models"
+)
+
+// cpuUtilizationMetric имя метрики загрузки процессора в процентах, ядро задается меткой cpu.
+const cpuUtilizationMetric = "CPUtilization"
+
+// sectorSize размер сектора, в котором ядро считает прочитанные и записанные данные в /proc/diskstats.
+const sectorSize = 512
+
+// counterDeltas переводит накопленные счетчики ядра в приращения counter.
+// Первое значение счетчика задает точку отсчета, при сбросе счетчика приращением считается новое значение.
+type counterDeltas map[string]uint64
+
+func (d counterDeltas) delta(key string, value uint64) int64 {
+	prev, ok := d[key]
+	d[key] = value
+	switch {
+	case !ok:
+		return 0
+	case value < prev:
+		return int64(value)
+	}
+	return int64(value - prev)
+}
+
+// keep удаляет счетчики объектов, которых больше нет. Ключ счетчика имеет вид "<объект>/<счетчик>".
+func (d counterDeltas) keep(objects map[string]bool) {
+	for key := range d {
+		object, _, _ := strings.Cut(key, "/")
+		if !objects[object] {
+			delete(d, key)
+		}
+	}
+}
+
+// readLines читает файл procfs построчно.
+func readLines(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return lines, scanner.Err()
+}
+
+// parseUints разбирает поля как беззнаковые целые числа.
+func parseUints(fields []string) ([]uint64, error) {
+	values := make([]uint64, len(fields))
+	for i, field := range fields {
+		value, err := strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+	return values, nil
+}
+
+// cpuTimes время процессора из /proc/stat в тиках.
+type cpuTimes struct {
+	busy, total uint64
+}
+
+// cpuCollector считает загрузку каждого ядра и процессора в целом между опросами по /proc/stat.
+type cpuCollector struct {
+	interval time.Duration
+	procRoot string
+	previous map[string]cpuTimes
+}
+
+// NewCPU создает коллектор cpu.
+func NewCPU(opts Options) (Collector, error) {
+	return &cpuCollector{interval: opts.Interval, procRoot: opts.ProcRoot, previous: make(map[string]cpuTimes)}, nil
+}
+
+func (c *cpuCollector) Name() string            { return "cpu" }
+func (c *cpuCollector) Interval() time.Duration { return c.interval }
+
+func (c *cpuCollector) Collect(ctx context.Context) ([]models.Metrics, error) {
+	lines, err := readLines(filepath.Join(c.procRoot, "stat"))
+	if err != nil {
+		return nil, err
+	}
+	var metrics []models.Metrics
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) < 5 || !strings.HasPrefix(fields[0], "cpu") {
+			continue
+		}
+		// guest и guest_nice уже учтены в user и nice
+		if len(fields) > 9 {
+			fields = fields[:9]
+		}
+		values, err := parseUints(fields[1:])
+		if err != nil {
+			return nil, fmt.Errorf("malformed %s line: %w", fields[0], err)
+		}
+		var times cpuTimes
+		for _, value := range values {
+			times.total += value
+		}
+		// idle и iowait
+		idle := values[3]
+		if len(values) > 4 {
+			idle += values[4]
+		}
+		times.busy = times.total - idle
+
+		cpu := strings.TrimPrefix(fields[0], "cpu")
+		if cpu == "" {
+			cpu = "total"
+		}
+		prev := c.previous[cpu]
+		c.previous[cpu] = times
+		if times.total <= prev.total || times.busy < prev.busy {
+			continue
+		}
+		utilization := 100 * float64(times.busy-prev.busy) / float64(times.total-prev.total)
+		metrics = append(metrics, Gauge(cpuUtilizationMetric, utilization, map[string]string{"cpu": cpu}))
+	}
+	return metrics, nil
+}
+
+// memoryCollector собирает использование оперативной памяти и swap из /proc/meminfo в байтах.
+type memoryCollector struct {
+	interval time.Duration
+	procRoot string
+}
+
+// NewMemory создает коллектор memory.
+func NewMemory(opts Options) (Collector, error) {
+	return &memoryCollector{interval: opts.Interval, procRoot: opts.ProcRoot}, nil
+}
+
+func (c *memoryCollector) Name() string            { return "memory" }
+func (c *memoryCollector) Interval() time.Duration { return c.interval }
+
+func (c *memoryCollector) Collect(ctx context.Context) ([]models.Metrics, error) {
+	lines, err := readLines(filepath.Join(c.procRoot, "meminfo"))
+	if err != nil {
+		return nil, err
+	}
+	info := make(map[string]uint64, len(lines))
+	for _, line := range lines {
+		name, rest, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(rest)
+		if len(fields) == 0 {
+			continue
+		}
+		value, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("malformed meminfo line %q: %w", line, err)
+		}
+		if len(fields) > 1 && fields[1] == "kB" {
+			value *= 1024
+		}
+		info[name] = value
+	}
+	total, ok := info["MemTotal"]
+	if !ok {
+		return nil, fmt.Errorf("MemTotal is missing in meminfo")
+	}
+	used := total - info["MemFree"] - info["Buffers"] - info["Cached"] - info["SReclaimable"]
+	if used > total {
+		used = total - info["MemFree"]
+	}
+	return []models.Metrics{
+		Gauge("TotalMemory", float64(total), nil),
+		Gauge("FreeMemory", float64(info["MemFree"]), nil),
+		Gauge("AvailableMemory", float64(info["MemAvailable"]), nil),
+		Gauge("UsedMemory", float64(used), nil),
+		Gauge("SwapTotal", float64(info["SwapTotal"]), nil),
+		Gauge("SwapFree", float64(info["SwapFree"]), nil),
+	}, nil
+}
+
+// loadCollector собирает среднюю загрузку системы из /proc/loadavg.
+type loadCollector struct {
+	interval time.Duration
+	procRoot string
+}
+
+// NewLoad создает коллектор load.
+func NewLoad(opts Options) (Collector, error) {
+	return &loadCollector{interval: opts.Interval, procRoot: opts.ProcRoot}, nil
+}
+
+func (c *loadCollector) Name() string            { return "load" }
+func (c *loadCollector) Interval() time.Duration { return c.interval }
+
+func (c *loadCollector) Collect(ctx context.Context) ([]models.Metrics, error) {
+	data, err := os.ReadFile(filepath.Join(c.procRoot, "loadavg"))
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) < 3 {
+		return nil, fmt.Errorf("malformed loadavg %q", data)
+	}
+	var metrics []models.Metrics
+	for i, name := range []string{"Load1", "Load5", "Load15"} {
+		value, err := strconv.ParseFloat(fields[i], 64)
+		if err != nil {
+			return nil, fmt.Errorf("malformed loadavg %q: %w", data, err)
+		}
+		metrics = append(metrics, Gauge(name, value, nil))
+	}
+	return metrics, nil
+}
+
+// diskCollector собирает счетчики ввода-вывода дисков из /proc/diskstats.
+// Loop и ram устройства пропускаются.
+type diskCollector struct {
+	interval time.Duration
+	procRoot string
+	deltas   counterDeltas
+}
+
+// NewDisk создает коллектор disk.
+func NewDisk(opts Options) (Collector, error) {
+	return &diskCollector{interval: opts.Interval, procRoot: opts.ProcRoot, deltas: make(counterDeltas)}, nil
+}
+
+func (c *diskCollector) Name() string            { return "disk" }
+func (c *diskCollector) Interval() time.Duration { return c.interval }
+
+func (c *diskCollector) Collect(ctx context.Context) ([]models.Metrics, error) {
+	lines, err := readLines(filepath.Join(c.procRoot, "diskstats"))
+	if err != nil {
+		return nil, err
+	}
+	var metrics []models.Metrics
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) < 14 {
+			continue
+		}
+		device := fields[2]
+		if strings.HasPrefix(device, "loop") || strings.HasPrefix(device, "ram") {
+			continue
+		}
+		values, err := parseUints(fields[3:14])
+		if err != nil {
+			return nil, fmt.Errorf("malformed diskstats line of %s: %w", device, err)
+		}
+		labels := map[string]string{"device": device}
+		counters := []struct {
+			name  string
+			value uint64
+		}{
+			{"DiskReads", values[0]},
+			{"DiskReadBytes", values[2] * sectorSize},
+			{"DiskWrites", values[4]},
+			{"DiskWriteBytes", values[6] * sectorSize},
+			{"DiskIOTimeMs", values[9]},
+		}
+		for _, counter := range counters {
+			delta := c.deltas.delta(device+"/"+counter.name, counter.value)
+			metrics = append(metrics, Counter(counter.name, delta, labels))
+		}
+		metrics = append(metrics, Gauge("DiskIOInProgress", float64(values[8]), labels))
+	}
+	return metrics, nil
+}
+
+// networkCollector собирает счетчики сетевых интерфейсов из /proc/net/dev.
+type networkCollector struct {
+	interval time.Duration
+	procRoot string
+	deltas   counterDeltas
+}
+
+// NewNetwork создает коллектор network.
+func NewNetwork(opts Options) (Collector, error) {
+	return &networkCollector{interval: opts.Interval, procRoot: opts.ProcRoot, deltas: make(counterDeltas)}, nil
+}
+
+func (c *networkCollector) Name() string            { return "network" }
+func (c *networkCollector) Interval() time.Duration { return c.interval }
+
+func (c *networkCollector) Collect(ctx context.Context) ([]models.Metrics, error) {
+	lines, err := readLines(filepath.Join(c.procRoot, "net", "dev"))
+	if err != nil {
+		return nil, err
+	}
+	var metrics []models.Metrics
+	for _, line := range lines {
+		name, rest, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(rest)
+		if len(fields) < 16 {
+			continue
+		}
+		iface := strings.TrimSpace(name)
+		values, err := parseUints(fields[:16])
+		if err != nil {
+			return nil, fmt.Errorf("malformed net/dev line of %s: %w", iface, err)
+		}
+		labels := map[string]string{"interface": iface}
+		counters := []struct {
+			name  string
+			value uint64
+		}{
+			{"NetworkReceivedBytes", values[0]},
+			{"NetworkReceivedPackets", values[1]},
+			{"NetworkReceiveErrors", values[2]},
+			{"NetworkReceiveDrops", values[3]},
+			{"NetworkSentBytes", values[8]},
+			{"NetworkSentPackets", values[9]},
+			{"NetworkSendErrors", values[10]},
+			{"NetworkSendDrops", values[11]},
+		}
+		for _, counter := range counters {
+			delta := c.deltas.delta(iface+"/"+counter.name, counter.value)
+			metrics = append(metrics, Counter(counter.name, delta, labels))
+		}
+	}
+	return metrics, nil
+}
+
+// fdCollector собирает количество открытых в системе файловых дескрипторов из /proc/sys/fs/file-nr.
+type fdCollector struct {
+	interval time.Duration
+	procRoot string
+}
+
+// NewFD создает коллектор fd.
+func NewFD(opts Options) (Collector, error) {
+	return &fdCollector{interval: opts.Interval, procRoot: opts.ProcRoot}, nil
+}
+
+func (c *fdCollector) Name() string            { return "fd" }
+func (c *fdCollector) Interval() time.Duration { return c.interval }
+
+func (c *fdCollector) Collect(ctx context.Context) ([]models.Metrics, error) {
+	data, err := os.ReadFile(filepath.Join(c.procRoot, "sys", "fs", "file-nr"))
+	if err != nil {
+		return nil, err
+	}
+	values, err := parseUints(strings.Fields(string(data)))
+	if err != nil || len(values) < 3 {
+		return nil, fmt.Errorf("malformed file-nr %q", data)
+	}
+	return []models.Metrics{
+		Gauge("OpenFileDescriptors", float64(values[0]-values[1]), nil),
+		Gauge("MaxFileDescriptors", float64(values[2]), nil),
+	}, nil
+}
@@ -0,0 +1,110 @@
+package collector
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/justEngineer/go-metrics-service/internal/models"
+	"github.com/justEngineer/go-metrics-service/internal/storage"
+)
+
+// collect опрашивает коллектор и возвращает значения метрик по ключам рядов.
+func collect(t *testing.T, c Collector) map[string]float64 {
+	metrics, err := c.Collect(context.Background())
+	require.NoError(t, err)
+	return values(metrics)
+}
+
+func values(metrics []models.Metrics) map[string]float64 {
+	result := make(map[string]float64, len(metrics))
+	for _, metric := range metrics {
+		key := storage.SeriesKey(metric.ID, metric.Labels)
+		if metric.MType == models.Counter {
+			result[key] = float64(*metric.Delta)
+		} else {
+			result[key] = *metric.Value
+		}
+	}
+	return result
+}
+
+func newHostCollector(t *testing.T, factory Factory) Collector {
+	c, err := factory(Options{Interval: time.Second, ProcRoot: "testdata/proc"})
+	require.NoError(t, err)
+	return c
+}
+
+func TestCPUCollector(t *testing.T) {
+	c := newHostCollector(t, NewCPU)
+	got := collect(t, c)
+	assert.InDelta(t, 15.0, got[`CPUtilization{cpu="total"}`], 1e-9)
+	assert.InDelta(t, 18.0, got[`CPUtilization{cpu="0"}`], 1e-9)
+	assert.InDelta(t, 12.0, got[`CPUtilization{cpu="1"}`], 1e-9)
+
+	c.(*cpuCollector).procRoot = "testdata/proc-next"
+	got = collect(t, c)
+	assert.InDelta(t, 800.0/15, got[`CPUtilization{cpu="total"}`], 1e-9)
+	assert.InDelta(t, 600.0/7, got[`CPUtilization{cpu="0"}`], 1e-9)
+	assert.InDelta(t, 25.0, got[`CPUtilization{cpu="1"}`], 1e-9)
+}
+
+func TestMemoryCollector(t *testing.T) {
+	got := collect(t, newHostCollector(t, NewMemory))
+	assert.Equal(t, map[string]float64{
+		"TotalMemory":     8000000 * 1024,
+		"FreeMemory":      1000000 * 1024,
+		"AvailableMemory": 5000000 * 1024,
+		"UsedMemory":      3300000 * 1024,
+		"SwapTotal":       2000000 * 1024,
+		"SwapFree":        1500000 * 1024,
+	}, got)
+}
+
+func TestLoadAndFDCollectors(t *testing.T) {
+	assert.Equal(t, map[string]float64{"Load1": 0.52, "Load5": 0.58, "Load15": 0.59}, collect(t, newHostCollector(t, NewLoad)))
+	got := collect(t, newHostCollector(t, NewFD))
+	assert.Equal(t, 1536.0, got["OpenFileDescriptors"])
+	assert.Equal(t, float64(9223372036854775807), got["MaxFileDescriptors"])
+}
+
+func TestDiskCollector(t *testing.T) {
+	c := newHostCollector(t, NewDisk)
+	got := collect(t, c)
+	assert.Equal(t, 0.0, got[`DiskReads{device="sda"}`], "first poll sets the baseline")
+	assert.NotContains(t, got, `DiskReads{device="loop0"}`)
+
+	c.(*diskCollector).procRoot = "testdata/proc-next"
+	got = collect(t, c)
+	assert.Equal(t, 100.0, got[`DiskReads{device="sda"}`])
+	assert.Equal(t, 2000.0*512, got[`DiskReadBytes{device="sda"}`])
+	assert.Equal(t, 100.0, got[`DiskWrites{device="sda"}`])
+	assert.Equal(t, 2000.0*512, got[`DiskWriteBytes{device="sda"}`])
+	assert.Equal(t, 100.0, got[`DiskIOTimeMs{device="sda"}`])
+	assert.Equal(t, 2.0, got[`DiskIOInProgress{device="sda"}`])
+	assert.Equal(t, 90.0, got[`DiskReads{device="sda1"}`])
+}
+
+func TestNetworkCollector(t *testing.T) {
+	c := newHostCollector(t, NewNetwork)
+	got := collect(t, c)
+	assert.Len(t, got, 16)
+
+	c.(*networkCollector).procRoot = "testdata/proc-next"
+	got = collect(t, c)
+	assert.Equal(t, 4096.0, got[`NetworkReceivedBytes{interface="eth0"}`])
+	assert.Equal(t, 10.0, got[`NetworkReceivedPackets{interface="eth0"}`])
+	assert.Equal(t, 2048.0, got[`NetworkSentBytes{interface="eth0"}`])
+	assert.Equal(t, 0.0, got[`NetworkSendErrors{interface="eth0"}`])
+	assert.Equal(t, 1000.0, got[`NetworkReceivedBytes{interface="lo"}`])
+}
+
+func TestCounterDeltasReset(t *testing.T) {
+	deltas := make(counterDeltas)
+	assert.Equal(t, int64(0), deltas.delta("a", 100))
+	assert.Equal(t, int64(50), deltas.delta("a", 150))
+	assert.Equal(t, int64(20), deltas.delta("a", 20), "counter reset reports the new value")
+}
@@ -0,0 +1,14 @@
+package collector
+
+// registerPlatform регистрирует коллекторы узла, процессов и контрольных групп, читающие procfs и cgroupfs.
+func registerPlatform(r *Registry) {
+	r.Register("cpu", NewCPU)
+	r.Register("memory", NewMemory)
+	r.Register("load", NewLoad)
+	r.Register("filesystem", NewFilesystem)
+	r.Register("disk", NewDisk)
+	r.Register("network", NewNetwork)
+	r.Register("fd", NewFD)
+	r.Register("process", NewProcess)
+	r.Register("cgroup", NewCgroup)
+}
@@ -0,0 +1,246 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/justEngineer/go-metrics-service/internal/models"
+)
+
+// clockTicks частота, в которой ядро считает время процессора в /proc/<pid>/stat (USER_HZ).
+const clockTicks = 100
+
+// processCPU время процессора процесса и момент его измерения.
+type processCPU struct {
+	ticks uint64
+	at    time.Time
+}
+
+// processCollector собирает потребление ресурсов выбранными процессами из /proc/<pid>.
+// Процессы выбираются по PID-файлам, регулярным выражениям для имени или командной строки
+// и по контрольным группам; каждая метрика помечается метками pid и process.
+type processCollector struct {
+	interval   time.Duration
+	procRoot   string
+	cgroupRoot string
+	pidfiles   []string
+	names      []*regexp.Regexp
+	cgroups    []string
+	deltas     counterDeltas
+	cpu        map[int]processCPU
+	now        func() time.Time
+}
+
+// NewProcess создает коллектор process. Если процессы не выбраны, коллектор не создается.
+func NewProcess(opts Options) (Collector, error) {
+	s := opts.Settings
+	if len(s.Pidfiles) == 0 && len(s.Names) == 0 && len(s.Cgroups) == 0 {
+		return nil, nil
+	}
+	c := &processCollector{
+		interval:   opts.Interval,
+		procRoot:   opts.ProcRoot,
+		cgroupRoot: opts.CgroupRoot,
+		pidfiles:   s.Pidfiles,
+		cgroups:    s.Cgroups,
+		deltas:     make(counterDeltas),
+		cpu:        make(map[int]processCPU),
+		now:        time.Now,
+	}
+	for _, name := range s.Names {
+		re, err := regexp.Compile(name)
+		if err != nil {
+			return nil, fmt.Errorf("wrong process name pattern %q: %w", name, err)
+		}
+		c.names = append(c.names, re)
+	}
+	return c, nil
+}
+
+func (c *processCollector) Name() string            { return "process" }
+func (c *processCollector) Interval() time.Duration { return c.interval }
+
+func (c *processCollector) Collect(ctx context.Context) ([]models.Metrics, error) {
+	pids, errs := c.selectPids()
+	var metrics []models.Metrics
+	seen := make(map[string]bool)
+	for _, pid := range pids {
+		processMetrics, err := c.collectProcess(pid, seen)
+		// процесс мог завершиться между выбором и чтением: уже прочитанные метрики сохраняются,
+		// иначе приращение времени процессора, учтенное в состоянии коллектора, было бы потеряно
+		metrics = append(metrics, processMetrics...)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, fmt.Errorf("process %d: %w", pid, err))
+		}
+	}
+	c.deltas.keep(seen)
+	for pid := range c.cpu {
+		if !seen[strconv.Itoa(pid)] {
+			delete(c.cpu, pid)
+		}
+	}
+	return metrics, errors.Join(errs...)
+}
+
+// selectPids возвращает отсортированные PID выбранных процессов без повторов.
+func (c *processCollector) selectPids() ([]int, []error) {
+	var errs []error
+	selected := make(map[int]bool)
+	for _, pidfile := range c.pidfiles {
+		data, err := os.ReadFile(pidfile)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("malformed pidfile %s: %w", pidfile, err))
+			continue
+		}
+		selected[pid] = true
+	}
+	for _, cgroup := range c.cgroups {
+		lines, err := readLines(filepath.Join(c.cgroupRoot, cgroup, "cgroup.procs"))
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, line := range lines {
+			if pid, err := strconv.Atoi(strings.TrimSpace(line)); err == nil {
+				selected[pid] = true
+			}
+		}
+	}
+	if len(c.names) > 0 {
+		entries, err := os.ReadDir(c.procRoot)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		for _, entry := range entries {
+			pid, err := strconv.Atoi(entry.Name())
+			if err != nil || selected[pid] {
+				continue
+			}
+			if c.matchName(pid) {
+				selected[pid] = true
+			}
+		}
+	}
+	pids := make([]int, 0, len(selected))
+	for pid := range selected {
+		pids = append(pids, pid)
+	}
+	sort.Ints(pids)
+	return pids, errs
+}
+
+// matchName проверяет имя и командную строку процесса по регулярным выражениям.
+func (c *processCollector) matchName(pid int) bool {
+	dir := filepath.Join(c.procRoot, strconv.Itoa(pid))
+	comm, _ := os.ReadFile(filepath.Join(dir, "comm"))
+	cmdline, _ := os.ReadFile(filepath.Join(dir, "cmdline"))
+	name := strings.TrimSpace(string(comm))
+	command := strings.TrimSpace(strings.ReplaceAll(string(cmdline), "\x00", " "))
+	for _, re := range c.names {
+		if (name != "" && re.MatchString(name)) || (command != "" && re.MatchString(command)) {
+			return true
+		}
+	}
+	return false
+}
+
+// collectProcess читает stat, status, fd и io процесса. Недоступный io (нет прав) пропускается.
+func (c *processCollector) collectProcess(pid int, seen map[string]bool) ([]models.Metrics, error) {
+	dir := filepath.Join(c.procRoot, strconv.Itoa(pid))
+	stat, err := os.ReadFile(filepath.Join(dir, "stat"))
+	if err != nil {
+		return nil, err
+	}
+	// имя процесса в скобках может содержать пробелы, поэтому поля считаются от последней скобки
+	end := strings.LastIndexByte(string(stat), ')')
+	start := strings.IndexByte(string(stat), '(')
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("malformed stat %q", stat)
+	}
+	fields := strings.Fields(string(stat[end+1:]))
+	if len(fields) < 13 {
+		return nil, fmt.Errorf("malformed stat %q", stat)
+	}
+	times, err := parseUints(fields[11:13])
+	if err != nil {
+		return nil, fmt.Errorf("malformed stat %q: %w", stat, err)
+	}
+	id := strconv.Itoa(pid)
+	seen[id] = true
+	labels := map[string]string{"pid": id, "process": string(stat[start+1 : end])}
+	ticks := times[0] + times[1]
+	metrics := []models.Metrics{
+		Counter("ProcessCPUTimeMs", c.deltas.delta(id+"/cpu", ticks)*1000/clockTicks, labels),
+	}
+	now := c.now()
+	if prev, ok := c.cpu[pid]; ok && ticks >= prev.ticks && now.After(prev.at) {
+		utilization := 100 * float64(ticks-prev.ticks) / clockTicks / now.Sub(prev.at).Seconds()
+		metrics = append(metrics, Gauge("ProcessCPUUtilization", utilization, labels))
+	}
+	c.cpu[pid] = processCPU{ticks: ticks, at: now}
+
+	status, err := readLines(filepath.Join(dir, "status"))
+	if err != nil {
+		return metrics, err
+	}
+	for _, line := range status {
+		name, rest, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(rest)
+		if len(fields) == 0 {
+			continue
+		}
+		value, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		switch name {
+		case "VmRSS":
+			metrics = append(metrics, Gauge("ProcessRSSBytes", float64(value*1024), labels))
+		case "Threads":
+			metrics = append(metrics, Gauge("ProcessThreads", float64(value), labels))
+		}
+	}
+
+	fds, err := os.ReadDir(filepath.Join(dir, "fd"))
+	if err == nil {
+		metrics = append(metrics, Gauge("ProcessOpenFDs", float64(len(fds)), labels))
+	}
+
+	io, err := readLines(filepath.Join(dir, "io"))
+	if err != nil {
+		return metrics, nil
+	}
+	for _, line := range io {
+		name, rest, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		value, err := strconv.ParseUint(strings.TrimSpace(rest), 10, 64)
+		if err != nil {
+			continue
+		}
+		switch name {
+		case "read_bytes":
+			metrics = append(metrics, Counter("ProcessReadBytes", c.deltas.delta(id+"/read", value), labels))
+		case "write_bytes":
+			metrics = append(metrics, Counter("ProcessWriteBytes", c.deltas.delta(id+"/write", value), labels))
+		}
+	}
+	return metrics, nil
+}
@@ -0,0 +1,105 @@
+package collector
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProcessCollector(t *testing.T) {
+	c, err := NewProcess(Options{
+		Interval:   time.Second,
+		ProcRoot:   "testdata/proc",
+		CgroupRoot: "testdata/cgroup",
+		Settings: Settings{
+			Pidfiles: []string{"testdata/run/metrics-server.pid"},
+			Names:    []string{"^postgres$"},
+			Cgroups:  []string{"system.slice/worker.service"},
+		},
+	})
+	require.NoError(t, err)
+	processes := c.(*processCollector)
+	now := time.Unix(1700000000, 0)
+	processes.now = func() time.Time { return now }
+
+	got := collect(t, c)
+	server := `{pid="4242",process="metrics server"}`
+	assert.Equal(t, 20480.0*1024, got["ProcessRSSBytes"+server])
+	assert.Equal(t, 12.0, got["ProcessThreads"+server])
+	assert.Equal(t, 4.0, got["ProcessOpenFDs"+server])
+	assert.Equal(t, 0.0, got["ProcessCPUTimeMs"+server], "first poll sets the baseline")
+	assert.Contains(t, got, "ProcessWriteBytes"+server)
+	assert.Equal(t, 4.0, got[`ProcessThreads{pid="4343",process="worker"}`], "selected by cgroup")
+	assert.NotContains(t, got, `ProcessReadBytes{pid="4343",process="worker"}`, "unreadable io is skipped")
+	assert.Equal(t, 1.0, got[`ProcessThreads{pid="5000",process="postgres"}`], "selected by name")
+	assert.NotContains(t, got, `ProcessThreads{pid="6000",process="bash"}`)
+
+	// 4242 потратил 100 тиков, то есть секунду процессора, за две секунды
+	processes.cpu[4242] = processCPU{ticks: 100, at: now.Add(-2 * time.Second)}
+	processes.deltas["4242/cpu"] = 100
+	processes.deltas["9999/cpu"] = 1
+	got = collect(t, c)
+	assert.InDelta(t, 50.0, got["ProcessCPUUtilization"+server], 1e-9)
+	assert.Equal(t, 1000.0, got["ProcessCPUTimeMs"+server])
+	assert.NotContains(t, processes.deltas, "9999/cpu", "counters of exited processes are dropped")
+
+	c, err = NewProcess(Options{Interval: time.Second, ProcRoot: "testdata/proc"})
+	require.NoError(t, err)
+	assert.Nil(t, c, "collector without selected processes is not created")
+	_, err = NewProcess(Options{Settings: Settings{Names: []string{"("}}})
+	assert.Error(t, err)
+}
+
+func TestProcessCollectorExited(t *testing.T) {
+	// процесс завершился после чтения stat: время процессора не теряется и ошибка не сообщается
+	procRoot := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(procRoot, "7000"), 0755))
+	stat := "7000 (job) S 1 7000 7000 0 -1 4194560 0 0 0 0 30 20 0 0 20 0 1 0 100 0 0\n"
+	require.NoError(t, os.WriteFile(filepath.Join(procRoot, "7000", "stat"), []byte(stat), 0644))
+	pidfile := filepath.Join(t.TempDir(), "job.pid")
+	require.NoError(t, os.WriteFile(pidfile, []byte("7000\n"), 0644))
+
+	c, err := NewProcess(Options{Interval: time.Second, ProcRoot: procRoot, Settings: Settings{Pidfiles: []string{pidfile}}})
+	require.NoError(t, err)
+	c.(*processCollector).deltas["7000/cpu"] = 40
+	metrics, err := c.Collect(context.Background())
+	require.NoError(t, err)
+	require.Len(t, metrics, 1)
+	assert.Equal(t, "ProcessCPUTimeMs", metrics[0].ID)
+	assert.Equal(t, int64(100), *metrics[0].Delta)
+}
+
+func TestCgroupCollector(t *testing.T) {
+	c, err := NewCgroup(Options{
+		Interval:   time.Second,
+		CgroupRoot: "testdata/cgroup",
+		Settings:   Settings{Cgroups: []string{"system.slice/worker.service", "system.slice/limited.service"}},
+	})
+	require.NoError(t, err)
+	got := collect(t, c)
+	worker := `{cgroup="system.slice/worker.service"}`
+	assert.Equal(t, 52428800.0, got["CgroupMemoryBytes"+worker])
+	assert.NotContains(t, got, "CgroupMemoryLimitBytes"+worker, "unlimited memory has no limit metric")
+	assert.Equal(t, 2000.0, got[`CgroupMemoryLimitBytes{cgroup="system.slice/limited.service"}`])
+	assert.Equal(t, 0.0, got["CgroupCPUUsageUsec"+worker])
+	assert.Contains(t, got, `CgroupIOReadBytes{cgroup="system.slice/worker.service",device="8:0"}`)
+	assert.Len(t, got, 3+5+4)
+
+	cgroups := c.(*cgroupCollector)
+	cgroups.deltas["system.slice/worker.service|CgroupCPUUsageUsec"] = 3000000
+	cgroups.deltas["system.slice/worker.service|8:0|CgroupIOWriteBytes"] = 2097152 - 4096
+	got = collect(t, c)
+	assert.Equal(t, 1000000.0, got["CgroupCPUUsageUsec"+worker])
+	assert.Equal(t, 4096.0, got[`CgroupIOWriteBytes{cgroup="system.slice/worker.service",device="8:0"}`])
+
+	c, err = NewCgroup(Options{CgroupRoot: "testdata/cgroup", Interval: time.Second,
+		Settings: Settings{Cgroups: []string{"missing.slice"}}})
+	require.NoError(t, err)
+	_, err = c.Collect(context.Background())
+	assert.Error(t, err)
+}
@@ -0,0 +1,59 @@
+package collector
+
+import (
+	"context"
+	"math/rand"
+	"runtime"
+	"time"
+
+	"github.com/justEngineer/go-metrics-service/internal/models"
+)
+
+// runtimeCollector собирает статистику памяти Go из runtime.MemStats, RandomValue и счетчик опросов PollCount.
+type runtimeCollector struct {
+	interval time.Duration
+}
+
+// NewRuntime создает коллектор runtime.
+func NewRuntime(opts Options) (Collector, error) {
+	return &runtimeCollector{interval: opts.Interval}, nil
+}
+
+func (c *runtimeCollector) Name() string            { return "runtime" }
+func (c *runtimeCollector) Interval() time.Duration { return c.interval }
+
+func (c *runtimeCollector) Collect(ctx context.Context) ([]models.Metrics, error) {
+	m := &runtime.MemStats{}
+	runtime.ReadMemStats(m)
+	return []models.Metrics{
+		Gauge("Alloc", float64(m.Alloc), nil),
+		Gauge("BuckHashSys", float64(m.BuckHashSys), nil),
+		Gauge("Frees", float64(m.Frees), nil),
+		Gauge("GCCPUFraction", m.GCCPUFraction, nil),
+		Gauge("GCSys", float64(m.GCSys), nil),
+		Gauge("HeapAlloc", float64(m.HeapAlloc), nil),
+		Gauge("HeapIdle", float64(m.HeapIdle), nil),
+		Gauge("HeapInuse", float64(m.HeapInuse), nil),
+		Gauge("HeapObjects", float64(m.HeapObjects), nil),
+		Gauge("HeapReleased", float64(m.HeapReleased), nil),
+		Gauge("HeapSys", float64(m.HeapSys), nil),
+		Gauge("LastGC", float64(m.LastGC), nil),
+		Gauge("Lookups", float64(m.Lookups), nil),
+		Gauge("MCacheInuse", float64(m.MCacheInuse), nil),
+		Gauge("MCacheSys", float64(m.MCacheSys), nil),
+		Gauge("MSpanInuse", float64(m.MSpanInuse), nil),
+		Gauge("MSpanSys", float64(m.MSpanSys), nil),
+		Gauge("Mallocs", float64(m.Mallocs), nil),
+		Gauge("NextGC", float64(m.NextGC), nil),
+		Gauge("NumForcedGC", float64(m.NumForcedGC), nil),
+		Gauge("NumGC", float64(m.NumGC), nil),
+		Gauge("OtherSys", float64(m.OtherSys), nil),
+		Gauge("PauseTotalNs", float64(m.PauseTotalNs), nil),
+		Gauge("StackInuse", float64(m.StackInuse), nil),
+		Gauge("StackSys", float64(m.StackSys), nil),
+		Gauge("Sys", float64(m.Sys), nil),
+		Gauge("TotalAlloc", float64(m.TotalAlloc), nil),
+		Gauge("RandomValue", rand.Float64()*100, nil),
+		Counter("PollCount", 1, nil),
+	}, nil
+}
@@ -0,0 +1,62 @@
+//go:build !linux
+
+package collector
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/shirou/gopsutil/cpu"
+	"github.com/shirou/gopsutil/mem"
+
+	"github.com/justEngineer/go-metrics-service/internal/models"
+)
+
+// registerPlatform регистрирует коллектор system, так как procfs есть только в Linux.
+func registerPlatform(r *Registry) {
+	r.Register("system", NewSystem)
+}
+
+// systemCollector собирает загрузку процессоров и использование памяти через gopsutil.
+type systemCollector struct {
+	interval time.Duration
+}
+
+// NewSystem создает коллектор system.
+func NewSystem(opts Options) (Collector, error) {
+	return &systemCollector{interval: opts.Interval}, nil
+}
+
+func (c *systemCollector) Name() string            { return "system" }
+func (c *systemCollector) Interval() time.Duration { return c.interval }
+
+func (c *systemCollector) Collect(ctx context.Context) ([]models.Metrics, error) {
+	var metrics []models.Metrics
+	total, err := cpu.PercentWithContext(ctx, 0, false)
+	if err != nil {
+		return nil, fmt.Errorf("getting CPU percentage failed: %w", err)
+	}
+	perCPU, err := cpu.PercentWithContext(ctx, 0, true)
+	if err != nil {
+		return nil, fmt.Errorf("getting CPU percentage failed: %w", err)
+	}
+	if len(total) > 0 {
+		metrics = append(metrics, Gauge(cpuUtilizationMetric, total[0], map[string]string{"cpu": "total"}))
+	}
+	for i, percent := range perCPU {
+		metrics = append(metrics, Gauge(cpuUtilizationMetric, percent, map[string]string{"cpu": fmt.Sprint(i)}))
+	}
+
+	v, err := mem.VirtualMemoryWithContext(ctx)
+	if err != nil {
+		return metrics, fmt.Errorf("getting virtual memory metrics failed: %w", err)
+	}
+	metrics = append(metrics,
+		Gauge("TotalMemory", float64(v.Total), nil),
+		Gauge("FreeMemory", float64(v.Free), nil),
+		Gauge("AvailableMemory", float64(v.Available), nil),
+		Gauge("UsedMemory", float64(v.Used), nil),
+	)
+	return metrics, nil
+}
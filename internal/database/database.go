@@ -2,6 +2,7 @@ package database
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"time"
@@ -17,14 +18,19 @@ import (
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/database/postgres"
 	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/justEngineer/go-metrics-service/internal/distribution"
 	config "github.com/justEngineer/go-metrics-service/internal/http/server/config"
 	"github.com/justEngineer/go-metrics-service/internal/storage"
 )
 
-// Database предоставляет методы для БД.
+// Database предоставляет методы для БД и хранит историю значений метрик как временные ряды:
+// исходные значения в секционированной по дням таблице и их агрегаты за минуту и за час.
 type Database struct {
-	Connections *pgxpool.Pool
-	mainContext *context.Context
+	Connections      *pgxpool.Pool
+	mainContext      *context.Context
+	historyRetention time.Duration
+	minuteRetention  time.Duration
+	hourRetention    time.Duration
 }
 
 //go:embed migrations/*.sql
@@ -34,32 +40,115 @@ const migrationsDir = "migrations"
 
 // Запросы для вставки метрик в базу данных с обработкой конфликтов.
 const (
-	insertGaugeSQL = `INSERT INTO
-		gauge_metrics (id, value)
-	VALUES ($1, $2)
-	ON CONFLICT (id) DO UPDATE
-	SET value = EXCLUDED.value`
+	insertGaugeSQL = `WITH updated AS (
+		INSERT INTO
+			gauge_metrics (id, name, labels, value)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (id) DO UPDATE
+		SET value = EXCLUDED.value, updated_at = now()
+		RETURNING 'gauge' AS type, id, name, labels, value
+	)` + appendSampleSQL
 
-	insertCounterSQL = `INSERT INTO
-		counter_metrics (id, value)
-	VALUES ($1, $2)
-	ON CONFLICT (id) DO UPDATE
-	SET value = counter_metrics.value + EXCLUDED.value`
+	insertCounterSQL = `WITH updated AS (
+		INSERT INTO
+			counter_metrics (id, name, labels, value)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (id) DO UPDATE
+		SET value = counter_metrics.value + EXCLUDED.value, updated_at = now()
+		RETURNING 'counter' AS type, id, name, labels, value
+	)` + appendSampleSQL
 
-	selectGaugeSQL = `SELECT value FROM gauge_metrics WHERE id = $1`
+	// appendSampleSQL продолжает запрос с подзапросом updated: регистрирует ряд измененной метрики
+	// и добавляет ее новое значение в историю.
+	appendSampleSQL = `, series AS (
+		INSERT INTO metric_series (type, key, name, labels)
+		SELECT type, id, name, labels FROM updated
+		ON CONFLICT (type, key) DO UPDATE
+		SET labels = EXCLUDED.labels
+		RETURNING id
+	)
+	INSERT INTO metric_samples (series_id, ts, value)
+	SELECT series.id, now(), updated.value FROM series, updated`
 
-	selectCounterSQL = `SELECT value FROM counter_metrics WHERE id = $1`
+	insertDistributionSQL = `INSERT INTO
+		%s (id, name, labels, value)
+	VALUES ($1, $2, $3, $4)
+	ON CONFLICT (id) DO NOTHING`
+
+	selectDistributionForUpdateSQL = `SELECT value FROM %s WHERE id = $1 FOR UPDATE`
+
+	updateDistributionSQL = `UPDATE %s SET value = $2, updated_at = now() WHERE id = $1`
+
+	selectMetricSQL = `SELECT name, labels, value, updated_at FROM %s WHERE id = $1`
+
+	selectAllDistributionsSQL = `SELECT name, labels, value FROM %s`
+
+	selectAllGaugesSQL = `SELECT name, labels, value FROM gauge_metrics`
+
+	selectAllCountersSQL = `SELECT name, labels, value FROM counter_metrics`
+
+	resetCounterSQL = `WITH updated AS (
+		UPDATE counter_metrics SET value = 0, updated_at = now()
+		WHERE id = $1
+		RETURNING 'counter' AS type, id, name, labels, value
+	)` + appendSampleSQL
+
+	deleteMetricSQL = `DELETE FROM %s WHERE id = ANY($1) RETURNING id`
+
+	// deleteUnchangedMetricSQL удаляет метрики, не изменявшиеся с момента их отбора для удаления.
+	deleteUnchangedMetricSQL = `DELETE FROM %s m
+	USING unnest($1::TEXT[], $2::TIMESTAMPTZ[]) AS selected (id, updated_at)
+	WHERE m.id = selected.id AND m.updated_at <= selected.updated_at
+	RETURNING m.id`
+
+	// deleteMetricHistorySQL удаляет ряды метрик и их значения; агрегаты удаляются каскадно.
+	deleteMetricHistorySQL = `WITH deleted AS (
+		DELETE FROM metric_series WHERE type = $1 AND key = ANY($2)
+		RETURNING id
+	)
+	DELETE FROM metric_samples WHERE series_id IN (SELECT id FROM deleted)`
+
+	// selectMetricsSQL объединяет идентификаторы и время изменения метрик всех типов.
+	selectMetricsSQL = `SELECT 'gauge', id, name, updated_at FROM gauge_metrics
+	UNION ALL SELECT 'counter', id, name, updated_at FROM counter_metrics
+	UNION ALL SELECT 'histogram', id, name, updated_at FROM histogram_metrics
+	UNION ALL SELECT 'summary', id, name, updated_at FROM summary_metrics`
+
+	// listMetricsSQL объединяет метрики всех типов; имена и идентификаторы сравниваются побайтно,
+	// как в MemStorage, чтобы позиция страницы не зависела от правил сортировки базы данных.
+	listMetricsSQL = `SELECT type, id, name, labels, gauge, counter, distribution, updated_at FROM (
+		SELECT 'gauge' AS type, id COLLATE "C" AS id, name COLLATE "C" AS name, labels,
+			value AS gauge, NULL::BIGINT AS counter, NULL::JSONB AS distribution, updated_at FROM gauge_metrics
+		UNION ALL
+		SELECT 'counter', id, name, labels, NULL, value, NULL, updated_at FROM counter_metrics
+		UNION ALL
+		SELECT 'histogram', id, name, labels, NULL, NULL, value, updated_at FROM histogram_metrics
+		UNION ALL
+		SELECT 'summary', id, name, labels, NULL, NULL, value, updated_at FROM summary_metrics
+	) metrics
+	WHERE ($1 = '' OR type = $1) AND starts_with(name, $2)`
 )
 
 // Получаем одно соединение для базы данных
 func NewConnection(ctx context.Context, cfg *config.ServerConfig) (*Database, error) {
 	connect, err := pgxpool.New(ctx, cfg.DatabaseDSN)
-	db := Database{Connections: connect, mainContext: &ctx}
+	db := Database{
+		Connections:      connect,
+		mainContext:      &ctx,
+		historyRetention: cfg.HistoryRetention,
+		minuteRetention:  cfg.MinuteRetention,
+		hourRetention:    cfg.HourRetention,
+	}
 	if err != nil {
 		return &db, err
-	} else {
-		err = db.applyMigrations(cfg)
 	}
+	// обслуживание истории запускается и при ошибке миграций: оно повторит их и создаст секции,
+	// когда база данных станет доступна, а до тех пор значения примет секция по умолчанию
+	var migrate func() error
+	if err = db.applyMigrations(cfg); err != nil {
+		migrate = func() error { return db.applyMigrations(cfg) }
+	}
+	go db.maintainHistory(ctx, migrate)
 	return &db, err
 }
 
@@ -103,96 +192,473 @@ func (d *Database) Ping() error {
 	return nil
 }
 
-// SetGaugeMetric добавляет Gauge-метрику в хранилище и выполняет бэкап данных при необходимости.
-func (d *Database) SetGaugeMetric(ctx context.Context, key string, value float64) error {
+// Health проверяет наличие связи с БД.
+func (d *Database) Health(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+	return d.Connections.Ping(ctx)
+}
+
+// Close закрывает соединения с БД.
+func (d *Database) Close() error {
+	d.Connections.Close()
+	return nil
+}
+
+// Get извлекает метрику типа mType со временем ее последнего изменения.
+func (d *Database) Get(ctx context.Context, mType string, key string) (storage.Metric, error) {
+	table, ok := metricTables[mType]
+	if !ok {
+		return storage.Metric{}, fmt.Errorf("%w: %s %v", storage.ErrMetricNotFound, mType, key)
+	}
+	var metric storage.Metric
 	f := func() error {
-		if _, err := d.Connections.Exec(ctx, insertGaugeSQL, key, value); err != nil {
+		metric = storage.Metric{MType: mType}
+		var value []byte
+		var dest any = &value
+		switch mType {
+		case "gauge":
+			metric.Value = new(float64)
+			dest = metric.Value
+		case "counter":
+			metric.Delta = new(int64)
+			dest = metric.Delta
+		}
+		row := d.Connections.QueryRow(ctx, fmt.Sprintf(selectMetricSQL, table), key)
+		if err := row.Scan(&metric.ID, &metric.Labels, dest, &metric.UpdatedAt); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return backoff.Permanent(fmt.Errorf("%w: %s %v", storage.ErrMetricNotFound, mType, key))
+			}
 			return err
 		}
+		if len(metric.Labels) == 0 {
+			metric.Labels = nil
+		}
+		if err := decodeDistribution(&metric, value); err != nil {
+			return backoff.Permanent(fmt.Errorf("%s metric %v: %w", mType, key, err))
+		}
 		return nil
 	}
 	err := executeWithBackoff(f)
+	return metric, err
+}
+
+// Set сохраняет метрику любого типа.
+func (d *Database) Set(ctx context.Context, metric storage.Metric) error {
+	return d.Batch(ctx, []storage.Metric{metric})
+}
+
+// Batch сохраняет метрики в одной транзакции.
+func (d *Database) Batch(ctx context.Context, metrics []storage.Metric) error {
+	if err := storage.ValidateBatch(metrics); err != nil {
+		return err
+	}
+	return executeWithBackoff(func() error {
+		return d.inTransaction(ctx, func(tx pgx.Tx) error {
+			for _, metric := range metrics {
+				if err := setMetric(ctx, tx, metric); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+}
+
+// Таблицы для метрик, описывающих распределение значений.
+const (
+	histogramTable = "histogram_metrics"
+	summaryTable   = "summary_metrics"
+)
+
+// inTransaction выполняет fn в транзакции и фиксирует ее, если fn завершилась без ошибки.
+func (d *Database) inTransaction(ctx context.Context, fn func(tx pgx.Tx) error) error {
+	tx, err := d.Connections.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// после успешной фиксации транзакции откат ничего не делает
+		_ = tx.Rollback(ctx)
+	}()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// setMetric сохраняет проверенную метрику любого типа в транзакции tx.
+func setMetric(ctx context.Context, tx pgx.Tx, metric storage.Metric) error {
+	key := metric.Key()
+	var err error
+	switch metric.MType {
+	case "gauge":
+		_, err = tx.Exec(ctx, insertGaugeSQL, key, metric.ID, jsonLabels(metric.Labels), *metric.Value)
+	case "counter":
+		_, err = tx.Exec(ctx, insertCounterSQL, key, metric.ID, jsonLabels(metric.Labels), *metric.Delta)
+	case "histogram":
+		err = mergeHistogram(ctx, tx, key, metric.Histogram)
+	case "summary":
+		err = mergeSummary(ctx, tx, key, metric.Summary)
+	}
 	return err
 }
 
-// SetCounterMetric добавляет Counter-метрику в хранилище и выполняет бэкап данных при необходимости.
-func (d *Database) SetCounterMetric(ctx context.Context, key string, value int64) error {
-	f := func() error {
-		if _, err := d.Connections.Exec(ctx, insertCounterSQL, key, value); err != nil {
+func mergeHistogram(ctx context.Context, tx pgx.Tx, key string, value *distribution.Histogram) error {
+	return mergeDistribution(ctx, tx, histogramTable, key, value, func(stored *distribution.Histogram) error {
+		return stored.Merge(value)
+	})
+}
+
+func mergeSummary(ctx context.Context, tx pgx.Tx, key string, value *distribution.Sketch) error {
+	return mergeDistribution(ctx, tx, summaryTable, key, value, func(stored *distribution.Sketch) error {
+		if err := stored.Validate(); err != nil {
 			return err
 		}
-		return nil
+		return stored.Merge(value)
+	})
+}
+
+// mergeDistribution сохраняет метрику в транзакции tx или, если она уже есть, сливает ее с сохраненной.
+func mergeDistribution[T any](ctx context.Context, tx pgx.Tx, table string, key string, value *T, merge func(stored *T) error) error {
+	name, labels := storage.ParseSeriesKey(key)
+	tag, err := tx.Exec(ctx, fmt.Sprintf(insertDistributionSQL, table), key, name, jsonLabels(labels), value)
+	if err != nil {
+		return err
 	}
-	err := executeWithBackoff(f)
-	return err
+	if tag.RowsAffected() == 0 {
+		var stored T
+		if err := tx.QueryRow(ctx, fmt.Sprintf(selectDistributionForUpdateSQL, table), key).Scan(&stored); err != nil {
+			return err
+		}
+		if err := merge(&stored); err != nil {
+			return backoff.Permanent(err)
+		}
+		if _, err := tx.Exec(ctx, fmt.Sprintf(updateDistributionSQL, table), key, &stored); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-// GetGaugeMetric извлекает метрику типа gauge из хранилища.
-func (d *Database) GetGaugeMetric(ctx context.Context, key string) (float64, error) {
-	var value float64 = 0
+// GetAllMetrics извлекает все метрики из хранилища.
+func (d *Database) GetAllMetrics(ctx context.Context) (storage.MetricsDump, error) {
+	var dump storage.MetricsDump
 	f := func() error {
-		var result float64
-		row := d.Connections.QueryRow(ctx, selectGaugeSQL, key)
-		if err := row.Scan(&result); err != nil {
-			if errors.Is(err, pgx.ErrNoRows) {
-				return fmt.Errorf("gauge metric is not found: %w, id: %v", err, key)
+		dump = storage.MetricsDump{}
+		gaugeRows, err := d.Connections.Query(ctx, selectAllGaugesSQL)
+		if err != nil {
+			return err
+		}
+		for gaugeRows.Next() {
+			var metric storage.GaugeMetric
+			if err := gaugeRows.Scan(&metric.Name, &metric.Labels, &metric.Value); err != nil {
+				gaugeRows.Close()
+				return err
 			}
+			dump.Gauges = append(dump.Gauges, metric)
+		}
+		gaugeRows.Close()
+		if err := gaugeRows.Err(); err != nil {
 			return err
 		}
-		value = result
-		return nil
+		counterRows, err := d.Connections.Query(ctx, selectAllCountersSQL)
+		if err != nil {
+			return err
+		}
+		for counterRows.Next() {
+			var metric storage.CounterMetric
+			if err := counterRows.Scan(&metric.Name, &metric.Labels, &metric.Value); err != nil {
+				counterRows.Close()
+				return err
+			}
+			dump.Counters = append(dump.Counters, metric)
+		}
+		counterRows.Close()
+		if err := counterRows.Err(); err != nil {
+			return err
+		}
+		histogramRows, err := d.Connections.Query(ctx, fmt.Sprintf(selectAllDistributionsSQL, histogramTable))
+		if err != nil {
+			return err
+		}
+		for histogramRows.Next() {
+			var metric storage.HistogramMetric
+			if err := histogramRows.Scan(&metric.Name, &metric.Labels, &metric.Value); err != nil {
+				histogramRows.Close()
+				return err
+			}
+			dump.Histograms = append(dump.Histograms, metric)
+		}
+		histogramRows.Close()
+		if err := histogramRows.Err(); err != nil {
+			return err
+		}
+		summaryRows, err := d.Connections.Query(ctx, fmt.Sprintf(selectAllDistributionsSQL, summaryTable))
+		if err != nil {
+			return err
+		}
+		defer summaryRows.Close()
+		for summaryRows.Next() {
+			var metric storage.SummaryMetric
+			if err := summaryRows.Scan(&metric.Name, &metric.Labels, &metric.Value); err != nil {
+				return err
+			}
+			if err := metric.Value.Validate(); err != nil {
+				return backoff.Permanent(err)
+			}
+			dump.Summaries = append(dump.Summaries, metric)
+		}
+		return summaryRows.Err()
 	}
 	err := executeWithBackoff(f)
-	return value, err
+	return dump, err
 }
 
-// GetCounterMetric извлекает метрику типа counter из хранилища.
-func (d *Database) GetCounterMetric(ctx context.Context, key string) (int64, error) {
-	var value int64 = 0
+// List возвращает страницу метрик, отобранных фильтром, со временем их последнего изменения.
+// Регулярное выражение фильтра проверяется при чтении строк по правилам Go, как в остальных хранилищах.
+func (d *Database) List(ctx context.Context, filter storage.ListFilter) (storage.ListResult, error) {
+	if err := filter.Normalize(); err != nil {
+		return storage.ListResult{}, err
+	}
+	query, args := listQuery(filter)
+
+	var metrics []storage.Metric
 	f := func() error {
-		var result int64
-		row := d.Connections.QueryRow(ctx, selectCounterSQL, key)
-		if err := row.Scan(&result); err != nil {
-			if errors.Is(err, pgx.ErrNoRows) {
-				return fmt.Errorf("counter metric is not found: %w, id: %v", err, key)
-			}
+		rows, err := d.Connections.Query(ctx, query, args...)
+		if err != nil {
 			return err
 		}
-		value = result
-		return nil
+		defer rows.Close()
+		metrics = metrics[:0]
+		for rows.Next() {
+			var metric storage.Metric
+			var key string
+			var value []byte
+			if err := rows.Scan(&metric.MType, &key, &metric.ID, &metric.Labels, &metric.Value, &metric.Delta, &value, &metric.UpdatedAt); err != nil {
+				return err
+			}
+			if len(metric.Labels) == 0 {
+				metric.Labels = nil
+			}
+			if !filter.Match(metric.ID, metric.MType) {
+				continue
+			}
+			if err := decodeDistribution(&metric, value); err != nil {
+				return backoff.Permanent(fmt.Errorf("%s metric %v: %w", metric.MType, key, err))
+			}
+			metrics = append(metrics, metric)
+			// одна лишняя метрика показывает, что страница не последняя
+			if len(metrics) > filter.Limit {
+				break
+			}
+		}
+		return rows.Err()
 	}
-	err := executeWithBackoff(f)
-	return value, err
+	if err := executeWithBackoff(f); err != nil {
+		return storage.ListResult{}, err
+	}
+	result := storage.ListResult{Metrics: metrics}
+	if len(metrics) > filter.Limit {
+		result.Metrics = metrics[:filter.Limit]
+		result.NextCursor = filter.Cursor(metrics[filter.Limit-1]).String()
+	}
+	if result.Metrics == nil {
+		result.Metrics = []storage.Metric{}
+	}
+	return result, nil
+}
+
+// listQuery возвращает запрос страницы списка метрик и его параметры. Страница начинается после позиции
+// filter.After; если задано регулярное выражение, строки отбираются при чтении и их количество не ограничивается.
+func listQuery(filter storage.ListFilter) (string, []any) {
+	query := listMetricsSQL
+	args := []any{filter.Type, filter.Prefix}
+	column, order, compare := "name", "ASC", ">"
+	if filter.Sort == storage.SortByUpdated {
+		column = "updated_at"
+	}
+	if filter.Desc {
+		order, compare = "DESC", "<"
+	}
+	if filter.After != nil {
+		var position any = filter.After.Name
+		if filter.Sort == storage.SortByUpdated {
+			position = filter.After.UpdatedAt
+		}
+		query += fmt.Sprintf(" AND (%s, id, type) %s ($3, $4, $5)", column, compare)
+		args = append(args, position, filter.After.Key, filter.After.Type)
+	}
+	query += fmt.Sprintf(" ORDER BY %[1]s %[2]s, id %[2]s, type %[2]s", column, order)
+	if filter.Pattern == nil {
+		query += fmt.Sprintf(" LIMIT %d", filter.Limit+1)
+	}
+	return query, args
+}
+
+// metricTables таблицы метрик каждого типа.
+var metricTables = map[string]string{
+	"gauge":     "gauge_metrics",
+	"counter":   "counter_metrics",
+	"histogram": histogramTable,
+	"summary":   summaryTable,
+}
+
+// Delete удаляет метрику типа mType вместе с ее историей.
+func (d *Database) Delete(ctx context.Context, mType string, key string) error {
+	if _, ok := metricTables[mType]; !ok {
+		return fmt.Errorf("%w: %s %v", storage.ErrMetricNotFound, mType, key)
+	}
+	var deleted int
+	err := executeWithBackoff(func() error {
+		var err error
+		deleted, err = d.deleteMetrics(ctx, map[string]*selection{mType: {ids: []string{key}}})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return fmt.Errorf("%w: %s %v", storage.ErrMetricNotFound, mType, key)
+	}
+	return nil
 }
 
-// SetMetricsBatch добавляет несколько метрик в хранилище и выполняет бэкап данных при необходимости.
-func (d *Database) SetMetricsBatch(ctx context.Context, gaugesBatch []storage.GaugeMetric, countersBatch []storage.CounterMetric) error {
+// ResetCounter обнуляет метрику типа counter и добавляет нулевое значение в историю.
+func (d *Database) ResetCounter(ctx context.Context, key string) error {
+	var reset int64
+	err := executeWithBackoff(func() error {
+		tag, err := d.Connections.Exec(ctx, resetCounterSQL, key)
+		reset = tag.RowsAffected()
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if reset == 0 {
+		return fmt.Errorf("%w: counter %v", storage.ErrMetricNotFound, key)
+	}
+	return nil
+}
+
+// DeleteMetrics удаляет метрики, отобранные по типу и имени фильтром, и возвращает их количество.
+// Метрики отбираются в приложении, поэтому регулярное выражение проверяется по правилам Go, как в MemStorage.
+func (d *Database) DeleteMetrics(ctx context.Context, filter storage.ListFilter) (int, error) {
+	if err := filter.Normalize(); err != nil {
+		return 0, err
+	}
+	return d.deleteSelected(ctx, func(mType, name string, updatedAt time.Time) bool {
+		return filter.Match(name, mType)
+	})
+}
+
+// Expire удаляет ряды, не обновлявшиеся дольше времени жизни из policy.
+func (d *Database) Expire(ctx context.Context, policy storage.TTLPolicy, now time.Time) (int, error) {
+	if len(policy) == 0 {
+		return 0, nil
+	}
+	return d.deleteSelected(ctx, func(mType, name string, updatedAt time.Time) bool {
+		return policy.Expired(mType, name, updatedAt, now)
+	})
+}
+
+// selection метрики одного типа, отобранные для удаления. Если задано время изменения, метрика удаляется,
+// только если не изменялась после отбора.
+type selection struct {
+	ids       []string
+	updatedAt []time.Time
+}
+
+// deleteSelected удаляет метрики, для которых match возвращает true. Метрика, обновленная
+// между отбором и удалением, сохраняется: решение о ее удалении принималось по устаревшему состоянию.
+func (d *Database) deleteSelected(ctx context.Context, match func(mType, name string, updatedAt time.Time) bool) (int, error) {
+	var deleted int
 	f := func() error {
-		tx, err := d.Connections.BeginTx(ctx, pgx.TxOptions{})
+		rows, err := d.Connections.Query(ctx, selectMetricsSQL)
 		if err != nil {
 			return err
 		}
-		for _, gaugeMetric := range gaugesBatch {
-			if _, err := tx.Exec(ctx, insertGaugeSQL, gaugeMetric.Name, gaugeMetric.Value); err != nil {
-				errRollback := tx.Rollback(ctx)
-				if errRollback != nil {
-					return errRollback
-				}
+		selected := make(map[string]*selection)
+		for rows.Next() {
+			var mType, key, name string
+			var updatedAt time.Time
+			if err := rows.Scan(&mType, &key, &name, &updatedAt); err != nil {
+				rows.Close()
 				return err
 			}
-		}
-		for _, counterMetric := range countersBatch {
-			if _, err := tx.Exec(ctx, insertCounterSQL, counterMetric.Name, counterMetric.Value); err != nil {
-				errRollback := tx.Rollback(ctx)
-				if errRollback != nil {
-					return errRollback
+			if match(mType, name, updatedAt) {
+				if selected[mType] == nil {
+					selected[mType] = &selection{updatedAt: []time.Time{}}
 				}
+				selected[mType].ids = append(selected[mType].ids, key)
+				selected[mType].updatedAt = append(selected[mType].updatedAt, updatedAt)
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		deleted, err = d.deleteMetrics(ctx, selected)
+		return err
+	}
+	err := executeWithBackoff(f)
+	return deleted, err
+}
+
+// deleteMetrics удаляет метрики и историю удаленных метрик в одной транзакции; метрики сгруппированы по типу.
+func (d *Database) deleteMetrics(ctx context.Context, selected map[string]*selection) (int, error) {
+	if len(selected) == 0 {
+		return 0, nil
+	}
+	var deleted int
+	err := d.inTransaction(ctx, func(tx pgx.Tx) error {
+		for mType, metrics := range selected {
+			var rows pgx.Rows
+			var err error
+			if metrics.updatedAt != nil {
+				rows, err = tx.Query(ctx, fmt.Sprintf(deleteUnchangedMetricSQL, metricTables[mType]), metrics.ids, metrics.updatedAt)
+			} else {
+				rows, err = tx.Query(ctx, fmt.Sprintf(deleteMetricSQL, metricTables[mType]), metrics.ids)
+			}
+			if err != nil {
 				return err
 			}
+			ids, err := pgx.CollectRows(rows, pgx.RowTo[string])
+			if err != nil {
+				return err
+			}
+			deleted += len(ids)
+			if _, err = tx.Exec(ctx, deleteMetricHistorySQL, mType, ids); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return deleted, err
+}
+
+// decodeDistribution декодирует значение метрики типа histogram или summary; метрики других типов не изменяются.
+func decodeDistribution(metric *storage.Metric, value []byte) error {
+	switch metric.MType {
+	case "histogram":
+		metric.Histogram = &distribution.Histogram{}
+		return json.Unmarshal(value, metric.Histogram)
+	case "summary":
+		metric.Summary = &distribution.Sketch{}
+		if err := json.Unmarshal(value, metric.Summary); err != nil {
+			return err
 		}
-		return tx.Commit(ctx)
+		return metric.Summary.Validate()
+	}
+	return nil
+}
+
+// jsonLabels возвращает метки для записи в столбец labels; отсутствие меток записывается как пустой объект.
+func jsonLabels(labels map[string]string) map[string]string {
+	if labels == nil {
+		return map[string]string{}
 	}
-	return executeWithBackoff(f)
+	return labels
 }
 
 // executeWithBackoff выполняет операцию несколько раз с интервалом
@@ -202,7 +668,7 @@ func executeWithBackoff(f func() error) error {
 	expBackoff.RandomizationFactor = 0
 	err := backoff.Retry(f, expBackoff)
 	if err != nil {
-		return fmt.Errorf("failed to connect to database after retrying: %v", err)
+		return fmt.Errorf("failed to connect to database after retrying: %w", err)
 	}
 	return err
 }
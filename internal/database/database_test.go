@@ -0,0 +1,168 @@
+package database
+
+import (
+	"context"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	config "github.com/justEngineer/go-metrics-service/internal/http/server/config"
+	"github.com/justEngineer/go-metrics-service/internal/storage"
+	"github.com/justEngineer/go-metrics-service/internal/storage/storagetest"
+)
+
+// connect подключается к PostgreSQL из переменной TEST_DATABASE_DSN и очищает таблицы метрик.
+func connect(t *testing.T) *Database {
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN is not set")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	db, err := NewConnection(ctx, &config.ServerConfig{DatabaseDSN: dsn})
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	_, err = db.Connections.Exec(ctx, `TRUNCATE gauge_metrics, counter_metrics, histogram_metrics, summary_metrics,
+		metric_series, metric_samples, metric_rollups_1m, metric_rollups_1h`)
+	require.NoError(t, err)
+	_, err = db.Connections.Exec(ctx, `UPDATE metric_rollup_state SET rolled_up_to = 'epoch'`)
+	require.NoError(t, err)
+	return db
+}
+
+// TestConformance требует запущенного PostgreSQL, строка подключения задается переменной TEST_DATABASE_DSN.
+func TestConformance(t *testing.T) {
+	if os.Getenv("TEST_DATABASE_DSN") == "" {
+		t.Skip("TEST_DATABASE_DSN is not set")
+	}
+	storagetest.Run(t, func(t *testing.T) storage.Backend {
+		return connect(t)
+	})
+}
+
+func TestRollups(t *testing.T) {
+	db := connect(t)
+	ctx := context.Background()
+	require.NoError(t, db.Set(ctx, storage.NewGauge("temperature", 10)))
+
+	// значения вне суточных секций записываются в секцию по умолчанию
+	past := time.Now().Add(-90 * time.Minute).Truncate(time.Minute)
+	for i, value := range []float64{3, 1, 2} {
+		_, err := db.Connections.Exec(ctx, `INSERT INTO metric_samples (series_id, ts, value)
+			SELECT id, $1, $2 FROM metric_series WHERE type = 'gauge' AND key = 'temperature'`,
+			past.Add(time.Duration(i)*time.Second), value)
+		require.NoError(t, err)
+	}
+	require.NoError(t, db.maintain(ctx, time.Now()))
+
+	var min, max, sum, last float64
+	var count int64
+	row := db.Connections.QueryRow(ctx, `SELECT min, max, sum, count, last FROM metric_rollups_1m WHERE bucket = $1`, past)
+	require.NoError(t, row.Scan(&min, &max, &sum, &count, &last))
+	assert.Equal(t, []float64{1, 3, 6, 2}, []float64{min, max, sum, last})
+	assert.Equal(t, int64(3), count)
+
+	// исходные значения старше времени хранения читаются из минутных агрегатов, свежие — из неагрегированного хвоста
+	db.historyRetention = time.Hour
+	samples, err := db.GetMetricHistory(ctx, "gauge", "temperature", past.Add(-time.Minute), time.Now(), 0)
+	require.NoError(t, err)
+	require.Len(t, samples, 2)
+	assert.True(t, past.Equal(samples[0].Timestamp))
+	assert.Equal(t, 2.0, samples[0].Value)
+	assert.Equal(t, 10.0, samples[1].Value)
+
+	samples, err = db.GetMetricHistory(ctx, "gauge", "temperature", past.Add(-time.Hour), time.Now(), time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, 10.0, samples[len(samples)-1].Value)
+
+	require.NoError(t, db.Delete(ctx, "gauge", "temperature"))
+	_, err = db.GetMetricHistory(ctx, "gauge", "temperature", past.Add(-time.Hour), time.Now(), time.Minute)
+	assert.ErrorIs(t, err, storage.ErrMetricNotFound)
+}
+
+func TestCreatePartitionMovesDefaultRows(t *testing.T) {
+	db := connect(t)
+	ctx := context.Background()
+	require.NoError(t, db.Set(ctx, storage.NewGauge("temperature", 10)))
+
+	// секции на эти сутки еще нет, значение записывается в секцию по умолчанию
+	start := time.Now().UTC().Truncate(partitionSpan).Add(10 * partitionSpan)
+	_, err := db.Connections.Exec(ctx, "DROP TABLE IF EXISTS "+partitionName(start))
+	require.NoError(t, err)
+	_, err = db.Connections.Exec(ctx, `INSERT INTO metric_samples (series_id, ts, value)
+		SELECT id, $1, 1 FROM metric_series WHERE type = 'gauge' AND key = 'temperature'`, start.Add(time.Hour))
+	require.NoError(t, err)
+
+	require.NoError(t, db.createPartition(ctx, start))
+	require.NoError(t, db.createPartition(ctx, start), "existing partition is kept")
+	t.Cleanup(func() { db.Connections.Exec(context.Background(), "DROP TABLE IF EXISTS "+partitionName(start)) })
+	var moved, left int
+	require.NoError(t, db.Connections.QueryRow(ctx, "SELECT count(*) FROM "+partitionName(start)).Scan(&moved))
+	require.NoError(t, db.Connections.QueryRow(ctx, "SELECT count(*) FROM "+defaultPartition).Scan(&left))
+	assert.Equal(t, 1, moved)
+	assert.Equal(t, 0, left)
+}
+
+func TestListQuery(t *testing.T) {
+	filter := storage.ListFilter{Type: "gauge", Prefix: "host_"}
+	require.NoError(t, filter.Normalize())
+	query, args := listQuery(filter)
+	assert.NotContains(t, query, "~", "patterns are matched in Go")
+	assert.True(t, strings.HasSuffix(query, " ORDER BY name ASC, id ASC, type ASC LIMIT 101"), query)
+	assert.Equal(t, []any{"gauge", "host_"}, args)
+
+	updatedAt := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	filter = storage.ListFilter{
+		Pattern: regexp.MustCompile(`^host_\d+$`),
+		Sort:    storage.SortByUpdated,
+		Desc:    true,
+		After:   &storage.ListCursor{Sort: storage.SortByUpdated, Desc: true, UpdatedAt: updatedAt, Key: "host_1", Type: "gauge"},
+		Limit:   10,
+	}
+	require.NoError(t, filter.Normalize())
+	query, args = listQuery(filter)
+	assert.Contains(t, query, " AND (updated_at, id, type) < ($3, $4, $5)")
+	assert.True(t, strings.HasSuffix(query, " ORDER BY updated_at DESC, id DESC, type DESC"), "rows filtered by pattern are not limited: %s", query)
+	assert.Equal(t, []any{"", "", updatedAt, "host_1", "gauge"}, args)
+}
+
+func TestHistoryResolution(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	db := &Database{historyRetention: 3 * time.Hour, minuteRetention: 7 * 24 * time.Hour, hourRetention: 90 * 24 * time.Hour}
+	tests := []struct {
+		name string
+		from time.Time
+		step time.Duration
+		want time.Duration
+	}{
+		{name: "recent raw", from: now.Add(-time.Hour), step: 10 * time.Second, want: rawResolution},
+		{name: "recent coarse step", from: now.Add(-time.Hour), step: 5 * time.Minute, want: minuteResolution},
+		{name: "raw expired", from: now.Add(-4 * time.Hour), step: 0, want: minuteResolution},
+		{name: "hourly step", from: now.Add(-time.Hour), step: time.Hour, want: hourResolution},
+		{name: "minutes expired", from: now.Add(-30 * 24 * time.Hour), step: time.Minute, want: hourResolution},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, db.historyResolution(tt.from, tt.step, now))
+		})
+	}
+	unlimited := &Database{}
+	assert.Equal(t, rawResolution, unlimited.historyResolution(now.AddDate(-1, 0, 0), 0, now))
+}
+
+func TestPartitionName(t *testing.T) {
+	start := time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)
+	name := partitionName(start)
+	assert.Equal(t, "metric_samples_p20261018", name)
+	parsed, ok := parsePartitionName(name)
+	require.True(t, ok)
+	assert.True(t, start.Equal(parsed))
+	_, ok = parsePartitionName("metric_samples_default")
+	assert.False(t, ok)
+}
@@ -0,0 +1,380 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/justEngineer/go-metrics-service/internal/storage"
+)
+
+// Разрешения, с которыми хранится история значений метрик: исходные значения и агрегаты за минуту и за час.
+const (
+	rawResolution    = time.Duration(0)
+	minuteResolution = time.Minute
+	hourResolution   = time.Hour
+)
+
+// historyMaintenanceInterval интервал агрегации истории и удаления устаревших значений.
+const historyMaintenanceInterval = time.Minute
+
+// Секции таблицы metric_samples охватывают сутки UTC и называются metric_samples_pYYYYMMDD.
+// Значения, для которых секция еще не создана, например если обслуживание не выполнялось несколько суток,
+// записываются в секцию по умолчанию и переносятся в суточную секцию при ее создании.
+const (
+	partitionSpan      = 24 * time.Hour
+	partitionPrefix    = "metric_samples_p"
+	partitionLayout    = "20060102"
+	partitionLookahead = 3
+	defaultPartition   = "metric_samples_default"
+)
+
+// Запросы для обслуживания истории значений метрик.
+const (
+	selectNowSQL = `SELECT now()`
+
+	// lockDefaultPartitionSQL не дает экземплярам сервера создавать секции одновременно.
+	lockDefaultPartitionSQL = `LOCK TABLE ` + defaultPartition + ` IN SHARE ROW EXCLUSIVE MODE`
+
+	partitionExistsSQL = `SELECT to_regclass($1) IS NOT NULL`
+
+	createPartitionSQL = `CREATE TABLE %s (LIKE metric_samples INCLUDING DEFAULTS INCLUDING CONSTRAINTS)`
+
+	// movePartitionRowsSQL переносит в новую секцию значения ее интервала, записанные в секцию по умолчанию.
+	movePartitionRowsSQL = `WITH moved AS (
+		DELETE FROM ` + defaultPartition + ` WHERE ts >= $1 AND ts < $2 RETURNING series_id, ts, value
+	)
+	INSERT INTO %s (series_id, ts, value) SELECT series_id, ts, value FROM moved`
+
+	attachPartitionSQL = `ALTER TABLE metric_samples ATTACH PARTITION %s FOR VALUES FROM ('%s') TO ('%s')`
+
+	deleteDefaultPartitionSQL = `DELETE FROM ` + defaultPartition + ` WHERE ts < $1`
+
+	selectPartitionsSQL = `SELECT c.relname FROM pg_inherits i
+	JOIN pg_class c ON c.oid = i.inhrelid
+	WHERE i.inhparent = 'metric_samples'::regclass`
+
+	selectRollupStateSQL = `SELECT rolled_up_to FROM metric_rollup_state WHERE resolution = $1`
+
+	updateRollupStateSQL = `UPDATE metric_rollup_state SET rolled_up_to = $2 WHERE resolution = $1`
+
+	// lockMinuteRollupSQL возвращает интервал исходных значений, готовых к агрегации по минутам. Минута агрегируется
+	// через минуту после ее окончания по часам базы данных, чтобы успели зафиксироваться записавшие в нее транзакции.
+	lockMinuteRollupSQL = `SELECT rolled_up_to, date_trunc('minute', now() - interval '1 minute', 'UTC')
+	FROM metric_rollup_state WHERE resolution = '1m' FOR UPDATE`
+
+	// lockHourRollupSQL возвращает интервал минутных агрегатов, готовых к агрегации по часам.
+	lockHourRollupSQL = `SELECT rolled_up_to,
+		date_trunc('hour', (SELECT rolled_up_to FROM metric_rollup_state WHERE resolution = '1m'), 'UTC')
+	FROM metric_rollup_state WHERE resolution = '1h' FOR UPDATE`
+
+	rollupMinutesSQL = `INSERT INTO metric_rollups_1m AS r (series_id, bucket, min, max, sum, count, last, last_ts)
+	SELECT series_id, date_trunc('minute', ts, 'UTC'), min(value), max(value), sum(value), count(*),
+		(array_agg(value ORDER BY ts DESC))[1], max(ts)
+	FROM metric_samples
+	WHERE ts >= $1 AND ts < $2
+	GROUP BY 1, 2
+	ON CONFLICT (series_id, bucket) DO UPDATE SET ` + mergeRollupSQL
+
+	rollupHoursSQL = `INSERT INTO metric_rollups_1h AS r (series_id, bucket, min, max, sum, count, last, last_ts)
+	SELECT series_id, date_trunc('hour', bucket, 'UTC'), min(min), max(max), sum(sum), sum(count),
+		(array_agg(last ORDER BY last_ts DESC))[1], max(last_ts)
+	FROM metric_rollups_1m
+	WHERE bucket >= $1 AND bucket < $2
+	GROUP BY 1, 2
+	ON CONFLICT (series_id, bucket) DO UPDATE SET ` + mergeRollupSQL
+
+	// mergeRollupSQL сливает агрегат с уже сохраненным агрегатом того же интервала.
+	mergeRollupSQL = `min = LEAST(r.min, EXCLUDED.min), max = GREATEST(r.max, EXCLUDED.max),
+		sum = r.sum + EXCLUDED.sum, count = r.count + EXCLUDED.count,
+		last = CASE WHEN EXCLUDED.last_ts >= r.last_ts THEN EXCLUDED.last ELSE r.last END,
+		last_ts = GREATEST(r.last_ts, EXCLUDED.last_ts)`
+
+	deleteRollupsSQL = `DELETE FROM %s WHERE bucket < $1`
+
+	seriesExistsSQL = `SELECT EXISTS (SELECT 1 FROM metric_series WHERE type = $1 AND key = $2)`
+
+	// Запросы истории возвращают время, значение и номер источника. Значения, еще не вошедшие в агрегаты,
+	// агрегируются при чтении; при совпадении времени более свежий источник следует последним.
+	selectRawHistorySQL = `SELECT ts, value, 0 FROM metric_samples
+	WHERE series_id = (SELECT id FROM metric_series WHERE type = $1 AND key = $2) AND ts BETWEEN $3 AND $4
+	ORDER BY 1`
+
+	selectMinuteHistorySQL = `WITH series AS (
+		SELECT id FROM metric_series WHERE type = $1 AND key = $2
+	)
+	SELECT bucket, last, 0 FROM metric_rollups_1m
+	WHERE series_id = (SELECT id FROM series) AND bucket BETWEEN $3 AND $4
+	UNION ALL
+	SELECT date_trunc('minute', ts, 'UTC'), (array_agg(value ORDER BY ts DESC))[1], 1 FROM metric_samples
+	WHERE series_id = (SELECT id FROM series) AND ts BETWEEN $3 AND $4
+		AND ts >= (SELECT rolled_up_to FROM metric_rollup_state WHERE resolution = '1m')
+	GROUP BY 1
+	ORDER BY 1, 3`
+
+	selectHourHistorySQL = `WITH series AS (
+		SELECT id FROM metric_series WHERE type = $1 AND key = $2
+	)
+	SELECT bucket, last, 0 FROM metric_rollups_1h
+	WHERE series_id = (SELECT id FROM series) AND bucket BETWEEN $3 AND $4
+	UNION ALL
+	SELECT date_trunc('hour', bucket, 'UTC'), (array_agg(last ORDER BY last_ts DESC))[1], 1 FROM metric_rollups_1m
+	WHERE series_id = (SELECT id FROM series) AND bucket BETWEEN $3 AND $4
+		AND bucket >= (SELECT rolled_up_to FROM metric_rollup_state WHERE resolution = '1h')
+	GROUP BY 1
+	UNION ALL
+	SELECT date_trunc('hour', ts, 'UTC'), (array_agg(value ORDER BY ts DESC))[1], 2 FROM metric_samples
+	WHERE series_id = (SELECT id FROM series) AND ts BETWEEN $3 AND $4
+		AND ts >= (SELECT rolled_up_to FROM metric_rollup_state WHERE resolution = '1m')
+	GROUP BY 1
+	ORDER BY 1, 3`
+)
+
+// historyQueries запросы истории для каждого разрешения.
+var historyQueries = map[time.Duration]string{
+	rawResolution:    selectRawHistorySQL,
+	minuteResolution: selectMinuteHistorySQL,
+	hourResolution:   selectHourHistorySQL,
+}
+
+// GetMetricHistory извлекает значения метрики из интервала [from, to], прореженные с шагом step.
+// Разрешение выбирается по from и step: исходные значения, пока они хранятся и шаг меньше минуты,
+// затем последние значения минутных, а после них часовых агрегатов. Для существующего ряда без значений
+// в интервале возвращается пустой результат, для отсутствующего - ошибка с ErrMetricNotFound.
+func (d *Database) GetMetricHistory(ctx context.Context, mType string, key string, from, to time.Time, step time.Duration) ([]storage.Sample, error) {
+	query := historyQueries[d.historyResolution(from, step, time.Now())]
+	var samples []storage.Sample
+	f := func() error {
+		rows, err := d.Connections.Query(ctx, query, mType, key, from, to)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		samples = samples[:0]
+		for rows.Next() {
+			var sample storage.Sample
+			var source int
+			if err := rows.Scan(&sample.Timestamp, &sample.Value, &source); err != nil {
+				return err
+			}
+			if n := len(samples); n > 0 && samples[n-1].Timestamp.Equal(sample.Timestamp) {
+				samples[n-1].Value = sample.Value
+				continue
+			}
+			samples = append(samples, sample)
+		}
+		return rows.Err()
+	}
+	if err := executeWithBackoff(f); err != nil {
+		return nil, err
+	}
+	if len(samples) == 0 {
+		var exists bool
+		f := func() error {
+			return d.Connections.QueryRow(ctx, seriesExistsSQL, mType, key).Scan(&exists)
+		}
+		if err := executeWithBackoff(f); err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, fmt.Errorf("%w: %s %v", storage.ErrMetricNotFound, mType, key)
+		}
+		return nil, nil
+	}
+	return storage.Downsample(samples, from, step), nil
+}
+
+// historyResolution возвращает самое подробное разрешение истории, которое хранится начиная с from
+// и не подробнее шага step. Нулевое время хранения означает хранение без ограничения.
+func (d *Database) historyResolution(from time.Time, step time.Duration, now time.Time) time.Duration {
+	kept := func(retention time.Duration) bool {
+		return retention <= 0 || !from.Before(now.Add(-retention))
+	}
+	switch {
+	case step < minuteResolution && kept(d.historyRetention):
+		return rawResolution
+	case step < hourResolution && kept(d.minuteRetention):
+		return minuteResolution
+	default:
+		return hourResolution
+	}
+}
+
+// maintainHistory сразу и затем периодически агрегирует историю значений метрик и удаляет устаревшие значения
+// и агрегаты. Если migrate не nil, миграции не были применены при подключении, например база данных была
+// недоступна, и обслуживание начинается после их успешного применения.
+func (d *Database) maintainHistory(ctx context.Context, migrate func() error) {
+	ticker := time.NewTicker(historyMaintenanceInterval)
+	defer ticker.Stop()
+	for {
+		if migrate != nil && migrate() == nil {
+			migrate = nil
+		}
+		if migrate == nil {
+			// при ошибке обслуживание повторится на следующем срабатывании таймера
+			_ = d.maintain(ctx, time.Now())
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// maintain создает секции для новых значений, агрегирует значения и удаляет устаревшие данные.
+// Шаги выполняются независимо: удаление сверяется с границами агрегации и не теряет неагрегированные значения.
+func (d *Database) maintain(ctx context.Context, now time.Time) error {
+	return errors.Join(
+		d.createPartitions(ctx),
+		d.rollup(ctx),
+		d.dropPartitions(ctx, now),
+		d.deleteRollups(ctx, now),
+	)
+}
+
+// createPartitions создает секции metric_samples на текущие и следующие сутки по часам базы данных,
+// которыми заполняется время значений.
+func (d *Database) createPartitions(ctx context.Context) error {
+	var now time.Time
+	if err := d.Connections.QueryRow(ctx, selectNowSQL).Scan(&now); err != nil {
+		return fmt.Errorf("reading database time failed: %w", err)
+	}
+	day := now.UTC().Truncate(partitionSpan)
+	for i := 0; i < partitionLookahead; i++ {
+		if err := d.createPartition(ctx, day.Add(time.Duration(i)*partitionSpan)); err != nil {
+			return fmt.Errorf("creating history partition failed: %w", err)
+		}
+	}
+	return nil
+}
+
+// createPartition создает секцию metric_samples на сутки, начинающиеся в момент start, если ее еще нет.
+// Секция создается отдельной таблицей и присоединяется после переноса в нее значений из секции по умолчанию:
+// иначе присоединение завершилось бы ошибкой из-за значений ее интервала в секции по умолчанию.
+func (d *Database) createPartition(ctx context.Context, start time.Time) error {
+	name := partitionName(start)
+	from, to := start.Format(time.RFC3339), start.Add(partitionSpan).Format(time.RFC3339)
+	return d.inTransaction(ctx, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, lockDefaultPartitionSQL); err != nil {
+			return err
+		}
+		var exists bool
+		if err := tx.QueryRow(ctx, partitionExistsSQL, name).Scan(&exists); err != nil || exists {
+			return err
+		}
+		if _, err := tx.Exec(ctx, fmt.Sprintf(createPartitionSQL, name)); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, fmt.Sprintf(movePartitionRowsSQL, name), start, start.Add(partitionSpan)); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, fmt.Sprintf(attachPartitionSQL, name, from, to))
+		return err
+	})
+}
+
+// rollup агрегирует завершенные минуты исходных значений и завершенные часы минутных агрегатов.
+// Границы агрегации хранятся в metric_rollup_state, блокировка строк не дает экземплярам сервера агрегировать одновременно.
+func (d *Database) rollup(ctx context.Context) error {
+	return d.inTransaction(ctx, func(tx pgx.Tx) error {
+		if err := rollupResolution(ctx, tx, "1m", lockMinuteRollupSQL, rollupMinutesSQL); err != nil {
+			return err
+		}
+		return rollupResolution(ctx, tx, "1h", lockHourRollupSQL, rollupHoursSQL)
+	})
+}
+
+// rollupResolution агрегирует данные от сохраненной границы до границы, возвращенной lockSQL, и сдвигает границу.
+func rollupResolution(ctx context.Context, tx pgx.Tx, resolution string, lockSQL string, rollupSQL string) error {
+	var from, to time.Time
+	if err := tx.QueryRow(ctx, lockSQL).Scan(&from, &to); err != nil {
+		return fmt.Errorf("locking %s rollup failed: %w", resolution, err)
+	}
+	if !to.After(from) {
+		return nil
+	}
+	if _, err := tx.Exec(ctx, rollupSQL, from, to); err != nil {
+		return fmt.Errorf("%s rollup failed: %w", resolution, err)
+	}
+	_, err := tx.Exec(ctx, updateRollupStateSQL, resolution, to)
+	return err
+}
+
+// dropPartitions удаляет секции, все значения которых старше historyRetention и уже вошли в минутные агрегаты,
+// и такие же значения секции по умолчанию.
+func (d *Database) dropPartitions(ctx context.Context, now time.Time) error {
+	if d.historyRetention <= 0 {
+		return nil
+	}
+	var rolledUpTo time.Time
+	if err := d.Connections.QueryRow(ctx, selectRollupStateSQL, "1m").Scan(&rolledUpTo); err != nil {
+		return err
+	}
+	border := now.Add(-d.historyRetention)
+	if rolledUpTo.Before(border) {
+		border = rolledUpTo
+	}
+	if _, err := d.Connections.Exec(ctx, deleteDefaultPartitionSQL, border); err != nil {
+		return fmt.Errorf("deleting history from default partition failed: %w", err)
+	}
+	rows, err := d.Connections.Query(ctx, selectPartitionsSQL)
+	if err != nil {
+		return err
+	}
+	names, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		start, ok := parsePartitionName(name)
+		if !ok || start.Add(partitionSpan).After(border) {
+			continue
+		}
+		if _, err := d.Connections.Exec(ctx, "DROP TABLE IF EXISTS "+partitionName(start)); err != nil {
+			return fmt.Errorf("dropping history partition failed: %w", err)
+		}
+	}
+	return nil
+}
+
+// deleteRollups удаляет агрегаты старше времени их хранения. Минутные агрегаты, еще не вошедшие в часовые, сохраняются.
+func (d *Database) deleteRollups(ctx context.Context, now time.Time) error {
+	var errs []error
+	if d.minuteRetention > 0 {
+		var rolledUpTo time.Time
+		err := d.Connections.QueryRow(ctx, selectRollupStateSQL, "1h").Scan(&rolledUpTo)
+		if err == nil {
+			border := now.Add(-d.minuteRetention)
+			if rolledUpTo.Before(border) {
+				border = rolledUpTo
+			}
+			_, err = d.Connections.Exec(ctx, fmt.Sprintf(deleteRollupsSQL, "metric_rollups_1m"), border)
+		}
+		errs = append(errs, err)
+	}
+	if d.hourRetention > 0 {
+		_, err := d.Connections.Exec(ctx, fmt.Sprintf(deleteRollupsSQL, "metric_rollups_1h"), now.Add(-d.hourRetention))
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// partitionName возвращает имя секции metric_samples, начинающейся в момент start.
+func partitionName(start time.Time) string {
+	return partitionPrefix + start.UTC().Format(partitionLayout)
+}
+
+// parsePartitionName возвращает начало секции metric_samples по ее имени; секции с другими именами не обслуживаются.
+func parsePartitionName(name string) (time.Time, bool) {
+	day, found := strings.CutPrefix(name, partitionPrefix)
+	if !found {
+		return time.Time{}, false
+	}
+	start, err := time.Parse(partitionLayout, day)
+	return start, err == nil
+}
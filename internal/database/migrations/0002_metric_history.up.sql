@@ -0,0 +1,7 @@
+CREATE TABLE metric_history (
+		type    VARCHAR (16) NOT NULL,
+		id      VARCHAR (255) NOT NULL,
+		ts      TIMESTAMPTZ NOT NULL DEFAULT now(),
+		value   DOUBLE PRECISION NOT NULL
+	);
+	CREATE INDEX metric_history_type_id_ts_idx ON metric_history (type, id, ts);
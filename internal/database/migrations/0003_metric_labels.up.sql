@@ -0,0 +1,13 @@
+ALTER TABLE gauge_metrics ALTER COLUMN id TYPE TEXT;
+	ALTER TABLE gauge_metrics ADD COLUMN name TEXT;
+	ALTER TABLE gauge_metrics ADD COLUMN labels JSONB NOT NULL DEFAULT '{}';
+	UPDATE gauge_metrics SET name = id;
+	ALTER TABLE gauge_metrics ALTER COLUMN name SET NOT NULL;
+
+	ALTER TABLE counter_metrics ALTER COLUMN id TYPE TEXT;
+	ALTER TABLE counter_metrics ADD COLUMN name TEXT;
+	ALTER TABLE counter_metrics ADD COLUMN labels JSONB NOT NULL DEFAULT '{}';
+	UPDATE counter_metrics SET name = id;
+	ALTER TABLE counter_metrics ALTER COLUMN name SET NOT NULL;
+
+	ALTER TABLE metric_history ALTER COLUMN id TYPE TEXT;
@@ -0,0 +1,12 @@
+CREATE TABLE histogram_metrics (
+		id      TEXT PRIMARY KEY,
+		name    TEXT NOT NULL,
+		labels  JSONB NOT NULL DEFAULT '{}',
+		value   JSONB NOT NULL
+	);
+	CREATE TABLE summary_metrics (
+		id      TEXT PRIMARY KEY,
+		name    TEXT NOT NULL,
+		labels  JSONB NOT NULL DEFAULT '{}',
+		value   JSONB NOT NULL
+	);
@@ -0,0 +1,4 @@
+ALTER TABLE gauge_metrics ADD COLUMN updated_at TIMESTAMPTZ NOT NULL DEFAULT now();
+	ALTER TABLE counter_metrics ADD COLUMN updated_at TIMESTAMPTZ NOT NULL DEFAULT now();
+	ALTER TABLE histogram_metrics ADD COLUMN updated_at TIMESTAMPTZ NOT NULL DEFAULT now();
+	ALTER TABLE summary_metrics ADD COLUMN updated_at TIMESTAMPTZ NOT NULL DEFAULT now();
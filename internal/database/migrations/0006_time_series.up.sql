@@ -0,0 +1,57 @@
+CREATE TABLE metric_series (
+		id      BIGSERIAL PRIMARY KEY,
+		type    VARCHAR (16) NOT NULL,
+		key     TEXT NOT NULL,
+		name    TEXT NOT NULL,
+		labels  JSONB NOT NULL DEFAULT '{}',
+		UNIQUE (type, key)
+	);
+	CREATE TABLE metric_samples (
+		series_id  BIGINT NOT NULL,
+		ts         TIMESTAMPTZ NOT NULL,
+		value      DOUBLE PRECISION NOT NULL
+	) PARTITION BY RANGE (ts);
+	CREATE TABLE metric_samples_default PARTITION OF metric_samples DEFAULT;
+	CREATE INDEX metric_samples_series_id_ts_idx ON metric_samples (series_id, ts);
+	CREATE TABLE metric_rollups_1m (
+		series_id  BIGINT NOT NULL REFERENCES metric_series (id) ON DELETE CASCADE,
+		bucket     TIMESTAMPTZ NOT NULL,
+		min        DOUBLE PRECISION NOT NULL,
+		max        DOUBLE PRECISION NOT NULL,
+		sum        DOUBLE PRECISION NOT NULL,
+		count      BIGINT NOT NULL,
+		last       DOUBLE PRECISION NOT NULL,
+		last_ts    TIMESTAMPTZ NOT NULL,
+		PRIMARY KEY (series_id, bucket)
+	);
+	CREATE TABLE metric_rollups_1h (
+		series_id  BIGINT NOT NULL REFERENCES metric_series (id) ON DELETE CASCADE,
+		bucket     TIMESTAMPTZ NOT NULL,
+		min        DOUBLE PRECISION NOT NULL,
+		max        DOUBLE PRECISION NOT NULL,
+		sum        DOUBLE PRECISION NOT NULL,
+		count      BIGINT NOT NULL,
+		last       DOUBLE PRECISION NOT NULL,
+		last_ts    TIMESTAMPTZ NOT NULL,
+		PRIMARY KEY (series_id, bucket)
+	);
+	CREATE INDEX metric_rollups_1m_bucket_idx ON metric_rollups_1m (bucket);
+	CREATE INDEX metric_rollups_1h_bucket_idx ON metric_rollups_1h (bucket);
+	CREATE TABLE metric_rollup_state (
+		resolution    VARCHAR (8) PRIMARY KEY,
+		rolled_up_to  TIMESTAMPTZ NOT NULL
+	);
+	INSERT INTO metric_rollup_state (resolution, rolled_up_to) VALUES ('1m', 'epoch'), ('1h', 'epoch');
+
+	INSERT INTO metric_series (type, key, name, labels)
+	SELECT 'gauge', id, name, labels FROM gauge_metrics
+	UNION ALL
+	SELECT 'counter', id, name, labels FROM counter_metrics;
+
+	-- накопленная история копируется в минутные агрегаты, часовые построит фоновая агрегация;
+	-- таблица metric_history больше не используется и сохраняется, чтобы откат к прежней версии не терял историю
+	INSERT INTO metric_rollups_1m (series_id, bucket, min, max, sum, count, last, last_ts)
+	SELECT s.id, date_trunc('minute', h.ts, 'UTC'), min(h.value), max(h.value), sum(h.value), count(*),
+		(array_agg(h.value ORDER BY h.ts DESC))[1], max(h.ts)
+	FROM metric_history h JOIN metric_series s ON s.type = h.type AND s.key = h.id
+	GROUP BY s.id, date_trunc('minute', h.ts, 'UTC');
@@ -0,0 +1,139 @@
+// Package dedup отслеживает номера пакетов агентов, чтобы повторно доставленные пакеты не применялись дважды.
+// Агент при запуске выбирает случайный идентификатор экземпляра и нумерует пакеты с единицы,
+// поэтому новый идентификатор означает перезапуск агента.
+package dedup
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Заголовки HTTP запроса с идентификатором экземпляра агента и номером пакета.
+const (
+	HeaderAgentID  = "X-Agent-ID"
+	HeaderSequence = "X-Agent-Seq"
+)
+
+// DefaultTTL время, после которого сервер забывает неактивный экземпляр агента.
+const DefaultTTL = 24 * time.Hour
+
+// agentState последний примененный пакет экземпляра агента и пакеты, которые применяются сейчас.
+type agentState struct {
+	seq     uint64
+	pending map[uint64]struct{}
+	seen    time.Time
+}
+
+// Status результат резервирования пакета методом Reserve.
+type Status int
+
+const (
+	// Reserved пакет еще не применялся и зарезервирован за вызывающим.
+	Reserved Status = iota
+	// Applied пакет уже применен.
+	Applied
+	// InProgress пакет применяется параллельным запросом, например повторной отправкой после таймаута.
+	InProgress
+)
+
+// Tracker хранит номер последнего примененного пакета каждого экземпляра агента.
+type Tracker struct {
+	mu        sync.Mutex
+	agents    map[string]*agentState
+	ttl       time.Duration
+	lastPrune time.Time
+	now       func() time.Time
+}
+
+// New создает Tracker, который забывает экземпляры агентов, не присылавшие пакеты дольше ttl.
+func New(ttl time.Duration) *Tracker {
+	return &Tracker{agents: make(map[string]*agentState), ttl: ttl, now: time.Now}
+}
+
+// FromHeader читает идентификатор экземпляра агента и номер пакета из заголовков запроса.
+// ok равен false, если агент их не передал.
+func FromHeader(header http.Header) (agentID string, seq uint64, ok bool, err error) {
+	agentID = header.Get(HeaderAgentID)
+	if agentID == "" {
+		return "", 0, false, nil
+	}
+	seq, err = strconv.ParseUint(header.Get(HeaderSequence), 10, 64)
+	if err != nil || seq == 0 {
+		return "", 0, false, fmt.Errorf("wrong %s header %q", HeaderSequence, header.Get(HeaderSequence))
+	}
+	return agentID, seq, true, nil
+}
+
+// SetHeader записывает идентификатор экземпляра агента и номер пакета в заголовки запроса.
+func SetHeader(header http.Header, agentID string, seq uint64) {
+	header.Set(HeaderAgentID, agentID)
+	header.Set(HeaderSequence, strconv.FormatUint(seq, 10))
+}
+
+// Reserve проверяет и резервирует пакет seq экземпляра agentID под одной блокировкой, поэтому
+// одновременные повторные доставки одного пакета не применяются обе. Агент отправляет пакеты строго
+// по порядку, поэтому применены все пакеты с номерами не больше последнего. Зарезервированный пакет
+// подтверждается Commit после применения или освобождается Release, если применить его не удалось.
+func (t *Tracker) Reserve(agentID string, seq uint64) Status {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	state, ok := t.agents[agentID]
+	if !ok {
+		state = &agentState{pending: make(map[uint64]struct{})}
+		t.agents[agentID] = state
+	}
+	state.seen = t.now()
+	if seq <= state.seq {
+		return Applied
+	}
+	if _, ok := state.pending[seq]; ok {
+		return InProgress
+	}
+	state.pending[seq] = struct{}{}
+	return Reserved
+}
+
+// Commit запоминает примененный зарезервированный пакет. Возвращает true для первого пакета нового экземпляра агента.
+func (t *Tracker) Commit(agentID string, seq uint64) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.now()
+	state, ok := t.agents[agentID]
+	if !ok {
+		state = &agentState{pending: make(map[uint64]struct{})}
+		t.agents[agentID] = state
+	}
+	first := state.seq == 0
+	delete(state.pending, seq)
+	if seq > state.seq {
+		state.seq = seq
+	}
+	state.seen = now
+	if now.Sub(t.lastPrune) > t.ttl/10 {
+		t.prune(now)
+	}
+	return first
+}
+
+// Release освобождает зарезервированный пакет, который не удалось применить, чтобы агент мог отправить его повторно.
+func (t *Tracker) Release(agentID string, seq uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if state, ok := t.agents[agentID]; ok {
+		delete(state.pending, seq)
+	}
+}
+
+// prune удаляет экземпляры агентов, не присылавшие пакеты дольше ttl и не применяющие пакеты сейчас;
+// вызывается под блокировкой.
+func (t *Tracker) prune(now time.Time) {
+	for agentID, state := range t.agents {
+		if now.Sub(state.seen) > t.ttl && len(state.pending) == 0 {
+			delete(t.agents, agentID)
+		}
+	}
+	t.lastPrune = now
+}
@@ -0,0 +1,54 @@
+package dedup
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTracker(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	tracker := New(time.Hour)
+	tracker.now = func() time.Time { return now }
+
+	assert.Equal(t, Reserved, tracker.Reserve("a", 1))
+	assert.Equal(t, InProgress, tracker.Reserve("a", 1), "concurrent delivery of the same batch")
+	assert.True(t, tracker.Commit("a", 1), "first batch of an instance")
+	assert.Equal(t, Applied, tracker.Reserve("a", 1))
+
+	assert.Equal(t, Reserved, tracker.Reserve("a", 2))
+	tracker.Release("a", 2)
+	assert.Equal(t, Reserved, tracker.Reserve("a", 2), "failed batch can be delivered again")
+	tracker.Release("a", 2)
+
+	assert.Equal(t, Reserved, tracker.Reserve("a", 3))
+	assert.False(t, tracker.Commit("a", 3))
+	assert.Equal(t, Applied, tracker.Reserve("a", 2), "batches are applied in order")
+	assert.Equal(t, Reserved, tracker.Reserve("b", 1), "instances are tracked separately")
+	tracker.Release("b", 1)
+
+	now = now.Add(2 * time.Hour)
+	tracker.Commit("b", 1)
+	assert.Equal(t, Reserved, tracker.Reserve("a", 3), "inactive instances are forgotten")
+}
+
+func TestHeader(t *testing.T) {
+	header := http.Header{}
+	_, _, ok, err := FromHeader(header)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	SetHeader(header, "a1", 42)
+	agentID, seq, ok, err := FromHeader(header)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "a1", agentID)
+	assert.Equal(t, uint64(42), seq)
+
+	header.Set(HeaderSequence, "0")
+	_, _, _, err = FromHeader(header)
+	assert.Error(t, err)
+}
@@ -0,0 +1,74 @@
+package distribution
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSketchQuantile(t *testing.T) {
+	first := NewSketch(DefaultRelativeAccuracy)
+	second := NewSketch(DefaultRelativeAccuracy)
+	for i := 1; i <= 1000; i++ {
+		if i%2 == 0 {
+			first.Add(float64(i))
+		} else {
+			second.Add(float64(i))
+		}
+	}
+	require.NoError(t, first.Merge(second))
+
+	testCases := []struct {
+		q        float64
+		expected float64
+	}{
+		{q: 0, expected: 1},
+		{q: 0.5, expected: 500},
+		{q: 0.9, expected: 900},
+		{q: 0.99, expected: 990},
+		{q: 1, expected: 1000},
+	}
+	for _, tc := range testCases {
+		actual := first.Quantile(tc.q)
+		assert.InDelta(t, tc.expected, actual, tc.expected*DefaultRelativeAccuracy+1, "q=%v", tc.q)
+	}
+	assert.Equal(t, uint64(1000), first.Count)
+	assert.Equal(t, float64(500500), first.Sum)
+	assert.ErrorIs(t, first.Merge(NewSketch(0.05)), ErrAccuracyMismatch)
+}
+
+func TestSketchValidate(t *testing.T) {
+	sketch := &Sketch{Values: []float64{-3, 0, 2}}
+	require.NoError(t, sketch.Validate())
+	assert.Equal(t, uint64(3), sketch.Count)
+	assert.Equal(t, -3.0, sketch.Min)
+	assert.Equal(t, 2.0, sketch.Max)
+	assert.InDelta(t, 0, sketch.Quantile(0.5), 1e-9)
+
+	assert.Error(t, (&Sketch{Count: 2}).Validate())
+	assert.Error(t, (&Sketch{Values: []float64{math.Inf(1)}}).Validate())
+	assert.Error(t, (&Sketch{Sum: math.NaN()}).Validate())
+}
+
+func TestHistogram(t *testing.T) {
+	histogram := &Histogram{Bounds: []float64{1, 2, 4}, Counts: []uint64{1, 2, 1, 0}}
+	require.NoError(t, histogram.Validate())
+	assert.Equal(t, uint64(4), histogram.Count)
+
+	other := NewHistogram([]float64{1, 2, 4})
+	other.Observe(3)
+	other.Observe(10)
+	require.NoError(t, histogram.Merge(other))
+	assert.Equal(t, []uint64{1, 2, 2, 1}, histogram.Counts)
+	assert.Equal(t, uint64(6), histogram.Count)
+	assert.InDelta(t, 2, histogram.Quantile(0.5), 1e-9)
+	assert.InDelta(t, 1.25, histogram.Quantile(0.25), 1e-9)
+	assert.Equal(t, 4.0, histogram.Quantile(0.99))
+
+	assert.ErrorIs(t, histogram.Merge(NewHistogram([]float64{1, 2})), ErrBucketsMismatch)
+	assert.Error(t, (&Histogram{Bounds: []float64{2, 1}}).Validate())
+	assert.Error(t, (&Histogram{Bounds: []float64{1}, Counts: []uint64{1, 1}, Count: 3}).Validate())
+	assert.Error(t, (&Histogram{Bounds: []float64{1}, Sum: math.Inf(-1)}).Validate())
+}
@@ -0,0 +1,127 @@
+// Package distribution предоставляет типы метрик, описывающие распределение значений:
+// гистограмму с заданными клиентом корзинами и скетч DDSketch для вычисления квантилей.
+package distribution
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// ErrBucketsMismatch возвращается при слиянии гистограмм с разными границами корзин.
+var ErrBucketsMismatch = errors.New("histogram buckets mismatch")
+
+// Histogram описывает распределение значений по корзинам.
+// Bounds содержит верхние границы корзин по возрастанию, Counts - количество значений
+// в каждой корзине (не накопленное); последний элемент Counts относится к корзине +Inf.
+type Histogram struct {
+	Bounds []float64 `json:"bounds"`
+	Counts []uint64  `json:"counts"`
+	Sum    float64   `json:"sum"`
+	Count  uint64    `json:"count"`
+}
+
+// NewHistogram создает пустую гистограмму с заданными границами корзин.
+func NewHistogram(bounds []float64) *Histogram {
+	return &Histogram{
+		Bounds: append([]float64(nil), bounds...),
+		Counts: make([]uint64, len(bounds)+1),
+	}
+}
+
+// Validate проверяет согласованность гистограммы и дополняет ее:
+// если количество значений не указано, оно вычисляется по корзинам.
+func (h *Histogram) Validate() error {
+	if len(h.Counts) == 0 {
+		h.Counts = make([]uint64, len(h.Bounds)+1)
+	}
+	if len(h.Counts) != len(h.Bounds)+1 {
+		return fmt.Errorf("histogram must have %d counts for %d bounds, got %d", len(h.Bounds)+1, len(h.Bounds), len(h.Counts))
+	}
+	for i := range h.Bounds {
+		if math.IsNaN(h.Bounds[i]) || math.IsInf(h.Bounds[i], 0) {
+			return fmt.Errorf("histogram bound must be finite, got %v", h.Bounds[i])
+		}
+		if i > 0 && h.Bounds[i] <= h.Bounds[i-1] {
+			return errors.New("histogram bounds must be sorted in increasing order")
+		}
+	}
+	var total uint64
+	for _, count := range h.Counts {
+		total += count
+	}
+	if h.Count == 0 {
+		h.Count = total
+	}
+	if h.Count != total {
+		return fmt.Errorf("histogram count %d doesn't match bucket counts sum %d", h.Count, total)
+	}
+	if math.IsNaN(h.Sum) || math.IsInf(h.Sum, 0) {
+		return fmt.Errorf("histogram sum must be finite, got %v", h.Sum)
+	}
+	return nil
+}
+
+// Observe добавляет значение в гистограмму.
+func (h *Histogram) Observe(value float64) {
+	idx := sort.SearchFloat64s(h.Bounds, value)
+	h.Counts[idx]++
+	h.Sum += value
+	h.Count++
+}
+
+// Merge добавляет к гистограмме значения другой гистограммы с такими же границами корзин.
+func (h *Histogram) Merge(other *Histogram) error {
+	if len(h.Bounds) != len(other.Bounds) || len(h.Counts) != len(other.Counts) {
+		return ErrBucketsMismatch
+	}
+	for i := range h.Bounds {
+		if h.Bounds[i] != other.Bounds[i] {
+			return ErrBucketsMismatch
+		}
+	}
+	for i := range h.Counts {
+		h.Counts[i] += other.Counts[i]
+	}
+	h.Sum += other.Sum
+	h.Count += other.Count
+	return nil
+}
+
+// Clone возвращает независимую копию гистограммы.
+func (h *Histogram) Clone() *Histogram {
+	return &Histogram{
+		Bounds: append([]float64(nil), h.Bounds...),
+		Counts: append([]uint64(nil), h.Counts...),
+		Sum:    h.Sum,
+		Count:  h.Count,
+	}
+}
+
+// Quantile оценивает квантиль q линейной интерполяцией внутри корзины, как это делает histogram_quantile в Prometheus.
+// Для значений из корзины +Inf возвращается наибольшая граница.
+func (h *Histogram) Quantile(q float64) float64 {
+	if h.Count == 0 || len(h.Bounds) == 0 || q < 0 || q > 1 {
+		return math.NaN()
+	}
+	rank := q * float64(h.Count)
+	var cumulative uint64
+	for i, count := range h.Counts {
+		if float64(cumulative+count) < rank || count == 0 {
+			cumulative += count
+			continue
+		}
+		if i == len(h.Bounds) {
+			return h.Bounds[len(h.Bounds)-1]
+		}
+		lower := 0.0
+		if i > 0 {
+			lower = h.Bounds[i-1]
+		} else if h.Bounds[0] <= 0 {
+			return h.Bounds[0]
+		}
+		return lower + (h.Bounds[i]-lower)*(rank-float64(cumulative))/float64(count)
+	}
+	return h.Bounds[len(h.Bounds)-1]
+}
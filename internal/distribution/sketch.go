@@ -0,0 +1,214 @@
+package distribution
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+const (
+	// DefaultRelativeAccuracy относительная точность квантилей скетча по умолчанию.
+	DefaultRelativeAccuracy = 0.01
+	// minIndexableValue наименьшее по модулю значение, которое не считается нулем.
+	minIndexableValue = 1e-9
+)
+
+// ErrAccuracyMismatch возвращается при слиянии скетчей с разной относительной точностью.
+var ErrAccuracyMismatch = errors.New("sketch relative accuracy mismatch")
+
+// Sketch реализует DDSketch: значения раскладываются по логарифмическим корзинам так,
+// что любой квантиль оценивается с относительной погрешностью не больше RelativeAccuracy.
+// Скетчи с одинаковой точностью сливаются без потери точности.
+// Клиент может передать как готовые корзины, так и необработанные значения в Values.
+type Sketch struct {
+	RelativeAccuracy float64        `json:"relative_accuracy"`
+	Positive         map[int]uint64 `json:"positive,omitempty"`
+	Negative         map[int]uint64 `json:"negative,omitempty"`
+	Zero             uint64         `json:"zero,omitempty"`
+	Count            uint64         `json:"count"`
+	Sum              float64        `json:"sum"`
+	Min              float64        `json:"min"`
+	Max              float64        `json:"max"`
+	Values           []float64      `json:"values,omitempty"`
+}
+
+// NewSketch создает пустой скетч с заданной относительной точностью.
+func NewSketch(relativeAccuracy float64) *Sketch {
+	return &Sketch{
+		RelativeAccuracy: relativeAccuracy,
+		Positive:         make(map[int]uint64),
+		Negative:         make(map[int]uint64),
+	}
+}
+
+// Validate проверяет скетч, полученный от клиента, и переносит необработанные значения в корзины.
+func (s *Sketch) Validate() error {
+	if s.RelativeAccuracy == 0 {
+		s.RelativeAccuracy = DefaultRelativeAccuracy
+	}
+	if s.RelativeAccuracy <= 0 || s.RelativeAccuracy >= 1 {
+		return fmt.Errorf("sketch relative accuracy must be in (0, 1), got %v", s.RelativeAccuracy)
+	}
+	if s.Positive == nil {
+		s.Positive = make(map[int]uint64)
+	}
+	if s.Negative == nil {
+		s.Negative = make(map[int]uint64)
+	}
+	total := s.Zero
+	for _, count := range s.Positive {
+		total += count
+	}
+	for _, count := range s.Negative {
+		total += count
+	}
+	if total != s.Count {
+		return fmt.Errorf("sketch count %d doesn't match bins count sum %d", s.Count, total)
+	}
+	for _, value := range []float64{s.Sum, s.Min, s.Max} {
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			return fmt.Errorf("sketch sum, min and max must be finite, got %v", value)
+		}
+	}
+	if s.Min > s.Max {
+		return fmt.Errorf("sketch min %v is greater than max %v", s.Min, s.Max)
+	}
+	if s.Count > 0 && s.Min == 0 && s.Max == 0 {
+		// границы не переданы клиентом: оцениваем их по крайним корзинам
+		s.Min, s.Max = s.binValue(0), s.binValue(s.Count-1)
+	}
+	values := s.Values
+	s.Values = nil
+	for _, value := range values {
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			return fmt.Errorf("sketch value must be finite, got %v", value)
+		}
+		s.Add(value)
+	}
+	return nil
+}
+
+// Add добавляет значение в скетч.
+func (s *Sketch) Add(value float64) {
+	switch {
+	case value > minIndexableValue:
+		s.Positive[s.index(value)]++
+	case value < -minIndexableValue:
+		s.Negative[s.index(-value)]++
+	default:
+		s.Zero++
+	}
+	if s.Count == 0 || value < s.Min {
+		s.Min = value
+	}
+	if s.Count == 0 || value > s.Max {
+		s.Max = value
+	}
+	s.Count++
+	s.Sum += value
+}
+
+// Merge добавляет к скетчу значения другого скетча с такой же относительной точностью.
+func (s *Sketch) Merge(other *Sketch) error {
+	if s.RelativeAccuracy != other.RelativeAccuracy {
+		return ErrAccuracyMismatch
+	}
+	if other.Count == 0 {
+		return nil
+	}
+	for idx, count := range other.Positive {
+		s.Positive[idx] += count
+	}
+	for idx, count := range other.Negative {
+		s.Negative[idx] += count
+	}
+	if s.Count == 0 || other.Min < s.Min {
+		s.Min = other.Min
+	}
+	if s.Count == 0 || other.Max > s.Max {
+		s.Max = other.Max
+	}
+	s.Zero += other.Zero
+	s.Count += other.Count
+	s.Sum += other.Sum
+	return nil
+}
+
+// Clone возвращает независимую копию скетча.
+func (s *Sketch) Clone() *Sketch {
+	clone := *s
+	clone.Positive = make(map[int]uint64, len(s.Positive))
+	for idx, count := range s.Positive {
+		clone.Positive[idx] = count
+	}
+	clone.Negative = make(map[int]uint64, len(s.Negative))
+	for idx, count := range s.Negative {
+		clone.Negative[idx] = count
+	}
+	clone.Values = nil
+	return &clone
+}
+
+// Quantile оценивает квантиль q с относительной погрешностью не больше RelativeAccuracy.
+func (s *Sketch) Quantile(q float64) float64 {
+	if s.Count == 0 || q < 0 || q > 1 {
+		return math.NaN()
+	}
+	return s.clamp(s.binValue(uint64(q * float64(s.Count-1))))
+}
+
+// binValue возвращает оценку значения с порядковым номером rank среди всех значений скетча.
+func (s *Sketch) binValue(rank uint64) float64 {
+	var cumulative uint64
+	negative := sortedIndexes(s.Negative)
+	for i := len(negative) - 1; i >= 0; i-- {
+		cumulative += s.Negative[negative[i]]
+		if cumulative > rank {
+			return -s.value(negative[i])
+		}
+	}
+	cumulative += s.Zero
+	if cumulative > rank {
+		return 0
+	}
+	positive := sortedIndexes(s.Positive)
+	for _, idx := range positive {
+		cumulative += s.Positive[idx]
+		if cumulative > rank {
+			return s.value(idx)
+		}
+	}
+	if len(positive) > 0 {
+		return s.value(positive[len(positive)-1])
+	}
+	return 0
+}
+
+func (s *Sketch) gamma() float64 {
+	return (1 + s.RelativeAccuracy) / (1 - s.RelativeAccuracy)
+}
+
+// index возвращает номер корзины для положительного значения.
+func (s *Sketch) index(value float64) int {
+	return int(math.Ceil(math.Log(value) / math.Log(s.gamma())))
+}
+
+// value возвращает оценку значения для корзины с номером idx.
+func (s *Sketch) value(idx int) float64 {
+	gamma := s.gamma()
+	return 2 * math.Pow(gamma, float64(idx)) / (gamma + 1)
+}
+
+func (s *Sketch) clamp(value float64) float64 {
+	return math.Max(s.Min, math.Min(s.Max, value))
+}
+
+func sortedIndexes(bins map[int]uint64) []int {
+	indexes := make([]int, 0, len(bins))
+	for idx := range bins {
+		indexes = append(indexes, idx)
+	}
+	sort.Ints(indexes)
+	return indexes
+}
@@ -1,72 +1,158 @@
 // Package filestorage предоставляет реализацию хранилища данных, использующего файловую систему для сохранения и восстановления метрик.
+// Копия хранилища периодически сохраняется в файл в формате пакета snapshot, а изменения между сохранениями
+// записываются в журнал упреждающей записи, который воспроизводится поверх копии при запуске.
 package filestorage
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"os"
+	"sync"
 	"time"
 
 	config "github.com/justEngineer/go-metrics-service/internal/http/server/config"
 	logger "github.com/justEngineer/go-metrics-service/internal/logger"
+	"github.com/justEngineer/go-metrics-service/internal/snapshot"
 	storage "github.com/justEngineer/go-metrics-service/internal/storage"
+	"github.com/justEngineer/go-metrics-service/internal/wal"
 	"go.uber.org/zap"
 )
 
-// FileStorage реализует интерфейс Storage, предоставляя методы для работы с метриками, хранящимися в файле.
+// DefaultSnapshotInterval интервал сохранения копии хранилища при StoreInterval = 0,
+// когда каждое изменение синхронно записывается в журнал.
+const DefaultSnapshotInterval = 5 * time.Minute
+
+// FileStorage реализует storage.Backend: метрики хранятся в памяти, а копия и журнал изменений — в файлах.
 type FileStorage struct {
-	storage *storage.MemStorage
+	*storage.MemStorage
 	config  *config.ServerConfig
+	journal *wal.Log
+	mu      sync.Mutex
 }
 
 // SaveDumpToFile реализует интерфейс для сохранения данных в файле.
-func (fs FileStorage) SaveDumpToFile() error {
-	rawData := fs.storage.GetAllMetrics()
-	jsonData, err := json.Marshal(rawData)
+// Копия записывается атомарно, а предыдущие копии сохраняются согласно SnapshotRetain.
+// Если журнал включен, копия запоминает номер первого не вошедшего в нее сегмента,
+// а сегменты, не нужные ни одной из хранимых копий, после сохранения удаляются.
+func (fs *FileStorage) SaveDumpToFile() error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	var rawData storage.MetricsDump
+	var segment uint64
+	var err error
+	if fs.journal != nil {
+		rawData, err = fs.MemStorage.Checkpoint(context.Background(), func() error {
+			segment, err = fs.journal.Rotate()
+			return err
+		})
+		rawData.WALSegment = segment
+	} else {
+		rawData, err = fs.MemStorage.GetAllMetrics(context.Background())
+	}
 	if err != nil {
-		return fmt.Errorf("serializing dump to JSON failed: %s", err)
+		return fmt.Errorf("reading metrics from storage failed: %s", err)
 	}
-	err = os.WriteFile(fs.config.FileStorePath, jsonData, 0666)
+	compression, err := snapshot.ParseCompression(fs.config.SnapshotCompress)
 	if err != nil {
+		return err
+	}
+	if _, err = snapshot.Save(fs.config.FileStorePath, rawData, compression, fs.retention()); err != nil {
 		return fmt.Errorf("write to file failed: %s", err)
 	}
+	if fs.journal != nil {
+		if err := fs.journal.Truncate(snapshot.OldestWALSegment(fs.config.FileStorePath, fs.retention())); err != nil {
+			return fmt.Errorf("truncating WAL failed: %s", err)
+		}
+	}
 	return nil
 }
 
+// Close сохраняет копию хранилища и закрывает журнал.
+func (fs *FileStorage) Close() error {
+	err := fs.SaveDumpToFile()
+	if fs.journal != nil {
+		err = errors.Join(err, fs.journal.Close())
+	}
+	return err
+}
+
+// Health сообщает об ошибке журнала, после которой изменения перестают приниматься.
+func (fs *FileStorage) Health(ctx context.Context) error {
+	if fs.journal == nil {
+		return nil
+	}
+	return fs.journal.Err()
+}
+
 // New создает новый экземпляр FileStorage.
-func New(metricStorage *storage.MemStorage, config *config.ServerConfig, ctx context.Context, logger *logger.Logger) *FileStorage {
+// StoreInterval = 0 означает синхронную запись: каждое изменение сбрасывается в журнал вызовом fsync
+// до подтверждения независимо от WALSync, а копия сохраняется раз в DefaultSnapshotInterval.
+// Ошибка возвращается, если все копии повреждены или журнал не удалось открыть или воспроизвести.
+func New(metricStorage *storage.MemStorage, config *config.ServerConfig, ctx context.Context, logger *logger.Logger) (*FileStorage, error) {
 	if config.FileStorePath == "" {
-		return nil
+		return nil, errors.New("store file path is empty")
 	}
 	fileStorage := &FileStorage{
-		storage: metricStorage,
-		config:  config,
+		MemStorage: metricStorage,
+		config:     config,
 	}
+	var walSegment uint64
 	if config.Restore {
-		data, err := os.ReadFile(config.FileStorePath)
-		if err == nil {
-			var backupData storage.MetricsDump
-			err = json.Unmarshal(data, &backupData)
-			if err != nil {
-				panic("cannot deserialize JSON data from file")
-			}
+		restored, errs := snapshot.Load(config.FileStorePath, fileStorage.retention())
+		for _, err := range errs {
+			logger.Log.Error("skipping corrupted snapshot", zap.Error(err))
+		}
+		if restored == nil && len(errs) > 0 {
+			return nil, errors.New("cannot restore metrics: all snapshots are corrupted")
+		}
+		if restored != nil {
+			logger.Log.Info("restoring snapshot", zap.String("path", restored.Path), zap.Time("created_at", restored.Header.CreatedAt))
+			backupData := restored.Dump
+			walSegment = backupData.WALSegment
 			metricStorage.Mutex.Lock()
 			for _, counter := range backupData.Counters {
-				metricStorage.Counter[counter.Name] = counter.Value
+				metricStorage.Counter[counter.Key()] = counter.Value
 			}
 			for _, gauge := range backupData.Gauges {
-				metricStorage.Gauge[gauge.Name] = gauge.Value
+				metricStorage.Gauge[gauge.Key()] = gauge.Value
+			}
+			for _, histogram := range backupData.Histograms {
+				if histogram.Value == nil || histogram.Value.Validate() != nil {
+					logger.Log.Warn("skipping invalid histogram from dump", zap.String("name", histogram.Name))
+					continue
+				}
+				metricStorage.Histogram[histogram.Key()] = histogram.Value
+			}
+			for _, summary := range backupData.Summaries {
+				if summary.Value == nil || summary.Value.Validate() != nil {
+					logger.Log.Warn("skipping invalid summary from dump", zap.String("name", summary.Name))
+					continue
+				}
+				metricStorage.Summary[summary.Key()] = summary.Value
 			}
 			metricStorage.Mutex.Unlock()
-		} else if !os.IsNotExist(err) {
-			panic("cannot read dump, file doesn't exists")
 		}
 	}
-	if config.StoreInterval > 0 {
+	journal, err := openJournal(config, walSegment)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open WAL: %w", err)
+	}
+	if journal != nil {
+		if err := replayJournal(journal, metricStorage, config.Restore, walSegment, logger); err != nil {
+			journal.Close()
+			return nil, fmt.Errorf("cannot replay WAL: %w", err)
+		}
+		metricStorage.SetJournal(journal)
+		fileStorage.journal = journal
+	}
+	storeInterval := time.Duration(config.StoreInterval) * time.Second
+	if storeInterval == 0 && journal != nil {
+		storeInterval = DefaultSnapshotInterval
+	}
+	if storeInterval > 0 {
 		go func() {
 			for {
-				storeTicker := time.NewTicker(time.Duration(config.StoreInterval) * time.Second)
+				storeTicker := time.NewTicker(storeInterval)
 				defer storeTicker.Stop()
 
 				for {
@@ -83,5 +169,56 @@ func New(metricStorage *storage.MemStorage, config *config.ServerConfig, ctx con
 			}
 		}()
 	}
-	return fileStorage
+	return fileStorage, nil
+}
+
+// retention возвращает количество хранимых копий.
+func (fs *FileStorage) retention() int {
+	return max(fs.config.SnapshotRetain, 1)
+}
+
+// openJournal открывает журнал упреждающей записи, если он не отключен.
+func openJournal(cfg *config.ServerConfig, firstSegment uint64) (*wal.Log, error) {
+	policy := cfg.WALSync
+	if cfg.StoreInterval == 0 {
+		policy = string(wal.SyncAlways)
+	}
+	if policy == config.WALDisabled {
+		return nil, nil
+	}
+	// пустая политика означает политику журнала по умолчанию
+	var sync wal.SyncPolicy
+	if policy != "" {
+		var err error
+		if sync, err = wal.ParseSyncPolicy(policy); err != nil {
+			return nil, err
+		}
+	}
+	dir := cfg.WALDir
+	if dir == "" {
+		dir = cfg.FileStorePath + ".wal"
+	}
+	return wal.Open(dir, wal.Options{Sync: sync, SyncInterval: cfg.WALSyncInterval, FirstSegment: firstSegment})
+}
+
+// replayJournal воспроизводит изменения, не вошедшие в копию хранилища. Без восстановления
+// из файла старые сегменты журнала удаляются, чтобы не примешать их к новым данным.
+func replayJournal(journal *wal.Log, metricStorage *storage.MemStorage, restore bool, from uint64, logger *logger.Logger) error {
+	if !restore {
+		return journal.Truncate(journal.Segment())
+	}
+	replayed, err := journal.Replay(from, func(record storage.JournalRecord) error {
+		if err := metricStorage.Apply(record); err != nil {
+			logger.Log.Warn("skipping WAL record", zap.String("op", record.Op), zap.String("key", record.Key), zap.Error(err))
+		}
+		return nil
+	})
+	if errors.Is(err, wal.ErrCorrupted) {
+		// поврежденный сегмент воспроизводится до испорченной записи, остальные сегменты — полностью
+		logger.Log.Warn("skipping corrupted WAL records", zap.Error(err))
+	} else if err != nil {
+		return err
+	}
+	logger.Log.Info("WAL replayed", zap.Int("records", replayed), zap.Uint64("from_segment", from))
+	return nil
 }
@@ -0,0 +1,142 @@
+package filestorage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	config "github.com/justEngineer/go-metrics-service/internal/http/server/config"
+	logger "github.com/justEngineer/go-metrics-service/internal/logger"
+	storage "github.com/justEngineer/go-metrics-service/internal/storage"
+	"github.com/justEngineer/go-metrics-service/internal/storage/storagetest"
+	"github.com/justEngineer/go-metrics-service/internal/wal"
+)
+
+// restart имитирует аварийный перезапуск: журнал закрывается без сохранения копии.
+func restart(t *testing.T, cfg *config.ServerConfig, previous *FileStorage) (*storage.MemStorage, *FileStorage) {
+	if previous != nil {
+		require.NoError(t, previous.journal.Close())
+	}
+	appLogger, err := logger.New("error")
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	metricStorage := storage.New()
+	fileStorage, err := New(metricStorage, cfg, ctx, appLogger)
+	require.NoError(t, err)
+	return metricStorage, fileStorage
+}
+
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Backend {
+		cfg := &config.ServerConfig{
+			FileStorePath: filepath.Join(t.TempDir(), "metrics.json"),
+			StoreInterval: 300,
+			WALSync:       string(wal.SyncBatch),
+		}
+		_, fileStorage := restart(t, cfg, nil)
+		t.Cleanup(func() { require.NoError(t, fileStorage.Close()) })
+		return fileStorage
+	})
+}
+
+func TestRestartKeepsAcknowledgedUpdates(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	cfg := &config.ServerConfig{
+		FileStorePath: filepath.Join(dir, "metrics.json"),
+		StoreInterval: 300,
+		Restore:       true,
+		WALSync:       string(wal.SyncBatch),
+	}
+
+	metricStorage, fileStorage := restart(t, cfg, nil)
+	require.NoError(t, metricStorage.Set(ctx, storage.NewCounter("requests", 5)))
+	require.NoError(t, metricStorage.Set(ctx, storage.NewGauge("temperature", 36.6)))
+	require.NoError(t, fileStorage.SaveDumpToFile())
+	require.NoError(t, metricStorage.Set(ctx, storage.NewCounter("requests", 3)))
+	require.NoError(t, metricStorage.Batch(ctx, []storage.Metric{storage.NewCounter("requests", 2)}))
+	require.NoError(t, metricStorage.Delete(ctx, "gauge", "temperature"))
+
+	metricStorage, fileStorage = restart(t, cfg, fileStorage)
+	counter, err := storage.GetCounter(ctx, metricStorage, "requests")
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), counter, "increments after the snapshot are replayed from the WAL exactly once")
+	_, err = storage.GetGauge(ctx, metricStorage, "temperature")
+	assert.Error(t, err)
+
+	// копия, сохраненная после воспроизведения, не дает повторно применить старые сегменты
+	require.NoError(t, fileStorage.SaveDumpToFile())
+	require.NoError(t, metricStorage.Set(ctx, storage.NewCounter("requests", 1)))
+	metricStorage, fileStorage = restart(t, cfg, fileStorage)
+	counter, err = storage.GetCounter(ctx, metricStorage, "requests")
+	require.NoError(t, err)
+	assert.Equal(t, int64(11), counter)
+	require.NoError(t, fileStorage.Close())
+
+	metricStorage, fileStorage = restart(t, cfg, nil)
+	counter, err = storage.GetCounter(ctx, metricStorage, "requests")
+	require.NoError(t, err)
+	assert.Equal(t, int64(11), counter)
+	require.NoError(t, fileStorage.Close())
+}
+
+func TestSynchronousStoreInterval(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	cfg := &config.ServerConfig{
+		FileStorePath: filepath.Join(dir, "metrics.json"),
+		Restore:       true,
+		WALSync:       config.WALDisabled,
+	}
+
+	metricStorage, fileStorage := restart(t, cfg, nil)
+	require.NotNil(t, fileStorage.journal, "StoreInterval = 0 enables the WAL even when it is turned off")
+	require.NoError(t, metricStorage.Set(ctx, storage.NewCounter("requests", 7)))
+	_, err := os.Stat(filepath.Join(dir, "metrics.json.wal"))
+	require.NoError(t, err)
+
+	metricStorage, fileStorage = restart(t, cfg, fileStorage)
+	counter, err := storage.GetCounter(ctx, metricStorage, "requests")
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), counter)
+	require.NoError(t, fileStorage.Close())
+
+	cfg.StoreInterval = 300
+	cfg.Restore = false
+	metricStorage, fileStorage = restart(t, cfg, nil)
+	assert.Nil(t, fileStorage.journal)
+	_, err = storage.GetCounter(ctx, metricStorage, "requests")
+	assert.Error(t, err)
+}
+
+func TestRestoreFromPreviousSnapshot(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	cfg := &config.ServerConfig{
+		FileStorePath:    filepath.Join(dir, "metrics.json"),
+		StoreInterval:    300,
+		Restore:          true,
+		WALSync:          string(wal.SyncBatch),
+		SnapshotCompress: "gzip",
+		SnapshotRetain:   2,
+	}
+
+	metricStorage, fileStorage := restart(t, cfg, nil)
+	require.NoError(t, metricStorage.Set(ctx, storage.NewCounter("requests", 1)))
+	require.NoError(t, fileStorage.SaveDumpToFile())
+	require.NoError(t, metricStorage.Set(ctx, storage.NewCounter("requests", 2)))
+	require.NoError(t, fileStorage.SaveDumpToFile())
+	require.NoError(t, metricStorage.Set(ctx, storage.NewCounter("requests", 4)))
+	require.NoError(t, os.WriteFile(cfg.FileStorePath, []byte("MSNP"), 0644))
+
+	metricStorage, fileStorage = restart(t, cfg, fileStorage)
+	counter, err := storage.GetCounter(ctx, metricStorage, "requests")
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), counter, "the WAL is kept for the previous snapshot and replayed on top of it")
+	require.NoError(t, fileStorage.Close())
+}
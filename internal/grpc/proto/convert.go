@@ -0,0 +1,102 @@
+package proto
+
+import (
+	"github.com/justEngineer/go-metrics-service/internal/distribution"
+	"github.com/justEngineer/go-metrics-service/internal/models"
+)
+
+// FromModel преобразует метрику из формата JSON API в сообщение gRPC.
+func FromModel(metric models.Metrics) *Metric {
+	result := &Metric{Id: metric.ID, Type: metric.MType, Labels: metric.Labels}
+	if metric.Delta != nil {
+		result.Delta = *metric.Delta
+	}
+	if metric.Value != nil {
+		result.Value = *metric.Value
+	}
+	if metric.Histogram != nil {
+		result.Histogram = FromHistogram(metric.Histogram)
+	}
+	if metric.Summary != nil {
+		result.Summary = FromSketch(metric.Summary)
+	}
+	return result
+}
+
+// ToModel преобразует сообщение gRPC в метрику формата JSON API.
+func (m *Metric) ToModel() models.Metrics {
+	result := models.Metrics{ID: m.GetId(), MType: m.GetType(), Labels: m.GetLabels()}
+	switch m.GetType() {
+	case models.Gauge:
+		value := m.GetValue()
+		result.Value = &value
+	case models.Counter:
+		delta := m.GetDelta()
+		result.Delta = &delta
+	case models.Histogram:
+		if m.GetHistogram() != nil {
+			result.Histogram = m.GetHistogram().ToHistogram()
+		}
+	case models.Summary:
+		if m.GetSummary() != nil {
+			result.Summary = m.GetSummary().ToSketch()
+		}
+	}
+	return result
+}
+
+// FromHistogram преобразует гистограмму в сообщение gRPC.
+func FromHistogram(h *distribution.Histogram) *Histogram {
+	return &Histogram{Bounds: h.Bounds, Counts: h.Counts, Sum: h.Sum, Count: h.Count}
+}
+
+// ToHistogram преобразует сообщение gRPC в гистограмму.
+func (h *Histogram) ToHistogram() *distribution.Histogram {
+	return &distribution.Histogram{Bounds: h.GetBounds(), Counts: h.GetCounts(), Sum: h.GetSum(), Count: h.GetCount()}
+}
+
+// FromSketch преобразует скетч в сообщение gRPC.
+func FromSketch(s *distribution.Sketch) *Summary {
+	return &Summary{
+		RelativeAccuracy: s.RelativeAccuracy,
+		Positive:         toProtoBins(s.Positive),
+		Negative:         toProtoBins(s.Negative),
+		Zero:             s.Zero,
+		Count:            s.Count,
+		Sum:              s.Sum,
+		Min:              s.Min,
+		Max:              s.Max,
+		Values:           s.Values,
+	}
+}
+
+// ToSketch преобразует сообщение gRPC в скетч.
+func (s *Summary) ToSketch() *distribution.Sketch {
+	return &distribution.Sketch{
+		RelativeAccuracy: s.GetRelativeAccuracy(),
+		Positive:         fromProtoBins(s.GetPositive()),
+		Negative:         fromProtoBins(s.GetNegative()),
+		Zero:             s.GetZero(),
+		Count:            s.GetCount(),
+		Sum:              s.GetSum(),
+		Min:              s.GetMin(),
+		Max:              s.GetMax(),
+		Values:           s.GetValues(),
+	}
+}
+
+func toProtoBins(bins map[int]uint64) map[int32]uint64 {
+	result := make(map[int32]uint64, len(bins))
+	for idx, count := range bins {
+		result[int32(idx)] = count
+	}
+	return result
+}
+
+func fromProtoBins(bins map[int32]uint64) map[int]uint64 {
+	result := make(map[int]uint64, len(bins))
+	for idx, count := range bins {
+		result[int(idx)] = count
+	}
+	return result
+}
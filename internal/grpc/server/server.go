@@ -0,0 +1,203 @@
+// Package server предоставляет gRPC API для записи и чтения метрик.
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/justEngineer/go-metrics-service/internal/dedup"
+	"github.com/justEngineer/go-metrics-service/internal/distribution"
+	pb "github.com/justEngineer/go-metrics-service/internal/grpc/proto"
+	"github.com/justEngineer/go-metrics-service/internal/logger"
+	"github.com/justEngineer/go-metrics-service/internal/models"
+	"github.com/justEngineer/go-metrics-service/internal/pubsub"
+	"github.com/justEngineer/go-metrics-service/internal/storage"
+)
+
+// Server реализует gRPC сервис Metrics поверх того же хранилища, что и HTTP API.
+type Server struct {
+	pb.UnimplementedMetricsServer
+	storage   storage.Backend
+	appLogger *logger.Logger
+	batches   *dedup.Tracker
+	hub       *pubsub.Hub
+}
+
+// New создает реализацию gRPC сервиса Metrics.
+func New(metricStorage storage.Backend, appLogger *logger.Logger) *Server {
+	return &Server{storage: metricStorage, appLogger: appLogger, batches: dedup.New(dedup.DefaultTTL)}
+}
+
+// SetHub задает хаб, в который публикуются принятые обновления метрик, обычно общий с HTTP API.
+func (s *Server) SetHub(hub *pubsub.Hub) {
+	s.hub = hub
+}
+
+// Start регистрирует сервис и начинает прием соединений на адресе endpoint.
+func Start(endpoint string, service *Server, opts ...grpc.ServerOption) (*grpc.Server, error) {
+	listener, err := net.Listen("tcp", endpoint)
+	if err != nil {
+		return nil, err
+	}
+	server := grpc.NewServer(opts...)
+	pb.RegisterMetricsServer(server, service)
+	go func() {
+		if err := server.Serve(listener); err != nil {
+			service.appLogger.Log.Error("gRPC server stopped", zap.Error(err))
+		}
+	}()
+	return server, nil
+}
+
+// UpdateBatch сохраняет пакет метрик.
+func (s *Server) UpdateBatch(ctx context.Context, req *pb.UpdateBatchRequest) (*pb.UpdateBatchResponse, error) {
+	accepted, err := s.updateBatch(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.UpdateBatchResponse{Accepted: accepted}, nil
+}
+
+// StreamUpdates сохраняет пакеты метрик по мере их получения из потока.
+func (s *Server) StreamUpdates(stream pb.Metrics_StreamUpdatesServer) error {
+	var accepted uint64
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return stream.SendAndClose(&pb.UpdateBatchResponse{Accepted: accepted})
+		}
+		if err != nil {
+			return err
+		}
+		count, err := s.updateBatch(stream.Context(), req)
+		if err != nil {
+			return err
+		}
+		accepted += count
+	}
+}
+
+// GetMetric возвращает текущее значение метрики.
+func (s *Server) GetMetric(ctx context.Context, req *pb.GetMetricRequest) (*pb.Metric, error) {
+	if err := storage.ValidateLabels(req.GetLabels()); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	key := storage.SeriesKey(req.GetId(), req.GetLabels())
+	metric := &pb.Metric{Id: req.GetId(), Type: req.GetType(), Labels: req.GetLabels()}
+	switch req.GetType() {
+	case models.Gauge, models.Counter, models.Histogram, models.Summary:
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "unknown metric type %q", req.GetType())
+	}
+	stored, err := s.storage.Get(ctx, req.GetType(), key)
+	if err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	switch req.GetType() {
+	case models.Gauge:
+		metric.Value = *stored.Value
+	case models.Counter:
+		metric.Delta = *stored.Delta
+	case models.Histogram:
+		metric.Histogram = pb.FromHistogram(stored.Histogram)
+	case models.Summary:
+		metric.Summary = pb.FromSketch(stored.Summary)
+	}
+	return metric, nil
+}
+
+// ListMetrics возвращает значения всех метрик.
+func (s *Server) ListMetrics(ctx context.Context, _ *pb.ListMetricsRequest) (*pb.ListMetricsResponse, error) {
+	dump, err := s.storage.GetAllMetrics(ctx)
+	if err != nil {
+		s.appLogger.Log.Warn("Error while reading metrics from storage", zap.Error(err))
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	metrics := make([]*pb.Metric, 0, len(dump.Gauges)+len(dump.Counters)+len(dump.Histograms)+len(dump.Summaries))
+	for _, gauge := range dump.Gauges {
+		metrics = append(metrics, &pb.Metric{Id: gauge.Name, Type: models.Gauge, Labels: gauge.Labels, Value: gauge.Value})
+	}
+	for _, counter := range dump.Counters {
+		metrics = append(metrics, &pb.Metric{Id: counter.Name, Type: models.Counter, Labels: counter.Labels, Delta: counter.Value})
+	}
+	for _, histogram := range dump.Histograms {
+		metrics = append(metrics, &pb.Metric{Id: histogram.Name, Type: models.Histogram, Labels: histogram.Labels, Histogram: pb.FromHistogram(histogram.Value)})
+	}
+	for _, summary := range dump.Summaries {
+		metrics = append(metrics, &pb.Metric{Id: summary.Name, Type: models.Summary, Labels: summary.Labels, Summary: pb.FromSketch(summary.Value)})
+	}
+	return &pb.ListMetricsResponse{Metrics: metrics}, nil
+}
+
+// updateBatch сохраняет пакет метрик; пакет агента, уже примененный ранее, подтверждается без повторного применения,
+// а пакет, который в этот момент применяет другой вызов, отклоняется с кодом Aborted для повторной отправки.
+func (s *Server) updateBatch(ctx context.Context, req *pb.UpdateBatchRequest) (uint64, error) {
+	agentID, seq := req.GetAgentId(), req.GetSeq()
+	if agentID == "" {
+		return s.update(ctx, req.GetMetrics())
+	}
+	if seq == 0 {
+		return 0, status.Error(codes.InvalidArgument, "batch seq must be positive")
+	}
+	switch s.batches.Reserve(agentID, seq) {
+	case dedup.Applied:
+		s.appLogger.Log.Info("Duplicate batch skipped", zap.String("agent_id", agentID), zap.Uint64("seq", seq))
+		return uint64(len(req.GetMetrics())), nil
+	case dedup.InProgress:
+		return 0, status.Error(codes.Aborted, "batch is being applied by another call")
+	}
+	accepted, err := s.update(ctx, req.GetMetrics())
+	if err != nil {
+		s.batches.Release(agentID, seq)
+		return 0, err
+	}
+	if s.batches.Commit(agentID, seq) {
+		s.appLogger.Log.Info("New agent instance", zap.String("agent_id", agentID), zap.Uint64("seq", seq))
+	}
+	return accepted, nil
+}
+
+// update проверяет метрики так же, как обработчик POST /updates/, и сохраняет их одним пакетом:
+// при любой ошибке не сохраняется ни одна метрика.
+func (s *Server) update(ctx context.Context, metrics []*pb.Metric) (uint64, error) {
+	batch := make([]storage.Metric, 0, len(metrics))
+	accepted := make([]models.Metrics, 0, len(metrics))
+	for _, m := range metrics {
+		if err := storage.ValidateLabels(m.GetLabels()); err != nil {
+			return 0, status.Error(codes.InvalidArgument, err.Error())
+		}
+		metric := m.ToModel()
+		value := storage.FromModel(metric)
+		if err := value.Validate(); err != nil {
+			return 0, status.Error(codes.InvalidArgument, err.Error())
+		}
+		batch = append(batch, value)
+		accepted = append(accepted, metric)
+	}
+	if err := s.storage.Batch(ctx, batch); err != nil {
+		return 0, updateError(err)
+	}
+	if s.hub != nil {
+		s.hub.PublishMetrics(accepted...)
+	}
+	return uint64(len(metrics)), nil
+}
+
+// updateError возвращает статус ошибки сохранения пакета: некорректная метрика и несовпадение корзин
+// или точности распределения с сохраненной метрикой считаются ошибками клиента.
+func updateError(err error) error {
+	switch {
+	case errors.Is(err, storage.ErrInvalidMetric):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, distribution.ErrBucketsMismatch) || errors.Is(err, distribution.ErrAccuracyMismatch):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	pb "github.com/justEngineer/go-metrics-service/internal/grpc/proto"
+	"github.com/justEngineer/go-metrics-service/internal/logger"
+	"github.com/justEngineer/go-metrics-service/internal/security"
+	"github.com/justEngineer/go-metrics-service/internal/storage"
+)
+
+func newTestClient(t *testing.T, serverOpts []grpc.ServerOption, dialOpts ...grpc.DialOption) pb.MetricsClient {
+	appLogger, err := logger.New("error")
+	require.NoError(t, err)
+	listener := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer(serverOpts...)
+	pb.RegisterMetricsServer(server, New(storage.New(), appLogger))
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	dialOpts = append(dialOpts,
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	conn, err := grpc.NewClient("passthrough:///bufnet", dialOpts...)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return pb.NewMetricsClient(conn)
+}
+
+func TestUpdateAndGet(t *testing.T) {
+	client := newTestClient(t, nil)
+	ctx := context.Background()
+
+	resp, err := client.UpdateBatch(ctx, &pb.UpdateBatchRequest{Metrics: []*pb.Metric{
+		{Id: "Alloc", Type: "gauge", Value: 12.5, Labels: map[string]string{"host": "a"}},
+		{Id: "PollCount", Type: "counter", Delta: 3},
+		{Id: "Latency", Type: "histogram", Histogram: &pb.Histogram{Bounds: []float64{1, 10}, Counts: []uint64{1, 2, 0}, Sum: 12}},
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3), resp.GetAccepted())
+
+	stream, err := client.StreamUpdates(ctx)
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, stream.Send(&pb.UpdateBatchRequest{Metrics: []*pb.Metric{{Id: "PollCount", Type: "counter", Delta: 1}}}))
+	}
+	resp, err = stream.CloseAndRecv()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3), resp.GetAccepted())
+
+	metric, err := client.GetMetric(ctx, &pb.GetMetricRequest{Id: "PollCount", Type: "counter"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), metric.GetDelta())
+	metric, err = client.GetMetric(ctx, &pb.GetMetricRequest{Id: "Alloc", Type: "gauge", Labels: map[string]string{"host": "a"}})
+	require.NoError(t, err)
+	assert.Equal(t, 12.5, metric.GetValue())
+	metric, err = client.GetMetric(ctx, &pb.GetMetricRequest{Id: "Latency", Type: "histogram"})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3), metric.GetHistogram().GetCount())
+
+	_, err = client.GetMetric(ctx, &pb.GetMetricRequest{Id: "Alloc", Type: "gauge"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, err = client.UpdateBatch(ctx, &pb.UpdateBatchRequest{Metrics: []*pb.Metric{{Id: "Alloc", Type: "unknown"}}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = client.UpdateBatch(ctx, &pb.UpdateBatchRequest{Metrics: []*pb.Metric{
+		{Id: "Latency", Type: "histogram", Histogram: &pb.Histogram{Bounds: []float64{5}, Counts: []uint64{1, 0}}},
+	}})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	list, err := client.ListMetrics(ctx, &pb.ListMetricsRequest{})
+	require.NoError(t, err)
+	assert.Len(t, list.GetMetrics(), 3)
+}
+
+func TestSignedUpdates(t *testing.T) {
+	const key = "secret"
+	serverOpts := []grpc.ServerOption{
+		grpc.UnaryInterceptor(security.UnaryServerInterceptor(key, false)),
+		grpc.StreamInterceptor(security.StreamServerInterceptor(false)),
+	}
+	ctx := context.Background()
+	request := &pb.UpdateBatchRequest{Metrics: []*pb.Metric{{Id: "PollCount", Type: "counter", Delta: 1}}}
+
+	signed := newTestClient(t, serverOpts, grpc.WithUnaryInterceptor(security.UnaryClientInterceptor(key)))
+	_, err := signed.UpdateBatch(ctx, request)
+	require.NoError(t, err)
+	var header metadata.MD
+	_, err = signed.ListMetrics(ctx, &pb.ListMetricsRequest{}, grpc.Header(&header))
+	require.NoError(t, err)
+	assert.NotEmpty(t, header.Get(security.HashMetadata))
+
+	unsigned := newTestClient(t, serverOpts)
+	_, err = unsigned.UpdateBatch(ctx, request)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	wrongKey := newTestClient(t, serverOpts, grpc.WithUnaryInterceptor(security.UnaryClientInterceptor("other")))
+	_, err = wrongKey.UpdateBatch(ctx, request)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	stream, err := signed.StreamUpdates(ctx)
+	require.NoError(t, err)
+	_ = stream.Send(request)
+	_, err = stream.CloseAndRecv()
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
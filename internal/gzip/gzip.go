@@ -11,8 +11,9 @@ import (
 // compressWriter реализует интерфейс http.ResponseWriter и позволяет прозрачно для сервера
 // сжимать передаваемые данные и выставлять правильные HTTP-заголовки
 type compressWriter struct {
-	w  http.ResponseWriter
-	zw *gzip.Writer
+	w           http.ResponseWriter
+	zw          *gzip.Writer
+	wroteHeader bool
 }
 
 // newCompressWriter создает новый экземпляр middleware для сжатия и распаковки данных.
@@ -30,19 +31,42 @@ func (c *compressWriter) Header() http.Header {
 
 // Write записывает данные в gzip writer, автоматически сжимая их перед отправкой клиенту.
 func (c *compressWriter) Write(p []byte) (int, error) {
+	if !c.wroteHeader {
+		c.WriteHeader(http.StatusOK)
+	}
 	return c.zw.Write(p)
 }
 
 // WriteHeader отправляет HTTP статус код.
 func (c *compressWriter) WriteHeader(statusCode int) {
-	if statusCode < 300 {
-		c.w.Header().Set("Content-Encoding", "gzip")
+	if c.wroteHeader {
+		return
 	}
+	c.wroteHeader = true
+	// тело ответа сжимается при любом коде, поэтому заголовок выставляется всегда
+	c.w.Header().Set("Content-Encoding", "gzip")
+	c.w.Header().Del("Content-Length")
 	c.w.WriteHeader(statusCode)
 }
 
+// FlushError досылает клиенту сжатые данные из буфера; используется http.ResponseController
+// для ответов, которые отправляются частями.
+func (c *compressWriter) FlushError() error {
+	if !c.wroteHeader {
+		c.WriteHeader(http.StatusOK)
+	}
+	if err := c.zw.Flush(); err != nil {
+		return err
+	}
+	return http.NewResponseController(c.w).Flush()
+}
+
 // Close закрывает gzip.Writer и досылает все данные из буфера.
+// Если обработчик ничего не отправил, ответ остается без тела.
 func (c *compressWriter) Close() error {
+	if !c.wroteHeader {
+		return nil
+	}
 	return c.zw.Close()
 }
 
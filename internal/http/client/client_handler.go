@@ -2,11 +2,10 @@ package client
 
 import (
 	"bytes"
+	"crypto/rand"
 	"encoding/hex"
 	"encoding/json"
-	"math/rand"
 	"net/http"
-	"runtime"
 	"time"
 
 	"context"
@@ -14,76 +13,110 @@ import (
 
 	"compress/gzip"
 
+	"github.com/cenkalti/backoff"
 	async "github.com/justEngineer/go-metrics-service/internal/async"
+	"github.com/justEngineer/go-metrics-service/internal/collector"
+	"github.com/justEngineer/go-metrics-service/internal/dedup"
+	pb "github.com/justEngineer/go-metrics-service/internal/grpc/proto"
 	logger "github.com/justEngineer/go-metrics-service/internal/logger"
 	model "github.com/justEngineer/go-metrics-service/internal/models"
+	"github.com/justEngineer/go-metrics-service/internal/queue"
 	security "github.com/justEngineer/go-metrics-service/internal/security"
 	storage "github.com/justEngineer/go-metrics-service/internal/storage"
-	"github.com/shirou/gopsutil/cpu"
-	"github.com/shirou/gopsutil/mem"
 	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
+// grpcRequestTimeout время ожидания ответа на gRPC запрос.
+const grpcRequestTimeout = 5 * time.Second
+
 type Handler struct {
-	storage   *storage.MemStorage
-	config    *ClientConfig
-	appLogger *logger.Logger
-	serverURL string
+	storage    *storage.MemStorage
+	config     *ClientConfig
+	appLogger  *logger.Logger
+	serverURL  string
+	grpcClient pb.MetricsClient
+	collectors []collector.Collector
+
+	agentID string  // идентификатор экземпляра агента, новый при каждом запуске
+	seq     uint64  // номер последнего собранного пакета
+	pending []batch // пакеты, которые не удалось отправить без очереди, в порядке отправки
+
+	queue           *queue.Queue
+	backoff         *backoff.ExponentialBackOff
+	retryAt         time.Time
+	reportedDropped uint64
 }
 
 func New(metricsService *storage.MemStorage, config *ClientConfig, appLogger *logger.Logger) *Handler {
-	return &Handler{metricsService, config, appLogger, "http://" + config.Endpoint + "/updates/"}
+	return &Handler{
+		storage:   metricsService,
+		config:    config,
+		appLogger: appLogger,
+		serverURL: "http://" + config.Endpoint + "/updates/",
+		agentID:   newAgentID(),
+	}
+}
+
+// newAgentID создает случайный идентификатор экземпляра агента.
+func newAgentID() string {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(id)
+}
+
+// SetGRPCClient включает отправку метрик через gRPC вместо POST /updates/.
+func (h *Handler) SetGRPCClient(grpcClient pb.MetricsClient) {
+	h.grpcClient = grpcClient
 }
 
+// SetCollectors задает коллекторы, которые опрашивает GetMetrics.
+func (h *Handler) SetCollectors(collectors []collector.Collector) {
+	h.collectors = collectors
+}
+
+// GetMetrics опрашивает коллекторы, каждый со своим интервалом, до отмены контекста.
 func (h *Handler) GetMetrics(ctx context.Context) {
-	pollTicker := time.NewTicker(time.Duration(h.config.PollInterval) * time.Second)
-	defer pollTicker.Stop()
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case <-pollTicker.C:
-			m := &runtime.MemStats{}
-			runtime.ReadMemStats(m)
-			h.storage.Mutex.Lock()
-			h.storage.Gauge["Alloc"] = float64(m.Alloc)
-			h.storage.Gauge["BuckHashSys"] = float64(m.BuckHashSys)
-			h.storage.Gauge["Frees"] = float64(m.Frees)
-			h.storage.Gauge["GCCPUFraction"] = float64(m.GCCPUFraction)
-			h.storage.Gauge["GCSys"] = float64(m.GCSys)
-			h.storage.Gauge["HeapAlloc"] = float64(m.HeapAlloc)
-			h.storage.Gauge["HeapIdle"] = float64(m.HeapIdle)
-			h.storage.Gauge["HeapInuse"] = float64(m.HeapInuse)
-			h.storage.Gauge["HeapObjects"] = float64(m.HeapObjects)
-			h.storage.Gauge["HeapReleased"] = float64(m.HeapReleased)
-			h.storage.Gauge["HeapSys"] = float64(m.HeapSys)
-			h.storage.Gauge["LastGC"] = float64(m.LastGC)
-			h.storage.Gauge["Lookups"] = float64(m.Lookups)
-			h.storage.Gauge["MCacheInuse"] = float64(m.MCacheInuse)
-			h.storage.Gauge["MCacheSys"] = float64(m.MCacheSys)
-			h.storage.Gauge["MSpanInuse"] = float64(m.MSpanInuse)
-			h.storage.Gauge["MSpanSys"] = float64(m.MSpanSys)
-			h.storage.Gauge["Mallocs"] = float64(m.Mallocs)
-			h.storage.Gauge["NextGC"] = float64(m.NextGC)
-			h.storage.Gauge["NumForcedGC"] = float64(m.NumForcedGC)
-			h.storage.Gauge["NumGC"] = float64(m.NumGC)
-			h.storage.Gauge["OtherSys"] = float64(m.OtherSys)
-			h.storage.Gauge["PauseTotalNs"] = float64(m.PauseTotalNs)
-			h.storage.Gauge["StackInuse"] = float64(m.StackInuse)
-			h.storage.Gauge["StackSys"] = float64(m.StackSys)
-			h.storage.Gauge["Sys"] = float64(m.Sys)
-			h.storage.Gauge["TotalAlloc"] = float64(m.TotalAlloc)
-			h.storage.Gauge["RandomValue"] = float64(rand.Float64() * 100)
-
-			h.storage.Counter["PollCount"] += 1
-			h.GetAdditionalMetrics()
-			h.storage.Mutex.Unlock()
+	collector.Run(ctx, h.collectors, h.store, h.appLogger)
+}
+
+// store записывает собранные метрики в хранилище агента: gauge заменяются, приращения counter суммируются.
+func (h *Handler) store(metrics []model.Metrics) {
+	h.storage.Mutex.Lock()
+	defer h.storage.Mutex.Unlock()
+	for _, metric := range metrics {
+		key := storage.SeriesKey(metric.ID, metric.Labels)
+		switch {
+		case metric.MType == model.Gauge && metric.Value != nil:
+			h.storage.Gauge[key] = *metric.Value
+		case metric.MType == model.Counter && metric.Delta != nil:
+			h.storage.Counter[key] += *metric.Delta
+		default:
+			h.appLogger.Log.Warn("collected metric is skipped", zap.String("id", metric.ID), zap.String("type", metric.MType))
 		}
 	}
 }
 
-func (h *Handler) sendRequest(metric []model.Metrics, url *string, client *http.Client, limiter *async.Semaphore) error {
-	body, err := json.Marshal(metric)
+// labels объединяет метки агента из конфигурации с метками ряда; метки ряда имеют приоритет.
+func (h *Handler) labels(seriesLabels map[string]string) map[string]string {
+	if len(seriesLabels) == 0 {
+		return h.config.Labels
+	}
+	labels := make(map[string]string, len(h.config.Labels)+len(seriesLabels))
+	for name, value := range h.config.Labels {
+		labels[name] = value
+	}
+	for name, value := range seriesLabels {
+		labels[name] = value
+	}
+	return labels
+}
+
+func (h *Handler) sendRequest(b batch, url *string, client *http.Client, limiter *async.Semaphore) error {
+	body, err := json.Marshal(b.Metrics)
 	if err != nil {
 		panic(err)
 	}
@@ -105,8 +138,11 @@ func (h *Handler) sendRequest(metric []model.Metrics, url *string, client *http.
 	request.Header.Add("Content-Type", "application/json")
 	request.Header.Set("Accept-Encoding", "gzip")
 	request.Header.Set("Content-Encoding", "gzip")
+	if b.AgentID != "" {
+		dedup.SetHeader(request.Header, b.AgentID, b.Seq)
+	}
 	if h.config.SHA256Key != "" {
-		signedBody, err := security.AddSign(body, h.config.SHA256Key)
+		signedBody, err := security.AddSign(security.SignedData(request.Header, body), h.config.SHA256Key)
 		if err != nil {
 			return fmt.Errorf("error while adding SHA256 sign: %w", err)
 		}
@@ -119,40 +155,121 @@ func (h *Handler) sendRequest(metric []model.Metrics, url *string, client *http.
 	}
 	response, err := client.Do(request)
 	if err != nil {
-		h.appLogger.Log.Info("request sending is failed", zap.String("error", err.Error()))
 		return err
 	}
 	response.Body.Close()
+	switch {
+	case response.StatusCode >= http.StatusInternalServerError:
+		return fmt.Errorf("server failed to store metrics with status %d", response.StatusCode)
+	case response.StatusCode == http.StatusConflict:
+		// пакет еще применяется по предыдущей попытке отправки, его нужно повторить позже
+		return fmt.Errorf("batch is being applied by server, status %d", response.StatusCode)
+	case response.StatusCode >= http.StatusBadRequest:
+		return fmt.Errorf("%w with status %d", errRejected, response.StatusCode)
+	}
 	return nil
 }
 
+// sendGRPCRequest отправляет пакет метрик методом UpdateBatch.
+func (h *Handler) sendGRPCRequest(b batch, limiter *async.Semaphore) error {
+	request := &pb.UpdateBatchRequest{AgentId: b.AgentID, Seq: b.Seq, Metrics: make([]*pb.Metric, 0, len(b.Metrics))}
+	for _, metric := range b.Metrics {
+		request.Metrics = append(request.Metrics, pb.FromModel(metric))
+	}
+	if limiter != nil {
+		limiter.Wait()
+		defer limiter.Signal()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), grpcRequestTimeout)
+	defer cancel()
+	_, err := h.grpcClient.UpdateBatch(ctx, request)
+	switch status.Code(err) {
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.Unauthenticated, codes.PermissionDenied:
+		return fmt.Errorf("%w: %s", errRejected, err)
+	}
+	return err
+}
+
+// send отправляет пакет метрик через gRPC, если он включен, иначе POST-запросом на /updates/.
+func (h *Handler) send(b batch, client *http.Client, limiter *async.Semaphore) error {
+	if h.grpcClient != nil {
+		return h.sendGRPCRequest(b, limiter)
+	}
+	return h.sendRequest(b, &h.serverURL, client, limiter)
+}
+
+// SendMetricsHandler отправляет на сервер новый пакет метрик. Счетчики отправляются как приращения
+// с предыдущего пакета: при сборке пакета они забираются из хранилища. Если пакет не удалось
+// ни отправить, ни сохранить в очередь, он отправляется повторно с тем же номером перед следующим пакетом,
+// а новые приращения тем временем накапливаются в хранилище.
 func (h *Handler) SendMetricsHandler(client *http.Client, limiter *async.Semaphore) {
-	h.storage.Mutex.RLock()
+	h.updateQueueMetrics()
+	for len(h.pending) > 0 {
+		if !h.deliver(h.pending[0], client, limiter) {
+			return
+		}
+		h.pending = h.pending[1:]
+	}
+	b := h.takeBatch()
+	if len(b.Metrics) != 0 && !h.deliver(b, client, limiter) {
+		h.pending = append(h.pending, b)
+	}
+}
+
+// takeBatch собирает пакет из текущих значений gauge и накопленных приращений counter, histogram и summary
+// и присваивает ему следующий номер.
+func (h *Handler) takeBatch() batch {
+	h.storage.Mutex.Lock()
+	defer h.storage.Mutex.Unlock()
 	var metricsBatch []model.Metrics
-	for id, value := range h.storage.Gauge {
+	for key, value := range h.storage.Gauge {
+		value := value
+		id, labels := storage.ParseSeriesKey(key)
 		metric := model.Metrics{
-			ID:    id,
-			MType: "gauge",
-			Value: &value,
+			ID:     id,
+			MType:  "gauge",
+			Value:  &value,
+			Labels: h.labels(labels),
 		}
 		metricsBatch = append(metricsBatch, metric)
 	}
-	for id, value := range h.storage.Counter {
+	for key, value := range h.storage.Counter {
+		value := value
+		id, labels := storage.ParseSeriesKey(key)
 		metric := model.Metrics{
-			ID:    id,
-			MType: "counter",
-			Delta: &value,
+			ID:     id,
+			MType:  "counter",
+			Delta:  &value,
+			Labels: h.labels(labels),
 		}
 		metricsBatch = append(metricsBatch, metric)
+		delete(h.storage.Counter, key)
 	}
-	if len(metricsBatch) != 0 {
-		err := h.sendRequest(metricsBatch, &h.serverURL, client, limiter)
-		if err != nil {
-			h.appLogger.Log.Info("request sending is failed", zap.String("error", err.Error()))
-		}
+	metricsBatch = append(metricsBatch, h.takeDistributions()...)
+	if len(metricsBatch) == 0 {
+		return batch{}
+	}
+	h.seq++
+	return batch{AgentID: h.agentID, Seq: h.seq, Metrics: metricsBatch}
+}
 
+// takeDistributions забирает из хранилища накопленные histogram и summary: сервер добавляет
+// их к сохраненным, поэтому каждое значение отправляется один раз. Забранные значения не теряются,
+// если пакет не удалось отправить: он остается в очереди или в pending до повторной отправки.
+// Вызывается под блокировкой хранилища.
+func (h *Handler) takeDistributions() []model.Metrics {
+	var metrics []model.Metrics
+	for key, value := range h.storage.Histogram {
+		id, labels := storage.ParseSeriesKey(key)
+		metrics = append(metrics, model.Metrics{ID: id, MType: model.Histogram, Histogram: value, Labels: h.labels(labels)})
+		delete(h.storage.Histogram, key)
+	}
+	for key, value := range h.storage.Summary {
+		id, labels := storage.ParseSeriesKey(key)
+		metrics = append(metrics, model.Metrics{ID: id, MType: model.Summary, Summary: value, Labels: h.labels(labels)})
+		delete(h.storage.Summary, key)
 	}
-	h.storage.Mutex.RUnlock()
+	return metrics
 }
 
 func (h *Handler) SendMetrics(ctx context.Context, client *http.Client, limiter *async.Semaphore) {
@@ -162,26 +279,12 @@ func (h *Handler) SendMetrics(ctx context.Context, client *http.Client, limiter
 		select {
 		case <-ctx.Done():
 			h.SendMetricsHandler(client, limiter)
+			if len(h.pending) > 0 {
+				h.appLogger.Log.Warn("unsent batches are lost on shutdown, enable the queue to keep them", zap.Int("batches", len(h.pending)))
+			}
 			return
 		case <-sendTicker.C:
 			h.SendMetricsHandler(client, limiter)
 		}
 	}
 }
-
-func (h *Handler) GetAdditionalMetrics() {
-	cpuPercents, err := cpu.Percent(0, true)
-	if err != nil {
-		h.appLogger.Log.Info("getting CPU percentage failed", zap.String("error", err.Error()))
-		return
-	}
-	h.storage.Gauge["CPUtilization1"] = float64(cpuPercents[1])
-
-	v, err := mem.SwapMemory()
-	if err != nil {
-		h.appLogger.Log.Info("getting swap memory metrics failed", zap.String("error", err.Error()))
-		return
-	}
-	h.storage.Gauge["TotalMemory"] = float64(v.Total / (1024 * 1024))
-	h.storage.Gauge["FreeMemory"] = float64(v.Free / (1024 * 1024))
-}
@@ -0,0 +1,229 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/justEngineer/go-metrics-service/internal/distribution"
+	compression "github.com/justEngineer/go-metrics-service/internal/gzip"
+	"github.com/justEngineer/go-metrics-service/internal/http/server/config"
+	server "github.com/justEngineer/go-metrics-service/internal/http/server/handlers"
+	"github.com/justEngineer/go-metrics-service/internal/http/server/routing"
+	logger "github.com/justEngineer/go-metrics-service/internal/logger"
+	model "github.com/justEngineer/go-metrics-service/internal/models"
+	"github.com/justEngineer/go-metrics-service/internal/queue"
+	security "github.com/justEngineer/go-metrics-service/internal/security"
+	storage "github.com/justEngineer/go-metrics-service/internal/storage"
+)
+
+func TestSendRequestSign(t *testing.T) {
+	appLogger, err := logger.New("error")
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name          string
+		agentKey      string
+		serverKey     string
+		allowUnsigned bool
+		wantErr       bool
+	}{
+		{name: "no keys", agentKey: "", serverKey: ""},
+		{name: "same keys", agentKey: "secret", serverKey: "secret"},
+		{name: "different keys", agentKey: "secret", serverKey: "other", wantErr: true},
+		{name: "unsigned agent", agentKey: "", serverKey: "secret", wantErr: true},
+		{name: "unsigned agent during migration", agentKey: "", serverKey: "secret", allowUnsigned: true},
+		{name: "signed agent, server without key", agentKey: "secret", serverKey: ""},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			serverStorage := storage.New()
+			serverConfig := &config.ServerConfig{SHA256Key: tc.serverKey, AllowUnsigned: tc.allowUnsigned}
+			router := chi.NewRouter()
+			routing.SetMiddlewares(router, appLogger, &serverConfig.SHA256Key, serverConfig.AllowUnsigned, nil, false)
+			routing.SetRequestRouting(router, server.New(serverStorage, serverConfig, appLogger))
+			ts := httptest.NewServer(router)
+			defer ts.Close()
+
+			agent := New(storage.New(), &ClientConfig{SHA256Key: tc.agentKey}, appLogger)
+			value := 42.5
+			url := ts.URL + "/updates/"
+			err := agent.sendRequest(batch{Metrics: []model.Metrics{{ID: "Alloc", MType: "gauge", Value: &value}}}, &url, ts.Client(), nil)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			stored, err := storage.GetGauge(context.Background(), serverStorage, "Alloc")
+			require.NoError(t, err)
+			assert.Equal(t, value, stored)
+		})
+	}
+}
+
+func TestSendRequestSignsCompressedBody(t *testing.T) {
+	appLogger, err := logger.New("error")
+	require.NoError(t, err)
+	var received *http.Request
+	var body []byte
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	agent := New(storage.New(), &ClientConfig{SHA256Key: "secret"}, appLogger)
+	delta := int64(1)
+	url := ts.URL + "/updates/"
+	b := batch{AgentID: "a1", Seq: 7, Metrics: []model.Metrics{{ID: "PollCount", MType: "counter", Delta: &delta}}}
+	require.NoError(t, agent.sendRequest(b, &url, ts.Client(), nil))
+	require.NotNil(t, received)
+	assert.Equal(t, "gzip", received.Header.Get("Content-Encoding"))
+	assert.True(t, security.CheckSign(security.SignedData(received.Header, body), received.Header.Get(security.HashHeader), "secret"))
+	assert.False(t, security.CheckSign(body, received.Header.Get(security.HashHeader), "secret"), "sign must cover the batch number")
+}
+
+func TestSendMetricsQueue(t *testing.T) {
+	appLogger, err := logger.New("error")
+	require.NoError(t, err)
+	var available atomic.Bool
+	var received [][]model.Metrics
+	ts := httptest.NewServer(compression.GzipMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !available.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var batch []model.Metrics
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&batch))
+		received = append(received, batch)
+	})))
+	defer ts.Close()
+
+	dir := t.TempDir()
+	outbox, err := queue.Open(dir, 1<<20, 1<<16)
+	require.NoError(t, err)
+	agentStorage := storage.New()
+	agent := New(agentStorage, &ClientConfig{}, appLogger)
+	agent.serverURL = ts.URL + "/updates/"
+	agent.SetQueue(outbox)
+
+	for i := int64(1); i <= 3; i++ {
+		agentStorage.Counter["PollCount"] = i
+		agent.SendMetricsHandler(ts.Client(), nil)
+		agent.retryAt = time.Time{}
+	}
+	assert.Empty(t, received)
+	assert.Equal(t, 3, outbox.Len())
+	require.NoError(t, outbox.Close())
+
+	// очередь переживает перезапуск агента
+	outbox, err = queue.Open(dir, 1<<20, 1<<16)
+	require.NoError(t, err)
+	defer outbox.Close()
+	agent = New(agentStorage, &ClientConfig{}, appLogger)
+	agent.serverURL = ts.URL + "/updates/"
+	agent.SetQueue(outbox)
+
+	available.Store(true)
+	agentStorage.Counter["PollCount"] = 4
+	agent.SendMetricsHandler(ts.Client(), nil)
+	require.Len(t, received, 4)
+	for i, batch := range received {
+		var pollCount int64
+		for _, metric := range batch {
+			if metric.ID == "PollCount" {
+				pollCount = *metric.Delta
+			}
+		}
+		assert.Equal(t, int64(i+1), pollCount, "batches must be replayed in order")
+	}
+	assert.Equal(t, 0, outbox.Len())
+	assert.Equal(t, float64(3), agentStorage.Gauge[queueDepthMetric])
+}
+
+func TestSendMetricsDeltas(t *testing.T) {
+	appLogger, err := logger.New("error")
+	require.NoError(t, err)
+	serverStorage := storage.New()
+	serverConfig := &config.ServerConfig{}
+	router := chi.NewRouter()
+	routing.SetMiddlewares(router, appLogger, &serverConfig.SHA256Key, false, nil, false)
+	routing.SetRequestRouting(router, server.New(serverStorage, serverConfig, appLogger))
+	var available atomic.Bool
+	available.Store(true)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !available.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		router.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	agentStorage := storage.New()
+	agent := New(agentStorage, &ClientConfig{}, appLogger)
+	agent.serverURL = ts.URL + "/updates/"
+	serverCounter := func() int64 {
+		value, err := storage.GetCounter(context.Background(), serverStorage, "PollCount")
+		require.NoError(t, err)
+		return value
+	}
+	poll := func(n int64) {
+		agentStorage.Mutex.Lock()
+		agentStorage.Counter["PollCount"] += n
+		agentStorage.Mutex.Unlock()
+	}
+
+	poll(3)
+	agent.SendMetricsHandler(ts.Client(), nil)
+	poll(2)
+	agent.SendMetricsHandler(ts.Client(), nil)
+	assert.Equal(t, int64(5), serverCounter(), "server counter grows by deltas only")
+
+	// неотправленный пакет повторяется с тем же номером, новые приращения ждут следующего пакета
+	available.Store(false)
+	poll(4)
+	summary := distribution.NewSketch(distribution.DefaultRelativeAccuracy)
+	summary.Add(10)
+	agentStorage.Summary["rtt"] = summary
+	agent.SendMetricsHandler(ts.Client(), nil)
+	require.Len(t, agent.pending, 1)
+	poll(1)
+	available.Store(true)
+	agent.SendMetricsHandler(ts.Client(), nil)
+	assert.Empty(t, agent.pending)
+	assert.Equal(t, int64(10), serverCounter())
+	stored, err := storage.GetSummary(context.Background(), serverStorage, "rtt")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), stored.Count, "distributions taken into an unsent batch are delivered with it")
+
+	// повторно доставленный пакет не применяется
+	delta := int64(7)
+	duplicate := batch{AgentID: agent.agentID, Seq: agent.seq, Metrics: []model.Metrics{{ID: "PollCount", MType: "counter", Delta: &delta}}}
+	require.NoError(t, agent.send(duplicate, ts.Client(), nil))
+	assert.Equal(t, int64(10), serverCounter())
+	duplicate.Seq++
+	require.NoError(t, agent.send(duplicate, ts.Client(), nil))
+	assert.Equal(t, int64(17), serverCounter())
+
+	// из отклоненного пакета теряется только метрика, которую сервер не принимает
+	agent.seq = duplicate.Seq
+	require.NoError(t, serverStorage.Set(context.Background(), storage.NewHistogram("latency", distribution.NewHistogram([]float64{1}))))
+	histogram := distribution.NewHistogram([]float64{2})
+	histogram.Observe(1.5)
+	agentStorage.Histogram["latency"] = histogram
+	poll(3)
+	agent.SendMetricsHandler(ts.Client(), nil)
+	assert.Empty(t, agent.pending)
+	assert.Equal(t, int64(20), serverCounter())
+}
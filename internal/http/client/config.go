@@ -4,13 +4,19 @@ import (
 	"crypto/rsa"
 	"encoding/json"
 	"flag"
+	"fmt"
 	"log"
 	"os"
 	"strconv"
 
+	"github.com/justEngineer/go-metrics-service/internal/collector"
 	security "github.com/justEngineer/go-metrics-service/internal/security"
+	storage "github.com/justEngineer/go-metrics-service/internal/storage"
 )
 
+// DefaultQueueMaxBytes максимальный размер очереди неотправленных пакетов на диске по умолчанию.
+const DefaultQueueMaxBytes = 64 << 20
+
 type ClientConfig struct {
 	Endpoint        string `json:"address"`
 	ReportInterval  uint64 `json:"poll_interval"`
@@ -20,6 +26,18 @@ type ClientConfig struct {
 	RateLimit       uint64
 	PublicKeyPath   string `json:"crypto_key"`
 	PublicCryptoKey *rsa.PublicKey
+	Labels          map[string]string `json:"labels"`
+	GRPCEndpoint    string            `json:"grpc_address"`
+	QueueDir        string            `json:"queue_dir"`
+	QueueMaxBytes   int64             `json:"queue_max_bytes"`
+	// Collectors включает и выключает коллекторы метрик и задает их интервалы опроса.
+	Collectors map[string]collector.Settings `json:"collectors"`
+	ProcRoot   string                        `json:"proc_root"`
+	CgroupRoot string                        `json:"cgroup_root"`
+	// Локальная точка приема метрик приложений; пустой адрес выключает соответствующий прием.
+	PushAddress       string `json:"push_address"`        // HTTP адрес, например localhost:8081
+	PushSocket        string `json:"push_socket"`         // путь к Unix сокету для HTTP
+	PushStatsDAddress string `json:"push_statsd_address"` // UDP адрес для строк StatsD
 }
 
 func loadConfigFromFile(path string) (ClientConfig, error) {
@@ -49,6 +67,8 @@ func Parse() ClientConfig {
 	var cfg ClientConfig
 	var publicKeyPath string
 	var configFilePath string
+	var labels string
+	var collectors, collectorIntervals string
 	flag.StringVar(&cfg.Endpoint, "a", "localhost:8080", "server host/port")
 	flag.Uint64Var(&cfg.ReportInterval, "r", 10, "update notification sending interval")
 	flag.Uint64Var(&cfg.PollInterval, "p", 2, "polling stats interval")
@@ -57,6 +77,17 @@ func Parse() ClientConfig {
 	flag.StringVar(&publicKeyPath, "crypto-key", "", "path to the public encryption key")
 	flag.Uint64Var(&cfg.RateLimit, "l", 1, "max rate limit of outgoing requests")
 	flag.StringVar(&configFilePath, "c", "", "path to the configuration file")
+	flag.StringVar(&labels, "labels", "", "labels added to every metric, e.g. host=a,region=b")
+	flag.StringVar(&cfg.GRPCEndpoint, "grpc", "", "server gRPC host/port, metrics are sent over gRPC when set")
+	flag.StringVar(&cfg.QueueDir, "queue-dir", "", "directory of the on-disk queue for unsent batches, disabled when empty")
+	flag.Int64Var(&cfg.QueueMaxBytes, "queue-max-bytes", 0, fmt.Sprintf("max size of the on-disk queue in bytes (default %d)", DefaultQueueMaxBytes))
+	flag.StringVar(&collectors, "collectors", "", "enabled collectors, e.g. runtime,cpu,memory; all collectors are enabled when empty")
+	flag.StringVar(&cfg.ProcRoot, "proc-root", "", "procfs mount point read by host collectors (default /proc)")
+	flag.StringVar(&cfg.CgroupRoot, "cgroup-root", "", "cgroup v2 mount point read by process and cgroup collectors (default /sys/fs/cgroup)")
+	flag.StringVar(&cfg.PushAddress, "push-address", "", "local HTTP address accepting application metrics, e.g. localhost:8081")
+	flag.StringVar(&cfg.PushSocket, "push-socket", "", "unix socket path accepting application metrics over HTTP")
+	flag.StringVar(&cfg.PushStatsDAddress, "push-statsd", "", "local UDP address accepting application StatsD lines, e.g. localhost:8125")
+	flag.StringVar(&collectorIntervals, "collector-intervals", "", "collector polling intervals, e.g. runtime=2s,filesystem=30s")
 	flag.Parse()
 	if res := os.Getenv("ADDRESS"); res != "" {
 		cfg.Endpoint = res
@@ -88,6 +119,55 @@ func Parse() ClientConfig {
 		}
 		cfg.RateLimit = uint64(value)
 	}
+	if res := os.Getenv("QUEUE_DIR"); res != "" {
+		cfg.QueueDir = res
+	}
+	if res := os.Getenv("QUEUE_MAX_BYTES"); res != "" {
+		value, err := strconv.ParseInt(res, 10, 64)
+		if err != nil {
+			log.Fatal(err)
+		}
+		cfg.QueueMaxBytes = value
+	}
+	if res := os.Getenv("GRPC_ADDRESS"); res != "" {
+		cfg.GRPCEndpoint = res
+	}
+	if res := os.Getenv("LABELS"); res != "" {
+		labels = res
+	}
+	if labels != "" {
+		var err error
+		cfg.Labels, err = storage.ParseLabels(labels)
+		if err != nil {
+			log.Fatalf("Labels parse error: %s", err)
+		}
+	}
+	if res := os.Getenv("PROC_ROOT"); res != "" {
+		cfg.ProcRoot = res
+	}
+	if res := os.Getenv("CGROUP_ROOT"); res != "" {
+		cfg.CgroupRoot = res
+	}
+	if res := os.Getenv("PUSH_ADDRESS"); res != "" {
+		cfg.PushAddress = res
+	}
+	if res := os.Getenv("PUSH_SOCKET"); res != "" {
+		cfg.PushSocket = res
+	}
+	if res := os.Getenv("PUSH_STATSD_ADDRESS"); res != "" {
+		cfg.PushStatsDAddress = res
+	}
+	if res := os.Getenv("COLLECTORS"); res != "" {
+		collectors = res
+	}
+	if res := os.Getenv("COLLECTOR_INTERVALS"); res != "" {
+		collectorIntervals = res
+	}
+	var err error
+	cfg.Collectors, err = collector.ParseSettings(collector.NewRegistry(), collectors, collectorIntervals)
+	if err != nil {
+		log.Fatalf("Collectors parse error: %s", err)
+	}
 	if cryptoKeyEnv := os.Getenv("CRYPTO_KEY"); cryptoKeyEnv != "" {
 		publicKeyPath = cryptoKeyEnv
 	}
@@ -110,6 +190,30 @@ func Parse() ClientConfig {
 		if cfg.Endpoint == "" {
 			cfg.Endpoint = fileConfig.Endpoint
 		}
+		if cfg.GRPCEndpoint == "" {
+			cfg.GRPCEndpoint = fileConfig.GRPCEndpoint
+		}
+		if cfg.QueueDir == "" {
+			cfg.QueueDir = fileConfig.QueueDir
+		}
+		if cfg.QueueMaxBytes == 0 {
+			cfg.QueueMaxBytes = fileConfig.QueueMaxBytes
+		}
+		if cfg.ProcRoot == "" {
+			cfg.ProcRoot = fileConfig.ProcRoot
+		}
+		if cfg.CgroupRoot == "" {
+			cfg.CgroupRoot = fileConfig.CgroupRoot
+		}
+		if cfg.PushAddress == "" {
+			cfg.PushAddress = fileConfig.PushAddress
+		}
+		if cfg.PushSocket == "" {
+			cfg.PushSocket = fileConfig.PushSocket
+		}
+		if cfg.PushStatsDAddress == "" {
+			cfg.PushStatsDAddress = fileConfig.PushStatsDAddress
+		}
 		if cfg.ReportInterval == 0 {
 			cfg.ReportInterval = fileConfig.ReportInterval
 		}
@@ -119,6 +223,28 @@ func Parse() ClientConfig {
 		if cfg.PublicCryptoKey.Size() == 0 {
 			cfg.PublicCryptoKey = fileConfig.PublicCryptoKey
 		}
+		if len(cfg.Labels) == 0 {
+			if err := storage.ValidateLabels(fileConfig.Labels); err != nil {
+				log.Fatalf("Labels parse error: %s", err)
+			}
+			cfg.Labels = fileConfig.Labels
+		}
+		for name, settings := range fileConfig.Collectors {
+			flagSettings := cfg.Collectors[name]
+			if flagSettings.Enabled == nil {
+				flagSettings.Enabled = settings.Enabled
+			}
+			if flagSettings.Interval == 0 {
+				flagSettings.Interval = settings.Interval
+			}
+			flagSettings.Pidfiles = settings.Pidfiles
+			flagSettings.Names = settings.Names
+			flagSettings.Cgroups = settings.Cgroups
+			cfg.Collectors[name] = flagSettings
+		}
+	}
+	if cfg.QueueMaxBytes == 0 {
+		cfg.QueueMaxBytes = DefaultQueueMaxBytes
 	}
 	return cfg
 }
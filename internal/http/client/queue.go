@@ -0,0 +1,193 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/cenkalti/backoff"
+	"go.uber.org/zap"
+
+	async "github.com/justEngineer/go-metrics-service/internal/async"
+	model "github.com/justEngineer/go-metrics-service/internal/models"
+	"github.com/justEngineer/go-metrics-service/internal/queue"
+)
+
+// Имена метрик состояния очереди неотправленных пакетов.
+const (
+	queueDepthMetric   = "AgentQueueDepth"
+	queueDroppedMetric = "AgentQueueDroppedBatches"
+)
+
+// batch пакет метрик с идентификатором экземпляра агента и номером пакета.
+// В очереди пакет хранится в JSON вместе с номером, чтобы при повторной отправке сервер распознал дубликат.
+type batch struct {
+	AgentID string          `json:"agent_id"`
+	Seq     uint64          `json:"seq"`
+	Metrics []model.Metrics `json:"metrics"`
+}
+
+// errRejected возвращается, если сервер отклонил пакет; такой пакет не отправляется повторно целиком,
+// его метрики отправляются по одной методом salvage.
+var errRejected = errors.New("server rejected metrics")
+
+// SetQueue включает сохранение пакетов, не отправленных из-за недоступности сервера, в очередь на диске.
+// Пакеты из очереди отправляются повторно по порядку с экспоненциально растущей паузой.
+func (h *Handler) SetQueue(q *queue.Queue) {
+	h.queue = q
+	h.backoff = backoff.NewExponentialBackOff()
+	h.backoff.MaxElapsedTime = 0
+}
+
+// updateQueueMetrics записывает в хранилище агента глубину очереди и количество удаленных при переполнении пакетов.
+func (h *Handler) updateQueueMetrics() {
+	if h.queue == nil {
+		return
+	}
+	dropped := h.queue.Dropped()
+	h.storage.Mutex.Lock()
+	h.storage.Gauge[queueDepthMetric] = float64(h.queue.Len())
+	h.storage.Counter[queueDroppedMetric] += int64(dropped - h.reportedDropped)
+	h.storage.Mutex.Unlock()
+	h.reportedDropped = dropped
+}
+
+// deliver отправляет пакет на сервер. Если сервер недоступен, пакет сохраняется в очередь;
+// пока очередь не пуста, новые пакеты ставятся в ее конец, чтобы сохранить порядок отправки.
+// Возвращает false, если пакет не удалось ни отправить, ни сохранить в очередь.
+// Отклоненный сервером пакет считается обработанным: повторная отправка его не исправит, поэтому
+// его метрики отправляются по одной и теряются только те, которые сервер не принимает.
+func (h *Handler) deliver(b batch, client *http.Client, limiter *async.Semaphore) bool {
+	if h.queue == nil || h.queue.Len() == 0 {
+		err := h.send(b, client, limiter)
+		if err == nil {
+			return true
+		}
+		h.appLogger.Log.Info("request sending is failed", zap.String("error", err.Error()))
+		if errors.Is(err, errRejected) {
+			h.keep(h.salvage(b, client, limiter))
+			return true
+		}
+		if h.queue == nil {
+			return false
+		}
+		h.retryAt = time.Now().Add(h.backoff.NextBackOff())
+		return h.enqueue(b)
+	}
+	if !h.enqueue(b) {
+		return false
+	}
+	h.replay(client, limiter)
+	return true
+}
+
+// salvage отправляет метрики отклоненного сервером пакета по одной. Каждая метрика отправляется пакетом
+// отдельной последовательности с идентификатором <идентификатор агента>.<номер пакета>, поэтому сервер
+// распознает их повторную доставку независимо от основной последовательности пакетов агента.
+// Пакет из одной метрики не разбивается, а удаляется. Возвращает пакеты, которые не удалось отправить
+// из-за недоступности сервера.
+func (h *Handler) salvage(b batch, client *http.Client, limiter *async.Semaphore) []batch {
+	if len(b.Metrics) < 2 {
+		for _, metric := range b.Metrics {
+			h.appLogger.Log.Warn("rejected metric is dropped", zap.String("id", metric.ID), zap.String("type", metric.MType))
+		}
+		return nil
+	}
+	parts := make([]batch, 0, len(b.Metrics))
+	for i, metric := range b.Metrics {
+		part := batch{Metrics: []model.Metrics{metric}}
+		if b.AgentID != "" {
+			part.AgentID = b.AgentID + "." + strconv.FormatUint(b.Seq, 10)
+			part.Seq = uint64(i + 1)
+		}
+		parts = append(parts, part)
+	}
+	for i, part := range parts {
+		err := h.send(part, client, limiter)
+		switch {
+		case err == nil:
+		case errors.Is(err, errRejected):
+			metric := part.Metrics[0]
+			h.appLogger.Log.Warn("rejected metric is dropped", zap.String("id", metric.ID), zap.String("type", metric.MType), zap.Error(err))
+		default:
+			return parts[i:]
+		}
+	}
+	return nil
+}
+
+// keep сохраняет пакеты, которые не удалось отправить, для повторной отправки: в очередь, если она включена,
+// иначе в память до следующей отправки.
+func (h *Handler) keep(batches []batch) {
+	if len(batches) == 0 {
+		return
+	}
+	if h.queue == nil {
+		h.pending = append(h.pending, batches...)
+		return
+	}
+	h.retryAt = time.Now().Add(h.backoff.NextBackOff())
+	for i, b := range batches {
+		if !h.enqueue(b) {
+			h.pending = append(h.pending, batches[i:]...)
+			return
+		}
+	}
+}
+
+func (h *Handler) enqueue(b batch) bool {
+	data, err := json.Marshal(b)
+	if err != nil {
+		h.appLogger.Log.Warn("batch encoding failed", zap.Error(err))
+		return false
+	}
+	if err = h.queue.Push(data); err != nil {
+		h.appLogger.Log.Warn("batch wasn't queued", zap.Error(err))
+		return false
+	}
+	return true
+}
+
+// decodeBatch разбирает пакет из очереди; пакеты, сохраненные предыдущими версиями агента, хранятся как массив метрик.
+func decodeBatch(data []byte) (batch, error) {
+	var b batch
+	if len(data) > 0 && data[0] == '[' {
+		err := json.Unmarshal(data, &b.Metrics)
+		return b, err
+	}
+	err := json.Unmarshal(data, &b)
+	return b, err
+}
+
+// replay отправляет пакеты из очереди по порядку, пока сервер их принимает.
+func (h *Handler) replay(client *http.Client, limiter *async.Semaphore) {
+	for !time.Now().Before(h.retryAt) {
+		data, err := h.queue.Peek()
+		if errors.Is(err, queue.ErrEmpty) {
+			h.backoff.Reset()
+			return
+		}
+		if err != nil {
+			h.appLogger.Log.Warn("queue read failed", zap.Error(err))
+			return
+		}
+		b, err := decodeBatch(data)
+		if err != nil {
+			h.appLogger.Log.Warn("queued batch is corrupted and skipped", zap.Error(err))
+		} else if err = h.send(b, client, limiter); err != nil && !errors.Is(err, errRejected) {
+			h.retryAt = time.Now().Add(h.backoff.NextBackOff())
+			h.appLogger.Log.Info("queued batch sending is failed", zap.String("error", err.Error()), zap.Time("retry_at", h.retryAt))
+			return
+		} else if err != nil {
+			h.appLogger.Log.Warn("queued batch is rejected", zap.Error(err))
+			h.keep(h.salvage(b, client, limiter))
+		}
+		if err = h.queue.Ack(); err != nil {
+			h.appLogger.Log.Warn("queue acknowledge failed", zap.Error(err))
+			return
+		}
+		h.backoff.Reset()
+	}
+}
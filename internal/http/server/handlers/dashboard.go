@@ -0,0 +1,150 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/justEngineer/go-metrics-service/internal/storage"
+)
+
+// defaultDashboardRefresh интервал автоматического обновления страницы по умолчанию в секундах.
+const defaultDashboardRefresh = 10
+
+// dashboardRefreshOptions интервалы автоматического обновления, которые можно выбрать на странице.
+var dashboardRefreshOptions = []int{0, 5, 10, 30, 60}
+
+//go:embed dashboard
+var dashboardFiles embed.FS
+
+// dashboardTemplate разбирается один раз при запуске сервера.
+var dashboardTemplate = template.Must(template.New("index.html.tmpl").Funcs(template.FuncMap{
+	"timestamp": func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return t.UTC().Format(time.RFC3339)
+	},
+}).ParseFS(dashboardFiles, "dashboard/index.html.tmpl"))
+
+// dashboardMetric строка таблицы метрик на странице.
+type dashboardMetric struct {
+	Key       string    // идентификатор временного ряда
+	Name      string    // имя метрики
+	Labels    string    // метки в виде host=a,region=b для параметра labels
+	Value     string    // значение метрики
+	UpdatedAt time.Time // время последнего изменения
+}
+
+// dashboardSection таблица метрик одного типа.
+type dashboardSection struct {
+	Type    string
+	Title   string
+	Metrics []dashboardMetric
+}
+
+// dashboardPage данные страницы с метриками.
+type dashboardPage struct {
+	Filter         string
+	Refresh        int
+	RefreshOptions []int
+	Sections       []dashboardSection
+}
+
+// DashboardAssets возвращает обработчик статических файлов страницы с метриками.
+// Файлы встроены в исполняемый файл, поэтому страница не зависит от внешних CDN.
+func DashboardAssets() http.Handler {
+	static, err := fs.Sub(dashboardFiles, "dashboard/static")
+	if err != nil {
+		panic(err)
+	}
+	return http.FileServer(http.FS(static))
+}
+
+// MainPage выводит страницу с метриками типов gauge и counter, отсортированными по имени.
+// Параметр filter оставляет метрики, идентификатор которых содержит подстроку без учета регистра,
+// параметр refresh задает интервал автоматического обновления в секундах, 0 отключает обновление.
+func (h *Handler) MainPage(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.Error(w, "Wrong URL", http.StatusBadRequest)
+		return
+	}
+	page := dashboardPage{Filter: r.URL.Query().Get("filter"), Refresh: defaultDashboardRefresh}
+	if value := r.URL.Query().Get("refresh"); value != "" {
+		refresh, err := strconv.Atoi(value)
+		if err != nil || refresh < 0 {
+			http.Error(w, "Wrong 'refresh' parameter", http.StatusBadRequest)
+			return
+		}
+		page.Refresh = refresh
+	}
+	page.RefreshOptions = dashboardRefreshOptions
+	if !slices.Contains(page.RefreshOptions, page.Refresh) {
+		page.RefreshOptions = append(slices.Clone(page.RefreshOptions), page.Refresh)
+		slices.Sort(page.RefreshOptions)
+	}
+	for _, section := range []dashboardSection{{Type: "gauge", Title: "Gauges"}, {Type: "counter", Title: "Counters"}} {
+		metrics, err := h.dashboardMetrics(r.Context(), section.Type, page.Filter)
+		if err != nil {
+			h.appLogger.Log.Warn("Error while reading metrics from storage", zap.Error(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		section.Metrics = metrics
+		page.Sections = append(page.Sections, section)
+	}
+	var body bytes.Buffer
+	if err := dashboardTemplate.Execute(&body, page); err != nil {
+		h.appLogger.Log.Warn("Error while rendering main page", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	_, err := w.Write(body.Bytes())
+	if err != nil {
+		h.appLogger.Log.Warn("Error writing response body", zap.Error(err))
+	}
+}
+
+// dashboardMetrics читает все метрики типа mType постранично и отбирает содержащие filter.
+func (h *Handler) dashboardMetrics(ctx context.Context, mType string, filter string) ([]dashboardMetric, error) {
+	filter = strings.ToLower(filter)
+	metrics := []dashboardMetric{}
+	listFilter := storage.ListFilter{Type: mType, Limit: storage.MaxListLimit}
+	for {
+		result, err := h.storage.List(ctx, listFilter)
+		if err != nil {
+			return nil, err
+		}
+		for _, metric := range result.Metrics {
+			key := storage.SeriesKey(metric.ID, metric.Labels)
+			if !strings.Contains(strings.ToLower(key), filter) {
+				continue
+			}
+			row := dashboardMetric{Key: key, Name: metric.ID, Labels: storage.FormatLabels(metric.Labels), UpdatedAt: metric.UpdatedAt}
+			if metric.Value != nil {
+				row.Value = strconv.FormatFloat(*metric.Value, 'f', -1, 64)
+			} else if metric.Delta != nil {
+				row.Value = strconv.FormatInt(*metric.Delta, 10)
+			}
+			metrics = append(metrics, row)
+		}
+		if result.NextCursor == "" {
+			return metrics, nil
+		}
+		listFilter.After, err = storage.ParseListCursor(result.NextCursor)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
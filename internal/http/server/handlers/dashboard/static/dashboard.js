@@ -0,0 +1,233 @@
+// Страница с метриками: фильтр, автоматическое обновление значений и графики истории.
+(function () {
+    "use strict";
+
+    var historyWindow = 3600; // секунд истории на графике
+    var historyStep = "60s";
+    var serverFilter = (new URLSearchParams(location.search).get("filter") || "").toLowerCase();
+    var filterInput = document.getElementById("filter");
+    var refreshSelect = document.getElementById("refresh");
+    var timer = null;
+    var onScreen = new Set(); // строки в области просмотра
+    var drawing = Promise.resolve();
+
+    function rows() {
+        return Array.prototype.slice.call(document.querySelectorAll("tr[data-key]"));
+    }
+
+    function setQuery(name, value) {
+        var params = new URLSearchParams(location.search);
+        if (value) {
+            params.set(name, value);
+        } else {
+            params.delete(name);
+        }
+        var query = params.toString();
+        history.replaceState(null, "", query ? "?" + query : location.pathname);
+    }
+
+    function applyFilter() {
+        var filter = filterInput.value.toLowerCase();
+        document.querySelectorAll("section").forEach(function (section) {
+            var visible = 0;
+            section.querySelectorAll("tr[data-key]").forEach(function (row) {
+                var match = row.dataset.key.toLowerCase().indexOf(filter) >= 0;
+                row.hidden = !match;
+                if (match) {
+                    visible++;
+                }
+            });
+            section.querySelector(".count").textContent = visible;
+        });
+        setQuery("filter", filterInput.value);
+    }
+
+    function relativeTime(element) {
+        var value = element.getAttribute("datetime");
+        if (!value) {
+            return;
+        }
+        var seconds = Math.max(0, Math.round((Date.now() - Date.parse(value)) / 1000));
+        var text;
+        if (seconds < 60) {
+            text = seconds + "s ago";
+        } else if (seconds < 3600) {
+            text = Math.floor(seconds / 60) + "m ago";
+        } else if (seconds < 86400) {
+            text = Math.floor(seconds / 3600) + "h ago";
+        } else {
+            text = value;
+        }
+        element.textContent = text;
+        element.title = value;
+    }
+
+    function listMetrics(type, cursor, metrics) {
+        var url = "/api/v1/metrics?limit=1000&type=" + type + (cursor ? "&cursor=" + encodeURIComponent(cursor) : "");
+        return fetch(url).then(function (response) {
+            if (!response.ok) {
+                throw new Error("metrics list request failed with status " + response.status);
+            }
+            return response.json();
+        }).then(function (page) {
+            metrics = metrics.concat(page.metrics);
+            return page.next_cursor ? listMetrics(type, page.next_cursor, metrics) : metrics;
+        });
+    }
+
+    function seriesKey(metric) {
+        var names = Object.keys(metric.labels || {}).sort();
+        if (names.length === 0) {
+            return metric.id;
+        }
+        return metric.id + "{" + names.map(function (name) {
+            var value = metric.labels[name].replace(/\\/g, "\\\\").replace(/"/g, "\\\"").replace(/\n/g, "\\n");
+            return name + "=\"" + value + "\"";
+        }).join(",") + "}";
+    }
+
+    function updateSection(section) {
+        var type = section.dataset.type;
+        return listMetrics(type, "", []).then(function (metrics) {
+            var current = {};
+            section.querySelectorAll("tr[data-key]").forEach(function (row) {
+                current[row.dataset.key] = row;
+            });
+            var changedSet = false;
+            var seen = 0;
+            metrics.forEach(function (metric) {
+                var key = seriesKey(metric);
+                if (key.toLowerCase().indexOf(serverFilter) < 0) {
+                    return;
+                }
+                var row = current[key];
+                if (!row) {
+                    changedSet = true;
+                    return;
+                }
+                seen++;
+                var value = String(type === "counter" ? metric.delta : metric.value);
+                var cell = row.querySelector("td.value");
+                row.classList.toggle("changed", cell.textContent !== value);
+                cell.textContent = value;
+                var time = row.querySelector("time");
+                time.setAttribute("datetime", metric.updated_at);
+                relativeTime(time);
+            });
+            return changedSet || seen !== Object.keys(current).length;
+        });
+    }
+
+    function sparkline(row, type) {
+        var params = new URLSearchParams({
+            from: String(Math.floor(Date.now() / 1000) - historyWindow),
+            step: historyStep
+        });
+        if (row.dataset.labels) {
+            params.set("labels", row.dataset.labels);
+        }
+        var url = "/history/" + type + "/" + encodeURIComponent(row.dataset.name) + "?" + params.toString();
+        return fetch(url).then(function (response) {
+            return response.ok ? response.json() : {samples: []};
+        }).then(function (history) {
+            drawSparkline(row.querySelector("td.spark"), history.samples.map(function (sample) {
+                return sample.value;
+            }));
+        });
+    }
+
+    function drawSparkline(cell, values) {
+        var width = 120;
+        var height = 24;
+        cell.textContent = "";
+        if (values.length < 2) {
+            return;
+        }
+        var min = Math.min.apply(null, values);
+        var max = Math.max.apply(null, values);
+        var span = max - min || 1;
+        var points = values.map(function (value, i) {
+            var x = (i / (values.length - 1)) * width;
+            var y = height - 1 - ((value - min) / span) * (height - 2);
+            return x.toFixed(1) + "," + y.toFixed(1);
+        }).join(" ");
+        var ns = "http://www.w3.org/2000/svg";
+        var svg = document.createElementNS(ns, "svg");
+        svg.setAttribute("width", width);
+        svg.setAttribute("height", height);
+        svg.setAttribute("viewBox", "0 0 " + width + " " + height);
+        var line = document.createElementNS(ns, "polyline");
+        line.setAttribute("points", points);
+        svg.appendChild(line);
+        var title = document.createElementNS(ns, "title");
+        title.textContent = "min " + min + ", max " + max;
+        svg.appendChild(title);
+        cell.appendChild(svg);
+    }
+
+    // queueSparkline строит графики последовательно, чтобы не отправлять серверу много запросов одновременно.
+    function queueSparkline(row) {
+        var type = row.closest("section").dataset.type;
+        drawing = drawing.then(function () {
+            return sparkline(row, type);
+        }).catch(function (error) {
+            console.warn(error);
+        });
+        return drawing;
+    }
+
+    function drawSparklines() {
+        // при обновлении запрашивается история только видимых строк, остальные строятся при прокрутке
+        rows().filter(function (row) {
+            return !row.hidden && onScreen.has(row);
+        }).forEach(queueSparkline);
+        return drawing;
+    }
+
+    var observer = new IntersectionObserver(function (entries) {
+        entries.forEach(function (entry) {
+            if (!entry.isIntersecting) {
+                onScreen.delete(entry.target);
+                return;
+            }
+            onScreen.add(entry.target);
+            if (!entry.target.dataset.drawn) {
+                entry.target.dataset.drawn = "true";
+                queueSparkline(entry.target);
+            }
+        });
+    });
+
+    function refresh() {
+        var sections = Array.prototype.slice.call(document.querySelectorAll("section"));
+        Promise.all(sections.map(updateSection)).then(function (changed) {
+            if (changed.indexOf(true) >= 0) {
+                location.reload();
+                return;
+            }
+            return drawSparklines();
+        }).catch(function (error) {
+            console.warn(error);
+        }).then(schedule);
+    }
+
+    function schedule() {
+        clearTimeout(timer);
+        var seconds = parseInt(refreshSelect.value, 10);
+        if (seconds > 0) {
+            timer = setTimeout(refresh, seconds * 1000);
+        }
+    }
+
+    filterInput.addEventListener("input", applyFilter);
+    refreshSelect.addEventListener("change", function () {
+        setQuery("refresh", refreshSelect.value);
+        schedule();
+    });
+    document.querySelectorAll("time").forEach(relativeTime);
+    applyFilter();
+    rows().forEach(function (row) {
+        observer.observe(row);
+    });
+    schedule();
+})();
@@ -0,0 +1,138 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+
+	"github.com/justEngineer/go-metrics-service/internal/models"
+	"github.com/justEngineer/go-metrics-service/internal/pubsub"
+	"github.com/justEngineer/go-metrics-service/internal/storage"
+)
+
+// DeletedMetrics описывает ответ на удаление метрик по шаблону.
+type DeletedMetrics struct {
+	Deleted int `json:"deleted"`
+}
+
+// DeleteMetric удаляет метрику вместе с ее историей. Метки задаются параметром labels, как в GET /value/.
+func (h *Handler) DeleteMetric(w http.ResponseWriter, r *http.Request) {
+	valueType := chi.URLParam(r, "type")
+	if valueType != "gauge" && valueType != "counter" && !isDistribution(valueType) {
+		http.Error(w, "Unknown metric type", http.StatusBadRequest)
+		return
+	}
+	name, err := requestSeriesKey(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err = h.storage.Delete(r.Context(), valueType, name)
+	if err == nil {
+		h.publishOp(pubsub.OpDelete, valueType, name)
+	}
+	h.writeChangeResult(w, err)
+}
+
+// ResetCounter обнуляет метрику типа counter.
+func (h *Handler) ResetCounter(w http.ResponseWriter, r *http.Request) {
+	name, err := requestSeriesKey(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err = h.storage.ResetCounter(r.Context(), name)
+	if err == nil {
+		h.publishOp(pubsub.OpReset, models.Counter, name)
+	}
+	h.writeChangeResult(w, err)
+}
+
+// DeleteMetrics удаляет метрики, отобранные параметрами type, prefix и regex, и возвращает их количество.
+// Чтобы случайно не удалить все метрики, нужно указать prefix или regex.
+func (h *Handler) DeleteMetrics(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseSelector(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if filter.Prefix == "" && filter.Pattern == nil {
+		http.Error(w, "'prefix' or 'regex' parameter is required", http.StatusBadRequest)
+		return
+	}
+	// удаляемые метрики читаются заранее, только если есть подписчики на события
+	var matched []storage.Metric
+	if h.hub.Subscribers() > 0 {
+		matched, err = h.listAll(r.Context(), filter)
+	}
+	var deleted int
+	if err == nil {
+		deleted, err = h.storage.DeleteMetrics(r.Context(), filter)
+	}
+	if errors.Is(err, storage.ErrInvalidFilter) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		h.appLogger.Log.Warn("Error while deleting metrics", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	h.appLogger.Log.Info("Metrics deleted", zap.Int("count", deleted), zap.String("query", r.URL.RawQuery))
+	for _, metric := range matched {
+		h.hub.PublishOp(pubsub.OpDelete, models.Metrics{ID: metric.ID, MType: metric.MType, Labels: metric.Labels})
+	}
+	body, err := json.Marshal(DeletedMetrics{Deleted: deleted})
+	if err != nil {
+		h.appLogger.Log.Warn("Error converting response body to JSON", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(body)
+	if err != nil {
+		h.appLogger.Log.Warn("Error writing response body", zap.Error(err))
+	}
+}
+
+// writeChangeResult отвечает на удаление или сброс одной метрики.
+func (h *Handler) writeChangeResult(w http.ResponseWriter, err error) {
+	if errors.Is(err, storage.ErrMetricNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.appLogger.Log.Warn("Error while changing metric", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// listAll возвращает все метрики, отобранные фильтром, читая их постранично.
+func (h *Handler) listAll(ctx context.Context, filter storage.ListFilter) ([]storage.Metric, error) {
+	filter.Limit = storage.MaxListLimit
+	if err := filter.Normalize(); err != nil {
+		return nil, err
+	}
+	var metrics []storage.Metric
+	for {
+		result, err := h.storage.List(ctx, filter)
+		if err != nil {
+			return nil, err
+		}
+		metrics = append(metrics, result.Metrics...)
+		if result.NextCursor == "" {
+			return metrics, nil
+		}
+		filter.After, err = storage.ParseListCursor(result.NextCursor)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
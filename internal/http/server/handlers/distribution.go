@@ -0,0 +1,160 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/justEngineer/go-metrics-service/internal/distribution"
+	"github.com/justEngineer/go-metrics-service/internal/models"
+	storage "github.com/justEngineer/go-metrics-service/internal/storage"
+)
+
+// reportedQuantiles квантили, которые возвращаются для метрик типа histogram и summary.
+var reportedQuantiles = []struct {
+	name  string
+	value float64
+}{
+	{name: "p50", value: 0.5},
+	{name: "p90", value: 0.9},
+	{name: "p99", value: 0.99},
+}
+
+// errInvalidDistribution возвращается, если значение метрики типа histogram или summary некорректно.
+var errInvalidDistribution = errors.New("invalid distribution value")
+
+// isDistribution проверяет, описывает ли тип метрики распределение значений.
+func isDistribution(valueType string) bool {
+	return valueType == models.Histogram || valueType == models.Summary
+}
+
+// quantileFunc возвращает функцию вычисления квантилей сохраненной метрики типа histogram или summary.
+func (h *Handler) quantileFunc(ctx context.Context, valueType, key string) (func(float64) float64, error) {
+	if valueType == models.Histogram {
+		histogram, err := storage.GetHistogram(ctx, h.storage, key)
+		if err != nil {
+			return nil, err
+		}
+		return histogram.Quantile, nil
+	}
+	summary, err := storage.GetSummary(ctx, h.storage, key)
+	if err != nil {
+		return nil, err
+	}
+	return summary.Quantile, nil
+}
+
+// quantilesText возвращает квантили метрики в текстовом виде: значение квантиля q,
+// если он задан в виде 0.95 или p95, иначе строки вида "p50 12.5" для p50, p90 и p99.
+func quantilesText(quantile func(float64) float64, q string) (string, error) {
+	if q != "" {
+		value, err := parseQuantile(q)
+		if err != nil {
+			return "", err
+		}
+		return strconv.FormatFloat(quantile(value), 'f', -1, 64), nil
+	}
+	var body strings.Builder
+	for _, reported := range reportedQuantiles {
+		body.WriteString(reported.name + " " + strconv.FormatFloat(quantile(reported.value), 'f', -1, 64) + "\n")
+	}
+	return body.String(), nil
+}
+
+// quantilesMap возвращает квантили p50, p90 и p99; неопределенные значения пропускаются.
+func quantilesMap(quantile func(float64) float64) map[string]float64 {
+	result := make(map[string]float64, len(reportedQuantiles))
+	for _, reported := range reportedQuantiles {
+		if value := quantile(reported.value); !math.IsNaN(value) {
+			result[reported.name] = value
+		}
+	}
+	return result
+}
+
+func parseQuantile(q string) (float64, error) {
+	var value float64
+	var err error
+	if percentile, ok := strings.CutPrefix(q, "p"); ok {
+		value, err = strconv.ParseFloat(percentile, 64)
+		value /= 100
+	} else {
+		value, err = strconv.ParseFloat(q, 64)
+	}
+	if err != nil || value < 0 || value > 1 {
+		return 0, fmt.Errorf("wrong quantile: %q", q)
+	}
+	return value, nil
+}
+
+// observeDistribution добавляет одно значение к метрике типа histogram или summary.
+// Для гистограммы используются границы корзин уже сохраненной метрики.
+func (h *Handler) observeDistribution(ctx context.Context, valueType, key string, value float64) error {
+	if valueType == models.Histogram {
+		stored, err := storage.GetHistogram(ctx, h.storage, key)
+		if err != nil {
+			return fmt.Errorf("histogram buckets are not defined: %w", errInvalidDistribution)
+		}
+		histogram := distribution.NewHistogram(stored.Bounds)
+		histogram.Observe(value)
+		return h.storage.Set(ctx, storage.NewHistogram(key, histogram))
+	}
+	accuracy := distribution.DefaultRelativeAccuracy
+	if stored, err := storage.GetSummary(ctx, h.storage, key); err == nil {
+		accuracy = stored.RelativeAccuracy
+	}
+	summary := distribution.NewSketch(accuracy)
+	summary.Add(value)
+	return h.storage.Set(ctx, storage.NewSummary(key, summary))
+}
+
+// validateDistribution проверяет значение метрики типа histogram или summary, полученное в JSON.
+func validateDistribution(metric *models.Metrics) error {
+	if metric.MType == models.Histogram {
+		if metric.Histogram == nil {
+			return fmt.Errorf("histogram value is missing: %w", errInvalidDistribution)
+		}
+		if err := metric.Histogram.Validate(); err != nil {
+			return fmt.Errorf("%w: %s", errInvalidDistribution, err)
+		}
+		return nil
+	}
+	if metric.Summary == nil {
+		return fmt.Errorf("summary value is missing: %w", errInvalidDistribution)
+	}
+	if err := metric.Summary.Validate(); err != nil {
+		return fmt.Errorf("%w: %s", errInvalidDistribution, err)
+	}
+	return nil
+}
+
+// fillDistribution заполняет значение и квантили метрики типа histogram или summary из хранилища.
+func (h *Handler) fillDistribution(ctx context.Context, metric *models.Metrics, key string) error {
+	if metric.MType == models.Histogram {
+		histogram, err := storage.GetHistogram(ctx, h.storage, key)
+		if err != nil {
+			return err
+		}
+		metric.Histogram = histogram
+		metric.Quantiles = quantilesMap(histogram.Quantile)
+		return nil
+	}
+	summary, err := storage.GetSummary(ctx, h.storage, key)
+	if err != nil {
+		return err
+	}
+	metric.Summary = summary
+	metric.Quantiles = quantilesMap(summary.Quantile)
+	return nil
+}
+
+// isClientError проверяет, вызвана ли ошибка сохранения метрик некорректными данными клиента.
+func isClientError(err error) bool {
+	return errors.Is(err, errInvalidDistribution) ||
+		errors.Is(err, storage.ErrInvalidMetric) ||
+		errors.Is(err, distribution.ErrBucketsMismatch) ||
+		errors.Is(err, distribution.ErrAccuracyMismatch)
+}
@@ -7,10 +7,9 @@ import (
 
 	"time"
 
-	database "github.com/justEngineer/go-metrics-service/internal/database"
 	config "github.com/justEngineer/go-metrics-service/internal/http/server/config"
 	logger "github.com/justEngineer/go-metrics-service/internal/logger"
-	storage "github.com/justEngineer/go-metrics-service/internal/storage"
+	"github.com/justEngineer/go-metrics-service/internal/storage/registry"
 
 	"github.com/go-chi/chi/v5"
 )
@@ -23,10 +22,13 @@ func Example() {
 
 	cfg.Endpoint = "localhost:8080"
 	cfg.DatabaseDSN = "postgresql://localhost/dbname"
-	dbConnecton, _ := database.NewConnection(ctx, &cfg)
 	appLogger, _ := logger.New(cfg.LogLevel)
-	MetricStorage := storage.New()
-	ServerHandler := New(MetricStorage, &cfg, appLogger, dbConnecton)
+	MetricStorage, err := registry.Open(ctx, &cfg, appLogger)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer MetricStorage.Close()
+	ServerHandler := New(MetricStorage, &cfg, appLogger)
 
 	r.Post("/update/{type}/{name}/{value}", ServerHandler.UpdateMetric)
 	r.Get("/value/{type}/{name}", ServerHandler.GetMetric)
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/justEngineer/go-metrics-service/internal/storage"
+)
+
+// ListMetrics возвращает страницу списка метрик в формате JSON.
+// Параметры запроса: type - тип метрики, prefix - префикс имени, regex - регулярное выражение для имени,
+// sort - поле сортировки name или updated (с префиксом "-" по убыванию), limit - размер страницы,
+// cursor - значение next_cursor из предыдущего ответа.
+func (h *Handler) ListMetrics(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseListFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	result, err := h.storage.List(r.Context(), filter)
+	if errors.Is(err, storage.ErrInvalidFilter) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		h.appLogger.Log.Warn("Error while listing metrics", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	body, err := json.Marshal(result)
+	if err != nil {
+		h.appLogger.Log.Warn("Error converting response body to JSON", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(body)
+	if err != nil {
+		h.appLogger.Log.Warn("Error writing response body", zap.Error(err))
+	}
+}
+
+// parseListFilter разбирает параметры запроса списка метрик.
+func parseListFilter(r *http.Request) (storage.ListFilter, error) {
+	query := r.URL.Query()
+	filter, err := parseSelector(r)
+	if err != nil {
+		return filter, err
+	}
+	filter.Sort = query.Get("sort")
+	if strings.HasPrefix(filter.Sort, "-") {
+		filter.Sort = filter.Sort[1:]
+		filter.Desc = true
+	}
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			return filter, errors.New("wrong 'limit' parameter")
+		}
+		filter.Limit = limit
+	}
+	if value := query.Get("cursor"); value != "" {
+		cursor, err := storage.ParseListCursor(value)
+		if err != nil {
+			return filter, err
+		}
+		filter.After = cursor
+	}
+	return filter, filter.Normalize()
+}
+
+// parseSelector разбирает параметры type, prefix и regex, отбирающие метрики по типу и имени.
+func parseSelector(r *http.Request) (storage.ListFilter, error) {
+	query := r.URL.Query()
+	filter := storage.ListFilter{Type: query.Get("type"), Prefix: query.Get("prefix")}
+	if value := query.Get("regex"); value != "" {
+		pattern, err := regexp.Compile(value)
+		if err != nil {
+			return filter, errors.New("wrong 'regex' parameter")
+		}
+		filter.Pattern = pattern
+	}
+	return filter, nil
+}
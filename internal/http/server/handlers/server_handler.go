@@ -2,8 +2,7 @@
 package server
 
 import (
-	_ "embed"
-	"html/template"
+	"math"
 	"net/http"
 	"slices"
 	"strconv"
@@ -13,35 +12,41 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
-	"io"
+	"errors"
 
 	"github.com/go-chi/chi/v5"
 	"go.uber.org/zap"
 
-	database "github.com/justEngineer/go-metrics-service/internal/database"
+	"github.com/justEngineer/go-metrics-service/internal/alerting"
+	"github.com/justEngineer/go-metrics-service/internal/dedup"
 	config "github.com/justEngineer/go-metrics-service/internal/http/server/config"
 	logger "github.com/justEngineer/go-metrics-service/internal/logger"
 	"github.com/justEngineer/go-metrics-service/internal/models"
+	prometheus "github.com/justEngineer/go-metrics-service/internal/prometheus"
+	"github.com/justEngineer/go-metrics-service/internal/pubsub"
 	storage "github.com/justEngineer/go-metrics-service/internal/storage"
 )
 
-//go:embed main_page_html.tmpl
-var mainPageTemplateFile string
+// AlertsProvider возвращает текущие оповещения.
+type AlertsProvider interface {
+	Alerts() []alerting.Alert
+}
 
-// Storage интерфейс определяет методы, которые должны быть реализованы для работы с метриками.
-type Storage interface {
-	GetGaugeMetric(ctx context.Context, key string) (float64, error)
-	GetCounterMetric(ctx context.Context, key string) (int64, error)
-	SetGaugeMetric(ctx context.Context, key string, value float64) error
-	SetCounterMetric(ctx context.Context, key string, value int64) error
-	SetMetricsBatch(ctx context.Context, gaugesBatch []storage.GaugeMetric, countersBatch []storage.CounterMetric) error
+// MetricHistory описывает ответ с историей значений метрики.
+type MetricHistory struct {
+	ID      string            `json:"id"`
+	MType   string            `json:"type"`
+	Labels  map[string]string `json:"labels,omitempty"`
+	Samples []storage.Sample  `json:"samples"`
 }
 
 type Handler struct {
-	storage     Storage
-	config      *config.ServerConfig
-	appLogger   *logger.Logger
-	DatabaseDSN *database.Database
+	storage   storage.Backend
+	config    *config.ServerConfig
+	appLogger *logger.Logger
+	alerts    AlertsProvider
+	batches   *dedup.Tracker
+	hub       *pubsub.Hub
 }
 
 func TimeoutMiddleware(timeout time.Duration, next func(w http.ResponseWriter, r *http.Request)) func(w http.ResponseWriter, r *http.Request) {
@@ -58,15 +63,23 @@ func TimeoutMiddleware(timeout time.Duration, next func(w http.ResponseWriter, r
 	}
 }
 
-// New создает новый экземпляр Handler.
-func New(metricsService *storage.MemStorage, config *config.ServerConfig, log *logger.Logger, conn *database.Database) *Handler {
-	if config.DatabaseDSN == "" {
-		return &Handler{metricsService, config, log, conn}
-	} else {
-		return &Handler{conn, config, log, conn}
-	}
+// New создает новый экземпляр Handler, работающий с хранилищем metricsStorage.
+func New(metricsStorage storage.Backend, config *config.ServerConfig, log *logger.Logger) *Handler {
+	return &Handler{metricsStorage, config, log, nil, dedup.New(dedup.DefaultTTL), pubsub.New(pubsub.DefaultBufferSize)}
 }
 
+// Storage возвращает хранилище метрик, с которым работает обработчик.
+func (h *Handler) Storage() storage.Backend {
+	return h.storage
+}
+
+// SetAlerts задает источник оповещений для GET /alerts.
+func (h *Handler) SetAlerts(alerts AlertsProvider) {
+	h.alerts = alerts
+}
+
+// GetMetric возвращает текущее значение метрики. Параметр labels выбирает временной ряд точно:
+// метки должны совпадать со всеми метками ряда, а не с их подмножеством.
 func (h *Handler) GetMetric(w http.ResponseWriter, r *http.Request) {
 	urlPart := strings.Split(r.URL.Path, "/")
 	idx := slices.IndexFunc(urlPart, func(c string) bool { return c == "value" })
@@ -75,22 +88,37 @@ func (h *Handler) GetMetric(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	valueType := chi.URLParam(r, "type")
-	name := chi.URLParam(r, "name")
+	name, err := requestSeriesKey(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	var body string
 	if valueType == "gauge" {
-		val, err := h.storage.GetGaugeMetric(context.Background(), name)
+		val, err := storage.GetGauge(r.Context(), h.storage, name)
 		if err == nil {
 			body = strconv.FormatFloat(val, 'f', -1, 64)
 		} else {
 			w.WriteHeader(http.StatusNotFound)
 		}
 	} else if valueType == "counter" {
-		val, err := h.storage.GetCounterMetric(context.Background(), name)
+		val, err := storage.GetCounter(r.Context(), h.storage, name)
 		if err == nil {
 			body = strconv.FormatInt(val, 10)
 		} else {
 			w.WriteHeader(http.StatusNotFound)
 		}
+	} else if isDistribution(valueType) {
+		quantile, err := h.quantileFunc(r.Context(), valueType, name)
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		body, err = quantilesText(quantile, r.URL.Query().Get("quantile"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 	} else {
 		http.Error(w, "Unknown metric type", http.StatusBadRequest)
 		return
@@ -99,7 +127,7 @@ func (h *Handler) GetMetric(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
 	w.WriteHeader(http.StatusOK)
 	// пишем тело ответа
-	_, err := w.Write([]byte(body))
+	_, err = w.Write([]byte(body))
 	if err != nil {
 		panic(err)
 	}
@@ -113,17 +141,22 @@ func (h *Handler) UpdateMetric(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	valueType := chi.URLParam(r, "type")
-	name := chi.URLParam(r, "name")
+	name, err := requestSeriesKey(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	valueStr := chi.URLParam(r, "value")
 	if valueType == "gauge" {
 		value, err := strconv.ParseFloat(valueStr, 64)
 		if err == nil {
-			err = h.storage.SetGaugeMetric(context.Background(), name, value)
+			err = h.storage.Set(r.Context(), storage.NewGauge(name, value))
 			if err != nil {
 				h.appLogger.Log.Warn("Error while updating gauge metric", zap.Error(err))
 				w.WriteHeader(http.StatusInternalServerError)
 				return
 			}
+			h.publishUpdate(valueType, name, func(metric *models.Metrics) { metric.Value = &value })
 		} else {
 			http.Error(w, "Wrong data type, float64 is expected", http.StatusBadRequest)
 			return
@@ -131,16 +164,28 @@ func (h *Handler) UpdateMetric(w http.ResponseWriter, r *http.Request) {
 	} else if valueType == "counter" {
 		value, err := strconv.ParseInt(valueStr, 10, 64)
 		if err == nil {
-			err = h.storage.SetCounterMetric(context.Background(), name, value)
+			err = h.storage.Set(r.Context(), storage.NewCounter(name, value))
 			if err != nil {
 				h.appLogger.Log.Warn("Error while updating counter metric", zap.Error(err))
 				w.WriteHeader(http.StatusInternalServerError)
 				return
 			}
+			h.publishUpdate(valueType, name, func(metric *models.Metrics) { metric.Delta = &value })
 		} else {
 			http.Error(w, "Wrong data type, int64 is expected", http.StatusBadRequest)
 			return
 		}
+	} else if isDistribution(valueType) {
+		value, err := strconv.ParseFloat(valueStr, 64)
+		if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+			http.Error(w, "Wrong data type, finite float64 is expected", http.StatusBadRequest)
+			return
+		}
+		if err = h.observeDistribution(r.Context(), valueType, name, value); err != nil {
+			h.writeUpdateError(w, err)
+			return
+		}
+		h.publishUpdate(valueType, name, func(metric *models.Metrics) { metric.Value = &value })
 	} else {
 		http.Error(w, "Unknown metric type", http.StatusBadRequest)
 		return
@@ -152,37 +197,6 @@ func (h *Handler) UpdateMetric(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
-func (h *Handler) MainPage(w http.ResponseWriter, r *http.Request) {
-	urlPart := strings.Split(r.URL.Path, "/")
-	if len(urlPart) > 2 {
-		http.Error(w, "Wrong URL", http.StatusBadRequest)
-		return
-	}
-	if len(urlPart[1]) != 0 {
-		http.Error(w, "Wrong URL", http.StatusBadRequest)
-		return
-	}
-	tmpl, err := template.New("mainPage").Parse(mainPageTemplateFile)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		panic(err)
-	}
-	var body bytes.Buffer
-	err = tmpl.Execute(io.Writer(&body), h.storage)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	w.WriteHeader(http.StatusOK)
-	_, err = w.Write(body.Bytes())
-	if err != nil {
-		h.appLogger.Log.Warn("Error writing response body", zap.Error(err))
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
-}
-
 func (h *Handler) GetMetricAsJSON(w http.ResponseWriter, r *http.Request) {
 	var requestedMetric models.Metrics
 	var buffer bytes.Buffer
@@ -197,8 +211,13 @@ func (h *Handler) GetMetricAsJSON(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
+	if err = storage.ValidateLabels(requestedMetric.Labels); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	key := storage.SeriesKey(requestedMetric.ID, requestedMetric.Labels)
 	if requestedMetric.MType == "gauge" {
-		val, err := h.storage.GetGaugeMetric(context.Background(), requestedMetric.ID)
+		val, err := storage.GetGauge(r.Context(), h.storage, key)
 		if err == nil {
 			requestedMetric.Value = &val
 		} else {
@@ -207,7 +226,7 @@ func (h *Handler) GetMetricAsJSON(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 	} else if requestedMetric.MType == "counter" {
-		val, err := h.storage.GetCounterMetric(context.Background(), requestedMetric.ID)
+		val, err := storage.GetCounter(r.Context(), h.storage, key)
 		if err == nil {
 			requestedMetric.Delta = &val
 		} else {
@@ -215,6 +234,12 @@ func (h *Handler) GetMetricAsJSON(w http.ResponseWriter, r *http.Request) {
 			w.WriteHeader(http.StatusNotFound)
 			return
 		}
+	} else if isDistribution(requestedMetric.MType) {
+		if err = h.fillDistribution(r.Context(), &requestedMetric, key); err != nil {
+			h.appLogger.Log.Info("Metric is not found", zap.Error(err))
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
 	} else {
 		w.WriteHeader(http.StatusBadRequest)
 		return
@@ -249,26 +274,37 @@ func (h *Handler) UpdateMetricFromJSON(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
-	if requestedMetric.MType == "gauge" {
-		err = h.storage.SetGaugeMetric(context.Background(), requestedMetric.ID, *requestedMetric.Value)
-		if err != nil {
-			h.appLogger.Log.Warn("Error while updating gauge metric", zap.Error(err))
-			w.WriteHeader(http.StatusInternalServerError)
+	if err = storage.ValidateLabels(requestedMetric.Labels); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	key := storage.SeriesKey(requestedMetric.ID, requestedMetric.Labels)
+	accepted := requestedMetric
+	if !isKnownType(requestedMetric.MType) {
+		http.Error(w, "Unknown metric type", http.StatusBadRequest)
+		return
+	}
+	if isDistribution(requestedMetric.MType) {
+		if err = validateDistribution(&requestedMetric); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-	} else if requestedMetric.MType == "counter" {
-		err = h.storage.SetCounterMetric(context.Background(), requestedMetric.ID, *requestedMetric.Delta)
-		if err != nil {
-			h.appLogger.Log.Warn("Error while updating gauge metric", zap.Error(err))
+	}
+	if err = h.storage.Set(r.Context(), storage.FromModel(requestedMetric)); err != nil {
+		h.writeUpdateError(w, err)
+		return
+	}
+	if requestedMetric.MType == "counter" {
+		val, _ := storage.GetCounter(r.Context(), h.storage, key)
+		requestedMetric.Delta = &val
+	} else if isDistribution(requestedMetric.MType) {
+		if err = h.fillDistribution(r.Context(), &requestedMetric, key); err != nil {
+			h.appLogger.Log.Warn("Error while reading updated metric", zap.Error(err))
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
-		val, _ := h.storage.GetCounterMetric(context.Background(), requestedMetric.ID)
-		requestedMetric.Delta = &val
-	} else {
-		http.Error(w, "Unknown metric type", http.StatusBadRequest)
-		return
 	}
+	h.hub.PublishMetrics(accepted)
 	w.Header().Set("Content-Type", "application/json")
 	body, err := json.Marshal(requestedMetric)
 	if err != nil {
@@ -285,8 +321,9 @@ func (h *Handler) UpdateMetricFromJSON(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// CheckDBConnection проверяет готовность хранилища метрик.
 func (h *Handler) CheckDBConnection(w http.ResponseWriter, r *http.Request) {
-	err := h.DatabaseDSN.Ping()
+	err := h.storage.Health(r.Context())
 	if err == nil {
 		w.WriteHeader(http.StatusOK)
 	} else {
@@ -294,31 +331,230 @@ func (h *Handler) CheckDBConnection(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// UpdateMetricsFromBatch проверяет пакет метрик и сохраняет его целиком или не сохраняет совсем. Пакет агента, уже примененный ранее
+// (совпадают заголовки X-Agent-ID и X-Agent-Seq), подтверждается без повторного применения,
+// а пакет, который в этот момент применяет другой запрос, отклоняется с кодом 409 для повторной отправки.
 func (h *Handler) UpdateMetricsFromBatch(w http.ResponseWriter, r *http.Request) {
+	agentID, seq, identified, err := dedup.FromHeader(r.Header)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if identified {
+		switch h.batches.Reserve(agentID, seq) {
+		case dedup.Applied:
+			h.appLogger.Log.Info("Duplicate batch skipped", zap.String("agent_id", agentID), zap.Uint64("seq", seq))
+			w.WriteHeader(http.StatusOK)
+			return
+		case dedup.InProgress:
+			http.Error(w, "Batch is being applied by another request", http.StatusConflict)
+			return
+		}
+		// после Commit освобождать нечего, иначе резерв снимается, чтобы агент мог повторить пакет
+		defer h.batches.Release(agentID, seq)
+	}
 	var metrics []*models.Metrics
-	err := json.NewDecoder(r.Body).Decode(&metrics)
+	err = json.NewDecoder(r.Body).Decode(&metrics)
 	if err != nil {
 		h.appLogger.Log.Error("Error parsing request body as JSON", zap.Error(err))
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	var gaugeMetrics []storage.GaugeMetric
-	var counterMetrics []storage.CounterMetric
+	batch := make([]storage.Metric, 0, len(metrics))
 	for _, parameter := range metrics {
-		switch parameter.MType {
-		case "gauge":
-			gaugeMetrics = append(gaugeMetrics, storage.GaugeMetric{Name: parameter.ID, Value: *parameter.Value})
-		case "counter":
-			counterMetrics = append(counterMetrics, storage.CounterMetric{Name: parameter.ID, Value: *parameter.Delta})
-		default:
-			h.appLogger.Log.Warn("Unkniwn metrict type")
+		if err = storage.ValidateLabels(parameter.Labels); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !isKnownType(parameter.MType) {
+			h.appLogger.Log.Warn("Unknown metric type", zap.String("type", parameter.MType))
+			continue
 		}
+		if isDistribution(parameter.MType) {
+			if err = validateDistribution(parameter); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		batch = append(batch, storage.FromModel(*parameter))
+	}
+	if err = h.storage.Batch(r.Context(), batch); err != nil {
+		h.writeUpdateError(w, err)
+		return
+	}
+	if identified && h.batches.Commit(agentID, seq) {
+		h.appLogger.Log.Info("New agent instance", zap.String("agent_id", agentID), zap.Uint64("seq", seq))
+	}
+	h.publishBatch(metrics)
+	w.WriteHeader(http.StatusOK)
+}
+
+// GetMetricHistory возвращает историю значений метрики за интервал, заданный параметрами from, to и step.
+// Границы интервала принимаются в формате RFC3339 или Unix-времени в секундах, шаг - в формате time.Duration.
+func (h *Handler) GetMetricHistory(w http.ResponseWriter, r *http.Request) {
+	valueType := chi.URLParam(r, "type")
+	name := chi.URLParam(r, "name")
+	if valueType != "gauge" && valueType != "counter" {
+		http.Error(w, "Unknown metric type", http.StatusBadRequest)
+		return
+	}
+	labels, err := storage.ParseLabels(r.URL.Query().Get("labels"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	query := r.URL.Query()
+	to := time.Now()
+	if value := query.Get("to"); value != "" {
+		parsed, err := parseTime(value)
+		if err != nil {
+			http.Error(w, "Wrong 'to' parameter", http.StatusBadRequest)
+			return
+		}
+		to = parsed
+	}
+	from := to.Add(-h.config.HistoryRetention)
+	if value := query.Get("from"); value != "" {
+		parsed, err := parseTime(value)
+		if err != nil {
+			http.Error(w, "Wrong 'from' parameter", http.StatusBadRequest)
+			return
+		}
+		from = parsed
+	}
+	var step time.Duration
+	if value := query.Get("step"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed < 0 {
+			http.Error(w, "Wrong 'step' parameter", http.StatusBadRequest)
+			return
+		}
+		step = parsed
+	}
+	if from.After(to) {
+		http.Error(w, "'from' is after 'to'", http.StatusBadRequest)
+		return
+	}
+	samples, err := h.storage.GetMetricHistory(r.Context(), valueType, storage.SeriesKey(name, labels), from, to, step)
+	if errors.Is(err, storage.ErrMetricNotFound) {
+		h.appLogger.Log.Info("Metric history is not found", zap.Error(err))
+		w.WriteHeader(http.StatusNotFound)
+		return
 	}
-	err = h.storage.SetMetricsBatch(r.Context(), gaugeMetrics, counterMetrics)
 	if err != nil {
-		h.appLogger.Log.Warn("Error while updating metrics from batch", zap.Error(err))
+		h.appLogger.Log.Warn("Error while reading metric history", zap.Error(err))
 		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if samples == nil {
+		samples = []storage.Sample{}
+	}
+	body, err := json.Marshal(MetricHistory{ID: name, MType: valueType, Labels: labels, Samples: samples})
+	if err != nil {
+		h.appLogger.Log.Warn("Error converting response body to JSON", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
 	}
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(body)
+	if err != nil {
+		h.appLogger.Log.Warn("Error writing response body", zap.Error(err))
+	}
+}
+
+// publishBatch публикует метрики пакета известных типов.
+func (h *Handler) publishBatch(metrics []*models.Metrics) {
+	if h.hub.Subscribers() == 0 {
+		return
+	}
+	accepted := make([]models.Metrics, 0, len(metrics))
+	for _, metric := range metrics {
+		if isKnownType(metric.MType) {
+			accepted = append(accepted, *metric)
+		}
+	}
+	h.hub.PublishMetrics(accepted...)
+}
+
+// isKnownType проверяет, что сервер хранит метрики типа mType.
+func isKnownType(mType string) bool {
+	return mType == models.Gauge || mType == models.Counter || isDistribution(mType)
+}
+
+// writeUpdateError отвечает на ошибку сохранения метрик: некорректные данные клиента отклоняются с кодом 400.
+func (h *Handler) writeUpdateError(w http.ResponseWriter, err error) {
+	if isClientError(err) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	h.appLogger.Log.Warn("Error while updating metrics", zap.Error(err))
+	w.WriteHeader(http.StatusInternalServerError)
+}
+
+// requestSeriesKey возвращает идентификатор временного ряда из имени метрики в URL
+// и меток из параметра labels вида host=a,region=b. Ряд задается всеми своими метками.
+func requestSeriesKey(r *http.Request) (string, error) {
+	name := chi.URLParam(r, "name")
+	if err := storage.ValidateName(name); err != nil {
+		return "", err
+	}
+	labels, err := storage.ParseLabels(r.URL.Query().Get("labels"))
+	if err != nil {
+		return "", err
+	}
+	return storage.SeriesKey(name, labels), nil
+}
+
+// parseTime разбирает время в формате RFC3339 или Unix-время в секундах.
+func parseTime(value string) (time.Time, error) {
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// PrometheusMetrics выводит все метрики в текстовом формате Prometheus
+// или в формате OpenMetrics, если его запрашивает заголовок Accept.
+func (h *Handler) PrometheusMetrics(w http.ResponseWriter, r *http.Request) {
+	dump, err := h.storage.GetAllMetrics(r.Context())
+	if err != nil {
+		h.appLogger.Log.Warn("Error while reading metrics from storage", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	format := prometheus.Negotiate(r.Header.Get("Accept"))
+	var body bytes.Buffer
+	if err = prometheus.Write(&body, dump, format); err != nil {
+		h.appLogger.Log.Warn("Error while rendering metrics", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", format.ContentType())
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(body.Bytes())
+	if err != nil {
+		h.appLogger.Log.Warn("Error writing response body", zap.Error(err))
+	}
+}
+
+// GetAlerts возвращает текущие оповещения в формате JSON.
+func (h *Handler) GetAlerts(w http.ResponseWriter, r *http.Request) {
+	alerts := []alerting.Alert{}
+	if h.alerts != nil {
+		alerts = h.alerts.Alerts()
+	}
+	body, err := json.Marshal(alerts)
+	if err != nil {
+		h.appLogger.Log.Warn("Error while encoding alerts", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(body)
+	if err != nil {
+		h.appLogger.Log.Warn("Error writing response body", zap.Error(err))
+	}
 }
@@ -0,0 +1,122 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/justEngineer/go-metrics-service/internal/models"
+	"github.com/justEngineer/go-metrics-service/internal/pubsub"
+	"github.com/justEngineer/go-metrics-service/internal/storage"
+)
+
+// defaultHeartbeatInterval интервал отправки комментариев, по которым клиент и прокси понимают, что поток жив.
+const defaultHeartbeatInterval = 15 * time.Second
+
+// streamDropped описывает событие dropped с количеством событий, пропущенных из-за медленного клиента.
+type streamDropped struct {
+	Dropped uint64 `json:"dropped"`
+}
+
+// Hub возвращает хаб, в который публикуются принятые обновления метрик.
+func (h *Handler) Hub() *pubsub.Hub {
+	return h.hub
+}
+
+// Stream отправляет принятые обновления метрик в формате Server-Sent Events: каждое обновление
+// передается событием update с JSON pubsub.Event, удаление и обнуление метрики - событиями delete и reset. Параметры type, prefix и regex отбирают метрики,
+// как в GET /api/v1/metrics, параметр heartbeat задает интервал отправки комментариев-пульса.
+// Если клиент не успевает получать события, лишние отбрасываются, и клиенту отправляется событие dropped.
+func (h *Handler) Stream(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseSelector(r)
+	if err == nil {
+		err = filter.Normalize()
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	heartbeat := defaultHeartbeatInterval
+	if value := r.URL.Query().Get("heartbeat"); value != "" {
+		heartbeat, err = time.ParseDuration(value)
+		if err != nil || heartbeat <= 0 {
+			http.Error(w, "Wrong 'heartbeat' parameter", http.StatusBadRequest)
+			return
+		}
+	}
+	flusher := http.NewResponseController(w)
+	subscription := h.hub.Subscribe(func(event pubsub.Event) bool {
+		return filter.Match(event.ID, event.MType)
+	})
+	defer subscription.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	// комментарий сразу отправляет заголовки, чтобы клиент знал, что подписка создана
+	if _, err = fmt.Fprint(w, ": connected\n\n"); err == nil {
+		err = flusher.Flush()
+	}
+	if err != nil {
+		h.appLogger.Log.Warn("Streaming is not supported", zap.Error(err))
+		return
+	}
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+	var reportedDropped uint64
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+			_, err = fmt.Fprint(w, ": heartbeat\n\n")
+		case event := <-subscription.Events():
+			if dropped := subscription.Dropped(); dropped > reportedDropped {
+				err = writeStreamEvent(w, "dropped", streamDropped{Dropped: dropped - reportedDropped})
+				reportedDropped = dropped
+			}
+			if err == nil {
+				name := event.Op
+				if name == "" {
+					name = "update"
+				}
+				err = writeStreamEvent(w, name, event)
+			}
+		}
+		if err == nil {
+			err = flusher.Flush()
+		}
+		if err != nil {
+			h.appLogger.Log.Info("Stream closed", zap.Error(err))
+			return
+		}
+	}
+}
+
+// writeStreamEvent записывает событие Server-Sent Events с данными в JSON.
+func writeStreamEvent(w http.ResponseWriter, name string, data any) error {
+	body, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, body)
+	return err
+}
+
+// publishUpdate публикует обновление метрики, принятое по идентификатору временного ряда.
+func (h *Handler) publishUpdate(mType string, key string, fill func(metric *models.Metrics)) {
+	name, labels := storage.ParseSeriesKey(key)
+	metric := models.Metrics{ID: name, MType: mType, Labels: labels}
+	fill(&metric)
+	h.hub.PublishMetrics(metric)
+}
+
+// publishOp публикует удаление или обнуление метрики, заданной идентификатором временного ряда.
+func (h *Handler) publishOp(op string, mType string, key string) {
+	name, labels := storage.ParseSeriesKey(key)
+	h.hub.PublishOp(op, models.Metrics{ID: name, MType: mType, Labels: labels})
+}
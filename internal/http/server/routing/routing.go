@@ -2,7 +2,6 @@
 package routing
 
 import (
-	"crypto/rsa"
 	"log"
 	"net/http"
 	"strings"
@@ -18,11 +17,12 @@ import (
 	"github.com/justEngineer/go-metrics-service/internal/security"
 )
 
+// ServerStart запускает HTTP сервер в отдельной горутине и возвращает его для остановки через Shutdown.
 func ServerStart(appLogger *logger.Logger, ServerHandler *server.Handler, cfg *config.ServerConfig) *http.Server {
 
 	router := chi.NewRouter()
-	SetMiddlewares(router, appLogger, &cfg.SHA256Key, cfg.PrivateCryptoKey)
-	SetRequestRouting(router, ServerHandler, cfg.PrivateCryptoKey)
+	SetMiddlewares(router, appLogger, &cfg.SHA256Key, cfg.AllowUnsigned, cfg.CryptoKeys, cfg.AllowLegacyCrypt)
+	SetRequestRouting(router, ServerHandler)
 
 	endpoint := ":" + (strings.Split(cfg.Endpoint, ":"))[1]
 	server := &http.Server{
@@ -31,39 +31,44 @@ func ServerStart(appLogger *logger.Logger, ServerHandler *server.Handler, cfg *c
 	}
 
 	log.Printf("Running server on endpoint: %s\n", cfg.Endpoint)
-	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-		log.Fatalf("Could not listen on endpoint: %s, error: %v\n", cfg.Endpoint, err)
-	}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("Could not listen on endpoint: %s, error: %v\n", cfg.Endpoint, err)
+		}
+	}()
 	return server
 }
 
 // SetMiddlewares добавляет промежуточные обработчики запросов.
-func SetMiddlewares(router *chi.Mux, appLogger *logger.Logger, SHA256Key *string, cryptoKey *rsa.PrivateKey) {
+// Агент сжимает тело запроса, подписывает сжатые данные и затем шифрует их,
+// поэтому на сервере тело сначала расшифровывается, затем проверяется подпись и только потом распаковывается.
+func SetMiddlewares(router *chi.Mux, appLogger *logger.Logger, SHA256Key *string, allowUnsigned bool, cryptoKeys *security.Keyring, allowLegacyCrypt bool) {
 	router.Use(appLogger.RequestLogger)
 	router.Use(middleware.Recoverer)
-	router.Use(compression.GzipMiddleware)
+	router.Use(security.BodyDecrypt(cryptoKeys, allowLegacyCrypt))
 	if *SHA256Key != "" {
-		router.Use(security.New(*SHA256Key))
+		router.Use(security.New(*SHA256Key, allowUnsigned))
 	}
-	router.Use(security.BodyDecrypt(cryptoKey))
+	router.Use(compression.GzipMiddleware)
 }
 
 // SetRequestRouting добавляет обработчики для HTTP запросов.
-func SetRequestRouting(router *chi.Mux, ServerHandler *server.Handler, cryptoKey *rsa.PrivateKey) {
+func SetRequestRouting(router *chi.Mux, ServerHandler *server.Handler) {
 	router.Mount("/debug", profiler.Profiler())
 	router.Post("/update/{type}/{name}/{value}", ServerHandler.UpdateMetric)
 	router.Get("/value/{type}/{name}", ServerHandler.GetMetric)
+	router.Delete("/value/{type}/{name}", ServerHandler.DeleteMetric)
+	router.Post("/reset/counter/{name}", ServerHandler.ResetCounter)
+	router.Get("/history/{type}/{name}", ServerHandler.GetMetricHistory)
+	router.Get("/metrics", ServerHandler.PrometheusMetrics)
+	router.Get("/alerts", ServerHandler.GetAlerts)
+	router.Get("/api/v1/metrics", ServerHandler.ListMetrics)
+	router.Delete("/api/v1/metrics", ServerHandler.DeleteMetrics)
+	router.Get("/stream", ServerHandler.Stream)
 	router.Get("/", ServerHandler.MainPage)
+	router.Handle("/static/*", http.StripPrefix("/static/", server.DashboardAssets()))
 	router.Post("/update/", ServerHandler.UpdateMetricFromJSON)
 
-	router.Route("/updates", func(r chi.Router) {
-		r.Post("/",
-			security.DecryptMiddleware(cryptoKey)(
-				server.TimeoutMiddleware(time.Second, ServerHandler.UpdateMetricsFromBatch),
-			),
-		)
-	})
-
 	router.Post("/updates/", server.TimeoutMiddleware(time.Second, ServerHandler.UpdateMetricsFromBatch))
 	router.Post("/value/", ServerHandler.GetMetricAsJSON)
 	router.Get("/ping", ServerHandler.CheckDBConnection)
@@ -38,6 +38,12 @@ func (r *loggingResponseWriter) WriteHeader(statusCode int) {
 	r.responseData.status = statusCode // захватываем код статуса
 }
 
+// Unwrap возвращает оригинальный http.ResponseWriter, чтобы http.ResponseController мог отправлять
+// ответ частями, например события GET /stream.
+func (r *loggingResponseWriter) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
 // Log предоставляет глобальный доступ к логгеру zap.Logger
 type Logger struct {
 	Log *zap.Logger
@@ -1,10 +1,24 @@
 // Package models предназначен для структур данных, используемых во всем приложении.
 package models
 
-// Metrics описывает структуру данных метрики, которая может быть типа "gauge" или "counter".
+import "github.com/justEngineer/go-metrics-service/internal/distribution"
+
+// Типы метрик.
+const (
+	Gauge     = "gauge"
+	Counter   = "counter"
+	Histogram = "histogram"
+	Summary   = "summary"
+)
+
+// Metrics описывает структуру данных метрики, которая может быть типа "gauge", "counter", "histogram" или "summary".
 type Metrics struct {
-	ID    string   `json:"id"`              // имя метрики
-	MType string   `json:"type"`            // параметр, принимающий значение gauge или counter
-	Delta *int64   `json:"delta,omitempty"` // значение метрики в случае передачи counter
-	Value *float64 `json:"value,omitempty"` // значение метрики в случае передачи gauge
+	ID        string                  `json:"id"`                  // имя метрики
+	MType     string                  `json:"type"`                // параметр, принимающий значение gauge, counter, histogram или summary
+	Delta     *int64                  `json:"delta,omitempty"`     // значение метрики в случае передачи counter
+	Value     *float64                `json:"value,omitempty"`     // значение метрики в случае передачи gauge
+	Histogram *distribution.Histogram `json:"histogram,omitempty"` // значение метрики в случае передачи histogram
+	Summary   *distribution.Sketch    `json:"summary,omitempty"`   // значение метрики в случае передачи summary
+	Quantiles map[string]float64      `json:"quantiles,omitempty"` // квантили p50, p90 и p99 в ответе для histogram и summary
+	Labels    map[string]string       `json:"labels,omitempty"`    // метки, вместе с именем определяющие временной ряд
 }
@@ -0,0 +1,244 @@
+// Package prometheus предоставляет вывод метрик в текстовых форматах Prometheus и OpenMetrics.
+package prometheus
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+
+	storage "github.com/justEngineer/go-metrics-service/internal/storage"
+)
+
+// Format определяет формат вывода метрик.
+type Format int
+
+const (
+	// FormatText текстовый формат Prometheus версии 0.0.4.
+	FormatText Format = iota
+	// FormatOpenMetrics текстовый формат OpenMetrics версии 1.0.0.
+	FormatOpenMetrics
+)
+
+const (
+	textContentType        = "text/plain; version=0.0.4; charset=utf-8"
+	openMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+	openMetricsMediaType   = "application/openmetrics-text"
+)
+
+// ContentType возвращает значение заголовка Content-Type для формата.
+func (f Format) ContentType() string {
+	if f == FormatOpenMetrics {
+		return openMetricsContentType
+	}
+	return textContentType
+}
+
+// Negotiate выбирает формат вывода по заголовку Accept.
+// OpenMetrics выбирается, только если клиент предпочитает его текстовому формату.
+func Negotiate(accept string) Format {
+	openMetricsQuality, textQuality := -1.0, 0.0
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			if quality, err = strconv.ParseFloat(q, 64); err != nil {
+				continue
+			}
+		}
+		switch mediaType {
+		case openMetricsMediaType:
+			openMetricsQuality = math.Max(openMetricsQuality, quality)
+		case "text/plain", "*/*":
+			textQuality = math.Max(textQuality, quality)
+		}
+	}
+	if openMetricsQuality > 0 && openMetricsQuality >= textQuality {
+		return FormatOpenMetrics
+	}
+	return FormatText
+}
+
+// SanitizeName приводит имя метрики к виду [a-zA-Z_:][a-zA-Z0-9_:]*,
+// заменяя недопустимые символы на подчеркивание.
+func SanitizeName(name string) string {
+	if name == "" {
+		return "_"
+	}
+	var b strings.Builder
+	for i, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_', r == ':':
+			b.WriteRune(r)
+		case r >= '0' && r <= '9':
+			if i == 0 {
+				b.WriteByte('_')
+			}
+			b.WriteRune(r)
+		default:
+			b.WriteByte('_')
+		}
+	}
+	return b.String()
+}
+
+// family описывает семейство метрик с общим именем и типом.
+type family struct {
+	name       string
+	metricType string
+	samples    []sample
+}
+
+// sample описывает одно значение семейства метрик.
+type sample struct {
+	name   string
+	labels map[string]string
+	value  string
+}
+
+// Квантили, которые выводятся для метрик типа summary.
+var summaryQuantiles = []float64{0.5, 0.9, 0.99}
+
+// Write выводит метрики в выбранном формате.
+// Метрики группируются в семейства по имени и сортируются; если после приведения имен
+// несколько временных рядов совпадают, выводится только первая из метрик, а остальные пропускаются целиком.
+func Write(w io.Writer, dump storage.MetricsDump, format Format) error {
+	var families []*family
+	byName := make(map[string]*family)
+	written := make(map[string]bool)
+	// add добавляет значения метрики в семейство, только если ни одно из них не совпадает с уже
+	// добавленными, чтобы не выводить метрику частично.
+	add := func(familyName, metricType string, samples ...sample) {
+		f, ok := byName[familyName]
+		if ok && f.metricType != metricType {
+			return
+		}
+		keys := make([]string, 0, len(samples))
+		for _, s := range samples {
+			key := storage.SeriesKey(s.name, s.labels)
+			if written[key] {
+				return
+			}
+			keys = append(keys, key)
+		}
+		for _, key := range keys {
+			written[key] = true
+		}
+		if !ok {
+			f = &family{name: familyName, metricType: metricType}
+			byName[familyName] = f
+			families = append(families, f)
+		}
+		f.samples = append(f.samples, samples...)
+	}
+
+	gauges := append([]storage.GaugeMetric(nil), dump.Gauges...)
+	sort.Slice(gauges, func(i, j int) bool { return gauges[i].Key() < gauges[j].Key() })
+	for _, metric := range gauges {
+		name := SanitizeName(metric.Name)
+		add(name, "gauge", sample{name: name, labels: sanitizeLabels(metric.Labels), value: formatFloat(metric.Value)})
+	}
+
+	counters := append([]storage.CounterMetric(nil), dump.Counters...)
+	sort.Slice(counters, func(i, j int) bool { return counters[i].Key() < counters[j].Key() })
+	for _, metric := range counters {
+		name := SanitizeName(metric.Name)
+		sampleName := name
+		if format == FormatOpenMetrics {
+			// в OpenMetrics имя семейства счетчика не содержит суффикс _total, а имя значения содержит
+			name = strings.TrimSuffix(name, "_total")
+			sampleName = name + "_total"
+		}
+		add(name, "counter", sample{name: sampleName, labels: sanitizeLabels(metric.Labels), value: strconv.FormatInt(metric.Value, 10)})
+	}
+
+	histograms := append([]storage.HistogramMetric(nil), dump.Histograms...)
+	sort.Slice(histograms, func(i, j int) bool { return histograms[i].Key() < histograms[j].Key() })
+	for _, metric := range histograms {
+		name := SanitizeName(metric.Name)
+		labels := sanitizeLabels(metric.Labels)
+		var samples []sample
+		var cumulative uint64
+		for i, count := range metric.Value.Counts {
+			cumulative += count
+			bound := "+Inf"
+			if i < len(metric.Value.Bounds) {
+				bound = formatFloat(metric.Value.Bounds[i])
+			}
+			samples = append(samples, sample{name: name + "_bucket", labels: withLabel(labels, "le", bound), value: strconv.FormatUint(cumulative, 10)})
+		}
+		samples = append(samples,
+			sample{name: name + "_sum", labels: labels, value: formatFloat(metric.Value.Sum)},
+			sample{name: name + "_count", labels: labels, value: strconv.FormatUint(metric.Value.Count, 10)},
+		)
+		add(name, "histogram", samples...)
+	}
+
+	summaries := append([]storage.SummaryMetric(nil), dump.Summaries...)
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].Key() < summaries[j].Key() })
+	for _, metric := range summaries {
+		name := SanitizeName(metric.Name)
+		labels := sanitizeLabels(metric.Labels)
+		var samples []sample
+		for _, q := range summaryQuantiles {
+			samples = append(samples, sample{name: name, labels: withLabel(labels, "quantile", formatFloat(q)), value: formatFloat(metric.Value.Quantile(q))})
+		}
+		samples = append(samples,
+			sample{name: name + "_sum", labels: labels, value: formatFloat(metric.Value.Sum)},
+			sample{name: name + "_count", labels: labels, value: strconv.FormatUint(metric.Value.Count, 10)},
+		)
+		add(name, "summary", samples...)
+	}
+
+	out := bufio.NewWriter(w)
+	for _, f := range families {
+		out.WriteString("# TYPE " + f.name + " " + f.metricType + "\n")
+		for _, s := range f.samples {
+			out.WriteString(storage.SeriesKey(s.name, s.labels) + " " + s.value + "\n")
+		}
+	}
+	if format == FormatOpenMetrics {
+		out.WriteString("# EOF\n")
+	}
+	return out.Flush()
+}
+
+// withLabel возвращает копию меток с добавленной меткой.
+func withLabel(labels map[string]string, label, value string) map[string]string {
+	result := make(map[string]string, len(labels)+1)
+	for k, v := range labels {
+		result[k] = v
+	}
+	result[label] = value
+	return result
+}
+
+// sanitizeLabels приводит имена меток к виду [a-zA-Z_][a-zA-Z0-9_]*.
+func sanitizeLabels(labels map[string]string) map[string]string {
+	if len(labels) == 0 {
+		return nil
+	}
+	result := make(map[string]string, len(labels))
+	for label, value := range labels {
+		result[strings.ReplaceAll(SanitizeName(label), ":", "_")] = value
+	}
+	return result
+}
+
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
@@ -0,0 +1,125 @@
+package prometheus
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/justEngineer/go-metrics-service/internal/distribution"
+	storage "github.com/justEngineer/go-metrics-service/internal/storage"
+)
+
+func TestSanitizeName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"", "_"},
+		{"http_requests", "http_requests"},
+		{"node:cpu", "node:cpu"},
+		{"go.memstats.alloc", "go_memstats_alloc"},
+		{"9lives", "_9lives"},
+		{"disk-usage/%", "disk_usage__"},
+		{"температура", "___________"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, SanitizeName(tt.name), tt.name)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	sketch := distribution.NewSketch(distribution.DefaultRelativeAccuracy)
+	sketch.Add(2)
+	histogram := &distribution.Histogram{Bounds: []float64{1, 5}, Counts: []uint64{1, 2, 1}, Sum: 12.5, Count: 4}
+
+	tests := []struct {
+		name   string
+		dump   storage.MetricsDump
+		format Format
+		want   string
+	}{
+		{
+			name: "sanitized names and labels",
+			dump: storage.MetricsDump{
+				Gauges:   []storage.GaugeMetric{{Name: "go.alloc", Labels: map[string]string{"host.name": "a"}, Value: 1.5}},
+				Counters: []storage.CounterMetric{{Name: "requests_total", Value: 3}},
+			},
+			format: FormatText,
+			want: "# TYPE go_alloc gauge\n" +
+				"go_alloc{host_name=\"a\"} 1.5\n" +
+				"# TYPE requests_total counter\n" +
+				"requests_total 3\n",
+		},
+		{
+			name:   "openmetrics counter",
+			dump:   storage.MetricsDump{Counters: []storage.CounterMetric{{Name: "requests_total", Value: 3}}},
+			format: FormatOpenMetrics,
+			want: "# TYPE requests counter\n" +
+				"requests_total 3\n" +
+				"# EOF\n",
+		},
+		{
+			name: "colliding names keep the first series",
+			dump: storage.MetricsDump{Gauges: []storage.GaugeMetric{
+				{Name: "a_b", Value: 2},
+				{Name: "a.b", Value: 1},
+			}},
+			format: FormatText,
+			want: "# TYPE a_b gauge\n" +
+				"a_b 1\n",
+		},
+		{
+			name: "colliding types keep the first family",
+			dump: storage.MetricsDump{
+				Gauges:   []storage.GaugeMetric{{Name: "load", Value: 1}},
+				Counters: []storage.CounterMetric{{Name: "load", Labels: map[string]string{"cpu": "0"}, Value: 2}},
+			},
+			format: FormatText,
+			want: "# TYPE load gauge\n" +
+				"load 1\n",
+		},
+		{
+			name: "histogram family",
+			dump: storage.MetricsDump{Histograms: []storage.HistogramMetric{
+				{Name: "latency", Labels: map[string]string{"path": "/"}, Value: histogram},
+			}},
+			format: FormatText,
+			want: "# TYPE latency histogram\n" +
+				"latency_bucket{le=\"1\",path=\"/\"} 1\n" +
+				"latency_bucket{le=\"5\",path=\"/\"} 3\n" +
+				"latency_bucket{le=\"+Inf\",path=\"/\"} 4\n" +
+				"latency_sum{path=\"/\"} 12.5\n" +
+				"latency_count{path=\"/\"} 4\n",
+		},
+		{
+			name: "histogram colliding with a counter is skipped entirely",
+			dump: storage.MetricsDump{
+				Counters:   []storage.CounterMetric{{Name: "latency_count", Value: 7}},
+				Histograms: []storage.HistogramMetric{{Name: "latency", Value: histogram}},
+			},
+			format: FormatText,
+			want: "# TYPE latency_count counter\n" +
+				"latency_count 7\n",
+		},
+		{
+			name:   "summary family",
+			dump:   storage.MetricsDump{Summaries: []storage.SummaryMetric{{Name: "size", Value: sketch}}},
+			format: FormatText,
+			want: "# TYPE size summary\n" +
+				"size{quantile=\"0.5\"} 2\n" +
+				"size{quantile=\"0.9\"} 2\n" +
+				"size{quantile=\"0.99\"} 2\n" +
+				"size_sum 2\n" +
+				"size_count 1\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			require.NoError(t, Write(&buf, tt.dump, tt.format))
+			assert.Equal(t, tt.want, buf.String())
+		})
+	}
+}
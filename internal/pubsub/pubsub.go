@@ -0,0 +1,127 @@
+// Package pubsub рассылает принятые сервером обновления метрик подписчикам, например клиентам GET /stream.
+// Каждый подписчик получает события через собственный буфер ограниченного размера; если подписчик
+// не успевает их забирать, новые события для него отбрасываются, и запись метрик никогда не ждет подписчиков.
+package pubsub
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/justEngineer/go-metrics-service/internal/models"
+)
+
+// DefaultBufferSize размер буфера событий подписчика по умолчанию.
+const DefaultBufferSize = 256
+
+// Виды событий, отличных от обновления метрики.
+const (
+	// OpDelete метрика удалена.
+	OpDelete = "delete"
+	// OpReset метрика типа counter обнулена.
+	OpReset = "reset"
+)
+
+// Event принятое обновление метрики. Для counter событие содержит полученное приращение,
+// а не итоговое значение; для histogram и summary, обновленных через URL, Value содержит добавленное значение.
+// Для удаления и обнуления метрики Op содержит OpDelete или OpReset, а значение не заполняется.
+type Event struct {
+	models.Metrics
+	Op        string    `json:"op,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Subscription подписка на события хаба.
+type Subscription struct {
+	hub     *Hub
+	events  chan Event
+	match   func(Event) bool
+	dropped atomic.Uint64
+}
+
+// Events возвращает канал событий подписки; канал закрывается методом Close.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Dropped возвращает количество событий, отброшенных из-за переполнения буфера подписки.
+func (s *Subscription) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// Close отменяет подписку и закрывает канал событий. Повторный вызов ничего не делает.
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	if _, ok := s.hub.subscribers[s]; ok {
+		delete(s.hub.subscribers, s)
+		close(s.events)
+	}
+}
+
+// Hub рассылает события подписчикам.
+type Hub struct {
+	mu          sync.RWMutex
+	subscribers map[*Subscription]struct{}
+	bufferSize  int
+}
+
+// New создает хаб, в котором у каждого подписчика буфер на bufferSize событий.
+func New(bufferSize int) *Hub {
+	if bufferSize <= 0 {
+		bufferSize = DefaultBufferSize
+	}
+	return &Hub{subscribers: make(map[*Subscription]struct{}), bufferSize: bufferSize}
+}
+
+// Subscribe создает подписку на события, для которых match возвращает true; nil означает все события.
+func (h *Hub) Subscribe(match func(Event) bool) *Subscription {
+	subscription := &Subscription{hub: h, events: make(chan Event, h.bufferSize), match: match}
+	h.mu.Lock()
+	h.subscribers[subscription] = struct{}{}
+	h.mu.Unlock()
+	return subscription
+}
+
+// Subscribers возвращает количество активных подписок.
+func (h *Hub) Subscribers() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.subscribers)
+}
+
+// Publish рассылает события подписчикам без ожидания: события, не поместившиеся в буфер подписчика, отбрасываются.
+func (h *Hub) Publish(events ...Event) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for subscription := range h.subscribers {
+		for _, event := range events {
+			if subscription.match != nil && !subscription.match(event) {
+				continue
+			}
+			select {
+			case subscription.events <- event:
+			default:
+				subscription.dropped.Add(1)
+			}
+		}
+	}
+}
+
+// PublishMetrics рассылает принятые метрики с текущим временем.
+func (h *Hub) PublishMetrics(metrics ...models.Metrics) {
+	h.PublishOp("", metrics...)
+}
+
+// PublishOp рассылает события вида op для метрик с текущим временем; пустой op означает обновление.
+func (h *Hub) PublishOp(op string, metrics ...models.Metrics) {
+	if len(metrics) == 0 || h.Subscribers() == 0 {
+		return
+	}
+	now := time.Now()
+	events := make([]Event, len(metrics))
+	for i, metric := range metrics {
+		events[i] = Event{Metrics: metric, Op: op, Timestamp: now}
+	}
+	h.Publish(events...)
+}
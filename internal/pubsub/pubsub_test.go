@@ -0,0 +1,47 @@
+package pubsub
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/justEngineer/go-metrics-service/internal/models"
+)
+
+func gauge(name string, value float64) models.Metrics {
+	return models.Metrics{ID: name, MType: models.Gauge, Value: &value}
+}
+
+func TestHub(t *testing.T) {
+	hub := New(2)
+	all := hub.Subscribe(nil)
+	temp := hub.Subscribe(func(event Event) bool { return event.ID == "temp" })
+	assert.Equal(t, 2, hub.Subscribers())
+
+	hub.PublishMetrics(gauge("temp", 36.6), gauge("Alloc", 1), gauge("temp", 37.2))
+	assert.Equal(t, "temp", (<-all.Events()).ID)
+	assert.Equal(t, "Alloc", (<-all.Events()).ID)
+	assert.Equal(t, uint64(1), all.Dropped(), "the buffer holds two events, the third one is dropped")
+	assert.Equal(t, 36.6, *(<-temp.Events()).Value)
+	assert.Equal(t, 37.2, *(<-temp.Events()).Value)
+	assert.Equal(t, uint64(0), temp.Dropped())
+
+	all.Close()
+	all.Close()
+	_, ok := <-all.Events()
+	assert.False(t, ok, "the channel is closed with the subscription")
+	assert.Equal(t, 1, hub.Subscribers())
+	hub.PublishMetrics(gauge("temp", 38))
+	assert.Len(t, temp.Events(), 1)
+}
+
+func TestPublishDoesNotBlock(t *testing.T) {
+	hub := New(1)
+	slow := hub.Subscribe(nil)
+	defer slow.Close()
+	for i := 0; i < 1000; i++ {
+		hub.PublishMetrics(gauge("temp", float64(i)))
+	}
+	assert.Equal(t, uint64(999), slow.Dropped())
+	assert.Equal(t, 0.0, *(<-slow.Events()).Value)
+}
@@ -0,0 +1,212 @@
+// Package push предоставляет локальную точку приема метрик приложений на агенте.
+// Приложения отправляют агенту метрики в формате models.Metrics или строки StatsD
+// по HTTP на локальном порту или Unix сокете, а также StatsD по UDP.
+// Принятые метрики записываются в хранилище агента и отправляются на сервер вместе с остальными.
+package push
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"go.uber.org/zap"
+
+	"github.com/justEngineer/go-metrics-service/internal/distribution"
+	compression "github.com/justEngineer/go-metrics-service/internal/gzip"
+	"github.com/justEngineer/go-metrics-service/internal/logger"
+	"github.com/justEngineer/go-metrics-service/internal/models"
+	"github.com/justEngineer/go-metrics-service/internal/statsd"
+	"github.com/justEngineer/go-metrics-service/internal/storage"
+)
+
+// maxBodySize максимальный размер тела запроса.
+const maxBodySize = 4 << 20
+
+// shutdownTimeout время на завершение обработки запросов при остановке.
+const shutdownTimeout = 5 * time.Second
+
+// socketMode права файла Unix сокета: подключиться к нему может только владелец и его группа.
+const socketMode = 0o660
+
+// errInvalidMetric возвращается для метрики без имени, значения или с неизвестным типом.
+var errInvalidMetric = errors.New("invalid metric")
+
+// Server принимает метрики приложений и записывает их в хранилище агента.
+type Server struct {
+	storage   *storage.MemStorage
+	statsd    *statsd.Listener
+	appLogger *logger.Logger
+}
+
+// New создает точку приема метрик. Значения StatsD агрегируются и записываются в хранилище раз в flushInterval.
+func New(metricsStorage *storage.MemStorage, flushInterval time.Duration, appLogger *logger.Logger) *Server {
+	return &Server{
+		storage:   metricsStorage,
+		statsd:    statsd.New(metricsStorage, flushInterval, appLogger),
+		appLogger: appLogger,
+	}
+}
+
+// Router возвращает обработчик HTTP запросов:
+// POST /update/ принимает одну метрику в JSON, POST /updates/ - массив метрик, POST /statsd - строки StatsD.
+func (s *Server) Router() http.Handler {
+	router := chi.NewRouter()
+	router.Use(s.appLogger.RequestLogger)
+	router.Use(middleware.Recoverer)
+	router.Use(compression.GzipMiddleware)
+	router.Post("/update/", s.UpdateMetric)
+	router.Post("/updates/", s.UpdateMetrics)
+	router.Post("/statsd", s.UpdateStatsD)
+	return router
+}
+
+// ListenHTTP начинает прием метрик по HTTP до отмены контекста.
+// network принимает значения "tcp" или "unix"; оставшийся от предыдущего запуска файл сокета удаляется,
+// а новому задаются права socketMode, чтобы метрики могли отправлять только владелец и его группа.
+func (s *Server) ListenHTTP(ctx context.Context, network, address string) error {
+	if network == "unix" {
+		if err := os.Remove(address); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	listener, err := net.Listen(network, address)
+	if err != nil {
+		return err
+	}
+	if network == "unix" {
+		if err = os.Chmod(address, socketMode); err != nil {
+			listener.Close()
+			return err
+		}
+	}
+	server := &http.Server{Handler: s.Router(), ReadHeaderTimeout: shutdownTimeout}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.appLogger.Log.Warn("push endpoint stopped", zap.String("address", address), zap.Error(err))
+		}
+	}()
+	return nil
+}
+
+// ListenStatsD начинает прием строк StatsD на UDP адресе до отмены контекста.
+func (s *Server) ListenStatsD(ctx context.Context, address string) error {
+	return s.statsd.ListenUDP(ctx, address)
+}
+
+// Run записывает накопленные значения StatsD в хранилище агента до отмены контекста.
+func (s *Server) Run(ctx context.Context) {
+	s.statsd.Run(ctx)
+}
+
+// Flush записывает накопленные значения StatsD в хранилище агента.
+func (s *Server) Flush(ctx context.Context) error {
+	return s.statsd.Flush(ctx)
+}
+
+// UpdateMetric принимает одну метрику в формате models.Metrics.
+func (s *Server) UpdateMetric(w http.ResponseWriter, r *http.Request) {
+	var metric models.Metrics
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize)).Decode(&metric); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.write(w, []models.Metrics{metric})
+}
+
+// UpdateMetrics принимает массив метрик в формате models.Metrics.
+func (s *Server) UpdateMetrics(w http.ResponseWriter, r *http.Request) {
+	var metrics []models.Metrics
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize)).Decode(&metrics); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.write(w, metrics)
+}
+
+// UpdateStatsD принимает строки протокола StatsD, разделенные переводом строки.
+func (s *Server) UpdateStatsD(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	before := s.statsd.Stats().Malformed
+	s.statsd.Handle(body)
+	if malformed := s.statsd.Stats().Malformed - before; malformed > 0 {
+		http.Error(w, fmt.Sprintf("%d malformed statsd lines skipped", malformed), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// write проверяет метрики и записывает их в хранилище одним пакетом: при любой ошибке не записывается ни одна метрика.
+func (s *Server) write(w http.ResponseWriter, metrics []models.Metrics) {
+	batch := make([]storage.Metric, 0, len(metrics))
+	for _, metric := range metrics {
+		if err := validate(metric); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		batch = append(batch, storage.FromModel(metric))
+	}
+	err := s.storage.Batch(context.Background(), batch)
+	if errors.Is(err, distribution.ErrBucketsMismatch) || errors.Is(err, distribution.ErrAccuracyMismatch) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// validate проверяет имя, метки, тип и значение метрики.
+func validate(metric models.Metrics) error {
+	if metric.ID == "" {
+		return fmt.Errorf("%w: id is empty", errInvalidMetric)
+	}
+	if err := storage.ValidateName(metric.ID); err != nil {
+		return fmt.Errorf("%w: %s", errInvalidMetric, err)
+	}
+	if err := storage.ValidateLabels(metric.Labels); err != nil {
+		return err
+	}
+	switch metric.MType {
+	case models.Gauge:
+		if metric.Value == nil {
+			return fmt.Errorf("%w: gauge %s has no value", errInvalidMetric, metric.ID)
+		}
+	case models.Counter:
+		if metric.Delta == nil {
+			return fmt.Errorf("%w: counter %s has no delta", errInvalidMetric, metric.ID)
+		}
+	case models.Histogram:
+		if metric.Histogram == nil {
+			return fmt.Errorf("%w: histogram %s has no value", errInvalidMetric, metric.ID)
+		}
+		return metric.Histogram.Validate()
+	case models.Summary:
+		if metric.Summary == nil {
+			return fmt.Errorf("%w: summary %s has no value", errInvalidMetric, metric.ID)
+		}
+		return metric.Summary.Validate()
+	default:
+		return fmt.Errorf("%w: unknown type %q of %s", errInvalidMetric, metric.MType, metric.ID)
+	}
+	return nil
+}
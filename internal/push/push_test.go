@@ -0,0 +1,108 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/justEngineer/go-metrics-service/internal/distribution"
+	"github.com/justEngineer/go-metrics-service/internal/logger"
+	"github.com/justEngineer/go-metrics-service/internal/models"
+	"github.com/justEngineer/go-metrics-service/internal/storage"
+)
+
+func newServer(t *testing.T) (*Server, *storage.MemStorage) {
+	appLogger, err := logger.New("error")
+	require.NoError(t, err)
+	memStorage := storage.New()
+	return New(memStorage, time.Second, appLogger), memStorage
+}
+
+func post(t *testing.T, handler http.Handler, path string, body []byte) int {
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body)))
+	return recorder.Code
+}
+
+func TestPushJSON(t *testing.T) {
+	server, memStorage := newServer(t)
+	router := server.Router()
+	ctx := context.Background()
+
+	delta, value := int64(3), 1.5
+	histogram := distribution.NewHistogram([]float64{1, 10})
+	histogram.Observe(5)
+	batch, err := json.Marshal([]models.Metrics{
+		{ID: "jobs_done", MType: models.Counter, Delta: &delta, Labels: map[string]string{"queue": "mail"}},
+		{ID: "queue_size", MType: models.Gauge, Value: &value},
+		{ID: "job_seconds", MType: models.Histogram, Histogram: histogram},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, post(t, router, "/updates/", batch))
+	single, err := json.Marshal(models.Metrics{ID: "jobs_done", MType: models.Counter, Delta: &delta, Labels: map[string]string{"queue": "mail"}})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, post(t, router, "/update/", single))
+
+	counter, err := storage.GetCounter(ctx, memStorage, `jobs_done{queue="mail"}`)
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), counter)
+	gauge, err := storage.GetGauge(ctx, memStorage, "queue_size")
+	require.NoError(t, err)
+	assert.Equal(t, 1.5, gauge)
+	stored, err := storage.GetHistogram(ctx, memStorage, "job_seconds")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), stored.Count)
+
+	for _, body := range []string{
+		`[{"id":"queue_size","type":"gauge"}]`,
+		`[{"id":"","type":"counter","delta":1}]`,
+		`[{"id":"x","type":"unknown","value":1}]`,
+		`[{"id":"x","type":"gauge","value":1,"labels":{"1bad":"a"}}]`,
+		`not json`,
+	} {
+		assert.Equal(t, http.StatusBadRequest, post(t, router, "/updates/", []byte(body)), body)
+	}
+	_, err = storage.GetGauge(ctx, memStorage, "x")
+	assert.Error(t, err, "rejected batch must not be stored")
+}
+
+func TestPushStatsD(t *testing.T) {
+	server, memStorage := newServer(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	socket := filepath.Join(t.TempDir(), "push.sock")
+	require.NoError(t, server.ListenHTTP(ctx, "unix", socket))
+	info, err := os.Stat(socket)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(socketMode), info.Mode().Perm())
+
+	client := http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+		},
+	}}
+	response, err := client.Post("http://agent/statsd", "text/plain", bytes.NewReader([]byte("emails_sent:2|c|#queue:mail\nemails_sent:1|c|#queue:mail")))
+	require.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+
+	response, err = client.Post("http://agent/statsd", "text/plain", bytes.NewReader([]byte("broken")))
+	require.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+
+	require.NoError(t, server.Flush(ctx))
+	counter, err := storage.GetCounter(ctx, memStorage, `emails_sent{queue="mail"}`)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), counter)
+}
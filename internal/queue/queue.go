@@ -0,0 +1,351 @@
+// Package queue предоставляет ограниченную по размеру очередь записей на диске.
+// Очередь хранится в файлах-сегментах, переживает перезапуск процесса
+// и при переполнении удаляет самые старые сегменты.
+package queue
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	segmentExt = ".seg"
+	cursorFile = "cursor"
+	// recordHeaderSize длина и контрольная сумма записи.
+	recordHeaderSize = 8
+)
+
+// ErrEmpty возвращается, если в очереди нет записей.
+var ErrEmpty = errors.New("queue is empty")
+
+// segment описывает файл очереди.
+type segment struct {
+	id      uint64
+	size    int64
+	records int
+}
+
+// Queue очередь записей на диске. Каждая запись хранится как длина, CRC32 и данные.
+// Прочитанные записи подтверждаются методом Ack, позиция чтения сохраняется в файле cursor.
+type Queue struct {
+	mu           sync.Mutex
+	dir          string
+	maxBytes     int64
+	segmentBytes int64
+	segments     []*segment
+	headOffset   int64 // смещение первой неподтвержденной записи в первом сегменте
+	headRead     int   // количество подтвержденных записей первого сегмента
+	active       *os.File
+	dropped      uint64
+}
+
+// Open открывает очередь в каталоге dir, создавая его при необходимости.
+// maxBytes ограничивает суммарный размер сегментов, segmentBytes - размер одного сегмента.
+func Open(dir string, maxBytes, segmentBytes int64) (*Queue, error) {
+	if segmentBytes <= 0 || maxBytes < segmentBytes {
+		return nil, fmt.Errorf("queue size %d must be not less than segment size %d", maxBytes, segmentBytes)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	q := &Queue{dir: dir, maxBytes: maxBytes, segmentBytes: segmentBytes}
+	if err := q.load(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// Push добавляет запись в конец очереди. Если очередь переполнена, удаляются самые старые сегменты.
+func (q *Queue) Push(data []byte) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if int64(len(data))+recordHeaderSize > q.segmentBytes {
+		return fmt.Errorf("record of %d bytes exceeds segment size %d", len(data), q.segmentBytes)
+	}
+	tail := q.tail()
+	if tail == nil || tail.size+int64(len(data))+recordHeaderSize > q.segmentBytes {
+		if err := q.roll(); err != nil {
+			return err
+		}
+		tail = q.tail()
+	}
+	record := make([]byte, recordHeaderSize+len(data))
+	binary.BigEndian.PutUint32(record, uint32(len(data)))
+	binary.BigEndian.PutUint32(record[4:], crc32.ChecksumIEEE(data))
+	copy(record[recordHeaderSize:], data)
+	if _, err := q.active.Write(record); err != nil {
+		return err
+	}
+	if err := q.active.Sync(); err != nil {
+		return err
+	}
+	tail.size += int64(len(record))
+	tail.records++
+	return q.evict()
+}
+
+// Peek возвращает первую неподтвержденную запись.
+func (q *Queue) Peek() ([]byte, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.segments) > 0 {
+		head := q.segments[0]
+		if q.headRead < head.records {
+			file, err := os.Open(q.segmentPath(head.id))
+			if err != nil {
+				return nil, err
+			}
+			defer file.Close()
+			if _, err = file.Seek(q.headOffset, io.SeekStart); err != nil {
+				return nil, err
+			}
+			data, _, err := readRecord(bufio.NewReader(file), q.segmentBytes)
+			return data, err
+		}
+		if len(q.segments) == 1 {
+			break
+		}
+		if err := q.removeHead(); err != nil {
+			return nil, err
+		}
+	}
+	return nil, ErrEmpty
+}
+
+// Ack подтверждает обработку первой записи и удаляет ее из очереди.
+func (q *Queue) Ack() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.segments) == 0 || q.headRead >= q.segments[0].records {
+		return ErrEmpty
+	}
+	file, err := os.Open(q.segmentPath(q.segments[0].id))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err = file.Seek(q.headOffset, io.SeekStart); err != nil {
+		return err
+	}
+	_, size, err := readRecord(bufio.NewReader(file), q.segmentBytes)
+	if err != nil {
+		return err
+	}
+	q.headOffset += size
+	q.headRead++
+	if q.headRead == q.segments[0].records && len(q.segments) > 1 {
+		return q.removeHead()
+	}
+	return q.saveCursor()
+}
+
+// Len возвращает количество неподтвержденных записей.
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	total := -q.headRead
+	for _, s := range q.segments {
+		total += s.records
+	}
+	return total
+}
+
+// Dropped возвращает количество записей, удаленных при переполнении с момента открытия очереди.
+func (q *Queue) Dropped() uint64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.dropped
+}
+
+// Close закрывает файл текущего сегмента.
+func (q *Queue) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.active == nil {
+		return nil
+	}
+	err := q.active.Close()
+	q.active = nil
+	return err
+}
+
+// load читает сегменты и позицию чтения; поврежденный хвост последнего сегмента отбрасывается.
+func (q *Queue) load() error {
+	entries, err := os.ReadDir(q.dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), segmentExt)
+		if !ok {
+			continue
+		}
+		id, err := strconv.ParseUint(name, 10, 64)
+		if err != nil {
+			continue
+		}
+		q.segments = append(q.segments, &segment{id: id})
+	}
+	sort.Slice(q.segments, func(i, j int) bool { return q.segments[i].id < q.segments[j].id })
+	for i, s := range q.segments {
+		if err := q.scan(s, i == len(q.segments)-1); err != nil {
+			return err
+		}
+	}
+	if err := q.loadCursor(); err != nil {
+		return err
+	}
+	if tail := q.tail(); tail != nil {
+		q.active, err = os.OpenFile(q.segmentPath(tail.id), os.O_WRONLY|os.O_APPEND, 0644)
+		return err
+	}
+	return nil
+}
+
+// scan подсчитывает целые записи сегмента до первой поврежденной. Записи за поврежденной не читаются,
+// и очередь продолжается со следующего сегмента. Обрезается только последний сегмент, tail,
+// чтобы новые записи дописывались за последней целой; файлы остальных сегментов не изменяются.
+func (q *Queue) scan(s *segment, tail bool) error {
+	flag := os.O_RDONLY
+	if tail {
+		flag = os.O_RDWR
+	}
+	file, err := os.OpenFile(q.segmentPath(s.id), flag, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	reader := bufio.NewReader(file)
+	for {
+		_, size, err := readRecord(reader, q.segmentBytes)
+		if err != nil {
+			break
+		}
+		s.size += size
+		s.records++
+	}
+	if !tail {
+		return nil
+	}
+	return file.Truncate(s.size)
+}
+
+func (q *Queue) loadCursor() error {
+	data, err := os.ReadFile(filepath.Join(q.dir, cursorFile))
+	if errors.Is(err, os.ErrNotExist) || len(q.segments) == 0 {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var id uint64
+	var offset int64
+	var read int
+	if _, err = fmt.Sscanf(string(data), "%d %d %d", &id, &offset, &read); err != nil {
+		return nil
+	}
+	if id == q.segments[0].id && offset <= q.segments[0].size && read <= q.segments[0].records {
+		q.headOffset, q.headRead = offset, read
+	}
+	return nil
+}
+
+// saveCursor атомарно сохраняет позицию чтения.
+func (q *Queue) saveCursor() error {
+	if len(q.segments) == 0 {
+		return nil
+	}
+	tmp := filepath.Join(q.dir, cursorFile+".tmp")
+	data := fmt.Sprintf("%d %d %d", q.segments[0].id, q.headOffset, q.headRead)
+	if err := os.WriteFile(tmp, []byte(data), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(q.dir, cursorFile))
+}
+
+// roll начинает новый сегмент.
+func (q *Queue) roll() error {
+	var id uint64
+	if tail := q.tail(); tail != nil {
+		id = tail.id + 1
+	}
+	file, err := os.OpenFile(q.segmentPath(id), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if q.active != nil {
+		q.active.Close()
+	}
+	q.active = file
+	q.segments = append(q.segments, &segment{id: id})
+	return nil
+}
+
+// evict удаляет самые старые сегменты, пока размер очереди превышает maxBytes.
+func (q *Queue) evict() error {
+	for len(q.segments) > 1 && q.size() > q.maxBytes {
+		q.dropped += uint64(q.segments[0].records - q.headRead)
+		if err := q.removeHead(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (q *Queue) removeHead() error {
+	if err := os.Remove(q.segmentPath(q.segments[0].id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	q.segments = q.segments[1:]
+	q.headOffset, q.headRead = 0, 0
+	return q.saveCursor()
+}
+
+func (q *Queue) size() int64 {
+	var total int64
+	for _, s := range q.segments {
+		total += s.size
+	}
+	return total
+}
+
+func (q *Queue) tail() *segment {
+	if len(q.segments) == 0 {
+		return nil
+	}
+	return q.segments[len(q.segments)-1]
+}
+
+func (q *Queue) segmentPath(id uint64) string {
+	return filepath.Join(q.dir, fmt.Sprintf("%020d%s", id, segmentExt))
+}
+
+// readRecord читает одну запись не длиннее maxSize и возвращает ее данные и размер вместе с заголовком.
+func readRecord(reader io.Reader, maxSize int64) ([]byte, int64, error) {
+	header := make([]byte, recordHeaderSize)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return nil, 0, err
+	}
+	length := binary.BigEndian.Uint32(header)
+	if int64(length) > maxSize {
+		return nil, 0, errors.New("queue record is too long")
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(reader, data); err != nil {
+		return nil, 0, err
+	}
+	if crc32.ChecksumIEEE(data) != binary.BigEndian.Uint32(header[4:]) {
+		return nil, 0, errors.New("queue record checksum mismatch")
+	}
+	return data, int64(recordHeaderSize) + int64(length), nil
+}
@@ -0,0 +1,119 @@
+package queue
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func drain(t *testing.T, q *Queue) []string {
+	var records []string
+	for {
+		data, err := q.Peek()
+		if err == ErrEmpty {
+			return records
+		}
+		require.NoError(t, err)
+		records = append(records, string(data))
+		require.NoError(t, q.Ack())
+	}
+}
+
+func TestQueueOrderAndRestart(t *testing.T) {
+	dir := t.TempDir()
+	q, err := Open(dir, 1024, 64)
+	require.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		require.NoError(t, q.Push([]byte(fmt.Sprintf("batch-%d", i))))
+	}
+	assert.Equal(t, 10, q.Len())
+
+	data, err := q.Peek()
+	require.NoError(t, err)
+	assert.Equal(t, "batch-0", string(data))
+	require.NoError(t, q.Ack())
+	data, err = q.Peek()
+	require.NoError(t, err)
+	assert.Equal(t, "batch-1", string(data))
+	require.NoError(t, q.Ack())
+	require.NoError(t, q.Close())
+
+	q, err = Open(dir, 1024, 64)
+	require.NoError(t, err)
+	defer q.Close()
+	assert.Equal(t, 8, q.Len())
+	require.NoError(t, q.Push([]byte("batch-10")))
+	records := drain(t, q)
+	require.Len(t, records, 9)
+	assert.Equal(t, "batch-2", records[0])
+	assert.Equal(t, "batch-10", records[8])
+	assert.Equal(t, 0, q.Len())
+}
+
+func TestQueueEviction(t *testing.T) {
+	q, err := Open(t.TempDir(), 64, 32)
+	require.NoError(t, err)
+	defer q.Close()
+	// каждая запись занимает 8 байт заголовка и 8 байт данных, в сегмент помещаются две записи
+	for i := 0; i < 10; i++ {
+		require.NoError(t, q.Push([]byte(fmt.Sprintf("batch-%02d", i)[:8])))
+	}
+	assert.Equal(t, uint64(6), q.Dropped())
+	assert.Equal(t, 4, q.Len())
+	records := drain(t, q)
+	assert.Equal(t, []string{"batch-06", "batch-07", "batch-08", "batch-09"}, records)
+
+	assert.Error(t, q.Push(make([]byte, 64)), "record larger than a segment must be rejected")
+}
+
+func TestQueueTornWrite(t *testing.T) {
+	dir := t.TempDir()
+	q, err := Open(dir, 1024, 256)
+	require.NoError(t, err)
+	require.NoError(t, q.Push([]byte("complete")))
+	require.NoError(t, q.Close())
+
+	segment := filepath.Join(dir, fmt.Sprintf("%020d%s", 0, segmentExt))
+	file, err := os.OpenFile(segment, os.O_WRONLY|os.O_APPEND, 0644)
+	require.NoError(t, err)
+	_, err = file.Write([]byte{0, 0, 0, 100, 1, 2})
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	q, err = Open(dir, 1024, 256)
+	require.NoError(t, err)
+	defer q.Close()
+	assert.Equal(t, 1, q.Len())
+	require.NoError(t, q.Push([]byte("after restart")))
+	assert.Equal(t, []string{"complete", "after restart"}, drain(t, q))
+}
+
+func TestQueueCorruptedSegment(t *testing.T) {
+	dir := t.TempDir()
+	q, err := Open(dir, 1024, 32)
+	require.NoError(t, err)
+	// по два пакета в сегменте
+	for i := 0; i < 6; i++ {
+		require.NoError(t, q.Push([]byte(fmt.Sprintf("batch-%d", i))))
+	}
+	require.NoError(t, q.Close())
+
+	// повреждение второй записи среднего сегмента не затрагивает следующие сегменты
+	segment := filepath.Join(dir, fmt.Sprintf("%020d%s", 1, segmentExt))
+	data, err := os.ReadFile(segment)
+	require.NoError(t, err)
+	data[len(data)-1] ^= 0xff
+	require.NoError(t, os.WriteFile(segment, data, 0644))
+
+	q, err = Open(dir, 1024, 32)
+	require.NoError(t, err)
+	defer q.Close()
+	info, err := os.Stat(segment)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(data)), info.Size(), "only the tail segment is truncated")
+	assert.Equal(t, []string{"batch-0", "batch-1", "batch-2", "batch-4", "batch-5"}, drain(t, q))
+}
@@ -1,7 +1,6 @@
 package security
 
 import (
-	"bytes"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
@@ -10,7 +9,6 @@ import (
 	"errors"
 	"hash"
 	"io"
-	"net/http"
 	"os"
 )
 
@@ -33,6 +31,9 @@ func GetPrivateKey(privateKeyPath string) (*rsa.PrivateKey, error) {
 	}
 
 	pemBlock, _ := pem.Decode(privateKeyBytes)
+	if pemBlock == nil {
+		return nil, errors.New("failed to decode PEM block containing private key")
+	}
 	key, err := x509.ParsePKCS1PrivateKey(pemBlock.Bytes)
 	if err != nil {
 		return nil, err
@@ -53,6 +54,9 @@ func GetPublicKey(publicKeyPath string) (*rsa.PublicKey, error) {
 	}
 
 	pemBlock, _ := pem.Decode(publicKeyBytes)
+	if pemBlock == nil {
+		return nil, ErrBadPublicKeyFormat
+	}
 	untypedKey, err := x509.ParsePKIXPublicKey(pemBlock.Bytes)
 	if err != nil {
 		return nil, err
@@ -132,30 +136,6 @@ func DecryptWithPrivateKey(data []byte, key *rsa.PrivateKey) ([]byte, error) {
 	return decryptedMessage, nil
 }
 
-func DecryptMiddleware(privateKey *rsa.PrivateKey) func(next http.HandlerFunc) http.HandlerFunc {
-	return func(next http.HandlerFunc) http.HandlerFunc {
-		return func(w http.ResponseWriter, r *http.Request) {
-			body, err := io.ReadAll(r.Body)
-
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-
-			decryptedMessage, err := DecryptWithPrivateKey(body, privateKey)
-
-			if err != nil {
-				http.Error(w, "Failed to decrypt message", http.StatusInternalServerError)
-				return
-			}
-
-			r.Body = io.NopCloser(bytes.NewBuffer(decryptedMessage))
-
-			next.ServeHTTP(w, r)
-		}
-	}
-}
-
 // RSAEncrypt encrypts data with public key
 func RSAEncrypt(msg []byte, publicKey *rsa.PublicKey) ([]byte, error) {
 	if publicKey == nil {
@@ -0,0 +1,184 @@
+package security
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Конверт (envelope) шифрует данные случайным ключом AES-256-GCM, а сам ключ - открытым ключом RSA-OAEP.
+// Формат конверта:
+//
+//	magic "MSEV" | версия (1 байт) | длина ID ключа (1 байт) | ID ключа |
+//	длина зашифрованного ключа данных (2 байта, big endian) | ключ данных, зашифрованный RSA-OAEP |
+//	nonce GCM (12 байт) | шифротекст с тегом GCM
+//
+// Заголовок до nonce включительно используется как дополнительные данные GCM,
+// поэтому его изменение обнаруживается при расшифровке.
+const (
+	envelopeVersion = 1
+	dataKeySize     = 32
+)
+
+var envelopeMagic = []byte("MSEV")
+
+var (
+	// ErrNotEnvelope возвращается, если данные не являются конвертом.
+	ErrNotEnvelope = errors.New("data is not an encrypted envelope")
+	// ErrUnsupportedEnvelope возвращается для конверта неизвестной версии.
+	ErrUnsupportedEnvelope = errors.New("unsupported envelope version")
+	// ErrUnknownKeyID возвращается, если у сервера нет закрытого ключа с ID из конверта.
+	ErrUnknownKeyID = errors.New("unknown encryption key id")
+)
+
+// KeyID возвращает идентификатор открытого ключа: первые 8 байт SHA-256 от его PKIX представления в hex.
+func KeyID(key *rsa.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:8]), nil
+}
+
+// IsEnvelope проверяет, начинаются ли данные с заголовка конверта.
+func IsEnvelope(data []byte) bool {
+	return bytes.HasPrefix(data, envelopeMagic)
+}
+
+// EncryptEnvelope шифрует данные для владельца закрытой пары к открытому ключу key.
+func EncryptEnvelope(data []byte, key *rsa.PublicKey) ([]byte, error) {
+	keyID, err := KeyID(key)
+	if err != nil {
+		return nil, err
+	}
+	dataKey := make([]byte, dataKeySize)
+	if _, err = rand.Read(dataKey); err != nil {
+		return nil, err
+	}
+	encryptedKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, key, dataKey, nil)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't encrypt data key: %w", err)
+	}
+	gcm, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, 0, len(envelopeMagic)+2+len(keyID)+2+len(encryptedKey)+gcm.NonceSize())
+	header = append(header, envelopeMagic...)
+	header = append(header, envelopeVersion, byte(len(keyID)))
+	header = append(header, keyID...)
+	header = binary.BigEndian.AppendUint16(header, uint16(len(encryptedKey)))
+	header = append(header, encryptedKey...)
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	header = append(header, nonce...)
+	return gcm.Seal(header, nonce, data, header), nil
+}
+
+// Keyring хранит закрытые ключи сервера по их идентификаторам.
+// Несколько ключей позволяют сменить ключ агентов без остановки сервера.
+type Keyring struct {
+	keys    map[string]*rsa.PrivateKey
+	primary *rsa.PrivateKey
+}
+
+// NewKeyring создает набор закрытых ключей; первый ключ используется для данных в устаревшем формате.
+func NewKeyring(keys ...*rsa.PrivateKey) (*Keyring, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("keyring must contain at least one key")
+	}
+	keyring := &Keyring{keys: make(map[string]*rsa.PrivateKey, len(keys)), primary: keys[0]}
+	for _, key := range keys {
+		keyID, err := KeyID(&key.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+		keyring.keys[keyID] = key
+	}
+	return keyring, nil
+}
+
+// LoadKeyring читает закрытые ключи из файлов, перечисленных через запятую.
+// Пустая строка означает, что шифрование не используется, и возвращается nil.
+func LoadKeyring(paths string) (*Keyring, error) {
+	if strings.TrimSpace(paths) == "" {
+		return nil, nil
+	}
+	var keys []*rsa.PrivateKey
+	for _, path := range strings.Split(paths, ",") {
+		key, err := GetPrivateKey(strings.TrimSpace(path))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		keys = append(keys, key)
+	}
+	return NewKeyring(keys...)
+}
+
+// Decrypt расшифровывает конверт ключом с идентификатором из его заголовка.
+func (k *Keyring) Decrypt(data []byte) ([]byte, error) {
+	if !IsEnvelope(data) {
+		return nil, ErrNotEnvelope
+	}
+	rest := data[len(envelopeMagic):]
+	if len(rest) < 2 {
+		return nil, ErrNotEnvelope
+	}
+	if rest[0] != envelopeVersion {
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedEnvelope, rest[0])
+	}
+	idLen := int(rest[1])
+	rest = rest[2:]
+	if len(rest) < idLen+2 {
+		return nil, ErrNotEnvelope
+	}
+	keyID := string(rest[:idLen])
+	key, ok := k.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKeyID, keyID)
+	}
+	keyLen := int(binary.BigEndian.Uint16(rest[idLen:]))
+	rest = rest[idLen+2:]
+	if len(rest) < keyLen {
+		return nil, ErrNotEnvelope
+	}
+	dataKey, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, key, rest[:keyLen], nil)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't decrypt data key: %w", err)
+	}
+	gcm, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	rest = rest[keyLen:]
+	if len(rest) < gcm.NonceSize() {
+		return nil, ErrNotEnvelope
+	}
+	headerLen := len(data) - len(rest) + gcm.NonceSize()
+	return gcm.Open(nil, rest[:gcm.NonceSize()], rest[gcm.NonceSize():], data[:headerLen])
+}
+
+// DecryptLegacy расшифровывает данные в устаревшем формате блоков RSA-OAEP основным ключом.
+func (k *Keyring) DecryptLegacy(data []byte) ([]byte, error) {
+	return RSADecrypt(data, k.primary)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,112 @@
+package security
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func generateKey(t *testing.T) *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, RSAKeySize)
+	require.NoError(t, err)
+	return key
+}
+
+func TestEnvelope(t *testing.T) {
+	oldKey, newKey, foreignKey := generateKey(t), generateKey(t), generateKey(t)
+	keyring, err := NewKeyring(newKey, oldKey)
+	require.NoError(t, err)
+	payload := bytes.Repeat([]byte(`{"id":"Alloc","type":"gauge","value":1}`), 1000)
+
+	for _, key := range []*rsa.PrivateKey{oldKey, newKey} {
+		envelope, err := EncryptEnvelope(payload, &key.PublicKey)
+		require.NoError(t, err)
+		assert.True(t, IsEnvelope(envelope))
+		decrypted, err := keyring.Decrypt(envelope)
+		require.NoError(t, err)
+		assert.Equal(t, payload, decrypted)
+	}
+
+	envelope, err := EncryptEnvelope(payload, &foreignKey.PublicKey)
+	require.NoError(t, err)
+	_, err = keyring.Decrypt(envelope)
+	assert.ErrorIs(t, err, ErrUnknownKeyID)
+
+	envelope, err = EncryptEnvelope(payload, &newKey.PublicKey)
+	require.NoError(t, err)
+	envelope[len(envelope)-1] ^= 0xff
+	_, err = keyring.Decrypt(envelope)
+	assert.Error(t, err, "tampered ciphertext must be rejected")
+
+	envelope, err = EncryptEnvelope(payload, &newKey.PublicKey)
+	require.NoError(t, err)
+	envelope[len(envelopeMagic)] = envelopeVersion + 1
+	_, err = keyring.Decrypt(envelope)
+	assert.ErrorIs(t, err, ErrUnsupportedEnvelope)
+
+	_, err = keyring.Decrypt(envelope[:len(envelopeMagic)+3])
+	assert.Error(t, err)
+}
+
+func TestBodyDecrypt(t *testing.T) {
+	key := generateKey(t)
+	keyring, err := NewKeyring(key)
+	require.NoError(t, err)
+	payload := []byte(`[{"id":"PollCount","type":"counter","delta":1}]`)
+	envelope, err := EncryptEnvelope(payload, &key.PublicKey)
+	require.NoError(t, err)
+	legacy, err := RSAEncrypt(payload, &key.PublicKey)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name         string
+		body         []byte
+		allowLegacy  bool
+		expectedCode int
+	}{
+		{name: "envelope", body: envelope, expectedCode: http.StatusOK},
+		{name: "envelope with legacy allowed", body: envelope, allowLegacy: true, expectedCode: http.StatusOK},
+		{name: "legacy rejected", body: legacy, expectedCode: http.StatusBadRequest},
+		{name: "legacy allowed", body: legacy, allowLegacy: true, expectedCode: http.StatusOK},
+		{name: "plain body", body: payload, expectedCode: http.StatusBadRequest},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var received []byte
+			handler := BodyDecrypt(keyring, tc.allowLegacy)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				received, _ = io.ReadAll(r.Body)
+			}))
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/updates/", bytes.NewReader(tc.body)))
+			assert.Equal(t, tc.expectedCode, recorder.Code)
+			if tc.expectedCode == http.StatusOK {
+				assert.Equal(t, payload, received)
+			}
+		})
+	}
+}
+
+func TestEncryptionMiddleware(t *testing.T) {
+	key := generateKey(t)
+	keyring, err := NewKeyring(key)
+	require.NoError(t, err)
+	var received []byte
+	ts := httptest.NewServer(BodyDecrypt(keyring, false)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received, _ = io.ReadAll(r.Body)
+	})))
+	defer ts.Close()
+
+	client := http.Client{Transport: EncryptionMiddleware{Proxied: http.DefaultTransport, PublicKey: &key.PublicKey}}
+	response, err := client.Post(ts.URL, "application/json", bytes.NewReader([]byte("payload")))
+	require.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, "payload", string(received))
+}
@@ -0,0 +1,92 @@
+package security
+
+import (
+	"context"
+	"encoding/hex"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// HashMetadata ключ метаданных gRPC с подписью сообщения, аналог заголовка HashSHA256.
+const HashMetadata = "hashsha256"
+
+// marshalMessage сериализует сообщение для подписи детерминированно, одинаково у клиента и сервера.
+func marshalMessage(message any) ([]byte, error) {
+	msg, ok := message.(proto.Message)
+	if !ok {
+		return nil, status.Errorf(codes.Internal, "cannot sign %T", message)
+	}
+	return proto.MarshalOptions{Deterministic: true}.Marshal(msg)
+}
+
+// signMessage возвращает подпись сообщения в шестнадцатеричном виде.
+func signMessage(message any, key string) (string, error) {
+	data, err := marshalMessage(message)
+	if err != nil {
+		return "", err
+	}
+	sign, err := AddSign(data, key)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(sign), nil
+}
+
+// UnaryServerInterceptor проверяет подпись запроса в метаданных hashsha256 и подписывает ответ тем же ключом,
+// как middleware New для HTTP. Пустые запросы не проверяются; непустые запросы без подписи отклоняются,
+// если не задан allowUnsigned.
+func UnaryServerInterceptor(key string, allowUnsigned bool) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		data, err := marshalMessage(req)
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		var signs []string
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			signs = md.Get(HashMetadata)
+		}
+		switch {
+		case len(signs) > 0:
+			if !CheckSign(data, signs[0], key) {
+				return nil, status.Error(codes.Unauthenticated, "wrong security sign")
+			}
+		case len(data) > 0 && !allowUnsigned:
+			return nil, status.Error(codes.Unauthenticated, "security sign is not found")
+		}
+		resp, err := handler(ctx, req)
+		if err != nil {
+			return resp, err
+		}
+		if sign, err := signMessage(resp, key); err == nil {
+			_ = grpc.SetHeader(ctx, metadata.Pairs(HashMetadata, sign))
+		}
+		return resp, nil
+	}
+}
+
+// StreamServerInterceptor отклоняет потоковые вызовы, если не задан allowUnsigned: метаданные передаются
+// один раз на поток, и подписать ими каждое сообщение потока нельзя.
+func StreamServerInterceptor(allowUnsigned bool) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if !allowUnsigned {
+			return status.Errorf(codes.Unauthenticated, "%s cannot be signed, use unary calls", info.FullMethod)
+		}
+		return handler(srv, ss)
+	}
+}
+
+// UnaryClientInterceptor подписывает запрос ключом key и передает подпись в метаданных hashsha256.
+func UnaryClientInterceptor(key string) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		sign, err := signMessage(req, key)
+		if err != nil {
+			return err
+		}
+		ctx = metadata.AppendToOutgoingContext(ctx, HashMetadata, sign)
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
@@ -5,20 +5,28 @@ import (
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
-	"fmt"
 	"io"
 	"net/http"
+
+	"github.com/justEngineer/go-metrics-service/internal/dedup"
 )
 
 const (
 	HashHeader = "HashSHA256"
 )
 
+// securedResponseWriter накапливает ответ, чтобы подписать его целиком:
+// заголовок с подписью должен быть отправлен раньше тела.
+// Ответ, который обработчик отправляет частями через Flush, подписать нельзя, и он передается без подписи.
 type securedResponseWriter struct {
 	http.ResponseWriter
 	securityKey string
+	status      int
+	body        bytes.Buffer
+	streaming   bool
 }
 
+// AddSign вычисляет HMAC-SHA256 подпись данных.
 func AddSign(data []byte, securityKey string) ([]byte, error) {
 	h := hmac.New(sha256.New, []byte(securityKey))
 	if _, err := h.Write(data); err != nil {
@@ -27,50 +35,133 @@ func AddSign(data []byte, securityKey string) ([]byte, error) {
 	return h.Sum(nil), nil
 }
 
-func (w securedResponseWriter) Write(data []byte) (int, error) {
-	if w.securityKey != "" {
-		data, err := AddSign(data, w.securityKey)
-		if err != nil {
-			return 0, fmt.Errorf("failed to sign data: %w", err)
-		}
-		w.ResponseWriter.Header().Set(HashHeader, hex.EncodeToString(data))
+// CheckSign проверяет, что sign в шестнадцатеричном виде является подписью данных.
+func CheckSign(data []byte, sign string, securityKey string) bool {
+	decoded, err := hex.DecodeString(sign)
+	if err != nil {
+		return false
+	}
+	expected, err := AddSign(data, securityKey)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(decoded, expected)
+}
+
+// SignedData возвращает данные запроса, которые покрывает подпись HashSHA256. Если агент передал
+// заголовки X-Agent-ID и X-Agent-Seq, они добавляются перед телом, чтобы номер пакета нельзя было подменить
+// или удалить, не нарушив подпись; тело, сжатое gzip или в формате JSON, не может начинаться с них же.
+func SignedData(header http.Header, body []byte) []byte {
+	agentID := header.Get(dedup.HeaderAgentID)
+	if agentID == "" {
+		return body
+	}
+	prefix := dedup.HeaderAgentID + ": " + agentID + "\n" + dedup.HeaderSequence + ": " + header.Get(dedup.HeaderSequence) + "\n"
+	return append([]byte(prefix), body...)
+}
+
+// SignedTarget возвращает данные, которые покрывает подпись изменяющего запроса без тела:
+// метод, путь и параметры запроса, чтобы подпись нельзя было перенести на другой запрос.
+func SignedTarget(method, requestURI string) []byte {
+	return []byte(method + " " + requestURI)
+}
+
+// WriteHeader запоминает код ответа до отправки подписанного тела.
+func (w *securedResponseWriter) WriteHeader(statusCode int) {
+	if w.status == 0 {
+		w.status = statusCode
+	}
+}
+
+// Write добавляет данные к телу ответа.
+func (w *securedResponseWriter) Write(data []byte) (int, error) {
+	if w.streaming {
 		return w.ResponseWriter.Write(data)
 	}
-	return w.ResponseWriter.Write(data)
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.body.Write(data)
+}
+
+// FlushError переводит ответ в потоковый режим: накопленное тело отправляется без подписи,
+// дальнейшие данные передаются клиенту сразу. Используется http.ResponseController.
+func (w *securedResponseWriter) FlushError() error {
+	if !w.streaming {
+		w.streaming = true
+		if w.status == 0 {
+			w.status = http.StatusOK
+		}
+		w.ResponseWriter.WriteHeader(w.status)
+		if _, err := w.ResponseWriter.Write(w.body.Bytes()); err != nil {
+			return err
+		}
+		w.body.Reset()
+	}
+	return http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Unwrap возвращает оригинальный http.ResponseWriter для http.ResponseController.
+func (w *securedResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// send подписывает накопленное тело и отправляет ответ клиенту.
+func (w *securedResponseWriter) send() error {
+	if w.streaming {
+		return nil
+	}
+	sign, err := AddSign(w.body.Bytes(), w.securityKey)
+	if err != nil {
+		return err
+	}
+	w.ResponseWriter.Header().Set(HashHeader, hex.EncodeToString(sign))
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	_, err = w.ResponseWriter.Write(w.body.Bytes())
+	return err
 }
 
-func New(key string) func(http.Handler) http.Handler {
+// New создает middleware, которое проверяет подпись тела запроса в заголовке HashSHA256
+// (вместе с заголовками агента, см. SignedData) и подписывает тело ответа тем же ключом. Подпись вычисляется по телу в том виде,
+// в котором оно передается по сети, то есть после сжатия gzip, поэтому middleware
+// должно находиться снаружи middleware сжатия.
+// У изменяющих запросов без тела (DELETE /value/..., POST /reset/...) подписываются метод, путь и параметры,
+// см. SignedTarget; GET и HEAD без тела не проверяются. Запросы с телом и изменяющие запросы без подписи
+// отклоняются, если не задан allowUnsigned, который нужен на время перехода агентов на подпись.
+func New(key string, allowUnsigned bool) func(http.Handler) http.Handler {
 	return func(h http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			contentHashHeader := r.Header.Get(HashHeader)
-			if contentHashHeader == "" {
-				h.ServeHTTP(w, r)
-				return
-			}
-			response, err := io.ReadAll(r.Body)
+			body, err := io.ReadAll(r.Body)
 			if err != nil {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
 			}
-			r.Body = io.NopCloser(bytes.NewBuffer(response))
-			_, err = AddSign(response, key)
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
+			r.Body = io.NopCloser(bytes.NewBuffer(body))
+			signed := SignedData(r.Header, body)
+			mutating := len(body) == 0 && r.Method != http.MethodGet && r.Method != http.MethodHead
+			if mutating {
+				signed = SignedTarget(r.Method, r.URL.RequestURI())
 			}
-			_, err = hex.DecodeString(contentHashHeader)
-			if err != nil {
-				http.Error(w, "Header with security sign is not found", http.StatusInternalServerError)
+			contentHashHeader := r.Header.Get(HashHeader)
+			switch {
+			case contentHashHeader != "":
+				if !CheckSign(signed, contentHashHeader, key) {
+					http.Error(w, "Wrong security sign", http.StatusBadRequest)
+					return
+				}
+			case (len(body) > 0 || mutating) && !allowUnsigned:
+				http.Error(w, "Header with security sign is not found", http.StatusBadRequest)
 				return
 			}
-			// if contentHashHeader != "" && !hmac.Equal(decodedHash, signedResponse) {
-			// 	http.Error(w, "Wrong security sign", http.StatusBadRequest)
-			// 	return
-			// }
-			h.ServeHTTP(securedResponseWriter{
+			secured := &securedResponseWriter{
 				ResponseWriter: w,
 				securityKey:    key,
-			}, r)
+			}
+			h.ServeHTTP(secured, r)
+			_ = secured.send()
 		})
 	}
 }
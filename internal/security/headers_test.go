@@ -0,0 +1,164 @@
+package security
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/justEngineer/go-metrics-service/internal/dedup"
+	compression "github.com/justEngineer/go-metrics-service/internal/gzip"
+)
+
+func sign(t *testing.T, data []byte, key string) string {
+	signed, err := AddSign(data, key)
+	require.NoError(t, err)
+	return hex.EncodeToString(signed)
+}
+
+func TestSignMiddleware(t *testing.T) {
+	const key = "secret"
+	body := []byte(`[{"id":"Alloc","type":"gauge","value":1}]`)
+	echo := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(data)
+	})
+
+	testCases := []struct {
+		name          string
+		body          []byte
+		sign          string
+		allowUnsigned bool
+		expectedCode  int
+	}{
+		{name: "valid sign", body: body, sign: sign(t, body, key), expectedCode: http.StatusOK},
+		{name: "sign with another key", body: body, sign: sign(t, body, "other"), expectedCode: http.StatusBadRequest},
+		{name: "sign of another body", body: body, sign: sign(t, []byte("{}"), key), expectedCode: http.StatusBadRequest},
+		{name: "malformed sign", body: body, sign: "not-hex", expectedCode: http.StatusBadRequest},
+		{name: "missing sign", body: body, expectedCode: http.StatusBadRequest},
+		{name: "missing sign allowed", body: body, allowUnsigned: true, expectedCode: http.StatusOK},
+		{name: "invalid sign is rejected even if unsigned allowed", body: body, sign: sign(t, body, "other"), allowUnsigned: true, expectedCode: http.StatusBadRequest},
+		{name: "request without body", expectedCode: http.StatusBadRequest},
+		{name: "request without body allowed", allowUnsigned: true, expectedCode: http.StatusOK},
+		{name: "request without body signed", sign: sign(t, SignedTarget(http.MethodPost, "/updates/"), key), expectedCode: http.StatusOK},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodPost, "/updates/", bytes.NewReader(tc.body))
+			if tc.sign != "" {
+				request.Header.Set(HashHeader, tc.sign)
+			}
+			recorder := httptest.NewRecorder()
+			New(key, tc.allowUnsigned)(echo).ServeHTTP(recorder, request)
+			result := recorder.Result()
+			defer result.Body.Close()
+			responseBody, err := io.ReadAll(result.Body)
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.expectedCode, result.StatusCode)
+			if tc.expectedCode == http.StatusOK {
+				assert.Equal(t, string(tc.body), string(responseBody))
+				assert.True(t, CheckSign(responseBody, result.Header.Get(HashHeader), key), "response must be signed")
+			}
+		})
+	}
+}
+
+func TestSignCoversAgentHeaders(t *testing.T) {
+	const key = "secret"
+	body := []byte(`[{"id":"PollCount","type":"counter","delta":1}]`)
+	header := http.Header{}
+	dedup.SetHeader(header, "a1", 7)
+	signature := sign(t, SignedData(header, body), key)
+	handler := New(key, false)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for _, tc := range []struct {
+		seq          string
+		expectedCode int
+	}{
+		{seq: "7", expectedCode: http.StatusOK},
+		{seq: "8", expectedCode: http.StatusBadRequest},
+	} {
+		request := httptest.NewRequest(http.MethodPost, "/updates/", bytes.NewReader(body))
+		request.Header.Set(HashHeader, signature)
+		request.Header.Set(dedup.HeaderAgentID, "a1")
+		request.Header.Set(dedup.HeaderSequence, tc.seq)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		assert.Equal(t, tc.expectedCode, recorder.Code, "seq %s", tc.seq)
+	}
+
+	// подпись пакета с номером не подходит тому же телу без заголовков агента
+	request := httptest.NewRequest(http.MethodPost, "/updates/", bytes.NewReader(body))
+	request.Header.Set(HashHeader, signature)
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestSignBodylessRequests(t *testing.T) {
+	const key = "secret"
+	handler := New(key, false)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for _, tc := range []struct {
+		method       string
+		url          string
+		sign         string
+		expectedCode int
+	}{
+		{method: http.MethodGet, url: "/value/gauge/temp", expectedCode: http.StatusOK},
+		{method: http.MethodDelete, url: "/value/gauge/temp", expectedCode: http.StatusBadRequest},
+		{method: http.MethodDelete, url: "/value/gauge/temp", sign: sign(t, SignedTarget(http.MethodDelete, "/value/gauge/temp"), key), expectedCode: http.StatusOK},
+		{method: http.MethodDelete, url: "/value/gauge/cpu", sign: sign(t, SignedTarget(http.MethodDelete, "/value/gauge/temp"), key), expectedCode: http.StatusBadRequest},
+		{method: http.MethodDelete, url: "/api/v1/metrics?prefix=host_", sign: sign(t, SignedTarget(http.MethodDelete, "/api/v1/metrics?prefix=h"), key), expectedCode: http.StatusBadRequest},
+	} {
+		request := httptest.NewRequest(tc.method, tc.url, nil)
+		if tc.sign != "" {
+			request.Header.Set(HashHeader, tc.sign)
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		assert.Equal(t, tc.expectedCode, recorder.Code, "%s %s", tc.method, tc.url)
+	}
+}
+
+func TestSignMiddlewareWithGzip(t *testing.T) {
+	const key = "secret"
+	handler := New(key, false)(compression.GzipMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		_, _ = w.Write(data)
+	})))
+
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	_, err := zw.Write([]byte("payload"))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+
+	request := httptest.NewRequest(http.MethodPost, "/update/", bytes.NewReader(compressed.Bytes()))
+	request.Header.Set("Content-Encoding", "gzip")
+	request.Header.Set("Accept-Encoding", "gzip")
+	request.Header.Set(HashHeader, sign(t, compressed.Bytes(), key))
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	result := recorder.Result()
+	defer result.Body.Close()
+	responseBody, err := io.ReadAll(result.Body)
+	require.NoError(t, err)
+
+	require.Equal(t, http.StatusOK, result.StatusCode)
+	assert.Equal(t, "gzip", result.Header.Get("Content-Encoding"))
+	assert.True(t, CheckSign(responseBody, result.Header.Get(HashHeader), key), "sign must cover the compressed body")
+	zr, err := gzip.NewReader(bytes.NewReader(responseBody))
+	require.NoError(t, err)
+	plain, err := io.ReadAll(zr)
+	require.NoError(t, err)
+	assert.Equal(t, "payload", string(plain))
+}
@@ -13,24 +13,34 @@ var (
 	ErrCouldntReadBody = errors.New("couldn't read body")
 )
 
-// BodyDecrypt decrypts request body
-func BodyDecrypt(privateKey *rsa.PrivateKey) func(http.Handler) http.Handler {
+// BodyDecrypt расшифровывает тело запроса, зашифрованное конвертом EncryptEnvelope,
+// ключом из keyring с идентификатором из заголовка конверта.
+// Если allowLegacy задан, принимаются также данные в устаревшем формате блоков RSA-OAEP.
+func BodyDecrypt(keyring *Keyring, allowLegacy bool) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if privateKey == nil {
+			if keyring == nil {
 				next.ServeHTTP(w, r)
 				return
 			}
 			body, err := io.ReadAll(r.Body)
-			switch {
-			case errors.Is(err, io.EOF):
-				next.ServeHTTP(w, r)
-				return
-			case err != nil:
+			if err != nil {
 				http.Error(w, fmt.Sprintf("Cannot read provided data: %q", err), http.StatusInternalServerError)
 				return
 			}
-			decryptedBody, err := RSADecrypt(body, privateKey)
+			if len(body) == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+			var decryptedBody []byte
+			switch {
+			case IsEnvelope(body):
+				decryptedBody, err = keyring.Decrypt(body)
+			case allowLegacy:
+				decryptedBody, err = keyring.DecryptLegacy(body)
+			default:
+				err = ErrNotEnvelope
+			}
 			if err != nil {
 				http.Error(w, fmt.Sprintf("Cannot decrypt provided data: %q", err), http.StatusBadRequest)
 				return
@@ -44,7 +54,7 @@ func BodyDecrypt(privateKey *rsa.PrivateKey) func(http.Handler) http.Handler {
 	}
 }
 
-// EncryptionMiddleware encrypts HTTP client requests and decrypts HTTP server responses
+// EncryptionMiddleware encrypts HTTP client requests with EncryptEnvelope
 type EncryptionMiddleware struct {
 	Proxied   http.RoundTripper
 	PublicKey *rsa.PublicKey
@@ -64,7 +74,7 @@ func (ert EncryptionMiddleware) RoundTrip(req *http.Request) (*http.Response, er
 		return nil, ErrCouldntReadBody
 	}
 
-	encryptedBody, err := RSAEncrypt(body, ert.PublicKey)
+	encryptedBody, err := EncryptEnvelope(body, ert.PublicKey)
 	if err != nil {
 		return nil, fmt.Errorf("couldn't encrypt body: %w", err)
 	}
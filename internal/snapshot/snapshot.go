@@ -0,0 +1,357 @@
+// Package snapshot реализует формат файла копии хранилища метрик.
+// Файл начинается с заголовка с версией формата, способом сжатия, номером сегмента журнала упреждающей
+// записи и контрольной суммой CRC-32C, за которым следует JSON storage.MetricsDump, возможно сжатый gzip или zstd.
+// Копия записывается во временный файл и атомарно переименовывается, а несколько предыдущих копий
+// сохраняются с суффиксами .1, .2 и так далее, чтобы при повреждении последней восстановиться из более ранней.
+package snapshot
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/justEngineer/go-metrics-service/internal/storage"
+)
+
+// Version текущая версия формата. Версия 0 обозначает файлы без заголовка с JSON storage.MetricsDump.
+const Version = 1
+
+// DefaultRetention количество хранимых копий по умолчанию, включая последнюю.
+const DefaultRetention = 3
+
+const headerSize = 36
+
+var (
+	magic    = [4]byte{'M', 'S', 'N', 'P'}
+	crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+	// ErrCorrupted возвращается, если файл копии поврежден.
+	ErrCorrupted = errors.New("snapshot: corrupted")
+	// ErrUnsupportedVersion возвращается для файлов более новой версии формата.
+	ErrUnsupportedVersion = errors.New("snapshot: unsupported version")
+)
+
+// Compression способ сжатия содержимого копии.
+type Compression uint8
+
+const (
+	CompressionNone Compression = iota // без сжатия
+	CompressionGzip                    // gzip
+	CompressionZstd                    // zstd
+)
+
+var compressionNames = []string{"none", "gzip", "zstd"}
+
+// String возвращает название способа сжатия.
+func (c Compression) String() string {
+	if int(c) < len(compressionNames) {
+		return compressionNames[c]
+	}
+	return "unknown(" + strconv.Itoa(int(c)) + ")"
+}
+
+// ParseCompression разбирает название способа сжатия: none, gzip или zstd; пустая строка означает none.
+func ParseCompression(value string) (Compression, error) {
+	if value == "" {
+		return CompressionNone, nil
+	}
+	for i, name := range compressionNames {
+		if value == name {
+			return Compression(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown snapshot compression %q, expected none, gzip or zstd", value)
+}
+
+// Header заголовок файла копии.
+type Header struct {
+	Version     uint16      // версия формата
+	Compression Compression // способ сжатия содержимого
+	CreatedAt   time.Time   // время создания копии
+	WALSegment  uint64      // номер первого сегмента журнала, изменения из которого не вошли в копию
+	Size        uint64      // размер содержимого после заголовка в байтах
+	Checksum    uint32      // CRC-32C содержимого после заголовка
+}
+
+// Snapshot прочитанная копия хранилища.
+type Snapshot struct {
+	Path   string
+	Header Header
+	Dump   storage.MetricsDump
+}
+
+// Encode записывает копию dump в w. Номер сегмента журнала берется из dump.WALSegment.
+func Encode(w io.Writer, dump storage.MetricsDump, compression Compression, createdAt time.Time) (Header, error) {
+	data, err := json.Marshal(dump)
+	if err != nil {
+		return Header{}, fmt.Errorf("serializing dump to JSON failed: %w", err)
+	}
+	payload, err := compress(data, compression)
+	if err != nil {
+		return Header{}, err
+	}
+	header := Header{
+		Version:     Version,
+		Compression: compression,
+		CreatedAt:   createdAt,
+		WALSegment:  dump.WALSegment,
+		Size:        uint64(len(payload)),
+		Checksum:    crc32.Checksum(payload, crcTable),
+	}
+	if _, err := w.Write(header.marshal()); err != nil {
+		return Header{}, err
+	}
+	if _, err := w.Write(payload); err != nil {
+		return Header{}, err
+	}
+	return header, nil
+}
+
+// Decode проверяет и разбирает копию. Файлы версии 0 без заголовка разбираются как JSON.
+func Decode(data []byte) (Header, storage.MetricsDump, error) {
+	var dump storage.MetricsDump
+	if !bytes.HasPrefix(data, magic[:]) {
+		if err := json.Unmarshal(data, &dump); err != nil {
+			return Header{}, dump, fmt.Errorf("%w: %s", ErrCorrupted, err)
+		}
+		return Header{WALSegment: dump.WALSegment, Size: uint64(len(data))}, dump, nil
+	}
+	header, err := unmarshalHeader(data)
+	if err != nil {
+		return header, dump, err
+	}
+	payload := data[headerSize:]
+	if uint64(len(payload)) != header.Size {
+		return header, dump, fmt.Errorf("%w: size %d, expected %d", ErrCorrupted, len(payload), header.Size)
+	}
+	if checksum := crc32.Checksum(payload, crcTable); checksum != header.Checksum {
+		return header, dump, fmt.Errorf("%w: checksum %08x, expected %08x", ErrCorrupted, checksum, header.Checksum)
+	}
+	data, err = decompress(payload, header.Compression)
+	if err != nil {
+		return header, dump, fmt.Errorf("%w: %s", ErrCorrupted, err)
+	}
+	if err := json.Unmarshal(data, &dump); err != nil {
+		return header, dump, fmt.Errorf("%w: %s", ErrCorrupted, err)
+	}
+	dump.WALSegment = header.WALSegment
+	return header, dump, nil
+}
+
+// ReadFile читает и проверяет файл копии.
+func ReadFile(path string) (*Snapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	header, dump, err := Decode(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &Snapshot{Path: path, Header: header, Dump: dump}, nil
+}
+
+// ReadHeader читает заголовок файла копии без проверки содержимого.
+// Для файлов версии 0 файл читается целиком, чтобы узнать номер сегмента журнала.
+func ReadHeader(path string) (Header, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return Header{}, err
+	}
+	defer file.Close()
+	data := make([]byte, headerSize)
+	n, err := io.ReadFull(file, data)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return Header{}, err
+	}
+	if !bytes.HasPrefix(data[:n], magic[:]) {
+		snapshot, err := ReadFile(path)
+		if err != nil {
+			return Header{}, err
+		}
+		return snapshot.Header, nil
+	}
+	header, err := unmarshalHeader(data[:n])
+	if err != nil {
+		return header, fmt.Errorf("%s: %w", path, err)
+	}
+	return header, nil
+}
+
+// Paths возвращает пути хранимых копий от последней к самой старой: path, path.1, ..., path.<retention-1>.
+func Paths(path string, retention int) []string {
+	paths := []string{path}
+	for i := 1; i < retention; i++ {
+		paths = append(paths, path+"."+strconv.Itoa(i))
+	}
+	return paths
+}
+
+// Save атомарно сохраняет копию в path: копия записывается во временный файл в том же каталоге,
+// сбрасывается на диск и переименовывается. Предыдущие копии сдвигаются, так что хранится не более retention копий.
+func Save(path string, dump storage.MetricsDump, compression Compression, retention int) (Header, error) {
+	dir := filepath.Dir(path)
+	file, err := os.CreateTemp(dir, filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return Header{}, fmt.Errorf("creating temporary file failed: %w", err)
+	}
+	defer os.Remove(file.Name())
+	header, err := Encode(file, dump, compression, time.Now())
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return Header{}, fmt.Errorf("writing snapshot failed: %w", err)
+	}
+	paths := Paths(path, retention)
+	for i := len(paths) - 1; i > 0; i-- {
+		if err := os.Rename(paths[i-1], paths[i]); err != nil && !os.IsNotExist(err) {
+			return Header{}, fmt.Errorf("rotating snapshots failed: %w", err)
+		}
+	}
+	if err := os.Rename(file.Name(), path); err != nil {
+		return Header{}, fmt.Errorf("renaming snapshot failed: %w", err)
+	}
+	if err := syncDir(dir); err != nil {
+		return Header{}, err
+	}
+	return header, nil
+}
+
+// Load возвращает самую новую неповрежденную копию из хранимых и ошибки чтения более новых копий.
+// Если копий нет, возвращается nil.
+func Load(path string, retention int) (*Snapshot, []error) {
+	var errs []error
+	for _, candidate := range Paths(path, retention) {
+		snapshot, err := ReadFile(candidate)
+		if err == nil {
+			return snapshot, errs
+		}
+		if !os.IsNotExist(err) {
+			errs = append(errs, err)
+		}
+	}
+	return nil, errs
+}
+
+// OldestWALSegment возвращает наименьший номер сегмента журнала, необходимый хранимым копиям.
+// Поврежденные копии пропускаются; если нет ни одной читаемой копии, возвращается 0.
+func OldestWALSegment(path string, retention int) uint64 {
+	var oldest uint64
+	var found bool
+	for _, candidate := range Paths(path, retention) {
+		header, err := ReadHeader(candidate)
+		if err != nil {
+			continue
+		}
+		if !found || header.WALSegment < oldest {
+			oldest = header.WALSegment
+			found = true
+		}
+	}
+	return oldest
+}
+
+func (h Header) marshal() []byte {
+	data := make([]byte, 0, headerSize)
+	data = append(data, magic[:]...)
+	data = binary.LittleEndian.AppendUint16(data, h.Version)
+	data = append(data, byte(h.Compression), 0)
+	data = binary.LittleEndian.AppendUint64(data, uint64(h.CreatedAt.UnixNano()))
+	data = binary.LittleEndian.AppendUint64(data, h.WALSegment)
+	data = binary.LittleEndian.AppendUint64(data, h.Size)
+	return binary.LittleEndian.AppendUint32(data, h.Checksum)
+}
+
+func unmarshalHeader(data []byte) (Header, error) {
+	if len(data) < headerSize {
+		return Header{}, fmt.Errorf("%w: header is too short", ErrCorrupted)
+	}
+	header := Header{
+		Version:     binary.LittleEndian.Uint16(data[4:]),
+		Compression: Compression(data[6]),
+		CreatedAt:   time.Unix(0, int64(binary.LittleEndian.Uint64(data[8:]))),
+		WALSegment:  binary.LittleEndian.Uint64(data[16:]),
+		Size:        binary.LittleEndian.Uint64(data[24:]),
+		Checksum:    binary.LittleEndian.Uint32(data[32:]),
+	}
+	if header.Version > Version {
+		return header, fmt.Errorf("%w %d", ErrUnsupportedVersion, header.Version)
+	}
+	return header, nil
+}
+
+func compress(data []byte, compression Compression) ([]byte, error) {
+	var buf bytes.Buffer
+	var writer io.WriteCloser
+	switch compression {
+	case CompressionNone:
+		return data, nil
+	case CompressionGzip:
+		writer = gzip.NewWriter(&buf)
+	case CompressionZstd:
+		encoder, err := zstd.NewWriter(&buf)
+		if err != nil {
+			return nil, err
+		}
+		writer = encoder
+	default:
+		return nil, fmt.Errorf("unknown snapshot compression %s", compression)
+	}
+	if _, err := writer.Write(data); err != nil {
+		return nil, fmt.Errorf("compressing snapshot failed: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("compressing snapshot failed: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func decompress(data []byte, compression Compression) ([]byte, error) {
+	switch compression {
+	case CompressionNone:
+		return data, nil
+	case CompressionGzip:
+		reader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		return io.ReadAll(reader)
+	case CompressionZstd:
+		decoder, err := zstd.NewReader(nil)
+		if err != nil {
+			return nil, err
+		}
+		defer decoder.Close()
+		return decoder.DecodeAll(data, nil)
+	}
+	return nil, fmt.Errorf("unknown compression %s", compression)
+}
+
+// syncDir сбрасывает на диск изменения списка файлов каталога.
+func syncDir(dir string) error {
+	file, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("opening snapshot directory failed: %w", err)
+	}
+	defer file.Close()
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("syncing snapshot directory failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package snapshot
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/justEngineer/go-metrics-service/internal/storage"
+)
+
+func testDump(requests int64) storage.MetricsDump {
+	return storage.MetricsDump{
+		Counters:   []storage.CounterMetric{{Name: "requests", Labels: map[string]string{"host": "a"}, Value: requests}},
+		Gauges:     []storage.GaugeMetric{{Name: "temperature", Value: 36.6}},
+		WALSegment: uint64(requests),
+	}
+}
+
+func TestEncodeDecode(t *testing.T) {
+	createdAt := time.Unix(1700000000, 0)
+	for _, name := range []string{"none", "gzip", "zstd"} {
+		compression, err := ParseCompression(name)
+		require.NoError(t, err)
+		assert.Equal(t, name, compression.String())
+
+		var buf bytes.Buffer
+		header, err := Encode(&buf, testDump(7), compression, createdAt)
+		require.NoError(t, err)
+		decoded, dump, err := Decode(buf.Bytes())
+		require.NoError(t, err, name)
+		assert.Equal(t, header, decoded)
+		assert.Equal(t, uint16(Version), decoded.Version)
+		assert.True(t, createdAt.Equal(decoded.CreatedAt))
+		assert.Equal(t, testDump(7), dump)
+
+		data := buf.Bytes()
+		data[len(data)-1] ^= 0xff
+		_, _, err = Decode(data)
+		assert.ErrorIs(t, err, ErrCorrupted, name)
+		_, _, err = Decode(data[:len(data)-1])
+		assert.ErrorIs(t, err, ErrCorrupted, name)
+	}
+	_, err := ParseCompression("lz4")
+	assert.Error(t, err)
+
+	// файлы без заголовка, записанные предыдущими версиями сервера
+	header, dump, err := Decode([]byte(`{"counters":[{"name":"requests","value":3}],"gauges":[]}`))
+	require.NoError(t, err)
+	assert.Equal(t, uint16(0), header.Version)
+	assert.Equal(t, int64(3), dump.Counters[0].Value)
+	_, _, err = Decode([]byte(`{"counters":[`))
+	assert.ErrorIs(t, err, ErrCorrupted)
+
+	var buf bytes.Buffer
+	_, err = Encode(&buf, testDump(1), CompressionNone, createdAt)
+	require.NoError(t, err)
+	data := buf.Bytes()
+	data[4] = Version + 1
+	_, _, err = Decode(data)
+	assert.ErrorIs(t, err, ErrUnsupportedVersion)
+}
+
+func TestSaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.json")
+	snapshot, errs := Load(path, 3)
+	assert.Nil(t, snapshot)
+	assert.Empty(t, errs)
+
+	for i := int64(1); i <= 4; i++ {
+		_, err := Save(path, testDump(i), CompressionZstd, 3)
+		require.NoError(t, err)
+	}
+	entries, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	assert.Equal(t, []string{"metrics.json", "metrics.json.1", "metrics.json.2"}, names, "older snapshots are removed, no temporary files are left")
+	assert.Equal(t, uint64(2), OldestWALSegment(path, 3))
+
+	snapshot, errs = Load(path, 3)
+	require.NotNil(t, snapshot)
+	assert.Empty(t, errs)
+	assert.Equal(t, int64(4), snapshot.Dump.Counters[0].Value)
+
+	// оборванная запись последней копии
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, data[:len(data)/2], 0644))
+	snapshot, errs = Load(path, 3)
+	require.NotNil(t, snapshot)
+	assert.Len(t, errs, 1)
+	assert.Equal(t, path+".1", snapshot.Path)
+	assert.Equal(t, int64(3), snapshot.Dump.Counters[0].Value)
+
+	for _, candidate := range Paths(path, 3) {
+		require.NoError(t, os.WriteFile(candidate, []byte("garbage"), 0644))
+	}
+	snapshot, errs = Load(path, 3)
+	assert.Nil(t, snapshot)
+	assert.Len(t, errs, 3)
+}
@@ -0,0 +1,353 @@
+package statsd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/justEngineer/go-metrics-service/internal/distribution"
+	"github.com/justEngineer/go-metrics-service/internal/logger"
+	"github.com/justEngineer/go-metrics-service/internal/models"
+	"github.com/justEngineer/go-metrics-service/internal/pubsub"
+	"github.com/justEngineer/go-metrics-service/internal/storage"
+)
+
+// maxPacketSize максимальный размер датаграммы.
+const maxPacketSize = 65535
+
+// socketMode права файла Unix сокета: отправлять метрики может только владелец и его группа.
+const socketMode = 0o660
+
+// staleFlushes количество интервалов, после которого забываются последнее значение gauge
+// и остаток счетчика ряда, не получавшего значений.
+const staleFlushes = 10
+
+// Имена счетчиков, в которые приемник записывает собственную статистику.
+const (
+	packetsMetric   = "statsd_packets_received"
+	malformedMetric = "statsd_lines_malformed"
+)
+
+// Storage описывает хранилище, в которое записываются агрегированные значения.
+type Storage interface {
+	Batch(ctx context.Context, metrics []storage.Metric) error
+}
+
+// Stats содержит статистику приема пакетов.
+type Stats struct {
+	Packets   int64 // количество полученных пакетов
+	Lines     int64 // количество разобранных строк
+	Malformed int64 // количество строк, не соответствующих протоколу
+}
+
+// aggregate содержит значения, накопленные за один интервал сброса.
+type aggregate struct {
+	counters map[string]float64
+	gauges   map[string]float64
+	timers   map[string]*distribution.Sketch
+	sets     map[string]map[string]struct{}
+}
+
+// carried значение ряда, переносимое между интервалами: последнее значение gauge для относительных
+// изменений или дробный остаток счетчика.
+type carried struct {
+	value float64
+	flush uint64 // номер интервала, в котором ряд последний раз получил значение
+}
+
+func newAggregate() *aggregate {
+	return &aggregate{
+		counters: make(map[string]float64),
+		gauges:   make(map[string]float64),
+		timers:   make(map[string]*distribution.Sketch),
+		sets:     make(map[string]map[string]struct{}),
+	}
+}
+
+// Listener принимает метрики StatsD, агрегирует их в памяти и раз в интервал записывает в хранилище.
+// Счетчики суммируются с учетом частоты выборки, для gauge сохраняется последнее значение,
+// таймеры и гистограммы записываются как summary, для set - количество уникальных значений как gauge.
+type Listener struct {
+	storage   Storage
+	interval  time.Duration
+	appLogger *logger.Logger
+	hub       *pubsub.Hub
+
+	mu         sync.Mutex
+	current    *aggregate
+	flushes    uint64             // номер текущего интервала
+	gauges     map[string]carried // последние значения gauge для относительных изменений
+	remainders map[string]carried // дробные остатки счетчиков, не записанные в хранилище
+
+	packets   atomic.Int64
+	lines     atomic.Int64
+	malformed atomic.Int64
+	reported  Stats
+}
+
+// New создает приемник метрик StatsD.
+func New(storage Storage, interval time.Duration, appLogger *logger.Logger) *Listener {
+	return &Listener{
+		storage:    storage,
+		interval:   interval,
+		appLogger:  appLogger,
+		current:    newAggregate(),
+		gauges:     make(map[string]carried),
+		remainders: make(map[string]carried),
+	}
+}
+
+// SetHub задает хаб, в который публикуются записанные в хранилище значения, обычно общий с HTTP API.
+func (l *Listener) SetHub(hub *pubsub.Hub) {
+	l.hub = hub
+}
+
+// ListenUDP начинает прием пакетов на UDP адресе addr до отмены контекста.
+func (l *Listener) ListenUDP(ctx context.Context, addr string) error {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+	go l.Serve(ctx, conn)
+	return nil
+}
+
+// ListenUnix начинает прием пакетов на Unix datagram сокете path до отмены контекста.
+// Оставшийся от предыдущего запуска файл сокета удаляется, а новому задаются права socketMode.
+func (l *Listener) ListenUnix(ctx context.Context, path string) error {
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	conn, err := net.ListenPacket("unixgram", path)
+	if err != nil {
+		return err
+	}
+	if err = os.Chmod(path, socketMode); err != nil {
+		conn.Close()
+		return err
+	}
+	go func() {
+		l.Serve(ctx, conn)
+		_ = os.Remove(path)
+	}()
+	return nil
+}
+
+// Serve читает пакеты из conn, пока соединение не будет закрыто или контекст отменен.
+func (l *Listener) Serve(ctx context.Context, conn net.PacketConn) {
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() == nil && !errors.Is(err, net.ErrClosed) {
+				l.appLogger.Log.Warn("statsd read failed", zap.Error(err))
+			}
+			return
+		}
+		l.Handle(buf[:n])
+	}
+}
+
+// Handle разбирает пакет, содержащий одну или несколько строк протокола StatsD.
+func (l *Listener) Handle(packet []byte) {
+	l.packets.Add(1)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, line := range bytes.Split(packet, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		l.lines.Add(1)
+		sample, err := ParseLine(string(line))
+		if err != nil {
+			l.malformed.Add(1)
+			l.appLogger.Log.Debug("statsd line skipped", zap.Error(err))
+			continue
+		}
+		l.add(sample)
+	}
+}
+
+// add добавляет значение к текущему интервалу; вызывается под блокировкой.
+func (l *Listener) add(sample Sample) {
+	key := sample.Key()
+	agg := l.current
+	switch sample.Type {
+	case TypeCounter:
+		agg.counters[key] += sample.Value / sample.Rate
+	case TypeGauge:
+		value := sample.Value
+		if sample.Relative {
+			value += l.gauges[key].value
+		}
+		l.gauges[key] = carried{value: value, flush: l.flushes}
+		agg.gauges[key] = value
+	case TypeTimer, TypeHistogram:
+		sketch, ok := agg.timers[key]
+		if !ok {
+			sketch = distribution.NewSketch(distribution.DefaultRelativeAccuracy)
+			agg.timers[key] = sketch
+		}
+		for i := math.Max(1, math.Round(1/sample.Rate)); i > 0; i-- {
+			sketch.Add(sample.Value)
+		}
+	case TypeSet:
+		set, ok := agg.sets[key]
+		if !ok {
+			set = make(map[string]struct{})
+			agg.sets[key] = set
+		}
+		set[sample.SetValue] = struct{}{}
+	}
+}
+
+// Run записывает накопленные значения в хранилище раз в интервал,
+// а при отмене контекста выполняет последнюю запись.
+func (l *Listener) Run(ctx context.Context) {
+	ticker := time.NewTicker(l.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			if err := l.Flush(context.Background()); err != nil {
+				l.appLogger.Log.Warn("statsd flush failed", zap.Error(err))
+			}
+			return
+		case <-ticker.C:
+			if err := l.Flush(ctx); err != nil {
+				l.appLogger.Log.Warn("statsd flush failed", zap.Error(err))
+			}
+		}
+	}
+}
+
+// Flush записывает значения, накопленные с предыдущей записи, в хранилище.
+// Счетчики записываются целой частью, а дробный остаток переносится в следующий интервал.
+// Если запись не удалась, значения возвращаются в текущий интервал и будут записаны при следующем вызове.
+func (l *Listener) Flush(ctx context.Context) error {
+	l.mu.Lock()
+	agg := l.current
+	l.current = newAggregate()
+	flush := l.flushes
+	l.flushes++
+	l.prune()
+	counters := make(map[string]float64, len(agg.counters))
+	remainders := make(map[string]float64, len(agg.counters))
+	for key, value := range agg.counters {
+		total := value + l.remainders[key].value
+		counters[key] = math.Trunc(total)
+		remainders[key] = total - counters[key]
+	}
+	l.mu.Unlock()
+
+	metrics := make([]storage.Metric, 0, len(agg.gauges)+len(agg.sets)+len(agg.counters)+len(agg.timers)+2)
+	for key, value := range agg.gauges {
+		metrics = append(metrics, storage.NewGauge(key, value))
+	}
+	for key, set := range agg.sets {
+		metrics = append(metrics, storage.NewGauge(key, float64(len(set))))
+	}
+	for key, value := range counters {
+		metrics = append(metrics, storage.NewCounter(key, int64(value)))
+	}
+	for key, sketch := range agg.timers {
+		metrics = append(metrics, storage.NewSummary(key, sketch))
+	}
+	stats := l.Stats()
+	if delta := stats.Packets - l.reported.Packets; delta > 0 {
+		metrics = append(metrics, storage.NewCounter(packetsMetric, delta))
+	}
+	if delta := stats.Malformed - l.reported.Malformed; delta > 0 {
+		metrics = append(metrics, storage.NewCounter(malformedMetric, delta))
+	}
+	if len(metrics) == 0 {
+		return nil
+	}
+	if err := l.storage.Batch(ctx, metrics); err != nil {
+		l.restore(agg)
+		return err
+	}
+	l.mu.Lock()
+	for key, remainder := range remainders {
+		if remainder == 0 {
+			delete(l.remainders, key)
+			continue
+		}
+		l.remainders[key] = carried{value: remainder, flush: flush}
+	}
+	l.mu.Unlock()
+	l.reported = stats
+	if l.hub != nil && l.hub.Subscribers() > 0 {
+		accepted := make([]models.Metrics, len(metrics))
+		for i, metric := range metrics {
+			accepted[i] = metric.ToModel()
+		}
+		l.hub.PublishMetrics(accepted...)
+	}
+	return nil
+}
+
+// restore возвращает в текущий интервал значения, которые не удалось записать.
+// Значения gauge, полученные после неудачной записи, новее возвращаемых и не заменяются.
+func (l *Listener) restore(agg *aggregate) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	current := l.current
+	for key, value := range agg.counters {
+		current.counters[key] += value
+	}
+	for key, value := range agg.gauges {
+		if _, ok := current.gauges[key]; !ok {
+			current.gauges[key] = value
+		}
+	}
+	for key, sketch := range agg.timers {
+		if newer, ok := current.timers[key]; ok {
+			// скетчи приемника создаются с одинаковой точностью, поэтому слияние не завершается ошибкой
+			_ = sketch.Merge(newer)
+		}
+		current.timers[key] = sketch
+	}
+	for key, set := range agg.sets {
+		if newer, ok := current.sets[key]; ok {
+			for value := range newer {
+				set[value] = struct{}{}
+			}
+		}
+		current.sets[key] = set
+	}
+}
+
+// prune забывает последние значения gauge и остатки счетчиков рядов, не получавших значений
+// дольше staleFlushes интервалов; вызывается под блокировкой.
+func (l *Listener) prune() {
+	for _, values := range []map[string]carried{l.gauges, l.remainders} {
+		for key, value := range values {
+			if l.flushes-value.flush > staleFlushes {
+				delete(values, key)
+			}
+		}
+	}
+}
+
+// Stats возвращает статистику приема пакетов с момента запуска.
+func (l *Listener) Stats() Stats {
+	return Stats{
+		Packets:   l.packets.Load(),
+		Lines:     l.lines.Load(),
+		Malformed: l.malformed.Load(),
+	}
+}
@@ -0,0 +1,108 @@
+// Package statsd предоставляет прием метрик по протоколу StatsD через UDP и Unix datagram сокеты.
+package statsd
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/justEngineer/go-metrics-service/internal/storage"
+)
+
+// Типы метрик протокола StatsD.
+const (
+	TypeCounter   = "c"
+	TypeGauge     = "g"
+	TypeTimer     = "ms"
+	TypeHistogram = "h"
+	TypeSet       = "s"
+)
+
+// ErrMalformedLine возвращается, если строка не соответствует протоколу StatsD.
+var ErrMalformedLine = errors.New("malformed statsd line")
+
+// Sample описывает одно значение, полученное в строке вида name:value|type|@rate|#tag:value.
+type Sample struct {
+	Name     string
+	Labels   map[string]string
+	Type     string
+	Value    float64
+	SetValue string  // значение метрики типа set
+	Relative bool    // значение gauge со знаком + или - изменяет текущее значение
+	Rate     float64 // доля отправленных значений, от 0 до 1
+}
+
+// ParseLine разбирает одну строку протокола StatsD.
+// Теги в формате DogStatsD (#host:a,dc:b) становятся метками метрики.
+func ParseLine(line string) (Sample, error) {
+	name, rest, ok := strings.Cut(line, ":")
+	if !ok || name == "" {
+		return Sample{}, fmt.Errorf("%w: %q", ErrMalformedLine, line)
+	}
+	if err := storage.ValidateName(name); err != nil {
+		return Sample{}, fmt.Errorf("%w: %s", ErrMalformedLine, err)
+	}
+	parts := strings.Split(rest, "|")
+	if len(parts) < 2 {
+		return Sample{}, fmt.Errorf("%w: %q", ErrMalformedLine, line)
+	}
+	sample := Sample{Name: name, Type: parts[1], Rate: 1}
+	for _, field := range parts[2:] {
+		switch {
+		case strings.HasPrefix(field, "@"):
+			rate, err := strconv.ParseFloat(field[1:], 64)
+			if err != nil || rate <= 0 || rate > 1 {
+				return Sample{}, fmt.Errorf("%w: wrong sample rate %q", ErrMalformedLine, field)
+			}
+			sample.Rate = rate
+		case strings.HasPrefix(field, "#"):
+			labels, err := parseTags(field[1:])
+			if err != nil {
+				return Sample{}, fmt.Errorf("%w: %s", ErrMalformedLine, err)
+			}
+			sample.Labels = labels
+		default:
+			return Sample{}, fmt.Errorf("%w: unknown field %q", ErrMalformedLine, field)
+		}
+	}
+	value := parts[0]
+	switch sample.Type {
+	case TypeSet:
+		if value == "" {
+			return Sample{}, fmt.Errorf("%w: empty set value", ErrMalformedLine)
+		}
+		sample.SetValue = value
+		return sample, nil
+	case TypeGauge:
+		sample.Relative = strings.HasPrefix(value, "+") || strings.HasPrefix(value, "-")
+	case TypeCounter, TypeTimer, TypeHistogram:
+	default:
+		return Sample{}, fmt.Errorf("%w: unknown metric type %q", ErrMalformedLine, sample.Type)
+	}
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(parsed) || math.IsInf(parsed, 0) {
+		return Sample{}, fmt.Errorf("%w: wrong value %q", ErrMalformedLine, value)
+	}
+	sample.Value = parsed
+	return sample, nil
+}
+
+// Key возвращает идентификатор временного ряда значения.
+func (s Sample) Key() string {
+	return storage.SeriesKey(s.Name, s.Labels)
+}
+
+// parseTags разбирает теги вида host:a,dc:b; тег без значения получает пустое значение.
+func parseTags(value string) (map[string]string, error) {
+	labels := make(map[string]string)
+	for _, tag := range strings.Split(value, ",") {
+		label, labelValue, _ := strings.Cut(tag, ":")
+		labels[label] = labelValue
+	}
+	if err := storage.ValidateLabels(labels); err != nil {
+		return nil, err
+	}
+	return labels, nil
+}
@@ -0,0 +1,195 @@
+package statsd
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/justEngineer/go-metrics-service/internal/logger"
+	"github.com/justEngineer/go-metrics-service/internal/storage"
+)
+
+func TestParseLine(t *testing.T) {
+	testCases := []struct {
+		line     string
+		expected Sample
+	}{
+		{line: "requests:1|c", expected: Sample{Name: "requests", Type: TypeCounter, Value: 1, Rate: 1}},
+		{line: "requests:3|c|@0.1", expected: Sample{Name: "requests", Type: TypeCounter, Value: 3, Rate: 0.1}},
+		{line: "load:3.2|g", expected: Sample{Name: "load", Type: TypeGauge, Value: 3.2, Rate: 1}},
+		{line: "load:-1|g", expected: Sample{Name: "load", Type: TypeGauge, Value: -1, Relative: true, Rate: 1}},
+		{line: "latency:120|ms|#host:a,dc:eu", expected: Sample{Name: "latency", Type: TypeTimer, Value: 120, Rate: 1, Labels: map[string]string{"host": "a", "dc": "eu"}}},
+		{line: "users:alice|s", expected: Sample{Name: "users", Type: TypeSet, SetValue: "alice", Rate: 1}},
+	}
+	for _, tc := range testCases {
+		sample, err := ParseLine(tc.line)
+		require.NoError(t, err, tc.line)
+		assert.Equal(t, tc.expected, sample, tc.line)
+	}
+
+	for _, line := range []string{"requests", "requests:1", ":1|c", "requests:x|c", "requests:1|q", "requests:1|c|@2", "requests:1|c|#1host:a", "requests{host:1|c"} {
+		_, err := ParseLine(line)
+		assert.ErrorIs(t, err, ErrMalformedLine, line)
+	}
+}
+
+func TestListenerFlush(t *testing.T) {
+	appLogger, err := logger.New("error")
+	require.NoError(t, err)
+	ctx := context.Background()
+	memStorage := storage.New()
+	listener := New(memStorage, time.Second, appLogger)
+
+	listener.Handle([]byte("requests:1|c\nrequests:2|c|@0.5\nload:10|g\nload:+5|g\nbroken\n"))
+	listener.Handle([]byte("latency:100|ms|#host:a\nlatency:200|ms|#host:a\nusers:alice|s\nusers:bob|s\nusers:alice|s"))
+	require.NoError(t, listener.Flush(ctx))
+
+	counter, err := storage.GetCounter(ctx, memStorage, "requests")
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), counter)
+	gauge, err := storage.GetGauge(ctx, memStorage, "load")
+	require.NoError(t, err)
+	assert.Equal(t, 15.0, gauge)
+	users, err := storage.GetGauge(ctx, memStorage, "users")
+	require.NoError(t, err)
+	assert.Equal(t, 2.0, users)
+	latency, err := storage.GetSummary(ctx, memStorage, `latency{host="a"}`)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), latency.Count)
+	malformed, err := storage.GetCounter(ctx, memStorage, malformedMetric)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), malformed)
+	assert.Equal(t, Stats{Packets: 2, Lines: 10, Malformed: 1}, listener.Stats())
+
+	// относительное изменение gauge применяется к значению из предыдущего интервала
+	listener.Handle([]byte("load:-3|g"))
+	require.NoError(t, listener.Flush(ctx))
+	gauge, err = storage.GetGauge(ctx, memStorage, "load")
+	require.NoError(t, err)
+	assert.Equal(t, 12.0, gauge)
+	packets, err := storage.GetCounter(ctx, memStorage, packetsMetric)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), packets)
+}
+
+// failingStorage отклоняет запись, пока задан err.
+type failingStorage struct {
+	*storage.MemStorage
+	err error
+}
+
+func (s *failingStorage) Batch(ctx context.Context, metrics []storage.Metric) error {
+	if s.err != nil {
+		return s.err
+	}
+	return s.MemStorage.Batch(ctx, metrics)
+}
+
+func TestListenerFlushRetry(t *testing.T) {
+	appLogger, err := logger.New("error")
+	require.NoError(t, err)
+	ctx := context.Background()
+	backend := &failingStorage{MemStorage: storage.New(), err: errors.New("storage is unavailable")}
+	listener := New(backend, time.Second, appLogger)
+
+	// значения неудачной записи возвращаются в интервал и объединяются с новыми
+	listener.Handle([]byte("requests:1|c\nload:10|g\nlatency:100|ms\nusers:alice|s"))
+	require.Error(t, listener.Flush(ctx))
+	listener.Handle([]byte("requests:2|c\nload:20|g\nlatency:200|ms\nusers:bob|s"))
+	backend.err = nil
+	require.NoError(t, listener.Flush(ctx))
+
+	counter, err := storage.GetCounter(ctx, backend, "requests")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), counter)
+	gauge, err := storage.GetGauge(ctx, backend, "load")
+	require.NoError(t, err)
+	assert.Equal(t, 20.0, gauge, "newer gauge value wins")
+	users, err := storage.GetGauge(ctx, backend, "users")
+	require.NoError(t, err)
+	assert.Equal(t, 2.0, users)
+	latency, err := storage.GetSummary(ctx, backend, "latency")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), latency.Count)
+}
+
+func TestListenerCounterRemainder(t *testing.T) {
+	appLogger, err := logger.New("error")
+	require.NoError(t, err)
+	ctx := context.Background()
+	memStorage := storage.New()
+	listener := New(memStorage, time.Second, appLogger)
+
+	// при частоте выборки 0.4 каждое значение весит 2.5: дробная часть переносится между интервалами
+	for i := 0; i < 2; i++ {
+		listener.Handle([]byte("requests:1|c|@0.4"))
+		require.NoError(t, listener.Flush(ctx))
+	}
+	counter, err := storage.GetCounter(ctx, memStorage, "requests")
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), counter)
+	assert.Empty(t, listener.remainders)
+}
+
+func TestListenerPrune(t *testing.T) {
+	appLogger, err := logger.New("error")
+	require.NoError(t, err)
+	ctx := context.Background()
+	listener := New(storage.New(), time.Second, appLogger)
+
+	listener.Handle([]byte("load:10|g\nrequests:1|c|@0.4"))
+	require.NoError(t, listener.Flush(ctx))
+	require.Contains(t, listener.gauges, "load")
+	require.Contains(t, listener.remainders, "requests")
+	for i := 0; i <= staleFlushes; i++ {
+		require.NoError(t, listener.Flush(ctx))
+	}
+	assert.Empty(t, listener.gauges, "stale gauges are forgotten")
+	assert.Empty(t, listener.remainders, "stale remainders are forgotten")
+}
+
+func TestListenUnix(t *testing.T) {
+	appLogger, err := logger.New("error")
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	listener := New(storage.New(), time.Second, appLogger)
+
+	path := filepath.Join(t.TempDir(), "statsd.sock")
+	require.NoError(t, listener.ListenUnix(ctx, path))
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(socketMode), info.Mode().Perm())
+}
+
+func TestListenUDP(t *testing.T) {
+	appLogger, err := logger.New("error")
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	memStorage := storage.New()
+	listener := New(memStorage, time.Second, appLogger)
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go listener.Serve(ctx, conn)
+
+	client, err := net.Dial("udp", conn.LocalAddr().String())
+	require.NoError(t, err)
+	defer client.Close()
+	_, err = client.Write([]byte("requests:7|c"))
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool { return listener.Stats().Lines == 1 }, time.Second, 10*time.Millisecond)
+	require.NoError(t, listener.Flush(ctx))
+	counter, err := storage.GetCounter(ctx, memStorage, "requests")
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), counter)
+}
@@ -0,0 +1,191 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/justEngineer/go-metrics-service/internal/distribution"
+	"github.com/justEngineer/go-metrics-service/internal/models"
+)
+
+// ErrInvalidMetric возвращается для метрики без имени, с неизвестным типом или без значения этого типа.
+var ErrInvalidMetric = errors.New("invalid metric")
+
+// Getter читает метрику по типу и идентификатору временного ряда.
+type Getter interface {
+	// Get возвращает метрику со временем ее последнего изменения; для отсутствующей метрики ошибка содержит ErrMetricNotFound.
+	Get(ctx context.Context, mType string, key string) (Metric, error)
+}
+
+// Backend хранилище метрик. Сервер работает с памятью, файлом, PostgreSQL и bbolt через этот интерфейс
+// и выбирает реализацию по схеме строки подключения.
+//
+// Метрика задается типом и идентификатором временного ряда, построенным SeriesKey. Метрики разных типов
+// с одним идентификатором независимы. Все методы безопасны для одновременного вызова из нескольких горутин.
+// Метрики записываются только через Set и Batch; значения отдельных типов читаются функциями GetGauge и подобными.
+type Backend interface {
+	Getter
+	// Set сохраняет метрику: значение gauge заменяется, counter увеличивается на Delta, распределения сливаются с сохраненными.
+	Set(ctx context.Context, metric Metric) error
+	// Batch сохраняет метрики так же, как Set, атомарно: при ошибке не сохраняется ни одна из них.
+	Batch(ctx context.Context, metrics []Metric) error
+	// List возвращает страницу метрик, отобранных фильтром.
+	List(ctx context.Context, filter ListFilter) (ListResult, error)
+	// Delete удаляет метрику вместе с историей; для отсутствующей метрики ошибка содержит ErrMetricNotFound.
+	Delete(ctx context.Context, mType string, key string) error
+	// Close освобождает ресурсы хранилища.
+	Close() error
+	// Health проверяет, что хранилище готово принимать запросы.
+	Health(ctx context.Context) error
+
+	// GetAllMetrics возвращает значения всех метрик.
+	GetAllMetrics(ctx context.Context) (MetricsDump, error)
+	// GetMetricHistory возвращает значения метрики из интервала [from, to], прореженные с шагом step;
+	// для существующей метрики без значений в интервале результат пуст, для отсутствующей ошибка содержит ErrMetricNotFound.
+	GetMetricHistory(ctx context.Context, mType string, key string, from, to time.Time, step time.Duration) ([]Sample, error)
+	// ResetCounter обнуляет метрику типа counter; для отсутствующей метрики ошибка содержит ErrMetricNotFound.
+	ResetCounter(ctx context.Context, key string) error
+	// DeleteMetrics удаляет метрики, отобранные фильтром, и возвращает их количество.
+	DeleteMetrics(ctx context.Context, filter ListFilter) (int, error)
+	// Expire удаляет ряды, не обновлявшиеся дольше времени жизни из policy, и возвращает их количество.
+	Expire(ctx context.Context, policy TTLPolicy, now time.Time) (int, error)
+}
+
+// Metric описывает метрику любого типа: значение и время последнего изменения.
+// При сохранении время изменения назначает хранилище.
+type Metric struct {
+	ID        string                  `json:"id"`
+	MType     string                  `json:"type"`
+	Labels    map[string]string       `json:"labels,omitempty"`
+	Delta     *int64                  `json:"delta,omitempty"`
+	Value     *float64                `json:"value,omitempty"`
+	Histogram *distribution.Histogram `json:"histogram,omitempty"`
+	Summary   *distribution.Sketch    `json:"summary,omitempty"`
+	UpdatedAt time.Time               `json:"updated_at"`
+}
+
+// NewGauge возвращает метрику типа gauge временного ряда key.
+func NewGauge(key string, value float64) Metric {
+	name, labels := ParseSeriesKey(key)
+	return Metric{ID: name, MType: models.Gauge, Labels: labels, Value: &value}
+}
+
+// NewCounter возвращает приращение метрики типа counter временного ряда key.
+func NewCounter(key string, delta int64) Metric {
+	name, labels := ParseSeriesKey(key)
+	return Metric{ID: name, MType: models.Counter, Labels: labels, Delta: &delta}
+}
+
+// NewHistogram возвращает метрику типа histogram временного ряда key.
+func NewHistogram(key string, value *distribution.Histogram) Metric {
+	name, labels := ParseSeriesKey(key)
+	return Metric{ID: name, MType: models.Histogram, Labels: labels, Histogram: value}
+}
+
+// NewSummary возвращает метрику типа summary временного ряда key.
+func NewSummary(key string, value *distribution.Sketch) Metric {
+	name, labels := ParseSeriesKey(key)
+	return Metric{ID: name, MType: models.Summary, Labels: labels, Summary: value}
+}
+
+// FromModel преобразует метрику из формата API.
+func FromModel(m models.Metrics) Metric {
+	return Metric{ID: m.ID, MType: m.MType, Labels: m.Labels, Delta: m.Delta, Value: m.Value, Histogram: m.Histogram, Summary: m.Summary}
+}
+
+// ToModel преобразует метрику в формат API.
+func (m Metric) ToModel() models.Metrics {
+	return models.Metrics{ID: m.ID, MType: m.MType, Labels: m.Labels, Delta: m.Delta, Value: m.Value, Histogram: m.Histogram, Summary: m.Summary}
+}
+
+// GetGauge возвращает значение метрики типа gauge.
+func GetGauge(ctx context.Context, g Getter, key string) (float64, error) {
+	metric, err := g.Get(ctx, models.Gauge, key)
+	if err != nil {
+		return 0, err
+	}
+	return *metric.Value, nil
+}
+
+// GetCounter возвращает значение метрики типа counter.
+func GetCounter(ctx context.Context, g Getter, key string) (int64, error) {
+	metric, err := g.Get(ctx, models.Counter, key)
+	if err != nil {
+		return 0, err
+	}
+	return *metric.Delta, nil
+}
+
+// GetHistogram возвращает значение метрики типа histogram.
+func GetHistogram(ctx context.Context, g Getter, key string) (*distribution.Histogram, error) {
+	metric, err := g.Get(ctx, models.Histogram, key)
+	if err != nil {
+		return nil, err
+	}
+	return metric.Histogram, nil
+}
+
+// GetSummary возвращает значение метрики типа summary.
+func GetSummary(ctx context.Context, g Getter, key string) (*distribution.Sketch, error) {
+	metric, err := g.Get(ctx, models.Summary, key)
+	if err != nil {
+		return nil, err
+	}
+	return metric.Summary, nil
+}
+
+// Key возвращает идентификатор временного ряда метрики.
+func (m Metric) Key() string {
+	return SeriesKey(m.ID, m.Labels)
+}
+
+// Validate проверяет, что у метрики есть допустимое имя, известный тип и значение этого типа.
+func (m Metric) Validate() error {
+	if m.ID == "" {
+		return fmt.Errorf("%w: empty name", ErrInvalidMetric)
+	}
+	if err := ValidateName(m.ID); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidMetric, err)
+	}
+	var err error
+	switch m.MType {
+	case "gauge":
+		if m.Value == nil {
+			err = errors.New("no value")
+		}
+	case "counter":
+		if m.Delta == nil {
+			err = errors.New("no delta")
+		}
+	case "histogram":
+		if m.Histogram == nil {
+			err = errors.New("no histogram")
+		} else {
+			err = m.Histogram.Validate()
+		}
+	case "summary":
+		if m.Summary == nil {
+			err = errors.New("no summary")
+		} else {
+			err = m.Summary.Validate()
+		}
+	default:
+		err = errors.New("unknown type")
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %s %v: %s", ErrInvalidMetric, m.MType, m.ID, err)
+	}
+	return nil
+}
+
+// ValidateBatch проверяет все метрики пакета.
+func ValidateBatch(metrics []Metric) error {
+	for _, metric := range metrics {
+		if err := metric.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
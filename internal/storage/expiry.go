@@ -0,0 +1,124 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/justEngineer/go-metrics-service/internal/logger"
+)
+
+// DefaultJanitorInterval интервал удаления устаревших временных рядов по умолчанию.
+const DefaultJanitorInterval = time.Minute
+
+// ErrMetricNotFound возвращается, если запрошенная, удаляемая или сбрасываемая метрика не найдена.
+var ErrMetricNotFound = errors.New("metric is not found")
+
+// TTLRule задает время жизни временных рядов одного типа или с общим префиксом имени.
+type TTLRule struct {
+	Type   string        // тип метрики; пустая строка, если правило задано префиксом
+	Prefix string        // префикс имени метрики
+	TTL    time.Duration // время, после которого не обновлявшийся ряд удаляется
+}
+
+// TTLPolicy набор правил времени жизни временных рядов.
+// Для ряда применяется правило с самым длинным совпавшим префиксом, затем правило его типа,
+// затем правило "*" для всех рядов. Ряды, к которым не подошло ни одно правило, не удаляются.
+type TTLPolicy []TTLRule
+
+// ParseTTLPolicy разбирает правила вида gauge=24h,host_*=1h,*=168h:
+// слева от "=" указывается тип метрики или префикс имени со звездочкой в конце.
+func ParseTTLPolicy(value string) (TTLPolicy, error) {
+	var policy TTLPolicy
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		selector, ttlValue, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("metric TTL %q has no duration", item)
+		}
+		ttl, err := time.ParseDuration(strings.TrimSpace(ttlValue))
+		if err != nil || ttl <= 0 {
+			return nil, fmt.Errorf("metric TTL %q has wrong duration", item)
+		}
+		selector = strings.TrimSpace(selector)
+		var rule TTLRule
+		switch selector {
+		case "gauge", "counter", "histogram", "summary":
+			rule = TTLRule{Type: selector, TTL: ttl}
+		default:
+			prefix, ok := strings.CutSuffix(selector, "*")
+			if !ok {
+				return nil, fmt.Errorf("metric TTL selector %q is neither a metric type nor a prefix ending with '*'", selector)
+			}
+			rule = TTLRule{Prefix: prefix, TTL: ttl}
+		}
+		policy = append(policy, rule)
+	}
+	return policy, nil
+}
+
+// TTL возвращает время жизни ряда метрики типа mType с именем name; ноль означает, что ряд не удаляется.
+func (p TTLPolicy) TTL(mType, name string) time.Duration {
+	var typeTTL, defaultTTL time.Duration
+	prefixLength := -1
+	var prefixTTL time.Duration
+	for _, rule := range p {
+		switch {
+		case rule.Type != "":
+			if rule.Type == mType {
+				typeTTL = rule.TTL
+			}
+		case rule.Prefix == "":
+			defaultTTL = rule.TTL
+		case strings.HasPrefix(name, rule.Prefix) && len(rule.Prefix) > prefixLength:
+			prefixLength = len(rule.Prefix)
+			prefixTTL = rule.TTL
+		}
+	}
+	switch {
+	case prefixLength >= 0:
+		return prefixTTL
+	case typeTTL > 0:
+		return typeTTL
+	}
+	return defaultTTL
+}
+
+// Expired проверяет, истекло ли к моменту now время жизни ряда, обновленного в updatedAt.
+func (p TTLPolicy) Expired(mType, name string, updatedAt, now time.Time) bool {
+	ttl := p.TTL(mType, name)
+	return ttl > 0 && now.Sub(updatedAt) > ttl
+}
+
+// Expirer удаляет временные ряды, не обновлявшиеся дольше времени жизни.
+type Expirer interface {
+	Expire(ctx context.Context, policy TTLPolicy, now time.Time) (int, error)
+}
+
+// RunJanitor удаляет устаревшие временные ряды с интервалом interval до отмены контекста.
+func RunJanitor(ctx context.Context, backend Expirer, policy TTLPolicy, interval time.Duration, appLogger *logger.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			expired, err := backend.Expire(ctx, policy, now)
+			if err != nil {
+				appLogger.Log.Warn("Error while expiring metrics", zap.Error(err))
+				continue
+			}
+			if expired > 0 {
+				appLogger.Log.Info("Expired metrics removed", zap.Int("count", expired))
+			}
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package storage
+
+import (
+	"time"
+)
+
+const (
+	// DefaultHistoryRetention время хранения истории значений метрики по умолчанию.
+	DefaultHistoryRetention = 3 * time.Hour
+	// DefaultHistoryCapacity максимальное количество значений в истории одной метрики по умолчанию.
+	DefaultHistoryCapacity = 4096
+	// DefaultMinuteRetention время хранения минутных агрегатов истории по умолчанию.
+	DefaultMinuteRetention = 7 * 24 * time.Hour
+	// DefaultHourRetention время хранения часовых агрегатов истории по умолчанию.
+	DefaultHourRetention = 90 * 24 * time.Hour
+)
+
+// Sample описывает значение метрики в определенный момент времени.
+type Sample struct {
+	Timestamp time.Time `json:"timestamp"`
+	Value     float64   `json:"value"`
+}
+
+// series реализует кольцевой буфер значений одной метрики.
+// Буфер растет по мере добавления значений, пока не достигнет capacity.
+type series struct {
+	samples  []Sample
+	capacity int
+	start    int
+	size     int
+}
+
+func newSeries(capacity int) *series {
+	return &series{capacity: capacity}
+}
+
+// add добавляет значение в буфер, вытесняя самое старое при переполнении,
+// и удаляет значения старше retention.
+func (s *series) add(sample Sample, retention time.Duration) {
+	if s.capacity <= 0 {
+		return
+	}
+	switch {
+	case s.size < len(s.samples):
+		s.samples[(s.start+s.size)%len(s.samples)] = sample
+		s.size++
+	case len(s.samples) < s.capacity:
+		// буфер еще не заполнен: выравниваем его, чтобы дописывать значения в конец
+		if s.start != 0 {
+			s.samples = s.ordered()
+			s.start = 0
+		}
+		s.samples = append(s.samples, sample)
+		s.size = len(s.samples)
+	default:
+		s.samples[s.start] = sample
+		s.start = (s.start + 1) % len(s.samples)
+	}
+	if retention <= 0 {
+		return
+	}
+	border := sample.Timestamp.Add(-retention)
+	for s.size > 0 && s.samples[s.start].Timestamp.Before(border) {
+		s.start = (s.start + 1) % len(s.samples)
+		s.size--
+	}
+}
+
+// ordered возвращает копию значений буфера в хронологическом порядке.
+func (s *series) ordered() []Sample {
+	result := make([]Sample, 0, s.size+1)
+	for i := 0; i < s.size; i++ {
+		result = append(result, s.samples[(s.start+i)%len(s.samples)])
+	}
+	return result
+}
+
+// rangeSamples возвращает значения из интервала [from, to] в хронологическом порядке.
+func (s *series) rangeSamples(from, to time.Time) []Sample {
+	var result []Sample
+	capacity := len(s.samples)
+	for i := 0; i < s.size; i++ {
+		sample := s.samples[(s.start+i)%capacity]
+		if sample.Timestamp.Before(from) || sample.Timestamp.After(to) {
+			continue
+		}
+		result = append(result, sample)
+	}
+	return result
+}
+
+// Downsample прореживает упорядоченные по времени значения с шагом step:
+// для каждого интервала [from+i*step, from+(i+1)*step) остается последнее значение,
+// отметкой времени которого становится начало интервала.
+func Downsample(samples []Sample, from time.Time, step time.Duration) []Sample {
+	if step <= 0 || len(samples) == 0 {
+		return samples
+	}
+	var result []Sample
+	lastBucket := int64(-1)
+	for _, sample := range samples {
+		bucket := int64(sample.Timestamp.Sub(from) / step)
+		bucketSample := Sample{Timestamp: from.Add(time.Duration(bucket) * step), Value: sample.Value}
+		if bucket == lastBucket {
+			result[len(result)-1] = bucketSample
+			continue
+		}
+		result = append(result, bucketSample)
+		lastBucket = bucket
+	}
+	return result
+}
+
+func historyKey(mType, id string) string {
+	return mType + "/" + id
+}
@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/justEngineer/go-metrics-service/internal/distribution"
+)
+
+// Операции журнала изменений хранилища.
+const (
+	OpSetGauge       = "gauge"     // установка значения gauge
+	OpAddCounter     = "counter"   // увеличение counter на приращение
+	OpMergeHistogram = "histogram" // добавление значений гистограммы
+	OpMergeSummary   = "summary"   // добавление значений скетча
+	OpDelete         = "delete"    // удаление метрики типа Type
+	OpResetCounter   = "reset"     // обнуление counter
+)
+
+// JournalRecord описывает одно изменение хранилища.
+type JournalRecord struct {
+	Op        string                  // операция
+	Type      string                  // тип удаляемой метрики для OpDelete
+	Key       string                  // идентификатор временного ряда
+	Gauge     float64                 // значение для OpSetGauge
+	Counter   int64                   // приращение для OpAddCounter
+	Histogram *distribution.Histogram // значения для OpMergeHistogram
+	Summary   *distribution.Sketch    // значения для OpMergeSummary
+	Time      time.Time               // время изменения
+}
+
+// Journal сохраняет изменения хранилища до их применения, например в журнал упреждающей записи.
+// Append вызывается под блокировкой хранилища, поэтому порядок записей совпадает с порядком изменений;
+// если Append вернул ошибку, изменение не применяется.
+type Journal interface {
+	Append(records ...JournalRecord) error
+}
+
+// SetJournal задает журнал, в который записываются все последующие изменения хранилища.
+func (s *MemStorage) SetJournal(journal Journal) {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+	s.journal = journal
+}
+
+// Apply применяет изменение из журнала без повторной записи в журнал; используется при восстановлении.
+// Ошибка несовпадения корзин или точности распределения повторяет ошибку, которую получил клиент при записи.
+func (s *MemStorage) Apply(record JournalRecord) error {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+	return s.apply(record)
+}
+
+// Checkpoint атомарно относительно изменений хранилища вызывает rotate и снимает копию всех метрик.
+// Так копия содержит ровно изменения, записанные в журнал до rotate.
+func (s *MemStorage) Checkpoint(ctx context.Context, rotate func() error) (MetricsDump, error) {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+	if err := rotate(); err != nil {
+		return MetricsDump{}, err
+	}
+	return s.dump(), nil
+}
+
+// record записывает изменения в журнал, если он задан; вызывается под блокировкой.
+func (s *MemStorage) record(records ...JournalRecord) error {
+	if s.journal == nil || len(records) == 0 {
+		return nil
+	}
+	if err := s.journal.Append(records...); err != nil {
+		return fmt.Errorf("journal append failed: %w", err)
+	}
+	return nil
+}
+
+// apply применяет изменение; вызывается под блокировкой.
+func (s *MemStorage) apply(record JournalRecord) error {
+	switch record.Op {
+	case OpSetGauge:
+		s.setGauge(record.Key, record.Gauge, record.Time)
+	case OpAddCounter:
+		s.addCounter(record.Key, record.Counter, record.Time)
+	case OpResetCounter:
+		if _, ok := s.Counter[record.Key]; ok {
+			s.Counter[record.Key] = 0
+			s.addCounter(record.Key, 0, record.Time)
+		}
+	case OpMergeHistogram:
+		if err := s.mergeHistogram(record.Key, record.Histogram); err != nil {
+			return err
+		}
+		s.updated[historyKey("histogram", record.Key)] = record.Time
+	case OpMergeSummary:
+		if err := s.mergeSummary(record.Key, record.Summary); err != nil {
+			return err
+		}
+		s.updated[historyKey("summary", record.Key)] = record.Time
+	case OpDelete:
+		s.deleteMetric(record.Type, record.Key)
+	default:
+		return fmt.Errorf("unknown journal operation %q", record.Op)
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// SeriesKey возвращает идентификатор временного ряда: имя метрики и отсортированные по имени метки
+// в виде name{host="a",region="b"}. Для метрики без меток идентификатор совпадает с именем.
+func SeriesKey(name string, labels map[string]string) string {
+	if len(labels) == 0 {
+		return name
+	}
+	names := make([]string, 0, len(labels))
+	for label := range labels {
+		names = append(names, label)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	b.WriteString(name)
+	b.WriteByte('{')
+	for i, label := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(label)
+		b.WriteString(`="`)
+		b.WriteString(escapeLabelValue(labels[label]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// ParseSeriesKey разбирает идентификатор временного ряда, полученный из SeriesKey.
+// Если идентификатор не содержит меток, он целиком считается именем метрики.
+func ParseSeriesKey(key string) (string, map[string]string) {
+	start := strings.IndexByte(key, '{')
+	if start < 0 || !strings.HasSuffix(key, "}") {
+		return key, nil
+	}
+	labels, err := parseQuotedLabels(key[start+1 : len(key)-1])
+	if err != nil {
+		return key, nil
+	}
+	return key[:start], labels
+}
+
+// labelsEscaper экранирует символы, разделяющие метки в виде host=a,region=b.
+var labelsEscaper = strings.NewReplacer(`\`, `\\`, `,`, `\,`, `=`, `\=`)
+
+// labelsUnescaper восстанавливает символы, экранированные labelsEscaper.
+var labelsUnescaper = strings.NewReplacer(`\\`, `\`, `\,`, `,`, `\=`, `=`)
+
+// FormatLabels записывает метки в виде host=a,region=b, который принимает ParseLabels.
+func FormatLabels(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for label := range labels {
+		names = append(names, label)
+	}
+	sort.Strings(names)
+	pairs := make([]string, 0, len(names))
+	for _, label := range names {
+		pairs = append(pairs, label+"="+labelsEscaper.Replace(labels[label]))
+	}
+	return strings.Join(pairs, ",")
+}
+
+// ParseLabels разбирает метки, заданные в виде host=a,region=b.
+// Запятая, знак равенства и обратная косая черта в значении метки экранируются обратной косой чертой.
+func ParseLabels(value string) (map[string]string, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+	labels := make(map[string]string)
+	for _, pair := range splitLabelPairs(value) {
+		label, labelValue, ok := strings.Cut(pair, "=")
+		label = strings.TrimSpace(label)
+		if !ok {
+			return nil, fmt.Errorf("label %q has no value", label)
+		}
+		labels[label] = labelsUnescaper.Replace(strings.TrimSpace(labelValue))
+	}
+	if err := ValidateLabels(labels); err != nil {
+		return nil, err
+	}
+	return labels, nil
+}
+
+// ValidateName проверяет, что имя метрики не содержит фигурных скобок: в идентификаторе временного ряда
+// они отделяют метки, и ParseSeriesKey не смог бы отличить такое имя от имени с метками.
+func ValidateName(name string) error {
+	if strings.ContainsAny(name, "{}") {
+		return fmt.Errorf("invalid metric name: %q", name)
+	}
+	return nil
+}
+
+// ValidateLabels проверяет, что имена меток соответствуют шаблону [a-zA-Z_][a-zA-Z0-9_]*.
+func ValidateLabels(labels map[string]string) error {
+	for label := range labels {
+		if !isValidLabelName(label) {
+			return fmt.Errorf("invalid label name: %q", label)
+		}
+	}
+	return nil
+}
+
+// Key возвращает идентификатор временного ряда метрики.
+func (m GaugeMetric) Key() string {
+	return SeriesKey(m.Name, m.Labels)
+}
+
+// Key возвращает идентификатор временного ряда метрики.
+func (m CounterMetric) Key() string {
+	return SeriesKey(m.Name, m.Labels)
+}
+
+// Key возвращает идентификатор временного ряда метрики.
+func (m HistogramMetric) Key() string {
+	return SeriesKey(m.Name, m.Labels)
+}
+
+// Key возвращает идентификатор временного ряда метрики.
+func (m SummaryMetric) Key() string {
+	return SeriesKey(m.Name, m.Labels)
+}
+
+func isValidLabelName(label string) bool {
+	if label == "" {
+		return false
+	}
+	for i, r := range label {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_':
+		case r >= '0' && r <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// splitLabelPairs разделяет метки по запятым, не экранированным обратной косой чертой.
+func splitLabelPairs(value string) []string {
+	var pairs []string
+	start := 0
+	for i := 0; i < len(value); i++ {
+		switch value[i] {
+		case '\\':
+			i++
+		case ',':
+			pairs = append(pairs, value[start:i])
+			start = i + 1
+		}
+	}
+	return append(pairs, value[start:])
+}
+
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+// parseQuotedLabels разбирает метки вида host="a",region="b".
+func parseQuotedLabels(value string) (map[string]string, error) {
+	labels := make(map[string]string)
+	for len(value) > 0 {
+		label, rest, ok := strings.Cut(value, `="`)
+		if !ok || !isValidLabelName(label) {
+			return nil, fmt.Errorf("invalid label in %q", value)
+		}
+		var b strings.Builder
+		i := 0
+		for ; i < len(rest) && rest[i] != '"'; i++ {
+			if rest[i] == '\\' && i+1 < len(rest) {
+				i++
+				if rest[i] == 'n' {
+					b.WriteByte('\n')
+					continue
+				}
+			}
+			b.WriteByte(rest[i])
+		}
+		if i == len(rest) {
+			return nil, fmt.Errorf("unterminated label value in %q", value)
+		}
+		labels[label] = b.String()
+		value = strings.TrimPrefix(rest[i+1:], ",")
+	}
+	return labels, nil
+}
@@ -0,0 +1,26 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLabels(t *testing.T) {
+	labels, err := ParseLabels(" host = a , region=eu=west")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"host": "a", "region": "eu=west"}, labels)
+
+	labels = map[string]string{"path": `a,b=c\d`, "host": "a"}
+	query := FormatLabels(labels)
+	assert.Equal(t, `host=a,path=a\,b\=c\\d`, query)
+	parsed, err := ParseLabels(query)
+	require.NoError(t, err)
+	assert.Equal(t, labels, parsed)
+
+	_, err = ParseLabels("host")
+	assert.Error(t, err)
+	_, err = ParseLabels("1host=a")
+	assert.Error(t, err)
+}
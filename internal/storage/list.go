@@ -0,0 +1,179 @@
+package storage
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Поля сортировки списка метрик.
+const (
+	SortByName    = "name"
+	SortByUpdated = "updated"
+)
+
+const (
+	// DefaultListLimit количество метрик на странице списка по умолчанию.
+	DefaultListLimit = 100
+	// MaxListLimit максимальное количество метрик на странице списка.
+	MaxListLimit = 1000
+)
+
+// ErrInvalidFilter возвращается для некорректного фильтра списка метрик.
+var ErrInvalidFilter = errors.New("invalid list filter")
+
+// ListFilter задает отбор, сортировку и страницу списка метрик.
+type ListFilter struct {
+	Type    string         // тип метрики; пустая строка означает все типы
+	Prefix  string         // префикс имени метрики
+	Pattern *regexp.Regexp // регулярное выражение, которому должно соответствовать имя метрики
+	Sort    string         // SortByName или SortByUpdated
+	Desc    bool           // сортировка по убыванию
+	After   *ListCursor    // позиция последней метрики предыдущей страницы
+	Limit   int            // количество метрик на странице
+}
+
+// ListCursor позиция последней метрики страницы. Метрики упорядочены по полю сортировки,
+// затем по идентификатору временного ряда и типу, поэтому позиция однозначна.
+type ListCursor struct {
+	Sort      string    `json:"s"`
+	Desc      bool      `json:"d,omitempty"`
+	Name      string    `json:"n,omitempty"`
+	UpdatedAt time.Time `json:"u,omitempty"`
+	Key       string    `json:"k"`
+	Type      string    `json:"t"`
+}
+
+// ListResult страница списка метрик. NextCursor пуст на последней странице.
+type ListResult struct {
+	Metrics    []Metric `json:"metrics"`
+	NextCursor string   `json:"next_cursor,omitempty"`
+}
+
+// Normalize подставляет значения по умолчанию и проверяет фильтр.
+func (f *ListFilter) Normalize() error {
+	switch f.Type {
+	case "", "gauge", "counter", "histogram", "summary":
+	default:
+		return fmt.Errorf("%w: unknown metric type %q", ErrInvalidFilter, f.Type)
+	}
+	if f.Sort == "" {
+		f.Sort = SortByName
+	}
+	if f.Sort != SortByName && f.Sort != SortByUpdated {
+		return fmt.Errorf("%w: unknown sort field %q", ErrInvalidFilter, f.Sort)
+	}
+	if f.Limit == 0 {
+		f.Limit = DefaultListLimit
+	}
+	if f.Limit < 0 || f.Limit > MaxListLimit {
+		return fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidFilter, MaxListLimit)
+	}
+	if f.After != nil && (f.After.Sort != f.Sort || f.After.Desc != f.Desc) {
+		return fmt.Errorf("%w: cursor was issued for another sort order", ErrInvalidFilter)
+	}
+	return nil
+}
+
+// Match проверяет, проходит ли метрика фильтр по типу и имени.
+func (f *ListFilter) Match(name, mType string) bool {
+	if f.Type != "" && f.Type != mType {
+		return false
+	}
+	if !strings.HasPrefix(name, f.Prefix) {
+		return false
+	}
+	return f.Pattern == nil || f.Pattern.MatchString(name)
+}
+
+// Cursor возвращает позицию метрики для продолжения списка после нее.
+func (f *ListFilter) Cursor(metric Metric) ListCursor {
+	cursor := ListCursor{Sort: f.Sort, Desc: f.Desc, Key: SeriesKey(metric.ID, metric.Labels), Type: metric.MType}
+	if f.Sort == SortByName {
+		cursor.Name = metric.ID
+	} else {
+		cursor.UpdatedAt = metric.UpdatedAt
+	}
+	return cursor
+}
+
+// String кодирует позицию в непрозрачную строку для параметра cursor.
+func (c ListCursor) String() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// ParseListCursor разбирает позицию, полученную из ListCursor.String.
+func ParseListCursor(value string) (*ListCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidFilter)
+	}
+	var cursor ListCursor
+	if err = json.Unmarshal(data, &cursor); err != nil {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidFilter)
+	}
+	return &cursor, nil
+}
+
+// Paginate сортирует отобранные метрики и возвращает страницу, следующую за позицией filter.After.
+func Paginate(metrics []Metric, filter ListFilter) ListResult {
+	cursors := make([]ListCursor, len(metrics))
+	for i := range metrics {
+		cursors[i] = filter.Cursor(metrics[i])
+	}
+	sort.Sort(byCursor{metrics: metrics, cursors: cursors})
+	start := 0
+	if filter.After != nil {
+		start = sort.Search(len(cursors), func(i int) bool {
+			return compareCursors(*filter.After, cursors[i]) < 0
+		})
+	}
+	result := ListResult{Metrics: metrics[start:]}
+	if len(result.Metrics) > filter.Limit {
+		result.Metrics = result.Metrics[:filter.Limit]
+		result.NextCursor = cursors[start+filter.Limit-1].String()
+	}
+	if result.Metrics == nil {
+		result.Metrics = []Metric{}
+	}
+	return result
+}
+
+// compareCursors сравнивает позиции с учетом направления сортировки.
+func compareCursors(a, b ListCursor) int {
+	result := a.UpdatedAt.Compare(b.UpdatedAt)
+	if result == 0 {
+		result = strings.Compare(a.Name, b.Name)
+	}
+	if result == 0 {
+		result = strings.Compare(a.Key, b.Key)
+	}
+	if result == 0 {
+		result = strings.Compare(a.Type, b.Type)
+	}
+	if a.Desc {
+		return -result
+	}
+	return result
+}
+
+// byCursor сортирует метрики по их позициям.
+type byCursor struct {
+	metrics []Metric
+	cursors []ListCursor
+}
+
+func (s byCursor) Len() int { return len(s.metrics) }
+
+func (s byCursor) Less(i, j int) bool { return compareCursors(s.cursors[i], s.cursors[j]) < 0 }
+
+func (s byCursor) Swap(i, j int) {
+	s.metrics[i], s.metrics[j] = s.metrics[j], s.metrics[i]
+	s.cursors[i], s.cursors[j] = s.cursors[j], s.cursors[i]
+}
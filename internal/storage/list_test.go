@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPaginate(t *testing.T) {
+	start := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	metrics := func() []Metric {
+		return []Metric{
+			{MType: "gauge", ID: "cpu", Labels: map[string]string{"host": "b"}, UpdatedAt: start.Add(3 * time.Second)},
+			{MType: "counter", ID: "cpu", UpdatedAt: start.Add(time.Second)},
+			{MType: "gauge", ID: "alloc", UpdatedAt: start.Add(2 * time.Second)},
+			{MType: "gauge", ID: "cpu", UpdatedAt: start},
+		}
+	}
+	names := func(result ListResult) []string {
+		var names []string
+		for _, metric := range result.Metrics {
+			names = append(names, metric.MType+":"+SeriesKey(metric.ID, metric.Labels))
+		}
+		return names
+	}
+
+	filter := ListFilter{Limit: 2}
+	require.NoError(t, filter.Normalize())
+	page := Paginate(metrics(), filter)
+	assert.Equal(t, []string{"gauge:alloc", "counter:cpu"}, names(page), "same series key is ordered by type")
+	require.NotEmpty(t, page.NextCursor)
+
+	after, err := ParseListCursor(page.NextCursor)
+	require.NoError(t, err)
+	filter.After = after
+	page = Paginate(metrics(), filter)
+	assert.Equal(t, []string{"gauge:cpu", `gauge:cpu{host="b"}`}, names(page))
+	assert.Empty(t, page.NextCursor, "last page has no cursor")
+
+	filter = ListFilter{Sort: SortByUpdated, Desc: true, Limit: 3}
+	require.NoError(t, filter.Normalize())
+	page = Paginate(metrics(), filter)
+	assert.Equal(t, []string{`gauge:cpu{host="b"}`, "gauge:alloc", "counter:cpu"}, names(page))
+	after, err = ParseListCursor(page.NextCursor)
+	require.NoError(t, err)
+	filter.After = after
+	page = Paginate(metrics(), filter)
+	assert.Equal(t, []string{"gauge:cpu"}, names(page))
+
+	page = Paginate(nil, filter)
+	assert.NotNil(t, page.Metrics, "empty page is encoded as []")
+	assert.Empty(t, page.Metrics)
+}
+
+func TestListFilter(t *testing.T) {
+	filter := ListFilter{Type: "gauge", Prefix: "host_", Pattern: regexp.MustCompile(`_\d+$`)}
+	require.NoError(t, filter.Normalize())
+	assert.Equal(t, SortByName, filter.Sort)
+	assert.Equal(t, DefaultListLimit, filter.Limit)
+	assert.True(t, filter.Match("host_1", "gauge"))
+	assert.False(t, filter.Match("host_1", "counter"))
+	assert.False(t, filter.Match("disk_1", "gauge"))
+	assert.False(t, filter.Match("host_a", "gauge"))
+
+	for _, invalid := range []ListFilter{
+		{Type: "timer"},
+		{Sort: "value"},
+		{Limit: MaxListLimit + 1},
+		{Sort: SortByUpdated, After: &ListCursor{Sort: SortByName}},
+	} {
+		assert.ErrorIs(t, invalid.Normalize(), ErrInvalidFilter)
+	}
+	_, err := ParseListCursor("not a cursor")
+	assert.ErrorIs(t, err, ErrInvalidFilter)
+}
@@ -0,0 +1,158 @@
+// Package registry открывает хранилище метрик по схеме строки подключения из конфигурации сервера.
+//
+//	""                      файл FileStorePath, если он задан, иначе память
+//	memory://               память без сохранения на диск
+//	file:///path/to/file    память с копией и журналом изменений в файле
+//	postgres://...          PostgreSQL; строка вида "host=... user=..." без схемы тоже относится к нему
+//	bolt:///path/to/file    встроенная база bbolt
+//
+// Реестр вынесен из пакета storage, так как хранилищам нужна конфигурация сервера, которая сама зависит от storage.
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+
+	"github.com/justEngineer/go-metrics-service/internal/boltstorage"
+	"github.com/justEngineer/go-metrics-service/internal/database"
+	"github.com/justEngineer/go-metrics-service/internal/filestorage"
+	config "github.com/justEngineer/go-metrics-service/internal/http/server/config"
+	logger "github.com/justEngineer/go-metrics-service/internal/logger"
+	"github.com/justEngineer/go-metrics-service/internal/storage"
+)
+
+// Схемы строки подключения встроенных хранилищ.
+const (
+	SchemeMemory   = "memory"
+	SchemeFile     = "file"
+	SchemePostgres = "postgres"
+)
+
+// ErrUnknownScheme возвращается для строки подключения, схема которой не зарегистрирована.
+var ErrUnknownScheme = errors.New("unknown storage scheme")
+
+// Opener открывает хранилище; строка подключения передается в cfg.DatabaseDSN.
+// Хранилище работает, пока не отменен ctx, и освобождает ресурсы при вызове Close.
+type Opener func(ctx context.Context, cfg *config.ServerConfig, log *logger.Logger) (storage.Backend, error)
+
+var (
+	mu      sync.RWMutex
+	openers = map[string]Opener{
+		SchemeMemory:       openMemory,
+		SchemeFile:         openFile,
+		SchemePostgres:     openPostgres,
+		"postgresql":       openPostgres,
+		boltstorage.Scheme: openBolt,
+	}
+)
+
+// Register добавляет хранилище со схемой scheme. Повторная регистрация схемы вызывает панику.
+func Register(scheme string, open Opener) {
+	mu.Lock()
+	defer mu.Unlock()
+	if open == nil {
+		panic("registry: Register opener is nil")
+	}
+	if _, ok := openers[scheme]; ok {
+		panic("registry: Register called twice for scheme " + scheme)
+	}
+	openers[scheme] = open
+}
+
+// Schemes возвращает отсортированный список зарегистрированных схем.
+func Schemes() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	schemes := make([]string, 0, len(openers))
+	for scheme := range openers {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+// Scheme возвращает схему хранилища, которое выбирает конфигурация cfg.
+func Scheme(cfg *config.ServerConfig) string {
+	dsn := cfg.DatabaseDSN
+	if dsn == "" {
+		if cfg.FileStorePath != "" {
+			return SchemeFile
+		}
+		return SchemeMemory
+	}
+	scheme, _, found := strings.Cut(dsn, "://")
+	if !found {
+		return SchemePostgres
+	}
+	return scheme
+}
+
+// HistoryEnabled сообщает, ведет ли хранилище, которое выбирает cfg, историю значений метрик.
+// PostgreSQL хранит историю всегда, остальные встроенные хранилища не ведут ее при HistoryCapacity <= 0.
+func HistoryEnabled(cfg *config.ServerConfig) bool {
+	switch Scheme(cfg) {
+	case SchemePostgres, "postgresql":
+		return true
+	}
+	return cfg.HistoryCapacity > 0
+}
+
+// Open открывает хранилище, выбранное строкой подключения cfg.DatabaseDSN.
+func Open(ctx context.Context, cfg *config.ServerConfig, log *logger.Logger) (storage.Backend, error) {
+	scheme := Scheme(cfg)
+	mu.RLock()
+	open, ok := openers[scheme]
+	mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w %q, expected one of %s", ErrUnknownScheme, scheme, strings.Join(Schemes(), ", "))
+	}
+	return open(ctx, cfg, log)
+}
+
+func openMemory(ctx context.Context, cfg *config.ServerConfig, log *logger.Logger) (storage.Backend, error) {
+	return storage.NewWithHistory(cfg.HistoryRetention, cfg.HistoryCapacity), nil
+}
+
+// openFile открывает файловое хранилище; путь из строки подключения file:// заменяет FileStorePath.
+func openFile(ctx context.Context, cfg *config.ServerConfig, log *logger.Logger) (storage.Backend, error) {
+	if cfg.DatabaseDSN != "" {
+		fileCfg := *cfg
+		fileCfg.FileStorePath = strings.TrimPrefix(cfg.DatabaseDSN, SchemeFile+"://")
+		cfg = &fileCfg
+	}
+	if cfg.FileStorePath == "" {
+		return nil, errors.New("file storage DSN has no file path")
+	}
+	fileStorage, err := filestorage.New(storage.NewWithHistory(cfg.HistoryRetention, cfg.HistoryCapacity), cfg, ctx, log)
+	if err != nil {
+		return nil, err
+	}
+	return fileStorage, nil
+}
+
+// openPostgres подключается к PostgreSQL. Ошибка применения миграций, например недоступность базы
+// при запуске, не мешает запуску сервера: хранилище сообщает о ней через Health.
+func openPostgres(ctx context.Context, cfg *config.ServerConfig, log *logger.Logger) (storage.Backend, error) {
+	db, err := database.NewConnection(ctx, cfg)
+	if db.Connections == nil {
+		return nil, err
+	}
+	if err != nil {
+		log.Log.Error("database connection failed", zap.Error(err))
+	}
+	return db, nil
+}
+
+func openBolt(ctx context.Context, cfg *config.ServerConfig, log *logger.Logger) (storage.Backend, error) {
+	s, err := boltstorage.Open(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
@@ -0,0 +1,81 @@
+package registry
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/justEngineer/go-metrics-service/internal/boltstorage"
+	"github.com/justEngineer/go-metrics-service/internal/filestorage"
+	config "github.com/justEngineer/go-metrics-service/internal/http/server/config"
+	logger "github.com/justEngineer/go-metrics-service/internal/logger"
+	"github.com/justEngineer/go-metrics-service/internal/storage"
+)
+
+func TestScheme(t *testing.T) {
+	tests := []struct {
+		cfg  config.ServerConfig
+		want string
+	}{
+		{config.ServerConfig{}, SchemeMemory},
+		{config.ServerConfig{FileStorePath: "/tmp/metrics.json"}, SchemeFile},
+		{config.ServerConfig{DatabaseDSN: "memory://", FileStorePath: "/tmp/metrics.json"}, SchemeMemory},
+		{config.ServerConfig{DatabaseDSN: "postgresql://localhost/metrics"}, "postgresql"},
+		{config.ServerConfig{DatabaseDSN: "host=localhost user=metrics"}, SchemePostgres},
+		{config.ServerConfig{DatabaseDSN: "bolt:///var/lib/metrics.db"}, boltstorage.Scheme},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, Scheme(&tt.cfg), tt.cfg.DatabaseDSN)
+	}
+}
+
+func TestHistoryEnabled(t *testing.T) {
+	assert.True(t, HistoryEnabled(&config.ServerConfig{HistoryCapacity: storage.DefaultHistoryCapacity}))
+	assert.False(t, HistoryEnabled(&config.ServerConfig{}))
+	assert.False(t, HistoryEnabled(&config.ServerConfig{DatabaseDSN: "bolt:///var/lib/metrics.db"}))
+	assert.True(t, HistoryEnabled(&config.ServerConfig{DatabaseDSN: "postgres://localhost/metrics"}), "PostgreSQL ignores the capacity")
+}
+
+func TestOpen(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	appLogger, err := logger.New("error")
+	require.NoError(t, err)
+	dir := t.TempDir()
+
+	tests := []struct {
+		cfg  config.ServerConfig
+		want storage.Backend
+	}{
+		{config.ServerConfig{DatabaseDSN: "memory://"}, &storage.MemStorage{}},
+		{config.ServerConfig{DatabaseDSN: "file://" + filepath.Join(dir, "metrics.json"), StoreInterval: 300}, &filestorage.FileStorage{}},
+		{config.ServerConfig{FileStorePath: filepath.Join(dir, "default.json"), StoreInterval: 300}, &filestorage.FileStorage{}},
+		{config.ServerConfig{DatabaseDSN: "bolt://" + filepath.Join(dir, "metrics.db")}, &boltstorage.BoltStorage{}},
+	}
+	for _, tt := range tests {
+		backend, err := Open(ctx, &tt.cfg, appLogger)
+		require.NoError(t, err, tt.cfg.DatabaseDSN)
+		assert.IsType(t, tt.want, backend, tt.cfg.DatabaseDSN)
+		require.NoError(t, backend.Health(ctx))
+		require.NoError(t, backend.Close())
+	}
+
+	_, err = Open(ctx, &config.ServerConfig{DatabaseDSN: "redis://localhost"}, appLogger)
+	assert.ErrorIs(t, err, ErrUnknownScheme)
+	_, err = Open(ctx, &config.ServerConfig{DatabaseDSN: "bolt://"}, appLogger)
+	assert.Error(t, err)
+}
+
+func TestRegister(t *testing.T) {
+	Register("test", func(ctx context.Context, cfg *config.ServerConfig, log *logger.Logger) (storage.Backend, error) {
+		return storage.New(), nil
+	})
+	assert.Contains(t, Schemes(), "test")
+	backend, err := Open(context.Background(), &config.ServerConfig{DatabaseDSN: "test://"}, nil)
+	require.NoError(t, err)
+	assert.IsType(t, &storage.MemStorage{}, backend)
+	assert.Panics(t, func() { Register(SchemeMemory, openMemory) })
+}
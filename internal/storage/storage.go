@@ -4,95 +4,462 @@ import (
 	"context"
 	"fmt"
 	"sync"
+	"time"
+
+	"github.com/justEngineer/go-metrics-service/internal/distribution"
 )
 
 type GaugeMetric struct {
-	Name  string  `json:"name"`
-	Value float64 `json:"value"`
+	Name   string            `json:"name"`
+	Labels map[string]string `json:"labels,omitempty"`
+	Value  float64           `json:"value"`
 }
 
 type CounterMetric struct {
-	Name  string `json:"name"`
-	Value int64  `json:"value"`
+	Name   string            `json:"name"`
+	Labels map[string]string `json:"labels,omitempty"`
+	Value  int64             `json:"value"`
+}
+
+type HistogramMetric struct {
+	Name   string                  `json:"name"`
+	Labels map[string]string       `json:"labels,omitempty"`
+	Value  *distribution.Histogram `json:"value"`
+}
+
+type SummaryMetric struct {
+	Name   string               `json:"name"`
+	Labels map[string]string    `json:"labels,omitempty"`
+	Value  *distribution.Sketch `json:"value"`
 }
 
 type MetricsDump struct {
-	Counters []CounterMetric `json:"counters"`
-	Gauges   []GaugeMetric   `json:"gauges"`
+	Counters   []CounterMetric   `json:"counters"`
+	Gauges     []GaugeMetric     `json:"gauges"`
+	Histograms []HistogramMetric `json:"histograms,omitempty"`
+	Summaries  []SummaryMetric   `json:"summaries,omitempty"`
+	// WALSegment номер первого сегмента журнала упреждающей записи, изменения из которого не вошли в копию.
+	WALSegment uint64 `json:"wal_segment,omitempty"`
 }
 
+// MemStorage хранит метрики в памяти. Ключами Gauge и Counter служат идентификаторы
+// временных рядов, построенные SeriesKey из имени метрики и ее меток.
 type MemStorage struct {
 	// указаны некоторые поля структуры
-	Gauge   map[string]float64
-	Counter map[string]int64
-	Mutex   sync.RWMutex
+	Gauge     map[string]float64
+	Counter   map[string]int64
+	Histogram map[string]*distribution.Histogram
+	Summary   map[string]*distribution.Sketch
+	Mutex     sync.RWMutex
+
+	journal          Journal
+	updated          map[string]time.Time
+	history          map[string]*series
+	historyRetention time.Duration
+	historyCapacity  int
 }
 
 func New() *MemStorage {
+	return NewWithHistory(DefaultHistoryRetention, DefaultHistoryCapacity)
+}
+
+// NewWithHistory создает хранилище, которое помнит не более capacity значений каждой метрики
+// за последние retention.
+func NewWithHistory(retention time.Duration, capacity int) *MemStorage {
 	MetricStorage := &MemStorage{}
 	MetricStorage.Gauge = make(map[string]float64)
 	MetricStorage.Counter = make(map[string]int64)
+	MetricStorage.Histogram = make(map[string]*distribution.Histogram)
+	MetricStorage.Summary = make(map[string]*distribution.Sketch)
+	MetricStorage.updated = make(map[string]time.Time)
+	MetricStorage.history = make(map[string]*series)
+	MetricStorage.historyRetention = retention
+	MetricStorage.historyCapacity = capacity
 	return MetricStorage
 }
 
-// GetGaugeMetric извлекает все метрики из хранилища.
-func (s *MemStorage) GetAllMetrics() MetricsDump {
+// GetAllMetrics извлекает все метрики из хранилища.
+func (s *MemStorage) GetAllMetrics(ctx context.Context) (MetricsDump, error) {
+	s.Mutex.RLock()
+	defer s.Mutex.RUnlock()
+	return s.dump(), nil
+}
+
+// dump копирует все метрики хранилища; вызывается под блокировкой.
+func (s *MemStorage) dump() MetricsDump {
 	var gauges []GaugeMetric
 	var counters []CounterMetric
-	s.Mutex.RLock()
+	var histograms []HistogramMetric
+	var summaries []SummaryMetric
 	for key, value := range s.Gauge {
-		gauges = append(gauges, GaugeMetric{Name: key, Value: value})
+		name, labels := ParseSeriesKey(key)
+		gauges = append(gauges, GaugeMetric{Name: name, Labels: labels, Value: value})
 	}
 	for key, value := range s.Counter {
-		counters = append(counters, CounterMetric{Name: key, Value: value})
+		name, labels := ParseSeriesKey(key)
+		counters = append(counters, CounterMetric{Name: name, Labels: labels, Value: value})
+	}
+	for key, value := range s.Histogram {
+		name, labels := ParseSeriesKey(key)
+		histograms = append(histograms, HistogramMetric{Name: name, Labels: labels, Value: value.Clone()})
+	}
+	for key, value := range s.Summary {
+		name, labels := ParseSeriesKey(key)
+		summaries = append(summaries, SummaryMetric{Name: name, Labels: labels, Value: value.Clone()})
 	}
-	s.Mutex.RUnlock()
 	return MetricsDump{
-		Counters: counters,
-		Gauges:   gauges,
+		Counters:   counters,
+		Gauges:     gauges,
+		Histograms: histograms,
+		Summaries:  summaries,
 	}
 }
 
-// GetGaugeMetric извлекает метрику типа gauge из хранилища.
-func (s *MemStorage) GetGaugeMetric(ctx context.Context, id string) (float64, error) {
-	val, ok := s.Gauge[id]
-	if !ok {
-		return 0.0, fmt.Errorf("gauge metric is not found, id: %v", id)
-	} else {
-		return val, nil
+// Get возвращает копию метрики типа mType со временем ее последнего изменения.
+func (s *MemStorage) Get(ctx context.Context, mType string, id string) (Metric, error) {
+	s.Mutex.RLock()
+	defer s.Mutex.RUnlock()
+	if !s.exists(mType, id) {
+		return Metric{}, fmt.Errorf("%w: %s %v", ErrMetricNotFound, mType, id)
 	}
+	name, labels := ParseSeriesKey(id)
+	metric := Metric{ID: name, MType: mType, Labels: labels, UpdatedAt: s.updated[historyKey(mType, id)]}
+	switch mType {
+	case "gauge":
+		value := s.Gauge[id]
+		metric.Value = &value
+	case "counter":
+		value := s.Counter[id]
+		metric.Delta = &value
+	case "histogram":
+		metric.Histogram = s.Histogram[id].Clone()
+	case "summary":
+		metric.Summary = s.Summary[id].Clone()
+	}
+	return metric, nil
+}
+
+// Set сохраняет метрику любого типа.
+func (s *MemStorage) Set(ctx context.Context, metric Metric) error {
+	return s.Batch(ctx, []Metric{metric})
+}
+
+// Batch сохраняет метрики под одной блокировкой хранилища. Распределения предварительно сливаются
+// с копиями сохраненных, поэтому несовместимое распределение отклоняет пакет до записи в журнал.
+func (s *MemStorage) Batch(ctx context.Context, metrics []Metric) error {
+	if err := ValidateBatch(metrics); err != nil {
+		return err
+	}
+	now := time.Now()
+	records := make([]JournalRecord, 0, len(metrics))
+	for _, metric := range metrics {
+		records = append(records, journalRecord(metric, now))
+	}
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+	if err := s.checkMerges(records); err != nil {
+		return err
+	}
+	return s.commit(records...)
+}
+
+// Close ничего не делает: хранилище в памяти не занимает внешних ресурсов.
+func (s *MemStorage) Close() error {
+	return nil
 }
 
-// GetCounterMetric извлекает метрику типа counter из хранилища.
-func (s *MemStorage) GetCounterMetric(ctx context.Context, id string) (int64, error) {
-	val, ok := s.Counter[id]
+// Health всегда сообщает о готовности хранилища в памяти.
+func (s *MemStorage) Health(ctx context.Context) error {
+	return nil
+}
+
+// GetMetricHistory возвращает значения метрики из интервала [from, to], прореженные с шагом step.
+func (s *MemStorage) GetMetricHistory(ctx context.Context, mType string, id string, from, to time.Time, step time.Duration) ([]Sample, error) {
+	s.Mutex.RLock()
+	defer s.Mutex.RUnlock()
+	history, ok := s.history[historyKey(mType, id)]
 	if !ok {
-		return 0.0, fmt.Errorf("counter metric is not found, id: %v", id)
-	} else {
-		return val, nil
+		if !s.exists(mType, id) {
+			return nil, fmt.Errorf("%w: %s %v", ErrMetricNotFound, mType, id)
+		}
+		return nil, nil
+	}
+	return Downsample(history.rangeSamples(from, to), from, step), nil
+}
+
+// Delete удаляет метрику типа mType вместе с ее историей.
+func (s *MemStorage) Delete(ctx context.Context, mType string, id string) error {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+	if !s.exists(mType, id) {
+		return fmt.Errorf("%w: %s %v", ErrMetricNotFound, mType, id)
+	}
+	return s.commit(JournalRecord{Op: OpDelete, Type: mType, Key: id, Time: time.Now()})
+}
+
+// ResetCounter обнуляет метрику типа counter и добавляет нулевое значение в историю.
+func (s *MemStorage) ResetCounter(ctx context.Context, id string) error {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+	if _, ok := s.Counter[id]; !ok {
+		return fmt.Errorf("%w: counter %v", ErrMetricNotFound, id)
+	}
+	return s.commit(JournalRecord{Op: OpResetCounter, Key: id, Time: time.Now()})
+}
+
+// DeleteMetrics удаляет метрики, отобранные по типу и имени фильтром, и возвращает их количество.
+func (s *MemStorage) DeleteMetrics(ctx context.Context, filter ListFilter) (int, error) {
+	if err := filter.Normalize(); err != nil {
+		return 0, err
+	}
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+	return s.deleteMatching(func(mType, key string) bool {
+		name, _ := ParseSeriesKey(key)
+		return filter.Match(name, mType)
+	})
+}
+
+// Expire удаляет ряды, не обновлявшиеся дольше времени жизни из policy.
+// Рядам без времени изменения, например восстановленным из файла, оно назначается при первой проверке.
+func (s *MemStorage) Expire(ctx context.Context, policy TTLPolicy, now time.Time) (int, error) {
+	if len(policy) == 0 {
+		return 0, nil
+	}
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+	return s.deleteMatching(func(mType, key string) bool {
+		updatedAt, ok := s.updated[historyKey(mType, key)]
+		if !ok {
+			s.updated[historyKey(mType, key)] = now
+			return false
+		}
+		name, _ := ParseSeriesKey(key)
+		return policy.Expired(mType, name, updatedAt, now)
+	})
+}
+
+// List возвращает страницу метрик, отобранных фильтром, со временем их последнего изменения.
+// Для метрик, восстановленных из файла и с тех пор не изменявшихся, время не известно и остается нулевым.
+func (s *MemStorage) List(ctx context.Context, filter ListFilter) (ListResult, error) {
+	if err := filter.Normalize(); err != nil {
+		return ListResult{}, err
+	}
+	var metrics []Metric
+	add := func(mType, key string, fill func(metric *Metric)) {
+		name, labels := ParseSeriesKey(key)
+		if !filter.Match(name, mType) {
+			return
+		}
+		metric := Metric{ID: name, MType: mType, Labels: labels, UpdatedAt: s.updated[historyKey(mType, key)]}
+		fill(&metric)
+		metrics = append(metrics, metric)
+	}
+	s.Mutex.RLock()
+	for key, value := range s.Gauge {
+		value := value
+		add("gauge", key, func(metric *Metric) { metric.Value = &value })
+	}
+	for key, value := range s.Counter {
+		value := value
+		add("counter", key, func(metric *Metric) { metric.Delta = &value })
 	}
+	for key, value := range s.Histogram {
+		add("histogram", key, func(metric *Metric) { metric.Histogram = value.Clone() })
+	}
+	for key, value := range s.Summary {
+		add("summary", key, func(metric *Metric) { metric.Summary = value.Clone() })
+	}
+	s.Mutex.RUnlock()
+	return Paginate(metrics, filter), nil
 }
 
-func (s *MemStorage) SetGaugeMetric(ctx context.Context, id string, value float64) error {
+func (s *MemStorage) setGauge(id string, value float64, ts time.Time) {
 	s.Gauge[id] = value
-	return nil
+	s.updated[historyKey("gauge", id)] = ts
+	s.appendHistory("gauge", id, value, ts)
 }
 
-func (s *MemStorage) SetCounterMetric(ctx context.Context, id string, value int64) error {
+func (s *MemStorage) addCounter(id string, value int64, ts time.Time) {
 	s.Counter[id] += value
-	return nil
+	s.updated[historyKey("counter", id)] = ts
+	s.appendHistory("counter", id, float64(s.Counter[id]), ts)
 }
 
-func (s *MemStorage) SetMetricsBatch(ctx context.Context, gaugesBatch []GaugeMetric, countersBatch []CounterMetric) error {
-	for _, gaugeMetric := range gaugesBatch {
-		if err := s.SetGaugeMetric(ctx, gaugeMetric.Name, gaugeMetric.Value); err != nil {
+// commit записывает изменения в журнал и применяет их; вызывается под блокировкой.
+func (s *MemStorage) commit(records ...JournalRecord) error {
+	if err := s.record(records...); err != nil {
+		return err
+	}
+	for _, record := range records {
+		if err := s.apply(record); err != nil {
 			return err
 		}
 	}
-	for _, counterMetric := range countersBatch {
-		if err := s.SetCounterMetric(ctx, counterMetric.Name, counterMetric.Value); err != nil {
-			return err
+	return nil
+}
+
+// checkMerges проверяет, что распределения из records сливаются с сохраненными и между собой; вызывается под блокировкой.
+func (s *MemStorage) checkMerges(records []JournalRecord) error {
+	histograms := make(map[string]*distribution.Histogram)
+	summaries := make(map[string]*distribution.Sketch)
+	for _, record := range records {
+		switch record.Op {
+		case OpMergeHistogram:
+			merged, ok := histograms[record.Key]
+			if !ok {
+				stored, found := s.Histogram[record.Key]
+				if !found {
+					histograms[record.Key] = record.Histogram.Clone()
+					continue
+				}
+				merged = stored.Clone()
+				histograms[record.Key] = merged
+			}
+			if err := merged.Merge(record.Histogram); err != nil {
+				return fmt.Errorf("histogram metric %v: %w", record.Key, err)
+			}
+		case OpMergeSummary:
+			merged, ok := summaries[record.Key]
+			if !ok {
+				stored, found := s.Summary[record.Key]
+				if !found {
+					summaries[record.Key] = record.Summary.Clone()
+					continue
+				}
+				merged = stored.Clone()
+				summaries[record.Key] = merged
+			}
+			if err := merged.Merge(record.Summary); err != nil {
+				return fmt.Errorf("summary metric %v: %w", record.Key, err)
+			}
+		}
+	}
+	return nil
+}
+
+// journalRecord возвращает изменение хранилища, которое вносит сохранение проверенной метрики.
+func journalRecord(metric Metric, ts time.Time) JournalRecord {
+	record := JournalRecord{Key: metric.Key(), Time: ts}
+	switch metric.MType {
+	case "gauge":
+		record.Op, record.Gauge = OpSetGauge, *metric.Value
+	case "counter":
+		record.Op, record.Counter = OpAddCounter, *metric.Delta
+	case "histogram":
+		record.Op, record.Histogram = OpMergeHistogram, metric.Histogram
+	case "summary":
+		record.Op, record.Summary = OpMergeSummary, metric.Summary
+	}
+	return record
+}
+
+// deleteMatching удаляет метрики, для которых match возвращает true; вызывается под блокировкой.
+func (s *MemStorage) deleteMatching(match func(mType, id string) bool) (int, error) {
+	var records []JournalRecord
+	now := time.Now()
+	for _, mType := range []string{"gauge", "counter", "histogram", "summary"} {
+		for _, id := range s.keys(mType) {
+			if match(mType, id) {
+				records = append(records, JournalRecord{Op: OpDelete, Type: mType, Key: id, Time: now})
+			}
+		}
+	}
+	if err := s.commit(records...); err != nil {
+		return 0, err
+	}
+	return len(records), nil
+}
+
+// exists проверяет наличие метрики типа mType; вызывается под блокировкой.
+func (s *MemStorage) exists(mType, id string) bool {
+	var ok bool
+	switch mType {
+	case "gauge":
+		_, ok = s.Gauge[id]
+	case "counter":
+		_, ok = s.Counter[id]
+	case "histogram":
+		_, ok = s.Histogram[id]
+	case "summary":
+		_, ok = s.Summary[id]
+	}
+	return ok
+}
+
+// keys возвращает идентификаторы метрик типа mType; вызывается под блокировкой.
+func (s *MemStorage) keys(mType string) []string {
+	var keys []string
+	switch mType {
+	case "gauge":
+		for id := range s.Gauge {
+			keys = append(keys, id)
+		}
+	case "counter":
+		for id := range s.Counter {
+			keys = append(keys, id)
+		}
+	case "histogram":
+		for id := range s.Histogram {
+			keys = append(keys, id)
+		}
+	case "summary":
+		for id := range s.Summary {
+			keys = append(keys, id)
 		}
 	}
+	return keys
+}
+
+// deleteMetric удаляет метрику и ее историю; вызывается под блокировкой.
+func (s *MemStorage) deleteMetric(mType, id string) {
+	switch mType {
+	case "gauge":
+		delete(s.Gauge, id)
+	case "counter":
+		delete(s.Counter, id)
+	case "histogram":
+		delete(s.Histogram, id)
+	case "summary":
+		delete(s.Summary, id)
+	}
+	delete(s.updated, historyKey(mType, id))
+	delete(s.history, historyKey(mType, id))
+}
+
+func (s *MemStorage) mergeHistogram(id string, value *distribution.Histogram) error {
+	stored, ok := s.Histogram[id]
+	if !ok {
+		s.Histogram[id] = value.Clone()
+		return nil
+	}
+	if err := stored.Merge(value); err != nil {
+		return fmt.Errorf("histogram metric %v: %w", id, err)
+	}
 	return nil
 }
+
+func (s *MemStorage) mergeSummary(id string, value *distribution.Sketch) error {
+	stored, ok := s.Summary[id]
+	if !ok {
+		s.Summary[id] = value.Clone()
+		return nil
+	}
+	if err := stored.Merge(value); err != nil {
+		return fmt.Errorf("summary metric %v: %w", id, err)
+	}
+	return nil
+}
+
+func (s *MemStorage) appendHistory(mType, id string, value float64, ts time.Time) {
+	if s.historyCapacity <= 0 {
+		return
+	}
+	key := historyKey(mType, id)
+	history, ok := s.history[key]
+	if !ok {
+		history = newSeries(s.historyCapacity)
+		s.history[key] = history
+	}
+	history.add(Sample{Timestamp: ts, Value: value}, s.historyRetention)
+}
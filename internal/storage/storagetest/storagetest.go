@@ -0,0 +1,425 @@
+// Package storagetest содержит общий набор тестов, проверяющий, что реализации storage.Backend ведут себя одинаково.
+// Тесты хранилища вызывают Run, передавая функцию, создающую пустое хранилище для каждого теста.
+// Подтест Concurrency рассчитан на запуск с детектором гонок: go test -race.
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/justEngineer/go-metrics-service/internal/distribution"
+	"github.com/justEngineer/go-metrics-service/internal/storage"
+)
+
+// Run проверяет хранилище; newStorage вызывается в каждом подтесте и должен возвращать пустое хранилище.
+func Run(t *testing.T, newStorage func(t *testing.T) storage.Backend) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, s storage.Backend)
+	}{
+		{"GaugeCounter", testGaugeCounter},
+		{"GetSet", testGetSet},
+		{"NotFound", testNotFound},
+		{"Batch", testBatch},
+		{"BatchAtomicity", testBatchAtomicity},
+		{"Concurrency", testConcurrency},
+		{"Distributions", testDistributions},
+		{"List", testList},
+		{"Delete", testDelete},
+		{"Expire", testExpire},
+		{"History", testHistory},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newStorage(t))
+		})
+	}
+}
+
+func testGaugeCounter(t *testing.T, s storage.Backend) {
+	ctx := context.Background()
+	_, err := storage.GetGauge(ctx, s, "temperature")
+	assert.Error(t, err)
+	_, err = storage.GetCounter(ctx, s, "requests")
+	assert.Error(t, err)
+
+	require.NoError(t, s.Set(ctx, storage.NewGauge("temperature", 36.6)))
+	require.NoError(t, s.Set(ctx, storage.NewGauge("temperature", -1.5)))
+	require.NoError(t, s.Set(ctx, storage.NewCounter("requests", 5)))
+	require.NoError(t, s.Set(ctx, storage.NewCounter("requests", 7)))
+	gauge, err := storage.GetGauge(ctx, s, "temperature")
+	require.NoError(t, err)
+	assert.Equal(t, -1.5, gauge, "gauge keeps the last value")
+	counter, err := storage.GetCounter(ctx, s, "requests")
+	require.NoError(t, err)
+	assert.Equal(t, int64(12), counter, "counter accumulates increments")
+
+	_, err = storage.GetCounter(ctx, s, "temperature")
+	assert.Error(t, err, "metric types do not share names")
+}
+
+func testGetSet(t *testing.T, s storage.Backend) {
+	ctx := context.Background()
+	require.NoError(t, s.Health(ctx))
+	hostA := map[string]string{"host": "a"}
+	gauge, delta := 36.6, int64(5)
+	histogram := distribution.NewHistogram([]float64{0.1, 1})
+	histogram.Observe(0.5)
+	sketch := distribution.NewSketch(distribution.DefaultRelativeAccuracy)
+	sketch.Add(2)
+
+	before := time.Now().Add(-time.Second)
+	require.NoError(t, s.Set(ctx, storage.Metric{ID: "temperature", MType: "gauge", Labels: hostA, Value: &gauge}))
+	require.NoError(t, s.Set(ctx, storage.Metric{ID: "requests", MType: "counter", Delta: &delta}))
+	require.NoError(t, s.Set(ctx, storage.Metric{ID: "requests", MType: "counter", Delta: &delta}))
+	require.NoError(t, s.Set(ctx, storage.Metric{ID: "latency", MType: "histogram", Histogram: histogram}))
+	require.NoError(t, s.Set(ctx, storage.Metric{ID: "size", MType: "summary", Summary: sketch}))
+
+	metric, err := s.Get(ctx, "gauge", storage.SeriesKey("temperature", hostA))
+	require.NoError(t, err)
+	assert.Equal(t, "temperature", metric.ID)
+	assert.Equal(t, "gauge", metric.MType)
+	assert.Equal(t, hostA, metric.Labels)
+	require.NotNil(t, metric.Value)
+	assert.Equal(t, gauge, *metric.Value)
+	assert.True(t, metric.UpdatedAt.After(before), "the update time is set by the storage")
+
+	metric, err = s.Get(ctx, "counter", "requests")
+	require.NoError(t, err)
+	assert.Nil(t, metric.Labels)
+	require.NotNil(t, metric.Delta)
+	assert.Equal(t, int64(10), *metric.Delta)
+	value, err := storage.GetCounter(ctx, s, "requests")
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), value, "typed and generic methods share the data")
+
+	metric, err = s.Get(ctx, "histogram", "latency")
+	require.NoError(t, err)
+	require.NotNil(t, metric.Histogram)
+	assert.Equal(t, uint64(1), metric.Histogram.Count)
+	metric, err = s.Get(ctx, "summary", "size")
+	require.NoError(t, err)
+	require.NotNil(t, metric.Summary)
+	assert.Equal(t, 2.0, metric.Summary.Sum)
+
+	for _, invalid := range []storage.Metric{
+		{MType: "gauge", Value: &gauge},
+		{ID: "temperature", MType: "gauge"},
+		{ID: "requests", MType: "counter", Value: &gauge},
+		{ID: "latency", MType: "histogram"},
+		{ID: "temperature", MType: "unknown", Value: &gauge},
+		{ID: "temperature{room", MType: "gauge", Value: &gauge},
+	} {
+		assert.ErrorIs(t, s.Set(ctx, invalid), storage.ErrInvalidMetric, invalid)
+	}
+}
+
+func testNotFound(t *testing.T, s storage.Backend) {
+	ctx := context.Background()
+	require.NoError(t, s.Set(ctx, storage.NewGauge("temperature", 1)))
+	for _, mType := range []string{"gauge", "counter", "histogram", "summary", "unknown"} {
+		_, err := s.Get(ctx, mType, "missing")
+		assert.ErrorIs(t, err, storage.ErrMetricNotFound, mType)
+		assert.ErrorIs(t, s.Delete(ctx, mType, "missing"), storage.ErrMetricNotFound, mType)
+	}
+	_, err := s.Get(ctx, "counter", "temperature")
+	assert.ErrorIs(t, err, storage.ErrMetricNotFound, "metric types do not share names")
+	_, err = storage.GetSummary(ctx, s, "temperature")
+	assert.Error(t, err)
+	assert.ErrorIs(t, s.ResetCounter(ctx, "temperature"), storage.ErrMetricNotFound)
+
+	require.NoError(t, s.Delete(ctx, "gauge", "temperature"))
+	_, err = s.Get(ctx, "gauge", "temperature")
+	assert.ErrorIs(t, err, storage.ErrMetricNotFound)
+	assert.ErrorIs(t, s.Delete(ctx, "gauge", "temperature"), storage.ErrMetricNotFound)
+}
+
+func testBatch(t *testing.T, s storage.Backend) {
+	ctx := context.Background()
+	hostA := map[string]string{"host": "a"}
+	require.NoError(t, s.Set(ctx, storage.NewCounter(storage.SeriesKey("requests", hostA), 1)))
+	require.NoError(t, s.Batch(ctx, []storage.Metric{
+		storage.NewGauge(storage.SeriesKey("temperature", hostA), 1),
+		storage.NewGauge("temperature", 2),
+		storage.NewCounter(storage.SeriesKey("requests", hostA), 2),
+		storage.NewCounter(storage.SeriesKey("requests", hostA), 3),
+	}))
+
+	gauge, err := storage.GetGauge(ctx, s, storage.SeriesKey("temperature", hostA))
+	require.NoError(t, err)
+	assert.Equal(t, 1.0, gauge)
+	counter, err := storage.GetCounter(ctx, s, storage.SeriesKey("requests", hostA))
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), counter)
+
+	dump, err := s.GetAllMetrics(ctx)
+	require.NoError(t, err)
+	sort.Slice(dump.Gauges, func(i, j int) bool { return dump.Gauges[i].Key() < dump.Gauges[j].Key() })
+	assert.Equal(t, []storage.GaugeMetric{{Name: "temperature", Value: 2}, {Name: "temperature", Labels: hostA, Value: 1}}, dump.Gauges)
+	assert.Equal(t, []storage.CounterMetric{{Name: "requests", Labels: hostA, Value: 6}}, dump.Counters)
+	assert.Empty(t, dump.Histograms)
+	assert.Empty(t, dump.Summaries)
+}
+
+func testBatchAtomicity(t *testing.T, s storage.Backend) {
+	ctx := context.Background()
+	histogram := distribution.NewHistogram([]float64{0.1, 1})
+	histogram.Observe(0.5)
+	require.NoError(t, s.Set(ctx, storage.NewHistogram("latency", histogram)))
+	require.NoError(t, s.Set(ctx, storage.NewCounter("requests", 1)))
+
+	gauge, delta := 1.0, int64(5)
+	err := s.Batch(ctx, []storage.Metric{
+		{ID: "temperature", MType: "gauge", Value: &gauge},
+		{ID: "requests", MType: "counter", Delta: &delta},
+		{ID: "latency", MType: "histogram", Histogram: histogram},
+		{ID: "latency", MType: "histogram", Histogram: distribution.NewHistogram([]float64{5})},
+	})
+	require.Error(t, err, "bounds mismatch fails the batch")
+	_, err = s.Get(ctx, "gauge", "temperature")
+	assert.ErrorIs(t, err, storage.ErrMetricNotFound, "a failed batch stores nothing")
+	counter, err := storage.GetCounter(ctx, s, "requests")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), counter)
+	stored, err := storage.GetHistogram(ctx, s, "latency")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), stored.Count)
+
+	err = s.Batch(ctx, []storage.Metric{
+		{ID: "temperature", MType: "gauge", Value: &gauge},
+		{ID: "requests", MType: "counter"},
+	})
+	assert.ErrorIs(t, err, storage.ErrInvalidMetric)
+	_, err = s.Get(ctx, "gauge", "temperature")
+	assert.ErrorIs(t, err, storage.ErrMetricNotFound, "an invalid batch stores nothing")
+
+	require.NoError(t, s.Batch(ctx, nil))
+	require.NoError(t, s.Batch(ctx, []storage.Metric{
+		{ID: "temperature", MType: "gauge", Value: &gauge},
+		{ID: "requests", MType: "counter", Delta: &delta},
+		{ID: "requests", MType: "counter", Delta: &delta},
+		{ID: "latency", MType: "histogram", Histogram: histogram},
+		{ID: "latency", MType: "histogram", Histogram: histogram},
+	}))
+	counter, err = storage.GetCounter(ctx, s, "requests")
+	require.NoError(t, err)
+	assert.Equal(t, int64(11), counter)
+	stored, err = storage.GetHistogram(ctx, s, "latency")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3), stored.Count)
+}
+
+// testConcurrency одновременно изменяет и читает хранилище из нескольких горутин.
+// Счетчик должен учесть каждое увеличение, а детектор гонок — не найти несинхронизированных обращений.
+func testConcurrency(t *testing.T, s storage.Backend) {
+	ctx := context.Background()
+	const writers, updates = 4, 25
+	var wg sync.WaitGroup
+	// каждая итерация писателя отправляет три результата, читателя — два
+	errs := make(chan error, writers*updates*5)
+	for w := 0; w < writers; w++ {
+		w := w
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < updates; i++ {
+				gauge, delta := float64(i), int64(1)
+				errs <- s.Set(ctx, storage.NewCounter("requests", 1))
+				errs <- s.Set(ctx, storage.Metric{ID: "requests", MType: "counter", Delta: &delta})
+				errs <- s.Batch(ctx, []storage.Metric{
+					{ID: "requests", MType: "counter", Delta: &delta},
+					{ID: "load", MType: "gauge", Labels: map[string]string{"writer": strconv.Itoa(w)}, Value: &gauge},
+				})
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for i := 0; i < updates; i++ {
+				// пока метрики не записаны, чтение может вернуть ErrMetricNotFound
+				_, _ = s.Get(ctx, "counter", "requests")
+				_, err := s.List(ctx, storage.ListFilter{})
+				errs <- err
+				_, err = s.GetAllMetrics(ctx)
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	counter, err := storage.GetCounter(ctx, s, "requests")
+	require.NoError(t, err)
+	assert.Equal(t, int64(writers*updates*3), counter, "no increment is lost")
+	result, err := s.List(ctx, storage.ListFilter{Type: "gauge"})
+	require.NoError(t, err)
+	assert.Len(t, result.Metrics, writers)
+}
+
+func testDistributions(t *testing.T, s storage.Backend) {
+	ctx := context.Background()
+	_, err := storage.GetHistogram(ctx, s, "latency")
+	assert.Error(t, err)
+
+	histogram := distribution.NewHistogram([]float64{0.1, 1})
+	histogram.Observe(0.05)
+	require.NoError(t, s.Set(ctx, storage.NewHistogram("latency", histogram)))
+	require.NoError(t, s.Set(ctx, storage.NewHistogram("latency", histogram)))
+	assert.Error(t, s.Set(ctx, storage.NewHistogram("latency", distribution.NewHistogram([]float64{5}))), "bounds mismatch")
+	stored, err := storage.GetHistogram(ctx, s, "latency")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), stored.Count)
+	assert.Equal(t, []uint64{2, 0, 0}, stored.Counts)
+	stored.Observe(10)
+	stored, err = storage.GetHistogram(ctx, s, "latency")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), stored.Count, "a copy is returned")
+
+	sketch := distribution.NewSketch(distribution.DefaultRelativeAccuracy)
+	for _, value := range []float64{1, 2, 3} {
+		sketch.Add(value)
+	}
+	require.NoError(t, s.Set(ctx, storage.NewSummary("size", sketch)))
+	require.NoError(t, s.Set(ctx, storage.NewSummary("size", sketch)))
+	summary, err := storage.GetSummary(ctx, s, "size")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(6), summary.Count)
+	assert.Equal(t, 12.0, summary.Sum)
+
+	dump, err := s.GetAllMetrics(ctx)
+	require.NoError(t, err)
+	require.Len(t, dump.Histograms, 1)
+	assert.Equal(t, "latency", dump.Histograms[0].Name)
+	require.Len(t, dump.Summaries, 1)
+	assert.Equal(t, uint64(6), dump.Summaries[0].Value.Count)
+}
+
+func testList(t *testing.T, s storage.Backend) {
+	ctx := context.Background()
+	for _, name := range []string{"cpu_user", "cpu_system", "mem_free", "cpu_idle"} {
+		require.NoError(t, s.Set(ctx, storage.NewGauge(name, 1)))
+	}
+	require.NoError(t, s.Set(ctx, storage.NewCounter("cpu_ticks", 3)))
+
+	result, err := s.List(ctx, storage.ListFilter{Prefix: "cpu_", Limit: 2})
+	require.NoError(t, err)
+	var names []string
+	for page := 0; ; page++ {
+		require.Less(t, page, 10)
+		for _, metric := range result.Metrics {
+			assert.False(t, metric.UpdatedAt.IsZero(), metric.ID)
+			names = append(names, metric.MType+":"+metric.ID)
+		}
+		if result.NextCursor == "" {
+			break
+		}
+		after, err := storage.ParseListCursor(result.NextCursor)
+		require.NoError(t, err)
+		result, err = s.List(ctx, storage.ListFilter{Prefix: "cpu_", Limit: 2, After: after})
+		require.NoError(t, err)
+	}
+	assert.Equal(t, []string{"gauge:cpu_idle", "gauge:cpu_system", "counter:cpu_ticks", "gauge:cpu_user"}, names)
+
+	result, err = s.List(ctx, storage.ListFilter{Type: "counter"})
+	require.NoError(t, err)
+	require.Len(t, result.Metrics, 1)
+	assert.Equal(t, int64(3), *result.Metrics[0].Delta)
+	assert.Empty(t, result.NextCursor)
+
+	result, err = s.List(ctx, storage.ListFilter{Prefix: "disk_"})
+	require.NoError(t, err)
+	assert.NotNil(t, result.Metrics)
+	assert.Empty(t, result.Metrics)
+}
+
+func testDelete(t *testing.T, s storage.Backend) {
+	ctx := context.Background()
+	require.NoError(t, s.Set(ctx, storage.NewGauge("temperature", 1)))
+	require.NoError(t, s.Set(ctx, storage.NewCounter("requests", 5)))
+	require.NoError(t, s.Set(ctx, storage.NewCounter("host_requests", 1)))
+	require.NoError(t, s.Set(ctx, storage.NewGauge("host_load", 1)))
+
+	assert.True(t, errors.Is(s.Delete(ctx, "counter", "temperature"), storage.ErrMetricNotFound))
+	require.NoError(t, s.Delete(ctx, "gauge", "temperature"))
+	_, err := storage.GetGauge(ctx, s, "temperature")
+	assert.Error(t, err)
+	_, err = s.GetMetricHistory(ctx, "gauge", "temperature", time.Time{}, time.Now().Add(time.Hour), 0)
+	assert.ErrorIs(t, err, storage.ErrMetricNotFound, "history is deleted with the metric")
+
+	assert.True(t, errors.Is(s.ResetCounter(ctx, "missing"), storage.ErrMetricNotFound))
+	require.NoError(t, s.ResetCounter(ctx, "requests"))
+	counter, err := storage.GetCounter(ctx, s, "requests")
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), counter)
+	require.NoError(t, s.Set(ctx, storage.NewCounter("requests", 2)))
+	counter, err = storage.GetCounter(ctx, s, "requests")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), counter)
+
+	deleted, err := s.DeleteMetrics(ctx, storage.ListFilter{Prefix: "host_"})
+	require.NoError(t, err)
+	assert.Equal(t, 2, deleted)
+	deleted, err = s.DeleteMetrics(ctx, storage.ListFilter{Prefix: "host_"})
+	require.NoError(t, err)
+	assert.Equal(t, 0, deleted)
+	dump, err := s.GetAllMetrics(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, dump.Gauges)
+	assert.Equal(t, []storage.CounterMetric{{Name: "requests", Value: 2}}, dump.Counters)
+}
+
+func testExpire(t *testing.T, s storage.Backend) {
+	ctx := context.Background()
+	require.NoError(t, s.Set(ctx, storage.NewGauge("temperature", 1)))
+	require.NoError(t, s.Set(ctx, storage.NewCounter("requests", 1)))
+	policy, err := storage.ParseTTLPolicy("gauge=1h,*=24h")
+	require.NoError(t, err)
+
+	expired, err := s.Expire(ctx, nil, time.Now().Add(48*time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 0, expired, "an empty policy keeps everything")
+	expired, err = s.Expire(ctx, policy, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, 0, expired)
+	expired, err = s.Expire(ctx, policy, time.Now().Add(2*time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 1, expired)
+	_, err = storage.GetGauge(ctx, s, "temperature")
+	assert.Error(t, err)
+	expired, err = s.Expire(ctx, policy, time.Now().Add(48*time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 1, expired)
+}
+
+func testHistory(t *testing.T, s storage.Backend) {
+	ctx := context.Background()
+	from := time.Now().Add(-time.Minute)
+	for _, delta := range []int64{1, 2, 3} {
+		require.NoError(t, s.Set(ctx, storage.NewCounter("requests", delta)))
+	}
+	samples, err := s.GetMetricHistory(ctx, "counter", "requests", from, time.Now().Add(time.Minute), 0)
+	require.NoError(t, err)
+	var values []float64
+	for _, sample := range samples {
+		values = append(values, sample.Value)
+	}
+	assert.Equal(t, []float64{1, 3, 6}, values, "counter history holds accumulated values")
+
+	samples, err = s.GetMetricHistory(ctx, "counter", "requests", from.Add(-time.Hour), from, 0)
+	require.NoError(t, err, "an existing metric has an empty history outside of its samples")
+	assert.Empty(t, samples)
+
+	_, err = s.GetMetricHistory(ctx, "gauge", "requests", from, time.Now(), 0)
+	assert.ErrorIs(t, err, storage.ErrMetricNotFound)
+}
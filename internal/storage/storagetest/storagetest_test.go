@@ -0,0 +1,13 @@
+package storagetest
+
+import (
+	"testing"
+
+	"github.com/justEngineer/go-metrics-service/internal/storage"
+)
+
+func TestMemStorage(t *testing.T) {
+	Run(t, func(t *testing.T) storage.Backend {
+		return storage.New()
+	})
+}
@@ -0,0 +1,151 @@
+package wal
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/justEngineer/go-metrics-service/internal/distribution"
+	"github.com/justEngineer/go-metrics-service/internal/storage"
+)
+
+var byteOrder = binary.LittleEndian
+
+var errShortRecord = errors.New("record is too short")
+
+// encodeRecord дописывает запись в buf. Значение gauge хранится побитно, поэтому NaN и бесконечности
+// сохраняются без потерь; распределения записываются в JSON.
+func encodeRecord(buf []byte, record storage.JournalRecord) ([]byte, error) {
+	buf = appendString(buf, record.Op)
+	buf = appendString(buf, record.Type)
+	buf = appendString(buf, record.Key)
+	var timestamp int64
+	if !record.Time.IsZero() {
+		timestamp = record.Time.UnixNano()
+	}
+	buf = binary.AppendVarint(buf, timestamp)
+	buf = byteOrder.AppendUint64(buf, math.Float64bits(record.Gauge))
+	buf = binary.AppendVarint(buf, record.Counter)
+	var value any
+	switch {
+	case record.Histogram != nil:
+		value = record.Histogram
+	case record.Summary != nil:
+		value = record.Summary
+	}
+	var payload []byte
+	if value != nil {
+		var err error
+		payload, err = json.Marshal(value)
+		if err != nil {
+			return buf, fmt.Errorf("encoding %s %v failed: %w", record.Op, record.Key, err)
+		}
+	}
+	return appendString(buf, string(payload)), nil
+}
+
+// decodeRecord разбирает запись, записанную encodeRecord.
+func decodeRecord(data []byte) (storage.JournalRecord, error) {
+	var record storage.JournalRecord
+	decoder := recordDecoder{data: data}
+	record.Op = decoder.string()
+	record.Type = decoder.string()
+	record.Key = decoder.string()
+	if timestamp := decoder.varint(); timestamp != 0 {
+		record.Time = time.Unix(0, timestamp)
+	}
+	record.Gauge = math.Float64frombits(decoder.uint64())
+	record.Counter = decoder.varint()
+	payload := decoder.string()
+	if decoder.err != nil {
+		return record, decoder.err
+	}
+	if len(decoder.data) > 0 {
+		return record, fmt.Errorf("%d unexpected bytes after record", len(decoder.data))
+	}
+	if payload == "" {
+		return record, nil
+	}
+	switch record.Op {
+	case storage.OpMergeHistogram:
+		record.Histogram = &distribution.Histogram{}
+		if err := json.Unmarshal([]byte(payload), record.Histogram); err != nil {
+			return record, err
+		}
+	case storage.OpMergeSummary:
+		record.Summary = &distribution.Sketch{}
+		if err := json.Unmarshal([]byte(payload), record.Summary); err != nil {
+			return record, err
+		}
+	default:
+		return record, fmt.Errorf("unexpected payload for %s", record.Op)
+	}
+	return record, nil
+}
+
+func appendString(buf []byte, value string) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(value)))
+	return append(buf, value...)
+}
+
+// recordDecoder читает поля записи, запоминая первую ошибку.
+type recordDecoder struct {
+	data []byte
+	err  error
+}
+
+func (d *recordDecoder) string() string {
+	length := d.uvarint()
+	if d.err != nil {
+		return ""
+	}
+	if uint64(len(d.data)) < length {
+		d.err = errShortRecord
+		return ""
+	}
+	value := string(d.data[:length])
+	d.data = d.data[length:]
+	return value
+}
+
+func (d *recordDecoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	value, n := binary.Uvarint(d.data)
+	if n <= 0 {
+		d.err = errShortRecord
+		return 0
+	}
+	d.data = d.data[n:]
+	return value
+}
+
+func (d *recordDecoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	value, n := binary.Varint(d.data)
+	if n <= 0 {
+		d.err = errShortRecord
+		return 0
+	}
+	d.data = d.data[n:]
+	return value
+}
+
+func (d *recordDecoder) uint64() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	if len(d.data) < 8 {
+		d.err = errShortRecord
+		return 0
+	}
+	value := byteOrder.Uint64(d.data)
+	d.data = d.data[8:]
+	return value
+}
@@ -0,0 +1,470 @@
+// Package wal реализует журнал упреждающей записи для хранилища метрик в памяти.
+// Журнал состоит из сегментов — файлов с номерами по возрастанию, в которые только дописываются записи.
+// Каждая запись обрамлена длиной и контрольной суммой CRC-32C, поэтому оборванная при сбое запись
+// в конце последнего сегмента обнаруживается и отбрасывается при открытии журнала.
+package wal
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/justEngineer/go-metrics-service/internal/storage"
+)
+
+// SyncPolicy определяет, когда записи журнала сбрасываются на диск вызовом fsync.
+// При любой политике запись передается операционной системе до того, как изменение будет подтверждено,
+// поэтому подтвержденные изменения переживают аварийное завершение процесса; политика определяет,
+// сколько изменений может быть потеряно при отключении питания.
+type SyncPolicy string
+
+const (
+	SyncAlways   SyncPolicy = "always"   // fsync после каждой записи до подтверждения изменения
+	SyncBatch    SyncPolicy = "batched"  // fsync после BatchSize записей и не реже SyncInterval
+	SyncInterval SyncPolicy = "interval" // fsync раз в SyncInterval
+)
+
+const (
+	DefaultSyncInterval = time.Second // интервал fsync по умолчанию
+	DefaultBatchSize    = 128         // количество записей между fsync по умолчанию для SyncBatch
+	DefaultSegmentSize  = 64 << 20    // размер сегмента, после которого начинается новый
+
+	segmentExt     = ".wal"
+	headerSize     = 8
+	maxRecordSize  = 64 << 20
+	segmentPerm    = 0644
+	directoryPerm  = 0755
+	segmentNameLen = 20
+)
+
+var (
+	// ErrCorrupted возвращается, если запись в середине журнала повреждена.
+	ErrCorrupted = errors.New("wal: corrupted segment")
+	// ErrClosed возвращается при записи в закрытый журнал.
+	ErrClosed = errors.New("wal: log is closed")
+
+	crcTable = crc32.MakeTable(crc32.Castagnoli)
+)
+
+// syncBatchAlias прежнее название политики SyncBatch, которое по-прежнему принимается.
+const syncBatchAlias = "batch"
+
+// ParseSyncPolicy разбирает название политики fsync; вместо batched допускается batch.
+func ParseSyncPolicy(value string) (SyncPolicy, error) {
+	switch policy := SyncPolicy(value); policy {
+	case SyncAlways, SyncBatch, SyncInterval:
+		return policy, nil
+	case syncBatchAlias:
+		return SyncBatch, nil
+	}
+	return "", fmt.Errorf("unknown WAL sync policy %q, expected always, batched or interval", value)
+}
+
+// Options параметры журнала; нулевые значения заменяются значениями по умолчанию.
+type Options struct {
+	Sync         SyncPolicy    // политика fsync, по умолчанию SyncBatch
+	SyncInterval time.Duration // интервал fsync для SyncBatch и SyncInterval
+	BatchSize    int           // количество записей между fsync для SyncBatch
+	SegmentSize  int64         // размер сегмента в байтах
+	// FirstSegment минимальный номер нового сегмента. Позволяет не использовать повторно номера сегментов,
+	// на которые ссылается сохраненная копия хранилища, если каталог журнала был очищен.
+	FirstSegment uint64
+}
+
+// Log журнал упреждающей записи. Реализует storage.Journal.
+type Log struct {
+	dir     string
+	options Options
+
+	mu       sync.Mutex
+	file     *os.File
+	segment  uint64
+	size     int64
+	unsynced int
+	err      error
+	closed   bool
+	buf      []byte
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// Open открывает журнал в каталоге dir, создавая каталог при необходимости.
+// Оборванная запись в конце последнего сегмента отбрасывается, и новые записи пишутся в новый сегмент.
+func Open(dir string, options Options) (*Log, error) {
+	if options.Sync == "" {
+		options.Sync = SyncBatch
+	}
+	policy, err := ParseSyncPolicy(string(options.Sync))
+	if err != nil {
+		return nil, err
+	}
+	options.Sync = policy
+	if options.SyncInterval <= 0 {
+		options.SyncInterval = DefaultSyncInterval
+	}
+	if options.BatchSize <= 0 {
+		options.BatchSize = DefaultBatchSize
+	}
+	if options.SegmentSize <= 0 {
+		options.SegmentSize = DefaultSegmentSize
+	}
+	if err := os.MkdirAll(dir, directoryPerm); err != nil {
+		return nil, fmt.Errorf("creating WAL directory failed: %w", err)
+	}
+	segments, err := listSegments(dir)
+	if err != nil {
+		return nil, err
+	}
+	next := options.FirstSegment
+	if len(segments) > 0 {
+		last := segments[len(segments)-1]
+		if err := repairSegment(segmentPath(dir, last)); err != nil {
+			return nil, err
+		}
+		next = max(next, last+1)
+	}
+	l := &Log{dir: dir, options: options, segment: max(next, 1), done: make(chan struct{})}
+	if err := l.openSegment(); err != nil {
+		return nil, err
+	}
+	if options.Sync != SyncAlways {
+		l.wg.Add(1)
+		go l.syncLoop()
+	}
+	return l, nil
+}
+
+// Segment возвращает номер сегмента, в который пишутся новые записи.
+func (l *Log) Segment() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.segment
+}
+
+// Append дописывает записи в журнал и сбрасывает их на диск согласно политике fsync.
+// После ошибки записи или fsync журнал перестает принимать записи: их порядок на диске больше не гарантирован.
+func (l *Log) Append(records ...storage.JournalRecord) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return ErrClosed
+	}
+	if l.err != nil {
+		return l.err
+	}
+	l.buf = l.buf[:0]
+	for _, record := range records {
+		start := len(l.buf)
+		l.buf = append(l.buf, make([]byte, headerSize)...)
+		var err error
+		l.buf, err = encodeRecord(l.buf, record)
+		if err != nil {
+			return err
+		}
+		putHeader(l.buf[start:], l.buf[start+headerSize:])
+	}
+	if l.size > 0 && l.size+int64(len(l.buf)) > l.options.SegmentSize {
+		if err := l.rotate(); err != nil {
+			l.err = err
+			return err
+		}
+	}
+	n, err := l.file.Write(l.buf)
+	l.size += int64(n)
+	if err != nil {
+		l.err = fmt.Errorf("writing WAL segment failed: %w", err)
+		return l.err
+	}
+	l.unsynced += len(records)
+	if l.options.Sync == SyncAlways || (l.options.Sync == SyncBatch && l.unsynced >= l.options.BatchSize) {
+		return l.sync()
+	}
+	return nil
+}
+
+// Rotate начинает новый сегмент и возвращает его номер. Все записи, добавленные до вызова,
+// находятся в сегментах с меньшими номерами.
+func (l *Log) Rotate() (uint64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return 0, ErrClosed
+	}
+	if l.err != nil {
+		return 0, l.err
+	}
+	if err := l.rotate(); err != nil {
+		l.err = err
+		return 0, err
+	}
+	return l.segment, nil
+}
+
+// Truncate удаляет сегменты с номерами меньше before, например вошедшие в сохраненную копию хранилища.
+func (l *Log) Truncate(before uint64) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	before = min(before, l.segment)
+	segments, err := listSegments(l.dir)
+	if err != nil {
+		return err
+	}
+	for _, segment := range segments {
+		if segment >= before {
+			break
+		}
+		if err := os.Remove(segmentPath(l.dir, segment)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("removing WAL segment failed: %w", err)
+		}
+	}
+	return syncDir(l.dir)
+}
+
+// Replay передает apply записи из сегментов с номерами не меньше from в порядке их добавления
+// и возвращает количество записей. Ошибка apply прерывает чтение. Поврежденная запись прерывает чтение
+// только своего сегмента: остальные сегменты воспроизводятся, а повреждения возвращаются ошибкой ErrCorrupted.
+func (l *Log) Replay(from uint64, apply func(storage.JournalRecord) error) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	segments, err := listSegments(l.dir)
+	if err != nil {
+		return 0, err
+	}
+	var total int
+	var corrupted []error
+	for _, segment := range segments {
+		if segment < from {
+			continue
+		}
+		n, _, err := readSegment(segmentPath(l.dir, segment), apply)
+		total += n
+		if errors.Is(err, ErrCorrupted) {
+			corrupted = append(corrupted, fmt.Errorf("WAL segment %d: %w, %d records replayed", segment, err, n))
+			continue
+		}
+		if err != nil {
+			return total, fmt.Errorf("replaying WAL segment %d failed: %w", segment, err)
+		}
+	}
+	return total, errors.Join(corrupted...)
+}
+
+// Sync сбрасывает на диск все добавленные записи.
+func (l *Log) Sync() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return ErrClosed
+	}
+	if l.err != nil {
+		return l.err
+	}
+	return l.sync()
+}
+
+// Err возвращает ошибку записи, после которой журнал перестал принимать записи, или ErrClosed для закрытого журнала.
+func (l *Log) Err() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return ErrClosed
+	}
+	return l.err
+}
+
+// Close сбрасывает записи на диск и закрывает журнал. Повторный вызов ничего не делает.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return nil
+	}
+	l.closed = true
+	close(l.done)
+	var err error
+	if l.err == nil {
+		err = l.sync()
+	}
+	err = errors.Join(err, l.file.Close())
+	l.mu.Unlock()
+	l.wg.Wait()
+	return err
+}
+
+// syncLoop периодически сбрасывает записи на диск для политик SyncBatch и SyncInterval.
+func (l *Log) syncLoop() {
+	defer l.wg.Done()
+	ticker := time.NewTicker(l.options.SyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.done:
+			return
+		case <-ticker.C:
+			l.mu.Lock()
+			if !l.closed && l.err == nil && l.unsynced > 0 {
+				_ = l.sync()
+			}
+			l.mu.Unlock()
+		}
+	}
+}
+
+// sync вызывает fsync текущего сегмента; вызывается под блокировкой.
+func (l *Log) sync() error {
+	if err := l.file.Sync(); err != nil {
+		l.err = fmt.Errorf("syncing WAL segment failed: %w", err)
+		return l.err
+	}
+	l.unsynced = 0
+	return nil
+}
+
+// rotate закрывает текущий сегмент и открывает следующий; вызывается под блокировкой.
+func (l *Log) rotate() error {
+	if err := l.sync(); err != nil {
+		return err
+	}
+	if err := l.file.Close(); err != nil {
+		return fmt.Errorf("closing WAL segment failed: %w", err)
+	}
+	l.segment++
+	return l.openSegment()
+}
+
+// openSegment создает сегмент с текущим номером.
+func (l *Log) openSegment() error {
+	file, err := os.OpenFile(segmentPath(l.dir, l.segment), os.O_CREATE|os.O_EXCL|os.O_WRONLY|os.O_APPEND, segmentPerm)
+	if err != nil {
+		return fmt.Errorf("creating WAL segment failed: %w", err)
+	}
+	if err := syncDir(l.dir); err != nil {
+		file.Close()
+		return err
+	}
+	l.file = file
+	l.size = 0
+	return nil
+}
+
+// repairSegment обрезает сегмент по последней целой записи.
+func repairSegment(path string) error {
+	_, valid, err := readSegment(path, nil)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, ErrCorrupted) {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY, segmentPerm)
+	if err != nil {
+		return fmt.Errorf("opening WAL segment failed: %w", err)
+	}
+	defer file.Close()
+	if err := file.Truncate(valid); err != nil {
+		return fmt.Errorf("truncating WAL segment failed: %w", err)
+	}
+	return file.Sync()
+}
+
+// readSegment читает записи сегмента и возвращает их количество и смещение конца последней целой записи.
+func readSegment(path string, apply func(storage.JournalRecord) error) (int, int64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, 0, fmt.Errorf("reading WAL segment failed: %w", err)
+	}
+	var n int
+	var offset int64
+	for rest := data; len(rest) > 0; {
+		payload, err := readFrame(rest)
+		if err != nil {
+			return n, offset, fmt.Errorf("%w: offset %d: %s", ErrCorrupted, offset, err)
+		}
+		record, err := decodeRecord(payload)
+		if err != nil {
+			return n, offset, fmt.Errorf("%w: offset %d: %s", ErrCorrupted, offset, err)
+		}
+		if apply != nil {
+			if err := apply(record); err != nil {
+				return n, offset, err
+			}
+		}
+		n++
+		offset += int64(headerSize + len(payload))
+		rest = rest[headerSize+len(payload):]
+	}
+	return n, offset, nil
+}
+
+// readFrame проверяет заголовок записи и возвращает ее содержимое.
+func readFrame(data []byte) ([]byte, error) {
+	if len(data) < headerSize {
+		return nil, io.ErrUnexpectedEOF
+	}
+	length := int(byteOrder.Uint32(data))
+	if length == 0 || length > maxRecordSize {
+		return nil, fmt.Errorf("invalid record length %d", length)
+	}
+	if len(data)-headerSize < length {
+		return nil, io.ErrUnexpectedEOF
+	}
+	payload := data[headerSize : headerSize+length]
+	if crc32.Checksum(payload, crcTable) != byteOrder.Uint32(data[4:]) {
+		return nil, errors.New("checksum mismatch")
+	}
+	return payload, nil
+}
+
+// putHeader записывает в заголовок длину и контрольную сумму содержимого записи.
+func putHeader(header []byte, payload []byte) {
+	byteOrder.PutUint32(header, uint32(len(payload)))
+	byteOrder.PutUint32(header[4:], crc32.Checksum(payload, crcTable))
+}
+
+// listSegments возвращает номера сегментов каталога по возрастанию.
+func listSegments(dir string) ([]uint64, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("reading WAL directory failed: %w", err)
+	}
+	var segments []uint64
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), segmentExt)
+		if !ok || entry.IsDir() {
+			continue
+		}
+		segment, err := strconv.ParseUint(name, 10, 64)
+		if err != nil {
+			continue
+		}
+		segments = append(segments, segment)
+	}
+	sort.Slice(segments, func(i, j int) bool { return segments[i] < segments[j] })
+	return segments, nil
+}
+
+func segmentPath(dir string, segment uint64) string {
+	return filepath.Join(dir, fmt.Sprintf("%0*d%s", segmentNameLen, segment, segmentExt))
+}
+
+// syncDir сбрасывает на диск изменения списка файлов каталога.
+func syncDir(dir string) error {
+	file, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("opening WAL directory failed: %w", err)
+	}
+	defer file.Close()
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("syncing WAL directory failed: %w", err)
+	}
+	return nil
+}
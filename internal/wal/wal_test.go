@@ -0,0 +1,133 @@
+package wal
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/justEngineer/go-metrics-service/internal/distribution"
+	"github.com/justEngineer/go-metrics-service/internal/storage"
+)
+
+func replayAll(t *testing.T, log *Log, from uint64) []storage.JournalRecord {
+	var records []storage.JournalRecord
+	n, err := log.Replay(from, func(record storage.JournalRecord) error {
+		records = append(records, record)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Len(t, records, n)
+	return records
+}
+
+func TestAppendReplay(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Unix(1700000000, 123)
+	histogram := distribution.NewHistogram([]float64{1, 10})
+	histogram.Observe(5)
+	records := []storage.JournalRecord{
+		{Op: storage.OpSetGauge, Key: "temp{host=a}", Gauge: math.NaN(), Time: now},
+		{Op: storage.OpAddCounter, Key: "requests", Counter: -7, Time: now},
+		{Op: storage.OpMergeHistogram, Key: "latency", Histogram: histogram, Time: now},
+		{Op: storage.OpDelete, Type: "gauge", Key: "old"},
+	}
+
+	for _, policy := range []SyncPolicy{SyncAlways, SyncBatch, SyncInterval} {
+		log, err := Open(filepath.Join(dir, string(policy)), Options{Sync: policy})
+		require.NoError(t, err)
+		require.NoError(t, log.Append(records[:2]...))
+		require.NoError(t, log.Append(records[2:]...))
+		require.NoError(t, log.Close())
+		assert.ErrorIs(t, log.Append(records...), ErrClosed)
+
+		log, err = Open(filepath.Join(dir, string(policy)), Options{Sync: policy})
+		require.NoError(t, err)
+		replayed := replayAll(t, log, 0)
+		require.Len(t, replayed, len(records), string(policy))
+		assert.True(t, math.IsNaN(replayed[0].Gauge))
+		assert.True(t, now.Equal(replayed[0].Time))
+		assert.Equal(t, records[1], storage.JournalRecord{Op: replayed[1].Op, Key: replayed[1].Key, Counter: replayed[1].Counter, Time: now})
+		assert.Equal(t, histogram, replayed[2].Histogram)
+		assert.Equal(t, records[3], replayed[3])
+		require.NoError(t, log.Close())
+	}
+
+	_, err := Open(dir, Options{Sync: "never"})
+	assert.Error(t, err)
+	policy, err := ParseSyncPolicy("batch")
+	require.NoError(t, err)
+	assert.Equal(t, SyncBatch, policy, "batch is an alias of batched")
+}
+
+func TestTornTail(t *testing.T) {
+	dir := t.TempDir()
+	log, err := Open(dir, Options{Sync: SyncAlways})
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, log.Append(storage.JournalRecord{Op: storage.OpAddCounter, Key: "requests", Counter: 1}))
+	}
+	segment := log.Segment()
+	require.NoError(t, log.Close())
+
+	// обрыв последней записи при сбое
+	path := segmentPath(dir, segment)
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.NoError(t, os.Truncate(path, info.Size()-3))
+
+	log, err = Open(dir, Options{Sync: SyncAlways})
+	require.NoError(t, err)
+	assert.Equal(t, segment+1, log.Segment(), "new records go to a new segment")
+	require.NoError(t, log.Append(storage.JournalRecord{Op: storage.OpAddCounter, Key: "requests", Counter: 10}))
+	records := replayAll(t, log, 0)
+	require.Len(t, records, 3)
+	assert.Equal(t, int64(10), records[2].Counter)
+	require.NoError(t, log.Close())
+
+	// повреждение записи в середине журнала не скрывается, но следующие сегменты воспроизводятся
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	data[headerSize] ^= 0xff
+	require.NoError(t, os.WriteFile(path, data, 0644))
+	log, err = Open(dir, Options{Sync: SyncAlways})
+	require.NoError(t, err)
+	defer log.Close()
+	var counters []int64
+	n, err := log.Replay(0, func(record storage.JournalRecord) error {
+		counters = append(counters, record.Counter)
+		return nil
+	})
+	assert.ErrorIs(t, err, ErrCorrupted)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, []int64{10}, counters)
+}
+
+func TestRotateTruncate(t *testing.T) {
+	dir := t.TempDir()
+	log, err := Open(dir, Options{Sync: SyncBatch, SegmentSize: 64, FirstSegment: 5})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(5), log.Segment())
+	for i := 0; i < 10; i++ {
+		require.NoError(t, log.Append(storage.JournalRecord{Op: storage.OpSetGauge, Key: "temperature", Gauge: float64(i)}))
+	}
+	assert.Greater(t, log.Segment(), uint64(5), "segments are rotated by size")
+
+	checkpoint, err := log.Rotate()
+	require.NoError(t, err)
+	require.NoError(t, log.Append(storage.JournalRecord{Op: storage.OpSetGauge, Key: "temperature", Gauge: 10}))
+	assert.Len(t, replayAll(t, log, 0), 11)
+
+	require.NoError(t, log.Truncate(checkpoint))
+	segments, err := listSegments(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{checkpoint}, segments)
+	records := replayAll(t, log, checkpoint)
+	require.Len(t, records, 1)
+	assert.Equal(t, 10.0, records[0].Gauge)
+	require.NoError(t, log.Close())
+}
@@ -0,0 +1,32 @@
+package metricsclient_test
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/justEngineer/go-metrics-service/pkg/metricsclient"
+)
+
+func Example() {
+	client, err := metricsclient.New("localhost:8080",
+		metricsclient.WithKey("secret"),
+		metricsclient.WithLabels(map[string]string{"job": "import"}),
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+	processed := client.Counter("ImportedRows", nil)
+	duration := client.Histogram("ImportSeconds", []float64{1, 10, 60}, nil)
+
+	start := time.Now()
+	processed.Add(1000)
+	duration.Observe(time.Since(start).Seconds())
+
+	// Короткоживущая задача отправляет метрики синхронно перед завершением.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Flush(ctx); err != nil {
+		log.Print(err)
+	}
+}
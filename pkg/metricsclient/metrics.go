@@ -0,0 +1,104 @@
+package metricsclient
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+
+	"github.com/justEngineer/go-metrics-service/internal/distribution"
+	"github.com/justEngineer/go-metrics-service/internal/models"
+)
+
+// Counter счетчик. Сервер суммирует приращения, поэтому при каждой отправке передается
+// приращение с предыдущей успешной отправки.
+type Counter struct {
+	name   string
+	labels map[string]string
+	delta  atomic.Int64
+}
+
+// Add увеличивает счетчик на delta.
+func (c *Counter) Add(delta int64) {
+	c.delta.Add(delta)
+}
+
+// Inc увеличивает счетчик на единицу.
+func (c *Counter) Inc() {
+	c.delta.Add(1)
+}
+
+// take забирает накопленное приращение.
+func (c *Counter) take() (models.Metrics, bool) {
+	delta := c.delta.Swap(0)
+	if delta == 0 {
+		return models.Metrics{}, false
+	}
+	return models.Metrics{ID: c.name, MType: models.Counter, Delta: &delta, Labels: c.labels}, true
+}
+
+// Gauge метрика с текущим значением. Отправляется последнее установленное значение.
+type Gauge struct {
+	name   string
+	labels map[string]string
+	bits   atomic.Uint64
+	set    atomic.Bool
+}
+
+// Set устанавливает значение.
+func (g *Gauge) Set(value float64) {
+	g.bits.Store(math.Float64bits(value))
+	g.set.Store(true)
+}
+
+// Add изменяет значение на delta.
+func (g *Gauge) Add(delta float64) {
+	for {
+		old := g.bits.Load()
+		if g.bits.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+delta)) {
+			g.set.Store(true)
+			return
+		}
+	}
+}
+
+// Value возвращает текущее значение.
+func (g *Gauge) Value() float64 {
+	return math.Float64frombits(g.bits.Load())
+}
+
+// take возвращает текущее значение, если оно было установлено.
+func (g *Gauge) take() (models.Metrics, bool) {
+	if !g.set.Load() {
+		return models.Metrics{}, false
+	}
+	value := g.Value()
+	return models.Metrics{ID: g.name, MType: models.Gauge, Value: &value, Labels: g.labels}, true
+}
+
+// Histogram гистограмма с заданными границами корзин. При каждой отправке передаются
+// значения, добавленные с предыдущей успешной отправки, сервер добавляет их к сохраненным.
+type Histogram struct {
+	name    string
+	labels  map[string]string
+	mu      sync.Mutex
+	current *distribution.Histogram
+}
+
+// Observe добавляет значение в гистограмму.
+func (h *Histogram) Observe(value float64) {
+	h.mu.Lock()
+	h.current.Observe(value)
+	h.mu.Unlock()
+}
+
+// take забирает значения, добавленные с предыдущего вызова.
+func (h *Histogram) take() (models.Metrics, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.current.Count == 0 {
+		return models.Metrics{}, false
+	}
+	taken := h.current
+	h.current = distribution.NewHistogram(taken.Bounds)
+	return models.Metrics{ID: h.name, MType: models.Histogram, Histogram: taken, Labels: h.labels}, true
+}
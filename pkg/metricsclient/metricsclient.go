@@ -0,0 +1,319 @@
+// Package metricsclient предоставляет библиотеку для отправки метрик приложения на сервер метрик.
+//
+// Приложение создает Client, получает из него типизированные метрики Counter, Gauge и Histogram
+// и изменяет их значения. Client периодически отправляет накопленные значения пакетом на /updates/
+// с теми же сжатием, подписью HMAC и шифрованием RSA, что и агент. Для короткоживущих задач
+// отправку можно выполнить синхронно методом Flush.
+package metricsclient
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/justEngineer/go-metrics-service/internal/dedup"
+	"github.com/justEngineer/go-metrics-service/internal/distribution"
+	"github.com/justEngineer/go-metrics-service/internal/models"
+	"github.com/justEngineer/go-metrics-service/internal/security"
+	"github.com/justEngineer/go-metrics-service/internal/storage"
+)
+
+// DefaultInterval интервал фоновой отправки по умолчанию.
+const DefaultInterval = 10 * time.Second
+
+// ErrRejected возвращается, если сервер отклонил пакет; такой пакет не отправляется повторно.
+var ErrRejected = errors.New("server rejected metrics")
+
+// Option настраивает Client.
+type Option func(*Client)
+
+// WithInterval задает интервал фоновой отправки метрик методом Run.
+func WithInterval(interval time.Duration) Option {
+	return func(c *Client) { c.interval = interval }
+}
+
+// WithKey включает подпись пакетов HMAC-SHA256 ключом key, как флаг -k агента.
+func WithKey(key string) Option {
+	return func(c *Client) { c.key = key }
+}
+
+// WithPublicKey включает шифрование пакетов открытым ключом сервера, как флаг -crypto-key агента.
+func WithPublicKey(key *rsa.PublicKey) Option {
+	return func(c *Client) { c.publicKey = key }
+}
+
+// WithLabels задает метки, которые добавляются ко всем метрикам клиента.
+func WithLabels(labels map[string]string) Option {
+	return func(c *Client) { c.labels = labels }
+}
+
+// WithHTTPClient задает HTTP клиент для отправки пакетов.
+func WithHTTPClient(client *http.Client) Option {
+	return func(c *Client) { c.httpClient = client }
+}
+
+// WithErrorHandler задает обработчик ошибок фоновой отправки. По умолчанию ошибки игнорируются.
+func WithErrorHandler(handler func(error)) Option {
+	return func(c *Client) { c.onError = handler }
+}
+
+// pendingBatch пакет, который не удалось отправить; он отправляется повторно с тем же номером.
+type pendingBatch struct {
+	seq     uint64
+	metrics []models.Metrics
+}
+
+// Client реестр метрик приложения, отправляющий их значения на сервер.
+type Client struct {
+	url        string
+	interval   time.Duration
+	key        string
+	publicKey  *rsa.PublicKey
+	labels     map[string]string
+	httpClient *http.Client
+	onError    func(error)
+	instanceID string
+
+	mu         sync.Mutex
+	counters   map[string]*Counter
+	gauges     map[string]*Gauge
+	histograms map[string]*Histogram
+
+	sendMu  sync.Mutex
+	seq     uint64
+	pending *pendingBatch
+}
+
+// New создает клиент сервера метрик с адресом address, например localhost:8080 или https://metrics.example.com.
+func New(address string, opts ...Option) (*Client, error) {
+	if !strings.Contains(address, "://") {
+		address = "http://" + address
+	}
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	c := &Client{
+		url:        strings.TrimSuffix(address, "/") + "/updates/",
+		interval:   DefaultInterval,
+		httpClient: http.DefaultClient,
+		onError:    func(error) {},
+		instanceID: hex.EncodeToString(id),
+		counters:   make(map[string]*Counter),
+		gauges:     make(map[string]*Gauge),
+		histograms: make(map[string]*Histogram),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if err := storage.ValidateLabels(c.labels); err != nil {
+		return nil, err
+	}
+	if c.interval <= 0 {
+		return nil, fmt.Errorf("push interval must be positive, got %s", c.interval)
+	}
+	if c.publicKey != nil {
+		transport := c.httpClient.Transport
+		if transport == nil {
+			transport = http.DefaultTransport
+		}
+		client := *c.httpClient
+		client.Transport = security.EncryptionMiddleware{Proxied: transport, PublicKey: c.publicKey}
+		c.httpClient = &client
+	}
+	return c, nil
+}
+
+// Counter возвращает счетчик с именем name и метками labels, создавая его при первом обращении.
+// Некорректные имена меток приводят к панике.
+func (c *Client) Counter(name string, labels map[string]string) *Counter {
+	key := c.seriesKey(name, labels)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	counter, ok := c.counters[key]
+	if !ok {
+		counter = &Counter{name: name, labels: c.mergeLabels(labels)}
+		c.counters[key] = counter
+	}
+	return counter
+}
+
+// Gauge возвращает метрику gauge с именем name и метками labels, создавая ее при первом обращении.
+// Некорректные имена меток приводят к панике.
+func (c *Client) Gauge(name string, labels map[string]string) *Gauge {
+	key := c.seriesKey(name, labels)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	gauge, ok := c.gauges[key]
+	if !ok {
+		gauge = &Gauge{name: name, labels: c.mergeLabels(labels)}
+		c.gauges[key] = gauge
+	}
+	return gauge
+}
+
+// Histogram возвращает гистограмму с именем name, верхними границами корзин bounds и метками labels,
+// создавая ее при первом обращении; для существующей гистограммы bounds не учитываются.
+// Некорректные имена меток или границы корзин приводят к панике.
+func (c *Client) Histogram(name string, bounds []float64, labels map[string]string) *Histogram {
+	key := c.seriesKey(name, labels)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	histogram, ok := c.histograms[key]
+	if !ok {
+		current := distribution.NewHistogram(bounds)
+		if err := current.Validate(); err != nil {
+			panic(fmt.Sprintf("metricsclient: histogram %s: %s", name, err))
+		}
+		histogram = &Histogram{name: name, labels: c.mergeLabels(labels), current: current}
+		c.histograms[key] = histogram
+	}
+	return histogram
+}
+
+// Run отправляет метрики с интервалом, заданным WithInterval, до отмены контекста,
+// после чего выполняет последнюю отправку. Ошибки передаются обработчику WithErrorHandler.
+func (c *Client) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			flushCtx, cancel := context.WithTimeout(context.Background(), c.interval)
+			if err := c.Flush(flushCtx); err != nil {
+				c.onError(err)
+			}
+			cancel()
+			return
+		case <-ticker.C:
+			if err := c.Flush(ctx); err != nil {
+				c.onError(err)
+			}
+		}
+	}
+}
+
+// Flush синхронно отправляет значения, накопленные с предыдущей отправки.
+// Если сервер недоступен, пакет сохраняется и отправляется повторно при следующем вызове,
+// а новые значения продолжают накапливаться. Пакет, отклоненный сервером, отбрасывается с ошибкой ErrRejected.
+func (c *Client) Flush(ctx context.Context) error {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+	if c.pending == nil {
+		metrics := c.collect()
+		if len(metrics) == 0 {
+			return nil
+		}
+		c.seq++
+		c.pending = &pendingBatch{seq: c.seq, metrics: metrics}
+	}
+	err := c.send(ctx, c.pending)
+	if err == nil || errors.Is(err, ErrRejected) {
+		c.pending = nil
+	}
+	return err
+}
+
+// collect забирает накопленные значения всех метрик.
+func (c *Client) collect() []models.Metrics {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var metrics []models.Metrics
+	for _, counter := range c.counters {
+		if metric, ok := counter.take(); ok {
+			metrics = append(metrics, metric)
+		}
+	}
+	for _, gauge := range c.gauges {
+		if metric, ok := gauge.take(); ok {
+			metrics = append(metrics, metric)
+		}
+	}
+	for _, histogram := range c.histograms {
+		if metric, ok := histogram.take(); ok {
+			metrics = append(metrics, metric)
+		}
+	}
+	return metrics
+}
+
+// send сжимает, подписывает и отправляет пакет так же, как агент.
+func (c *Client) send(ctx context.Context, batch *pendingBatch) error {
+	body, err := json.Marshal(batch.metrics)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	gzipWriter := gzip.NewWriter(&buf)
+	if _, err = gzipWriter.Write(body); err != nil {
+		return err
+	}
+	if err = gzipWriter.Close(); err != nil {
+		return err
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Content-Encoding", "gzip")
+	dedup.SetHeader(request.Header, c.instanceID, batch.seq)
+	if c.key != "" {
+		sign, err := security.AddSign(security.SignedData(request.Header, buf.Bytes()), c.key)
+		if err != nil {
+			return fmt.Errorf("error while adding SHA256 sign: %w", err)
+		}
+		request.Header.Set(security.HashHeader, hex.EncodeToString(sign))
+	}
+	response, err := c.httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	switch {
+	case response.StatusCode >= http.StatusInternalServerError:
+		return fmt.Errorf("server failed to store metrics with status %d", response.StatusCode)
+	case response.StatusCode == http.StatusConflict:
+		// пакет еще применяется по предыдущей попытке отправки, его нужно повторить позже
+		return fmt.Errorf("batch is being applied by server, status %d", response.StatusCode)
+	case response.StatusCode >= http.StatusBadRequest:
+		return fmt.Errorf("%w with status %d", ErrRejected, response.StatusCode)
+	}
+	return nil
+}
+
+// seriesKey проверяет имя и метки метрики и возвращает ключ ряда.
+func (c *Client) seriesKey(name string, labels map[string]string) string {
+	if name == "" {
+		panic("metricsclient: metric name is empty")
+	}
+	if err := storage.ValidateLabels(labels); err != nil {
+		panic(fmt.Sprintf("metricsclient: metric %s: %s", name, err))
+	}
+	return storage.SeriesKey(name, labels)
+}
+
+// mergeLabels объединяет метки клиента с метками метрики; метки метрики имеют приоритет.
+func (c *Client) mergeLabels(labels map[string]string) map[string]string {
+	if len(c.labels) == 0 && len(labels) == 0 {
+		return nil
+	}
+	merged := make(map[string]string, len(c.labels)+len(labels))
+	for name, value := range c.labels {
+		merged[name] = value
+	}
+	for name, value := range labels {
+		merged[name] = value
+	}
+	return merged
+}
@@ -0,0 +1,157 @@
+package metricsclient
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/justEngineer/go-metrics-service/internal/http/server/config"
+	server "github.com/justEngineer/go-metrics-service/internal/http/server/handlers"
+	"github.com/justEngineer/go-metrics-service/internal/http/server/routing"
+	"github.com/justEngineer/go-metrics-service/internal/logger"
+	"github.com/justEngineer/go-metrics-service/internal/security"
+	"github.com/justEngineer/go-metrics-service/internal/storage"
+)
+
+// newServer запускает сервер метрик с настоящей маршрутизацией и middleware.
+func newServer(t *testing.T, key string, keyring *security.Keyring) (*storage.MemStorage, *httptest.Server) {
+	appLogger, err := logger.New("error")
+	require.NoError(t, err)
+	serverStorage := storage.New()
+	serverConfig := &config.ServerConfig{SHA256Key: key}
+	router := chi.NewRouter()
+	routing.SetMiddlewares(router, appLogger, &serverConfig.SHA256Key, false, keyring, false)
+	routing.SetRequestRouting(router, server.New(serverStorage, serverConfig, appLogger))
+	ts := httptest.NewServer(router)
+	t.Cleanup(ts.Close)
+	return serverStorage, ts
+}
+
+func TestFlush(t *testing.T) {
+	serverStorage, ts := newServer(t, "secret", nil)
+	client, err := New(ts.URL, WithKey("secret"), WithLabels(map[string]string{"job": "import"}))
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	requests := client.Counter("Requests", map[string]string{"route": "/api"})
+	requests.Add(3)
+	client.Counter("Requests", map[string]string{"route": "/api"}).Inc()
+	client.Gauge("QueueSize", nil).Set(7)
+	latency := client.Histogram("Latency", []float64{0.1, 1}, nil)
+	latency.Observe(0.05)
+	latency.Observe(0.5)
+	require.NoError(t, client.Flush(ctx))
+
+	counterKey := storage.SeriesKey("Requests", map[string]string{"job": "import", "route": "/api"})
+	gaugeKey := storage.SeriesKey("QueueSize", map[string]string{"job": "import"})
+	histogramKey := storage.SeriesKey("Latency", map[string]string{"job": "import"})
+	counter, err := storage.GetCounter(ctx, serverStorage, counterKey)
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), counter)
+	gauge, err := storage.GetGauge(ctx, serverStorage, gaugeKey)
+	require.NoError(t, err)
+	assert.Equal(t, 7.0, gauge)
+	histogram, err := storage.GetHistogram(ctx, serverStorage, histogramKey)
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{1, 1, 0}, histogram.Counts)
+
+	// Повторная отправка передает только приращения с предыдущей.
+	requests.Inc()
+	latency.Observe(5)
+	require.NoError(t, client.Flush(ctx))
+	counter, err = storage.GetCounter(ctx, serverStorage, counterKey)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), counter)
+	histogram, err = storage.GetHistogram(ctx, serverStorage, histogramKey)
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{1, 1, 1}, histogram.Counts)
+}
+
+func TestFlushRetry(t *testing.T) {
+	serverStorage, ts := newServer(t, "", nil)
+	var fail atomic.Bool
+	fail.Store(true)
+	var applied atomic.Int32
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail.Load() {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		applied.Add(1)
+		request, err := http.NewRequestWithContext(r.Context(), r.Method, ts.URL+r.URL.Path, r.Body)
+		require.NoError(t, err)
+		request.Header = r.Header
+		response, err := ts.Client().Do(request)
+		require.NoError(t, err)
+		response.Body.Close()
+		w.WriteHeader(response.StatusCode)
+	}))
+	defer proxy.Close()
+
+	client, err := New(proxy.URL)
+	require.NoError(t, err)
+	ctx := context.Background()
+	client.Counter("Jobs", nil).Add(2)
+	require.Error(t, client.Flush(ctx))
+
+	// Неотправленный пакет отправляется повторно, новые значения ждут следующей отправки.
+	fail.Store(false)
+	client.Counter("Jobs", nil).Add(5)
+	require.NoError(t, client.Flush(ctx))
+	counter, err := storage.GetCounter(ctx, serverStorage, "Jobs")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), counter)
+	require.NoError(t, client.Flush(ctx))
+	counter, err = storage.GetCounter(ctx, serverStorage, "Jobs")
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), counter)
+	assert.Equal(t, int32(2), applied.Load())
+
+	// Пустой реестр ничего не отправляет.
+	require.NoError(t, client.Flush(ctx))
+	assert.Equal(t, int32(2), applied.Load())
+}
+
+func TestFlushRejected(t *testing.T) {
+	_, ts := newServer(t, "secret", nil)
+	client, err := New(ts.URL, WithKey("other"))
+	require.NoError(t, err)
+	client.Gauge("QueueSize", nil).Set(1)
+	err = client.Flush(context.Background())
+	assert.True(t, errors.Is(err, ErrRejected))
+	assert.Nil(t, client.pending)
+}
+
+func TestFlushEncrypted(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	keyring, err := security.NewKeyring(key)
+	require.NoError(t, err)
+	serverStorage, ts := newServer(t, "", keyring)
+
+	client, err := New(ts.URL, WithPublicKey(&key.PublicKey))
+	require.NoError(t, err)
+	client.Gauge("QueueSize", nil).Add(2.5)
+	require.NoError(t, client.Flush(context.Background()))
+	gauge, err := storage.GetGauge(context.Background(), serverStorage, "QueueSize")
+	require.NoError(t, err)
+	assert.Equal(t, 2.5, gauge)
+}
+
+func TestInvalidLabels(t *testing.T) {
+	client, err := New("localhost:8080")
+	require.NoError(t, err)
+	assert.Panics(t, func() { client.Counter("Requests", map[string]string{"bad label": "x"}) })
+	assert.Panics(t, func() { client.Histogram("Latency", []float64{1, 0.5}, nil) })
+	_, err = New("localhost:8080", WithLabels(map[string]string{"bad label": "x"}))
+	assert.Error(t, err)
+}